@@ -0,0 +1,295 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/geofence/internal/configuration"
+	"github.com/geofence/internal/db"
+	"github.com/geofence/internal/exporter"
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/migrate"
+	"github.com/geofence/internal/repository"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const usage = `usage:
+  geofence                          run the server
+  geofence migrate up               apply every pending migration
+  geofence migrate down [steps]     revert the latest migration, or the latest steps migrations
+  geofence migrate status           list migrations and when they were applied
+  geofence import <file.csv> [-dry-run]
+                                    upsert store locations from a CSV, reporting rejected rows
+  geofence import-fences [-key column] [-property name] [-format format] [-repair]
+                         [-apply -changed-by name [-reason text]] <file>
+                                    set location polygons from GeoJSON, KML or a zipped Shapefile,
+                                    showing the changes and only writing them with -apply
+  geofence export-fences [-format format] [-filter json] [-o file]
+                                    write location polygons as GeoJSON, KML, CSV with WKT or a zipped
+                                    Shapefile, filtered as /poly/find filters them, to stdout or a file`
+
+// Runs the subcommand named by args, failing with the usage for one it does not know so a typo never starts the server.
+func runCommand(appConfig *configuration.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(appConfig, args[1:])
+	case "import":
+		return runImport(appConfig, args[1:])
+	case "import-fences":
+		return runImportFences(appConfig, args[1:])
+	case "export-fences":
+		return runExportFences(appConfig, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	}
+	return errors.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+// Helper function to open the database for a subcommand, logging to stderr.
+func openDB(appConfig *configuration.Config) (*sqlx.DB, error) {
+	logger := log.Logger{}
+	logger.SetOutput(os.Stderr)
+	return db.NewDB(appConfig.DBURL, logger)
+}
+
+// Helper function to open the locations STORAGE selects for a subcommand, with a function to close them.
+// Files must not be imported into while a server is running on them, as its next write would undo the import.
+func openLocations(appConfig *configuration.Config) (repository.PolygonRepository, func(), error) {
+	if appConfig.Storage == configuration.FileStorage {
+		locations, err := repository.NewPolygonFileRepository(appConfig.DataDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return locations, func() {}, nil
+	}
+	database, err := openDB(appConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repository.NewPolygonRepository(*database), func() { database.Close() }, nil
+}
+
+func runMigrate(appConfig *configuration.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	if appConfig.Storage != configuration.PostgresStorage {
+		return errors.Errorf("migrations only apply to STORAGE=%s", configuration.PostgresStorage)
+	}
+	database, err := openDB(appConfig)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	migrator, err := migrate.NewMigrator(database)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New("steps must be a positive number")
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return nil
+	}
+	return errors.New(usage)
+}
+
+func runImport(appConfig *configuration.Config, args []string) error {
+	var fileName string
+	dryRun := false
+	for _, arg := range args {
+		switch {
+		case arg == "-dry-run" || arg == "--dry-run":
+			dryRun = true
+		case fileName == "" && !strings.HasPrefix(arg, "-"):
+			fileName = arg
+		default:
+			return errors.New(usage)
+		}
+	}
+	if fileName == "" {
+		return errors.New(usage)
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	store, closeStore, err := openLocations(appConfig)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	locations := importer.NewImporter(store, appConfig.ImportBatchSize)
+
+	report, err := locations.Import(file, dryRun)
+	for _, rowError := range report.Errors {
+		column := ""
+		if rowError.Column != "" {
+			column = " " + rowError.Column + ":"
+		}
+		fmt.Fprintf(os.Stderr, "line %d (id %s):%s %s\n", rowError.Line, rowError.ID, column, rowError.Reason)
+	}
+	verb := "imported"
+	if dryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%d rows read, %s %d, rejected %d\n", report.Rows, verb, report.Imported, report.Rejected)
+	return err
+}
+
+func runImportFences(appConfig *configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("import-fences", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	key := flags.String("key", "id", "")
+	property := flags.String("property", "", "")
+	format := flags.String("format", "", "")
+	repair := flags.Bool("repair", false, "")
+	apply := flags.Bool("apply", false, "")
+	changedBy := flags.String("changed-by", "", "")
+	reason := flags.String("reason", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errors.New(usage)
+	}
+	if *apply && *changedBy == "" {
+		return errors.New("-apply requires -changed-by")
+	}
+	fileName := flags.Arg(0)
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = importer.FormatOfFile(fileName)
+	}
+
+	store, closeStore, err := openLocations(appConfig)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	report, err := importer.NewFenceImporter(store).Import(data, *format, importer.FenceOptions{
+		Key:      *key,
+		Property: *property,
+		Repair:   *repair,
+		DryRun:   !*apply,
+		Change:   repository.PolygonChange{ChangedBy: *changedBy, Reason: *reason},
+	})
+	if err != nil {
+		return err
+	}
+	for _, fence := range report.Fences {
+		name := ""
+		if fence.Name != "" {
+			name = fmt.Sprintf(" %q", fence.Name)
+		}
+		if fence.Change == importer.FenceRejected {
+			fmt.Fprintf(os.Stderr, "feature %d%s: %s\n", fence.Feature, name, fence.Reason)
+			continue
+		}
+		fmt.Printf("feature %d%s: location %d %s\n", fence.Feature, name, fence.LocationID, fence.Change)
+	}
+	fmt.Printf("%d features: %d created, %d updated, %d unchanged, %d rejected\n",
+		report.Features, report.Created, report.Updated, report.Unchanged, report.Rejected)
+	switch {
+	case report.Applied:
+		fmt.Println("applied")
+	case report.DryRun:
+		fmt.Println("dry run; nothing was written")
+	case report.Rejected > 0:
+		return errors.New("nothing was written as features were rejected")
+	}
+	return nil
+}
+
+func runExportFences(appConfig *configuration.Config, args []string) error {
+	flags := flag.NewFlagSet("export-fences", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	formatName := flags.String("format", "", "")
+	filter := flags.String("filter", "{}", "")
+	output := flags.String("o", "", "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errors.New(usage)
+	}
+	if *formatName == "" {
+		*formatName = exporter.FormatOfFile(*output)
+	}
+	format, err := exporter.FormatNamed(*formatName)
+	if err != nil {
+		return err
+	}
+	params, err := repository.ParseLocationFilter([]byte(*filter))
+	if err != nil {
+		return err
+	}
+
+	store, closeStore, err := openLocations(appConfig)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	locations, err := store.FindLocations(params)
+	if err != nil {
+		return err
+	}
+	fences, err := exporter.Fences(locations)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return format.Write(os.Stdout, fences)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := format.Write(file, fences); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d fences written to %s\n", len(fences), *output)
+	return nil
+}
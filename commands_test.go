@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/geofence/internal/configuration"
+)
+
+func TestRunCommandRejectsUnknownCommands(t *testing.T) {
+	for _, args := range [][]string{{"migarte", "up"}, {"serve"}, {"-port", "8080"}} {
+		err := runCommand(&configuration.Config{}, args)
+		if err == nil || !strings.Contains(err.Error(), "unknown command") || !strings.Contains(err.Error(), "usage:") {
+			t.Errorf("runCommand(%q) = %v, want an unknown command error with the usage", args, err)
+		}
+	}
+}
@@ -5,16 +5,29 @@ import (
 	"github.com/geofence/internal/configuration"
 	"github.com/pkg/errors"
 	"log"
+	"os"
+	// Store hours are checked in each store's time zone, which must load where the system has no zoneinfo.
+	_ "time/tzdata"
 )
 
 func main() {
 	appConfig := configuration.Load()
+	if len(os.Args) > 1 {
+		if err := runCommand(appConfig, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	app, err := application.NewApplication(appConfig)
 	if wErr := errors.Wrapf(err, "failed setting up application"); wErr != nil {
 		log.Panic(wErr)
 	}
-	defer app.DB.Close()
-
-	app.Run()
+	err = app.Run()
+	if closeErr := app.Close(); closeErr != nil {
+		log.Println("failed closing application", closeErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
\ No newline at end of file
@@ -1,49 +1,232 @@
 package application
 
 import (
+	"github.com/geofence/internal/batch"
 	"github.com/geofence/internal/configuration"
 	"github.com/geofence/internal/controller"
 	"github.com/geofence/internal/db"
+	"github.com/geofence/internal/events"
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/migrate"
+	"github.com/geofence/internal/repository"
 	r "github.com/geofence/internal/router"
+	"github.com/geofence/internal/scoring"
+	"github.com/geofence/internal/tracking"
+	"github.com/geofence/internal/webhook"
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"gopkg.in/go-playground/validator.v9"
+	"context"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// How long Start waits for requests in progress to finish once the process is told to stop.
+const shutdownTimeout = 20 * time.Second
+
 type App struct {
 	Port string
+	// DB is nil when data is kept in files.
 	DB *sqlx.DB
 	Router r.WithCORS
+	dispatcher *webhook.Dispatcher
+	live *events.Broker
+	closer io.Closer
+}
+
+// The repositories the application keeps its data in, and what to close when it stops.
+type storage struct {
+	db *sqlx.DB
+	polygons repository.PolygonRepository
+	events repository.EventRepository
+	webhooks repository.WebhookRepository
+	closer io.Closer
 }
 
 func NewApplication(appConfig *configuration.Config) (*App, error) {
 	logger := log.Logger{}
 	logger.SetOutput(os.Stdout)
-	db, err := db.NewDB(appConfig.DBURL, logger)
+	stores, err := openStorage(appConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	polygons := stores.polygons
+	fences := index.NewFenceIndex(polygons, logger)
+	err = fences.Load()
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating postgres client")
+		return nil, errors.Wrap(err, "error loading fence index")
+	}
+	logger.Printf("Loaded %d fences into index, skipping %d", fences.Len(), fences.Skipped())
+	if appConfig.IndexRefreshInterval > 0 {
+		go refreshFences(fences, appConfig.IndexRefreshInterval, logger)
 	}
 
-	polyController := controller.NewPolyController(validator.New(), logger, db)
-	circleController := controller.NewCircleController(validator.New(), logger)
+	bus := events.NewBus()
+	webhooks := stores.webhooks
+	dispatcher := webhook.NewDispatcher(webhooks, &http.Client{Timeout: 10 * time.Second}, webhook.Options{
+		MaxAttempts:    appConfig.WebhookMaxAttempts,
+		InitialBackoff: appConfig.WebhookBackoff,
+		MaxBackoff:     appConfig.WebhookMaxBackoff,
+		QueueSize:      appConfig.WebhookQueueSize,
+		Workers:        appConfig.WebhookWorkers,
+	}, logger)
+	err = dispatcher.Start()
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting webhook dispatcher")
+	}
+	bus.Subscribe(dispatcher.Publish)
+
+	batchPool := batch.NewPool(batch.Options{MaxSize: appConfig.MaxBatchSize, Workers: appConfig.BatchWorkers})
+	scorer, err := scoring.NewScorer(appConfig.ClosestTieBreak)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading CLOSEST_TIE_BREAK")
+	}
+	polyController := controller.NewPolyController(validator.New(), logger, polygons, fences, batchPool, bus, scorer)
+	circleController := controller.NewCircleController(validator.New(), logger, batchPool)
+
+	eventRepository := stores.events
+	tracker := tracking.NewTracker(fences, eventRepository, bus, appConfig.DwellDuration)
+	go expireDevices(tracker, appConfig.DeviceExpiry, logger)
+	live := events.NewBroker(bus, appConfig.LiveBufferSize)
+	trackingController := controller.NewTrackingController(validator.New(), logger, tracker, eventRepository, live)
+	webhookController := controller.NewWebhookController(validator.New(), logger, webhooks, dispatcher)
+	locationController := controller.NewLocationController(validator.New(), logger, polygons, importer.NewImporter(polygons, appConfig.ImportBatchSize), fences)
+
 	router := r.WithCORS{mux.NewRouter()}
-	router = r.InitRoutes(router, polyController, circleController, appConfig, logger)
+	router = r.InitRoutes(router, polyController, circleController, trackingController, webhookController, locationController, appConfig, logger)
 	return &App{
 		Port: appConfig.Port,
-		DB: db,
+		DB: stores.db,
 		Router: router,
+		dispatcher: dispatcher,
+		live: live,
+		closer: stores.closer,
 	}, nil
 }
 
+// Opens the storage STORAGE selects. Postgres is migrated first if AUTO_MIGRATE is set.
+func openStorage(appConfig *configuration.Config, logger log.Logger) (*storage, error) {
+	switch appConfig.Storage {
+	case configuration.PostgresStorage:
+		db, err := db.NewDB(appConfig.DBURL, logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating postgres client")
+		}
+		if appConfig.AutoMigrate {
+			err = migrateUp(db, logger)
+			if err != nil {
+				return nil, errors.Wrap(err, "error migrating database")
+			}
+		}
+		return &storage{
+			db: db,
+			polygons: repository.NewPolygonRepository(*db),
+			events: repository.NewEventRepository(*db),
+			webhooks: repository.NewWebhookRepository(*db),
+			closer: db,
+		}, nil
+	case configuration.FileStorage:
+		polygons, err := repository.NewPolygonFileRepository(appConfig.DataDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening location files")
+		}
+		events, err := repository.NewEventFileRepository(appConfig.DataDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening event file")
+		}
+		webhooks, err := repository.NewWebhookFileRepository(appConfig.DataDir)
+		if err != nil {
+			events.Close()
+			return nil, errors.Wrap(err, "error opening webhook file")
+		}
+		logger.Printf("Keeping data in files in %s", appConfig.DataDir)
+		return &storage{
+			polygons: polygons,
+			events: events,
+			webhooks: webhooks,
+			closer: events,
+		}, nil
+	}
+	return nil, errors.Errorf("unknown STORAGE %q, expected %q or %q", appConfig.Storage, configuration.PostgresStorage, configuration.FileStorage)
+}
+
+// Applies any pending schema migrations.
+func migrateUp(db *sqlx.DB, logger log.Logger) error {
+	migrator, err := migrate.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		logger.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+	return err
+}
 
-func (a *App) Run() {
-	a.Start()
+// Periodically reloads the fence index so writes made by other instances become visible.
+func refreshFences(fences *index.FenceIndex, interval time.Duration, logger log.Logger) {
+	for range time.Tick(interval) {
+		if err := fences.Load(); err != nil {
+			logger.Println("Failed to reload fence index", err)
+		}
+	}
 }
 
-func (a *App) Start() {
-	http.ListenAndServe(a.Port, a.Router)
+// Periodically forgets devices that have not pinged within the expiry.
+func expireDevices(tracker *tracking.Tracker, expiry time.Duration, logger log.Logger) {
+	for now := range time.Tick(expiry / 4) {
+		if expired := tracker.Expire(now.Add(-expiry)); expired > 0 {
+			logger.Printf("Expired %d idle devices", expired)
+		}
+	}
+}
+
+// Close stops the webhook dispatcher, recording deliveries it could not make as dead letters, then releases the
+// database connection or the files the data is kept in.
+func (a *App) Close() error {
+	a.dispatcher.Stop()
+	return a.closer.Close()
+}
+
+func (a *App) Run() error {
+	return a.Start()
+}
+
+// Start serves until the process is interrupted or terminated, then waits up to shutdownTimeout for requests in
+// progress so nothing is published after Close. Returns an error if the server could not start or stopped for any
+// other reason, such as the port already being in use.
+func (a *App) Start() error {
+	server := &http.Server{Addr: a.Port, Handler: a.Router}
+	// Shutdown waits for every request to finish, which live feeds never do on their own.
+	server.RegisterOnShutdown(a.live.Close)
+	stopping := make(chan os.Signal, 1)
+	signal.Notify(stopping, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stopping)
+	failed := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-stopping:
+		case <-failed:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		close(failed)
+		return errors.Wrapf(err, "failed serving on %s", a.Port)
+	}
+	<-stopped
+	return nil
 }
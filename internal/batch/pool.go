@@ -0,0 +1,56 @@
+package batch
+
+import (
+	"sync"
+)
+
+// A generous upper bound on the JSON size of one point, such as [-122.419415872311, 37.774929012345],
+// with its separator and whitespace.
+const bytesPerPoint = 128
+
+// Room in a batch request body for everything besides the points, such as a geometry to evaluate them against.
+const bytesOverhead = 1 << 20
+
+// Options bounds the size of a batch request and the concurrency used to evaluate it.
+type Options struct {
+	MaxSize int
+	Workers int
+}
+
+// MaxBytes is the largest request body a batch of MaxSize points needs, or 0 when the size is unbounded.
+func (o Options) MaxBytes() int64 {
+	if o.MaxSize <= 0 {
+		return 0
+	}
+	return int64(o.MaxSize)*bytesPerPoint + bytesOverhead
+}
+
+// Pool evaluates batches with at most Workers calls running at once between every batch it runs, so concurrent
+// requests share the limit rather than each starting Workers goroutines.
+type Pool struct {
+	Options
+	slots chan struct{}
+}
+
+func NewPool(options Options) *Pool {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	return &Pool{Options: options, slots: make(chan struct{}, options.Workers)}
+}
+
+// Run calls fn once for every index in [0, n), waiting for a free worker before each call, and returns when every
+// call has finished. Each call should only write to the slot of its own index so results keep the order of the input.
+func (p *Pool) Run(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		p.slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-p.slots }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,62 @@
+package batch
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolRunsEveryIndex(t *testing.T) {
+	pool := NewPool(Options{Workers: 3})
+	results := make([]int, 50)
+	pool.Run(len(results), func(i int) {
+		results[i] = i * i
+	})
+	for i, result := range results {
+		if result != i*i {
+			t.Fatalf("results[%d] = %d, want %d", i, result, i*i)
+		}
+	}
+	pool.Run(0, func(i int) {
+		t.Errorf("fn called with %d for an empty batch", i)
+	})
+}
+
+func TestPoolSharesWorkersBetweenRuns(t *testing.T) {
+	const workers = 2
+	pool := NewPool(Options{Workers: workers})
+	var running, most int32
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Run(10, func(int) {
+				now := atomic.AddInt32(&running, 1)
+				for {
+					seen := atomic.LoadInt32(&most)
+					if now <= seen || atomic.CompareAndSwapInt32(&most, seen, now) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			})
+		}()
+	}
+	wg.Wait()
+	if most > workers {
+		t.Errorf("%d calls ran at once between concurrent batches, want at most %d", most, workers)
+	}
+}
+
+func TestOptionsMaxBytes(t *testing.T) {
+	if limit := (Options{}).MaxBytes(); limit != 0 {
+		t.Errorf("unbounded MaxBytes = %d, want 0", limit)
+	}
+	small, large := Options{MaxSize: 10}.MaxBytes(), Options{MaxSize: 10000}.MaxBytes()
+	if small <= 0 || large <= small {
+		t.Errorf("MaxBytes = %d for 10 points and %d for 10000", small, large)
+	}
+}
@@ -2,19 +2,64 @@ package configuration
 
 import (
 	"os"
+	"runtime"
+	"strconv"
+	"time"
 )
 
 const AppName = "geofence"
 
+// The storage backends STORAGE selects. FileStorage keeps everything in DATA_DIR, for a single instance
+// running without Postgres.
+const (
+	PostgresStorage = "postgres"
+	FileStorage = "file"
+)
+
 type Config struct {
 	DBURL string
 	Port string
+	IndexRefreshInterval time.Duration
+	MaxBatchSize int
+	BatchWorkers int
+	DwellDuration time.Duration
+	DeviceExpiry time.Duration
+	WebhookMaxAttempts int
+	WebhookBackoff time.Duration
+	WebhookMaxBackoff time.Duration
+	WebhookQueueSize int
+	WebhookWorkers int
+	LiveBufferSize int
+	AutoMigrate bool
+	ImportBatchSize int
+	Storage string
+	DataDir string
+	ClosestTieBreak string
 }
 
 func Load() *Config {
 	dbURL := loadPSQLConfig()
 	port := loadHTTPConfig()
-	return &Config{dbURL, port}
+	return &Config{
+		DBURL: dbURL,
+		Port: port,
+		IndexRefreshInterval: loadIndexConfig(),
+		MaxBatchSize: loadIntConfig("MAX_BATCH_SIZE", 10000),
+		BatchWorkers: loadIntConfig("BATCH_WORKERS", runtime.NumCPU()),
+		DwellDuration: time.Duration(loadIntConfig("DWELL_SECONDS", 300)) * time.Second,
+		DeviceExpiry: time.Duration(loadIntConfig("DEVICE_EXPIRY_SECONDS", 86400)) * time.Second,
+		WebhookMaxAttempts: loadIntConfig("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookBackoff: time.Duration(loadIntConfig("WEBHOOK_BACKOFF_MS", 500)) * time.Millisecond,
+		WebhookMaxBackoff: time.Duration(loadIntConfig("WEBHOOK_MAX_BACKOFF_SECONDS", 300)) * time.Second,
+		WebhookQueueSize: loadIntConfig("WEBHOOK_QUEUE_SIZE", 1000),
+		WebhookWorkers: loadIntConfig("WEBHOOK_WORKERS", 4),
+		LiveBufferSize: loadIntConfig("LIVE_BUFFER_SIZE", 256),
+		AutoMigrate: loadBoolConfig("AUTO_MIGRATE"),
+		ImportBatchSize: loadIntConfig("IMPORT_BATCH_SIZE", 500),
+		Storage: loadStringConfig("STORAGE", PostgresStorage),
+		DataDir: loadStringConfig("DATA_DIR", "data"),
+		ClosestTieBreak: loadStringConfig("CLOSEST_TIE_BREAK", "nearest"),
+	}
 }
 
 func loadPSQLConfig() string {
@@ -34,3 +79,37 @@ func loadHTTPConfig() string {
 	}
 	return port
 }
+
+// How often the fence index is fully reloaded, to pick up writes made by other instances.
+// Zero disables periodic reloads; writes through this instance always refresh the index.
+func loadIndexConfig() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("INDEX_REFRESH_SECONDS"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Reads a positive integer from the environment, falling back to the default when unset or invalid.
+func loadIntConfig(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// Reads a string from the environment, falling back to the default when unset.
+func loadStringConfig(name string, defaultValue string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Reads a boolean from the environment, treating unset or invalid values as false.
+func loadBoolConfig(name string) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && value
+}
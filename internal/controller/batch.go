@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/geofence/internal/batch"
+	"github.com/geofence/internal/helpers"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+// The result for one point of a batch evaluated against a single fence.
+type BatchPositionResult struct {
+	Point    model.Coordinate `json:"point"`
+	Position string           `json:"position,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// The result for one point of a batch evaluated against every stored fence.
+type BatchFencesResult struct {
+	Point  model.Coordinate `json:"point"`
+	Fences []int            `json:"fences"`
+	Error  string           `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results interface{} `json:"results"`
+}
+
+// Helper function to read the body of a batch request, refusing one larger than a batch of the maximum size needs
+// before reading it all. Writes a 413 or a 500 and returns false if the body cannot be read.
+func readBatchBody(c *helpers.ResponseWritingController, w http.ResponseWriter, r *http.Request, options batch.Options) ([]byte, bool) {
+	defer r.Body.Close()
+	if maxBytes := options.MaxBytes(); maxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = fmt.Errorf("request body exceeds %d bytes, the most a batch of %d points needs", tooLarge.Limit, options.MaxSize)
+		c.Logger.Println("Batch too large", err)
+		c.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Batch Too Large", err)
+		return nil, false
+	}
+	if err != nil {
+		c.Logger.Println("Unprocessable request body", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+		return nil, false
+	}
+	return body, true
+}
+
+// Helper function to reject batches larger than the configured maximum.
+func checkBatchSize(size, maxSize int) error {
+	if maxSize > 0 && size > maxSize {
+		return fmt.Errorf("batch of %d points exceeds the maximum of %d", size, maxSize)
+	}
+	return nil
+}
+
+// BatchMembership evaluates many points in one request, either against the supplied geom or, when geom is omitted,
+// against every stored fence matching the filter. Results are returned in the order of the input points.
+func (c *PolyController) BatchMembership() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingBatchRequest struct {
+		index.Filter
+		Geom      *model.PolyGeometry `json:"geom" validate:"omitempty"`
+		Points    []model.Coordinate  `json:"points" validate:"required,min=1"`
+		Tolerance *float64            `json:"tolerance" validate:"omitempty,gte=0"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBatchBody(c.ResponseWritingController, w, r, c.Batch.Options)
+		if !ok {
+			return
+		}
+
+		var params IncomingBatchRequest
+		err := json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingBatchRequest", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			return
+		}
+
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		err = checkBatchSize(len(params.Points), c.Batch.MaxSize)
+		if err != nil {
+			c.Logger.Println("Batch too large", err)
+			c.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Batch Too Large", err)
+			return
+		}
+
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+
+		var results interface{}
+		if params.Geom != nil {
+			geom := params.Geom.WithAxisOrder(order)
+			err = validateCoordinates(geom)
+			if err != nil {
+				c.Logger.Println("Invalid coordinates", err)
+				c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+				return
+			}
+			locator := logic.NewLocator(logic.DefaultTolerance)
+			if params.Tolerance != nil {
+				locator = logic.NewLocator(*params.Tolerance)
+			}
+
+			positions := make([]BatchPositionResult, len(params.Points))
+			c.Batch.Run(len(params.Points), func(i int) {
+				positions[i].Point = params.Points[i]
+				point := order.Convert(params.Points[i])
+				if err := point.Validate(); err != nil {
+					positions[i].Error = err.Error()
+					return
+				}
+				positions[i].Position = locator.LocateGeometry(point, geom).String()
+			})
+			results = positions
+		} else {
+			fences := make([]BatchFencesResult, len(params.Points))
+			c.Batch.Run(len(params.Points), func(i int) {
+				fences[i].Point = params.Points[i]
+				fences[i].Fences = []int{}
+				point := order.Convert(params.Points[i])
+				if err := point.Validate(); err != nil {
+					fences[i].Error = err.Error()
+					return
+				}
+				for _, fence := range c.containing(point, params.Filter) {
+					fences[i].Fences = append(fences[i].Fences, fence.Location.ID)
+				}
+			})
+			results = fences
+		}
+
+		responseBody, err := json.Marshal(BatchResponse{results})
+		if err != nil {
+			c.Logger.Println("BatchResponse Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// BatchMembership evaluates many points against a single RadialFence, returning results in the order of the input points.
+func (c *CircleController) BatchMembership() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingCircleBatch struct {
+		Fence  *logic.RadialFence `json:"fence" validate:"required"`
+		Points []model.Coordinate `json:"points" validate:"required,min=1"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBatchBody(c.ResponseWritingController, w, r, c.Batch.Options)
+		if !ok {
+			return
+		}
+
+		var params IncomingCircleBatch
+		err := json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingCircleBatch", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			return
+		}
+
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		err = checkBatchSize(len(params.Points), c.Batch.MaxSize)
+		if err != nil {
+			c.Logger.Println("Batch too large", err)
+			c.WriteErrorResponse(w, http.StatusRequestEntityTooLarge, "Batch Too Large", err)
+			return
+		}
+
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		fence := logic.RadialFence{Center: order.Convert(params.Fence.Center), Radius: params.Fence.Radius}
+		err = validateCoordinates(fence.Center)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
+
+		positions := make([]BatchPositionResult, len(params.Points))
+		c.Batch.Run(len(params.Points), func(i int) {
+			positions[i].Point = params.Points[i]
+			point := order.Convert(params.Points[i])
+			if err := point.Validate(); err != nil {
+				positions[i].Error = err.Error()
+				return
+			}
+			if logic.InRadius(point, fence) {
+				positions[i].Position = "Inside"
+			} else {
+				positions[i].Position = "Outside"
+			}
+		})
+
+		responseBody, err := json.Marshal(BatchResponse{positions})
+		if err != nil {
+			c.Logger.Println("BatchResponse Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
@@ -0,0 +1,87 @@
+package controller_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type batchResult struct {
+	Point    []float64
+	Position string
+	Fences   []int
+	Error    string
+}
+
+// Points inside the square polygon, outside it, out of range and inside it again, so results can be matched to input.
+const batchPoints = `[[-122.42, 37.76], [-122.40, 37.76], [200, 37.76], [-122.425, 37.755]]`
+
+func TestPolyBatchMembership(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	var response struct{ Results []batchResult }
+	send(t, server, "POST", "/poly/batch", `{"geom": `+squarePolygon+`, "points": `+batchPoints+`}`, http.StatusOK, &response)
+	want := []string{"Inside", "Outside", "", "Inside"}
+	if len(response.Results) != len(want) {
+		t.Fatalf("results = %+v, want %d", response.Results, len(want))
+	}
+	for i, result := range response.Results {
+		if result.Position != want[i] {
+			t.Errorf("result %d position = %q, want %q", i, result.Position, want[i])
+		}
+	}
+	if fmt.Sprint(response.Results[1].Point) != "[-122.4 37.76]" {
+		t.Errorf("result 1 point = %v", response.Results[1].Point)
+	}
+	if response.Results[2].Error == "" || response.Results[0].Error != "" {
+		t.Errorf("errors = %q, %q; want only the out of range point to fail", response.Results[0].Error, response.Results[2].Error)
+	}
+
+	// Without a geom every stored fence is checked.
+	send(t, server, "POST", "/poly/batch", `{"points": `+batchPoints+`}`, http.StatusOK, &response)
+	for i, wantFences := range []string{"[1]", "[]", "[]", "[1]"} {
+		if fmt.Sprint(response.Results[i].Fences) != wantFences {
+			t.Errorf("result %d fences = %v, want %s", i, response.Results[i].Fences, wantFences)
+		}
+	}
+	if response.Results[2].Error == "" {
+		t.Error("out of range point has no error")
+	}
+}
+
+func TestCircleBatchMembership(t *testing.T) {
+	server := newTestServer(t)
+
+	var response struct{ Results []batchResult }
+	body := `{"fence": {"center": [-122.42, 37.76], "radius": 1}, "points": ` + batchPoints + `}`
+	send(t, server, "POST", "/circle/batch", body, http.StatusOK, &response)
+	want := []string{"Inside", "Outside", "", "Inside"}
+	if len(response.Results) != len(want) {
+		t.Fatalf("results = %+v, want %d", response.Results, len(want))
+	}
+	for i, result := range response.Results {
+		if result.Position != want[i] {
+			t.Errorf("result %d position = %q, want %q", i, result.Position, want[i])
+		}
+	}
+	if response.Results[2].Error == "" {
+		t.Error("out of range point has no error")
+	}
+}
+
+func TestBatchTooLarge(t *testing.T) {
+	server := newTestServer(t)
+
+	// The test server allows 100 points.
+	points := strings.TrimSuffix(strings.Repeat("[-122.42, 37.76], ", 101), ", ")
+	send(t, server, "POST", "/poly/batch", `{"geom": `+squarePolygon+`, "points": [`+points+`]}`, http.StatusRequestEntityTooLarge, nil)
+	send(t, server, "POST", "/circle/batch", `{"fence": {"center": [-122.42, 37.76], "radius": 1}, "points": [`+points+`]}`, http.StatusRequestEntityTooLarge, nil)
+
+	// A body far larger than 100 points need is refused before it is parsed.
+	padding := strings.Repeat(" ", 2<<20)
+	send(t, server, "POST", "/poly/batch", `{"points": [[-122.42, 37.76]]`+padding+`}`, http.StatusRequestEntityTooLarge, nil)
+	send(t, server, "POST", "/circle/batch", `{"fence": {"center": [-122.42, 37.76], "radius": 1}, "points": [[-122.42, 37.76]]`+padding+`}`, http.StatusRequestEntityTooLarge, nil)
+}
@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"github.com/geofence/internal/batch"
 	helpers2 "github.com/geofence/internal/helpers"
 	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
 	"github.com/pquerna/ffjson/ffjson"
 	"gopkg.in/go-playground/validator.v9"
 	"io/ioutil"
@@ -13,26 +15,28 @@ import (
 type CircleController struct {
 	*helpers2.ResponseWritingController
 	Validator *validator.Validate
+	Batch *batch.Pool
 }
 
-func NewCircleController(validator *validator.Validate, log log.Logger) *CircleController {
+func NewCircleController(validator *validator.Validate, log log.Logger, batchPool *batch.Pool) *CircleController {
 	return &CircleController{
 		ResponseWritingController: &helpers2.ResponseWritingController{
 			Logger: log,
 		},
 		Validator: validator,
+		Batch: batchPool,
 	}
 }
 
 func (c *CircleController) DetermineMembership() func(w http.ResponseWriter, r *http.Request) {
 	type IncomingCircleMessage struct {
 		Fence *logic.RadialFence `json:"fence" validate:"required"`
-		Point *[2]float64  `json:"point" validate:"required"`
+		Point *model.Coordinate  `json:"point" validate:"required"`
 	}
 
 	type CircleResponse struct {
 		Fence    *logic.RadialFence `json:"fence"`
-		Point    *[2]float64  `json:"point"`
+		Point    *model.Coordinate  `json:"point"`
 		Position string             `json:"position"`
 	}
 
@@ -60,17 +64,29 @@ func (c *CircleController) DetermineMembership() func(w http.ResponseWriter, r *
 			return
 		}
 
-		point := params.Point
-		fence := params.Fence
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(*params.Point)
+		fence := logic.RadialFence{Center: order.Convert(params.Fence.Center), Radius: params.Fence.Radius}
+		err = validateCoordinates(point, fence.Center)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
 
-		result := logic.InRadius(*point, *fence)
+		result := logic.InRadius(point, fence)
 		var position string
 		if result {
 			position = "Inside"
 		} else {
 			position = "Outside"
 		}
-		responseBodyInfo := CircleResponse{fence, point, position}
+		responseBodyInfo := CircleResponse{params.Fence, params.Point, position}
 		responseBody, err := ffjson.Marshal(responseBodyInfo)
 		if err != nil {
 			c.Logger.Println("CircleResponse Marshal Failed", err)
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/geofence/internal/scoring"
+)
+
+// The most candidates /poly/closest considers among the locations near the point.
+const maxClosestCandidates = 20
+
+// A candidate of /poly/closest, ranked by score, with what its score is made of.
+type ClosestCandidate struct {
+	Rank           int                       `json:"rank"`
+	Location       repository.LocationFields `json:"location"`
+	Inside         bool                      `json:"inside"`
+	DistanceMeters float64                   `json:"distance_meters"`
+	OverlapCount   int                       `json:"overlap_count"`
+	Priority       int                       `json:"priority"`
+	Score          scoring.Score             `json:"score"`
+}
+
+// The decision of /poly/closest and every candidate it was chosen from. Basis is one of the scoring bases, and
+// Contenders counts the candidates a tie-break chose between.
+type ClosestResponse struct {
+	Decision   ClosestCandidate   `json:"decision"`
+	Basis      string             `json:"basis"`
+	Strategy   string             `json:"strategy"`
+	Contenders int                `json:"contenders,omitempty"`
+	Candidates []ClosestCandidate `json:"candidates"`
+}
+
+// Helper function to find the candidates for a point: the active locations nearest it within maxMeters, and those
+// whose fence contains it however far away they are, with their store's priority. Overlaps counts the candidates
+// whose fence contains the point.
+func (c *PolyController) closestCandidates(point model.Coordinate, storeID int, maxMeters float64) ([]scoring.Candidate, error) {
+	nearest, err := c.Repository.FindNearest(repository.NearestQuery{
+		Point:     point,
+		K:         maxClosestCandidates,
+		MaxMeters: maxMeters,
+		StoreID:   storeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]scoring.Candidate, 0, len(nearest))
+	found := map[int]bool{}
+	for _, location := range nearest {
+		candidates = append(candidates, scoring.Candidate{Location: location.Location, Meters: location.Meters, Inside: location.Inside})
+		found[location.Location.ID] = true
+	}
+
+	active := true
+	for _, fence := range c.Fences.Containing(point, index.Filter{StoreID: int64(storeID), Active: &active}) {
+		if found[fence.Location.ID] {
+			continue
+		}
+		location, ok, err := c.Repository.GetLocation(fence.Location.ID, false)
+		if err != nil {
+			return nil, err
+		}
+		if ok && location.Active.Bool {
+			meters := logic.Distance(point, model.NewCoordinate(location.Longitude.Float64, location.Latitude.Float64))
+			candidates = append(candidates, scoring.Candidate{Location: location, Meters: meters, Inside: true})
+		}
+	}
+
+	priorities, err := c.Repository.ListStorePriorities()
+	if err != nil {
+		return nil, err
+	}
+	byStore := map[int64]int{}
+	for _, priority := range priorities {
+		byStore[priority.StoreID] = priority.Priority
+	}
+	overlaps := 0
+	for _, candidate := range candidates {
+		if candidate.Inside {
+			overlaps++
+		}
+	}
+	for i := range candidates {
+		candidates[i].Priority = byStore[candidates[i].Location.StoreID.Int64]
+		if candidates[i].Inside {
+			candidates[i].Overlaps = overlaps
+		}
+	}
+	return candidates, nil
+}
@@ -0,0 +1,58 @@
+package controller_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFindMostProbableStore(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro", "store_id": 8, "longitude": -122.425, "latitude": 37.76, "active": true}`, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+	send(t, server, "PUT", "/polygons/2", `{"polygon": `+widerPolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	type candidate struct {
+		Location       struct{ ID int }
+		Inside         bool
+		DistanceMeters float64 `json:"distance_meters"`
+		OverlapCount   int     `json:"overlap_count"`
+		Priority       int
+		Score          struct{ Total float64 }
+	}
+	var response struct {
+		Decision   candidate
+		Basis      string
+		Strategy   string
+		Candidates []candidate
+	}
+	point := `"point": {"type": "Point", "coordinates": [-122.421, 37.76]}`
+	send(t, server, "POST", "/poly/closest", `{`+point+`}`, http.StatusOK, &response)
+	if response.Decision.Location.ID != 1 || response.Basis != "tie_break" || response.Strategy != "nearest" || len(response.Candidates) != 2 {
+		t.Errorf("nearest decision = %+v", response)
+	}
+	if c := response.Candidates[0]; c.OverlapCount != 2 || !c.Inside || c.Score.Total <= response.Candidates[1].Score.Total {
+		t.Errorf("candidates = %+v", response.Candidates)
+	}
+
+	send(t, server, "PUT", "/stores/8/priority", `{"priority": 10}`, http.StatusOK, nil)
+	send(t, server, "POST", "/poly/closest", `{`+point+`, "tie_break": "priority"}`, http.StatusOK, &response)
+	if response.Decision.Location.ID != 2 || response.Decision.Priority != 10 {
+		t.Errorf("priority decision = %+v", response.Decision)
+	}
+	var priorities []struct {
+		StoreID  int64 `json:"store_id"`
+		Priority int
+	}
+	send(t, server, "GET", "/stores/priorities", "", http.StatusOK, &priorities)
+	if len(priorities) != 1 || priorities[0].StoreID != 8 || priorities[0].Priority != 10 {
+		t.Errorf("priorities = %+v", priorities)
+	}
+
+	send(t, server, "POST", "/poly/closest", `{`+point+`, "store_id": 7}`, http.StatusOK, &response)
+	if response.Decision.Location.ID != 1 || response.Basis != "only_candidate" {
+		t.Errorf("store 7 decision = %+v", response)
+	}
+	send(t, server, "POST", "/poly/closest", `{`+point+`, "tie_break": "coin"}`, http.StatusUnprocessableEntity, nil)
+	send(t, server, "POST", "/poly/closest", `{"point": {"type": "Point", "coordinates": [-100, 40]}}`, http.StatusNotFound, nil)
+}
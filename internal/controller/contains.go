@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/geofence/internal/helpers"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+)
+
+type IncomingContainsRequest struct {
+	index.Filter
+	Point *model.PointGeometry `json:"point" validate:"required"`
+}
+
+// Finds every stored fence matching the filter that contains the point. The point must already be in model.LonLat.
+// This is the membership logic shared by every "which fences contain this point" endpoint.
+func (c *PolyController) containing(point model.Coordinate, filter index.Filter) []index.Fence {
+	return c.Fences.Containing(point, filter)
+}
+
+// Helper function to publish a MATCH event for every fence found to contain the point.
+func (c *PolyController) publishMatches(point model.Coordinate, fences []index.Fence) {
+	matches := make([]model.FenceEvent, 0, len(fences))
+	now := time.Now().UTC()
+	for _, fence := range fences {
+		matches = append(matches, model.FenceEvent{
+			EventType:  model.MatchEvent,
+			LocationID: fence.Location.ID,
+			StoreID:    fence.Location.StoreID,
+			MetroID:    fence.Location.MetroID,
+			ZoneID:     fence.Location.ZoneID,
+			Longitude:  point.Lon(),
+			Latitude:   point.Lat(),
+			OccurredAt: now,
+		})
+	}
+	c.Bus.Publish(matches...)
+}
+
+// Helper function to convert fences into a GeoJSON FeatureCollection of polygon features.
+func fencesToFeatureCollection(fences []index.Fence) interface{} {
+	features := make([]interface{}, 0, len(fences))
+	for _, fence := range fences {
+		features = append(features, helpers.AsGeoJSONFenceFeature(fence.Location, fence.Geometry))
+	}
+	return helpers.AsGeoJSONFeatureCollection(features)
+}
+
+// ContainedBy returns every stored location whose polygon contains the given point as a GeoJSON FeatureCollection,
+// publishing a MATCH event for each.
+func (c *PolyController) ContainedBy() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.Logger.Println("Unprocessable request body", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+			return
+		}
+
+		var params IncomingContainsRequest
+		err = json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingContainsRequest", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			return
+		}
+
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(params.Point.Coordinates)
+		err = validateCoordinates(point)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
+
+		fences := c.containing(point, params.Filter)
+		c.publishMatches(point, fences)
+		responseBody, err := json.Marshal(fencesToFeatureCollection(fences))
+		if err != nil {
+			c.Logger.Println("FeatureCollection Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// The longest NDJSON line accepted by StreamContainedBy, and how often it flushes results: after every
+// streamFlushLines results, and whenever results have waited streamFlushInterval, so a caller that stops sending
+// still sees every result for what it has sent.
+const (
+	maxStreamLineBytes  = 1 << 20
+	streamFlushLines    = 256
+	streamFlushInterval = 100 * time.Millisecond
+)
+
+// One result line written by StreamContainedBy. Line is the 1-based input line number
+// and Ref is echoed back unchanged so callers can correlate results.
+type StreamContainsResult struct {
+	Line   int               `json:"line"`
+	Ref    json.RawMessage   `json:"ref,omitempty"`
+	Point  *model.Coordinate `json:"point,omitempty"`
+	Fences []int             `json:"fences"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// StreamContainedBy reads newline-delimited IncomingContainsRequest objects from the request body and writes one
+// NDJSON result per input line while it reads, holding only a single line in memory at a time.
+// Invalid lines produce a result with an error rather than ending the stream. Like ContainedBy, every fence found
+// to contain a point is published as a MATCH event.
+func (c *PolyController) StreamContainedBy() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingStreamLine struct {
+		IncomingContainsRequest
+		Ref json.RawMessage `json:"ref"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+
+		// HTTP/1 handlers otherwise drain the request body before the first response write.
+		err = http.NewResponseController(w).EnableFullDuplex()
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			c.Logger.Println("Could not enable full duplex", err)
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		output := bufio.NewWriter(w)
+		flusher, _ := w.(http.Flusher)
+		// The ticker flushes from its own goroutine, so every use of output holds outputMutex.
+		var outputMutex sync.Mutex
+		pending := 0
+		flush := func() {
+			pending = 0
+			if err := output.Flush(); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		ticker := time.NewTicker(streamFlushInterval)
+		done := make(chan struct{})
+		defer func() {
+			ticker.Stop()
+			close(done)
+			outputMutex.Lock()
+			defer outputMutex.Unlock()
+			flush()
+		}()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					outputMutex.Lock()
+					if pending > 0 {
+						flush()
+					}
+					outputMutex.Unlock()
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 64*1024), maxStreamLineBytes)
+		write := func(result StreamContainsResult) bool {
+			line, err := json.Marshal(result)
+			if err == nil {
+				line = append(line, '\n')
+				outputMutex.Lock()
+				_, err = output.Write(line)
+				pending++
+				if pending >= streamFlushLines {
+					flush()
+				}
+				outputMutex.Unlock()
+			}
+			if err != nil {
+				c.Logger.Println("Failed to write stream result", err)
+				return false
+			}
+			return true
+		}
+
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			result := StreamContainsResult{Line: lineNumber, Fences: []int{}}
+			var params IncomingStreamLine
+			err := json.Unmarshal(line, &params)
+			if err == nil {
+				result.Ref = params.Ref
+				err = c.Validator.Struct(params)
+			}
+			if err == nil {
+				point := order.Convert(params.Point.Coordinates)
+				result.Point = &params.Point.Coordinates
+				err = point.Validate()
+				if err == nil {
+					fences := c.containing(point, params.Filter)
+					c.publishMatches(point, fences)
+					for _, fence := range fences {
+						result.Fences = append(result.Fences, fence.Location.ID)
+					}
+				}
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			if !write(result) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			c.Logger.Println("Failed to read stream", err)
+			write(StreamContainsResult{Line: lineNumber + 1, Fences: []int{}, Error: err.Error()})
+		}
+	}
+}
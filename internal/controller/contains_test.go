@@ -0,0 +1,165 @@
+package controller_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geofence/internal/model"
+)
+
+// Collects the events published on a bus, safe to read while handlers publish.
+type publishedEvents struct {
+	mutex  sync.Mutex
+	events []model.FenceEvent
+}
+
+func (p *publishedEvents) listen(events ...model.FenceEvent) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.events = append(p.events, events...)
+}
+
+// Returns and forgets the events published so far.
+func (p *publishedEvents) take() []model.FenceEvent {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	taken := p.events
+	p.events = nil
+	return taken
+}
+
+func TestContainedBy(t *testing.T) {
+	server, bus := newTestServerWithBus(t)
+	published := &publishedEvents{}
+	bus.Subscribe(published.listen)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro", "store_id": 8, "longitude": -122.43, "latitude": 37.76}`, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+	send(t, server, "PUT", "/polygons/2", `{"polygon": `+widerPolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	var collection struct {
+		Type     string
+		Features []struct {
+			Properties struct{ ID float64 }
+			Geometry   struct{ Type string }
+		}
+	}
+	inside := `{"point": {"type": "Point", "coordinates": [-122.42, 37.76]}`
+	send(t, server, "POST", "/poly/contains", inside+`}`, http.StatusOK, &collection)
+	var ids []float64
+	for _, feature := range collection.Features {
+		ids = append(ids, feature.Properties.ID)
+		if feature.Geometry.Type != "Polygon" {
+			t.Errorf("feature %v geometry type = %q", feature.Properties.ID, feature.Geometry.Type)
+		}
+	}
+	if collection.Type != "FeatureCollection" || len(ids) != 2 {
+		t.Errorf("collection = %+v, want both locations", collection)
+	}
+	matches := published.take()
+	if len(matches) != 2 || matches[0].EventType != model.MatchEvent || matches[0].Longitude != -122.42 {
+		t.Errorf("published %+v, want a MATCH event per location", matches)
+	}
+
+	send(t, server, "POST", "/poly/contains", inside+`, "store_id": 8}`, http.StatusOK, &collection)
+	if len(collection.Features) != 1 || collection.Features[0].Properties.ID != 2 {
+		t.Errorf("store 8 collection = %+v, want location 2", collection)
+	}
+	if matches := published.take(); len(matches) != 1 || matches[0].LocationID != 2 || matches[0].StoreID != 8 {
+		t.Errorf("published %+v, want a MATCH event for location 2", matches)
+	}
+
+	send(t, server, "POST", "/poly/contains", `{"point": {"type": "Point", "coordinates": [-122.40, 37.76]}}`, http.StatusOK, &collection)
+	if len(collection.Features) != 0 {
+		t.Errorf("outside collection = %+v, want no features", collection)
+	}
+	send(t, server, "POST", "/poly/contains", `{"point": {"type": "Point", "coordinates": [200, 37.76]}}`, http.StatusUnprocessableEntity, nil)
+	send(t, server, "POST", "/poly/contains", `{}`, http.StatusUnprocessableEntity, nil)
+	if matches := published.take(); len(matches) != 0 {
+		t.Errorf("published %+v for points in no fence", matches)
+	}
+
+	// The streaming endpoint publishes the same events.
+	response, err := http.Post(server.URL+"/poly/contains/stream", "application/x-ndjson", strings.NewReader(inside+"}\n"+inside+`, "store_id": 8}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	if matches := published.take(); len(matches) != 3 {
+		t.Errorf("stream published %+v, want 3 MATCH events", matches)
+	}
+}
+
+func TestStreamContainedBy(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	body, upload := io.Pipe()
+	request, err := http.NewRequest("POST", server.URL+"/poly/contains/stream", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		responses <- response
+	}()
+
+	type result struct {
+		Line   int
+		Ref    string
+		Fences []int
+		Error  string
+	}
+	// The first result arrives while the upload is still open.
+	fmt.Fprintln(upload, `{"ref": "a", "point": {"type": "Point", "coordinates": [-122.42, 37.76]}}`)
+	var response *http.Response
+	select {
+	case response = <-responses:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response while the upload was open")
+	}
+	if response == nil {
+		return
+	}
+	defer response.Body.Close()
+	results := bufio.NewScanner(response.Body)
+	var first result
+	if !results.Scan() || json.Unmarshal(results.Bytes(), &first) != nil || first.Ref != "a" || fmt.Sprint(first.Fences) != "[1]" {
+		t.Fatalf("first result = %s", results.Bytes())
+	}
+
+	// Enough lines to flush by count, then a bad line, then the end of the upload.
+	go func() {
+		for i := 0; i < 600; i++ {
+			fmt.Fprintln(upload, `{"point": {"type": "Point", "coordinates": [0, 1]}}`)
+		}
+		fmt.Fprintln(upload, `{"point": `)
+		upload.Close()
+	}()
+	var lines []result
+	for results.Scan() {
+		var line result
+		if err := json.Unmarshal(results.Bytes(), &line); err != nil {
+			t.Fatalf("result %s: %v", results.Bytes(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 601 || lines[0].Line != 2 || len(lines[0].Fences) != 0 || !strings.Contains(lines[600].Error, "unexpected end") {
+		t.Errorf("got %d results, first %+v, last %+v", len(lines), lines[0], lines[len(lines)-1])
+	}
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/geofence/internal/eligibility"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+// How far from the point /stores/eligible looks for stores whose fence does not contain it, so that they can be
+// reported with a reason, unless the request says otherwise.
+const defaultEligibilityMeters = 25000
+
+// A store considered by /stores/eligible. LocalTime is the time the order is for in the store's time zone, and
+// Reasons say why an ineligible store cannot serve it.
+type StoreEligibility struct {
+	ID             int      `json:"id"`
+	Name           string   `json:"name"`
+	StoreID        int64    `json:"store_id"`
+	DistanceMeters float64  `json:"distance_meters"`
+	LocalTime      string   `json:"local_time,omitempty"`
+	Reasons        []string `json:"reasons,omitempty"`
+}
+
+type EligibilityResponse struct {
+	At         time.Time          `json:"at"`
+	Eligible   []StoreEligibility `json:"eligible"`
+	Ineligible []StoreEligibility `json:"ineligible"`
+}
+
+// EligibleStores answers which stores can serve an address at a time for an order with the given requirements.
+// Every store whose fence contains the point is considered, as is every store, deleted or not, within max_meters
+// of it. Each is returned as eligible, or as ineligible with the reasons of eligibility.Decide, nearest first.
+// at defaults to now and store_id restricts the stores to one store's locations.
+func (c *PolyController) EligibleStores() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingEligibilityRequest struct {
+		Point        *model.PointGeometry     `json:"point" validate:"required"`
+		At           *time.Time               `json:"at"`
+		Requirements eligibility.Requirements `json:"requirements"`
+		StoreID      int64                    `json:"store_id" validate:"gte=0"`
+		MaxMeters    float64                  `json:"max_meters" validate:"gte=0,lte=100000"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.Logger.Println("Unprocessable request body", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+			return
+		}
+
+		var params IncomingEligibilityRequest
+		err = json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingEligibilityRequest", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			return
+		}
+
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(params.Point.Coordinates)
+		err = validateCoordinates(point)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
+		at := time.Now()
+		if params.At != nil {
+			at = *params.At
+		}
+		if params.MaxMeters == 0 {
+			params.MaxMeters = defaultEligibilityMeters
+		}
+
+		candidates, err := c.eligibilityCandidates(point, params.MaxMeters, params.StoreID)
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+		response := EligibilityResponse{At: at, Eligible: []StoreEligibility{}, Ineligible: []StoreEligibility{}}
+		for _, candidate := range candidates {
+			location := candidate.location
+			decision := eligibility.Decide(location, candidate.polygon, point, at, params.Requirements)
+			store := StoreEligibility{
+				ID:             location.ID,
+				Name:           location.Name.String,
+				StoreID:        location.StoreID.Int64,
+				DistanceMeters: logic.Distance(point, model.NewCoordinate(location.Longitude.Float64, location.Latitude.Float64)),
+				Reasons:        decision.Reasons,
+			}
+			if !decision.LocalTime.IsZero() {
+				store.LocalTime = decision.LocalTime.Format(time.RFC3339)
+			}
+			if decision.Eligible {
+				response.Eligible = append(response.Eligible, store)
+			} else {
+				response.Ineligible = append(response.Ineligible, store)
+			}
+		}
+		for _, stores := range [][]StoreEligibility{response.Eligible, response.Ineligible} {
+			sort.SliceStable(stores, func(i, j int) bool {
+				return stores[i].DistanceMeters < stores[j].DistanceMeters
+			})
+		}
+
+		responseBody, err := json.Marshal(response)
+		if err != nil {
+			c.Logger.Println("EligibilityResponse Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// A location an eligibility request considers, with its columns as stored so that NULLs can be told from zeros,
+// and its polygon's GeoJSON.
+type eligibilityCandidate struct {
+	location repository.LocationRowNull
+	polygon  string
+}
+
+// Helper function to find the locations an eligibility request considers: those whose fence contains the point
+// and those within meters of it, ordered by ID.
+func (c *PolyController) eligibilityCandidates(point model.Coordinate, meters float64, storeID int64) ([]eligibilityCandidate, error) {
+	filter := repository.LocationFilter{
+		Within:         &repository.SpatialFilter{Point: &point, Meters: meters},
+		IncludeDeleted: true,
+	}
+	if storeID != 0 {
+		value, err := json.Marshal(storeID)
+		if err != nil {
+			return nil, err
+		}
+		filter.Where = &repository.Condition{Field: "store_id", Op: "eq", Value: value}
+	}
+	candidates, err := c.Repository.FindLocations(filter)
+	if err != nil {
+		return nil, err
+	}
+	found := map[int]bool{}
+	for _, location := range candidates {
+		found[location.ID] = true
+	}
+	for _, fence := range c.Fences.Containing(point, index.Filter{StoreID: storeID}) {
+		if !found[fence.Location.ID] {
+			candidates = append(candidates, fence.Location)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID < candidates[j].ID
+	})
+
+	rows := make([]eligibilityCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		location, ok, err := c.Repository.GetLocation(candidate.ID, true)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, eligibilityCandidate{location, candidate.Polygon})
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,46 @@
+package controller_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestEligibleStores(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", `{"name": "Mission", "store_id": 7, "longitude": -122.42, "latitude": 37.76, "state": "CA", "active": true, "opening_hour": 8, "closing_hour": 22, "sells_alcohol": true}`, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro", "store_id": 8, "longitude": -122.435, "latitude": 37.76, "state": "CA", "active": true}`, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	type store struct {
+		ID        int
+		LocalTime string `json:"local_time"`
+		Reasons   []string
+	}
+	var response struct {
+		Eligible, Ineligible []store
+	}
+	request := `{"point": {"type": "Point", "coordinates": [-122.42, 37.76]}, "at": "2026-07-01T19:30:00Z", "requirements": {"alcohol": true}}`
+	send(t, server, "POST", "/stores/eligible", request, http.StatusOK, &response)
+	if len(response.Eligible) != 1 || response.Eligible[0].ID != 1 || response.Eligible[0].LocalTime != "2026-07-01T12:30:00-07:00" {
+		t.Errorf("eligible = %+v", response.Eligible)
+	}
+	if len(response.Ineligible) != 1 || response.Ineligible[0].ID != 2 ||
+		!reflect.DeepEqual(response.Ineligible[0].Reasons, []string{"no_fence", "unknown_hours", "no_alcohol"}) {
+		t.Errorf("ineligible = %+v, want location 2 without a fence, hours or alcohol", response.Ineligible)
+	}
+
+	late := `{"point": {"type": "Point", "coordinates": [-122.42, 37.76]}, "at": "2026-07-02T06:00:00Z", "store_id": 7}`
+	send(t, server, "POST", "/stores/eligible", late, http.StatusOK, &response)
+	if len(response.Eligible) != 0 || len(response.Ineligible) != 1 || response.Ineligible[0].Reasons[0] != "closed" {
+		t.Errorf("at 23:00 = %+v", response)
+	}
+
+	// A store's time_zone column takes precedence over its state.
+	send(t, server, "PATCH", "/locations/1", `{"time_zone": "Mars/Olympus_Mons"}`, http.StatusUnprocessableEntity, nil)
+	send(t, server, "PATCH", "/locations/1", `{"time_zone": "America/Denver"}`, http.StatusOK, nil)
+	send(t, server, "POST", "/stores/eligible", request, http.StatusOK, &response)
+	if len(response.Eligible) != 1 || response.Eligible[0].LocalTime != "2026-07-01T13:30:00-06:00" {
+		t.Errorf("eligible in Denver = %+v", response.Eligible)
+	}
+}
@@ -0,0 +1,48 @@
+package controller_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFindEnclosingPolygon(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", `{"name": "Mission", "store_id": 7, "metro_id": 1, "zone_id": 3, "longitude": -122.42, "latitude": 37.76, "active": true}`, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro", "store_id": 8, "metro_id": 1, "zone_id": 4, "longitude": -122.425, "latitude": 37.76, "active": true}`, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+	send(t, server, "PUT", "/polygons/2", `{"polygon": `+widerPolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	var response struct {
+		Locations []struct {
+			ID      int
+			StoreID int64 `json:"store_id"`
+		}
+	}
+	point := `"point": {"type": "Point", "coordinates": [-122.42, 37.76]}`
+	tests := []struct {
+		body string
+		want []int
+	}{
+		{`{` + point + `}`, []int{1, 2}},
+		{`{` + point + `, "metro_id": 1}`, []int{1, 2}},
+		{`{` + point + `, "zone_id": 4}`, []int{2}},
+		{`{` + point + `, "store_id": 7, "metro_id": 1, "zone_id": 3}`, []int{1}},
+		{`{"point": {"type": "Point", "coordinates": [-122.435, 37.76]}}`, []int{2}},
+	}
+	for _, test := range tests {
+		send(t, server, "POST", "/poly/enclosing", test.body, http.StatusOK, &response)
+		var got []int
+		for _, location := range response.Locations {
+			got = append(got, location.ID)
+		}
+		if len(got) != len(test.want) || got[0] != test.want[0] || got[len(got)-1] != test.want[len(test.want)-1] {
+			t.Errorf("POST /poly/enclosing %s = %v, want %v", test.body, got, test.want)
+		}
+	}
+
+	send(t, server, "POST", "/poly/enclosing", `{`+point+`, "store_id": 9}`, http.StatusNotFound, nil)
+	send(t, server, "POST", "/poly/enclosing", `{"point": {"type": "Point", "coordinates": [-100, 40]}}`, http.StatusNotFound, nil)
+	send(t, server, "POST", "/poly/enclosing", `{`+point+`, "zone_id": -1}`, http.StatusUnprocessableEntity, nil)
+	send(t, server, "DELETE", "/locations/2", "", http.StatusNoContent, nil)
+	send(t, server, "POST", "/poly/enclosing", `{`+point+`, "zone_id": 4}`, http.StatusNotFound, nil)
+}
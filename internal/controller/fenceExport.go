@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/geofence/internal/exporter"
+	"github.com/geofence/internal/repository"
+)
+
+// ExportFences writes the polygons of the locations matching a repository.LocationFilter, as /poly/find takes, in
+// the format the format query parameter names: geojson (the default), kml, csv with WKT polygons, or shapefile,
+// which is zipped. An empty body exports every fence. Locations without a polygon are left out.
+func (c *PolyController) ExportFences() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := exporter.FormatNamed(r.URL.Query().Get("format"))
+		if err != nil {
+			c.Logger.Println("Invalid export format", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query Parameter", err)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.Logger.Println("Unprocessable request body", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+			return
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			body = []byte("{}")
+		}
+		params, err := repository.ParseLocationFilter(body)
+		if err != nil {
+			c.Logger.Println("Invalid LocationFilter", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Filter", err)
+			return
+		}
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		params = params.WithAxisOrder(order)
+
+		locationList, err := c.Repository.FindLocations(params)
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+		fences, err := exporter.Fences(locationList)
+		if err != nil {
+			c.Logger.Println("Fence export failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Export Failed", err)
+			return
+		}
+		var export bytes.Buffer
+		if err := format.Write(&export, fences); err != nil {
+			c.Logger.Println("Fence export failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Export Failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", format.ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="fences`+format.Extension+`"`)
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(export.Bytes()); err != nil {
+			c.Logger.Println("Could not write response", err)
+		}
+	}
+}
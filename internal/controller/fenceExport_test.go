@@ -0,0 +1,41 @@
+package controller_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExportFences(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro", "store_id": 8, "longitude": -122.43, "latitude": 37.76}`, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/3", `{"name": "Noe", "store_id": 9, "longitude": -122.43, "latitude": 37.75}`, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+	send(t, server, "PUT", "/polygons/2", `{"polygon": `+widerPolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	var collection struct {
+		Type     string
+		Features []struct {
+			ID         int
+			Geometry   struct{ Type string }
+			Properties map[string]interface{}
+		}
+	}
+	send(t, server, "POST", "/poly/export", "", http.StatusOK, &collection)
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Fatalf("export of every fence = %+v, want the 2 locations with polygons", collection)
+	}
+	if feature := collection.Features[0]; feature.ID != 1 || feature.Geometry.Type != "Polygon" || feature.Properties["name"] != "Mission" {
+		t.Errorf("first feature = %+v", feature)
+	}
+
+	filter := `{"where": {"field": "store_id", "op": "eq", "value": 8}}`
+	send(t, server, "POST", "/poly/export", filter, http.StatusOK, &collection)
+	if len(collection.Features) != 1 || collection.Features[0].ID != 2 {
+		t.Errorf("filtered export = %+v, want location 2", collection)
+	}
+
+	send(t, server, "POST", "/poly/export?format=kml", filter, http.StatusOK, nil)
+	send(t, server, "POST", "/poly/export?format=dxf", "", http.StatusBadRequest, nil)
+	send(t, server, "POST", "/poly/export", `{"where": {"field": "nope", "op": "eq", "value": 1}}`, http.StatusBadRequest, nil)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/repository"
+)
+
+// ImportFences sets the polygons of existing locations from a GeoJSON FeatureCollection, a KML or KMZ document or a
+// zipped Shapefile, sent as the request body or as the "file" part of a multipart form. The format query parameter,
+// or else the uploaded file's extension or its content, says which. Features are matched to locations by the key
+// column, id by default, using the feature attribute named by property, which defaults to key.
+//
+// Imports are dry runs unless dry_run=false, and report whether each feature creates, updates or leaves unchanged
+// its location's fence, or is rejected. Applying an import requires changed_by and writes every change at once;
+// if any feature is rejected nothing is written and the report is returned with a 422. repair=true repairs
+// geometries as it does for PUT /polygons/{id}.
+func (c *PolyController) ImportFences() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		options := importer.FenceOptions{
+			Key:      query.Get("key"),
+			Property: query.Get("property"),
+			Change:   repository.PolygonChange{ChangedBy: query.Get("changed_by"), Reason: query.Get("reason")},
+		}
+		var err error
+		if options.DryRun, err = boolQuery(r, "dry_run", true); err != nil {
+			c.Logger.Println("Invalid dry_run", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query Parameter", err)
+			return
+		}
+		if options.Repair, err = boolQuery(r, "repair", false); err != nil {
+			c.Logger.Println("Invalid repair", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query Parameter", err)
+			return
+		}
+		if !options.DryRun && options.Change.ChangedBy == "" {
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "changed_by is required", nil)
+			return
+		}
+
+		format := query.Get("format")
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+		var input io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				c.Logger.Println("Import file missing", err)
+				c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Upload", err)
+				return
+			}
+			defer file.Close()
+			input = file
+			if format == "" {
+				format = importer.FormatOfFile(header.Filename)
+			}
+		}
+		data, err := ioutil.ReadAll(input)
+		if err != nil {
+			c.Logger.Println("Failed to read import", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Upload", err)
+			return
+		}
+
+		report, err := importer.NewFenceImporter(c.Repository).Import(data, format, options)
+		var formatError *importer.FormatError
+		if errors.As(err, &formatError) {
+			c.Logger.Println("Invalid fence file", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Fence File", err)
+			return
+		}
+		if err != nil {
+			c.Logger.Println("Fence import failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Import Failed", err)
+			return
+		}
+		if report.Applied {
+			if err := c.Fences.Load(); err != nil {
+				c.Logger.Println("Failed to reload fence index", err)
+			}
+		}
+
+		responseBody, err := json.Marshal(report)
+		if err != nil {
+			c.Logger.Println("Import report Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		status := http.StatusOK
+		if !report.DryRun && !report.Applied && report.Rejected > 0 {
+			status = http.StatusUnprocessableEntity
+		}
+		c.WriteResponse(w, status, responseBody)
+	}
+}
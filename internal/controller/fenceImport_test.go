@@ -0,0 +1,61 @@
+package controller_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+type fenceReport struct {
+	Created, Updated, Unchanged, Rejected int
+	Applied                               bool
+	Fences                                []struct {
+		Feature    int
+		LocationID int `json:"location_id"`
+		Change     string
+		Reason     string
+		Version    int
+	}
+}
+
+func fenceFeature(storeID, polygon string) string {
+	return `{"type": "Feature", "properties": {"store_id": ` + storeID + `}, "geometry": ` + polygon + `}`
+}
+
+func TestImportFences(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro", "store_id": 8, "longitude": -122.43, "latitude": 37.76}`, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/2", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	collection := `{"type": "FeatureCollection", "features": [` +
+		fenceFeature("7", squarePolygon) + `, ` + fenceFeature("8", squarePolygon) + `]}`
+	var report fenceReport
+	send(t, server, "POST", "/polygons/import?key=store_id", collection, http.StatusOK, &report)
+	if report.Created != 1 || report.Unchanged != 1 || report.Applied {
+		t.Errorf("dry run = %+v", report)
+	}
+	send(t, server, "GET", "/polygons/1", "", http.StatusNotFound, nil)
+
+	send(t, server, "POST", "/polygons/import?key=store_id&dry_run=false", collection, http.StatusUnprocessableEntity, nil)
+	send(t, server, "POST", "/polygons/import?key=store_id&dry_run=false&changed_by=gis", collection, http.StatusOK, &report)
+	if !report.Applied || report.Fences[0].LocationID != 1 || report.Fences[0].Version != 1 {
+		t.Errorf("applied import = %+v", report)
+	}
+	send(t, server, "GET", "/polygons/1", "", http.StatusOK, nil)
+
+	rejected := `{"type": "FeatureCollection", "features": [` +
+		fenceFeature("8", widerPolygon) + `, ` + fenceFeature("9", squarePolygon) + `]}`
+	report = fenceReport{}
+	send(t, server, "POST", "/polygons/import?key=store_id&dry_run=false&changed_by=gis", rejected, http.StatusUnprocessableEntity, &report)
+	if report.Applied || report.Updated != 1 || report.Rejected != 1 || report.Fences[1].Reason == "" {
+		t.Errorf("import with a rejected feature = %+v", report)
+	}
+	var version polygonVersion
+	send(t, server, "GET", "/polygons/2", "", http.StatusOK, &version)
+	if version.Version != 1 {
+		t.Errorf("polygon 2 is at version %d after a rejected import, want 1", version.Version)
+	}
+
+	send(t, server, "POST", "/polygons/import?key=nope", collection, http.StatusBadRequest, nil)
+	send(t, server, "POST", "/polygons/import", `{"type": "Feature"}`, http.StatusBadRequest, nil)
+}
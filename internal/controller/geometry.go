@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+// Helper function to check a polygon before it is stored. Rings that wind the wrong way are always reversed. With
+// the repair=true query parameter the geometry is first normalized, and made valid by PostGIS if a ring crosses
+// itself. The changes made are returned. Writes a 422 listing every remaining problem by field if the geometry is
+// still invalid.
+func (c *PolyController) checkPolygon(w http.ResponseWriter, r *http.Request, geom model.PolyGeometry) (model.PolyGeometry, []string, bool) {
+	repair := false
+	if value := r.URL.Query().Get("repair"); value != "" {
+		var err error
+		if repair, err = strconv.ParseBool(value); err != nil {
+			c.Logger.Println("Invalid repair", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query", err)
+			return geom, nil, false
+		}
+	}
+
+	var changes []string
+	if repair {
+		geom, changes = logic.RepairGeometry(geom)
+		if logic.SelfIntersects(geom) {
+			valid, err := c.Repository.MakeValid(geom)
+			if err != nil {
+				c.Logger.Println("Failed to make geometry valid", err)
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Repair Failed", err)
+				return geom, nil, false
+			}
+			geom, _ = logic.RepairGeometry(valid)
+			changes = append(changes, "split self-intersecting rings into valid polygons")
+		}
+	}
+
+	geom, reversed := logic.OrientGeometry(geom)
+	changes = append(changes, reversed...)
+
+	err := logic.ValidateGeometry(geom)
+	if err != nil {
+		c.Logger.Println("Invalid geometry", err)
+		c.WriteFieldErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Geometry", err, err)
+		return geom, nil, false
+	}
+	return geom, changes, true
+}
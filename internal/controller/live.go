@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geofence/internal/events"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+)
+
+// How often an idle live feed writes a comment so proxies do not close the connection.
+const liveHeartbeatInterval = 15 * time.Second
+
+// The event types sent by LiveEvents when event_type is not given. MATCH events have no device to show.
+var defaultLiveEventTypes = []string{model.EnterEvent, model.ExitEvent, model.DwellEvent}
+
+// LiveEvents streams fence events as Server-Sent Events, filtered by the store_id, metro_id, zone_id and
+// event_type (comma separated) query parameters. Each connection has its own buffer; when a client falls behind,
+// events are dropped and the client is sent a "dropped" event with the number it missed. Streams end when the
+// broker is closed, as it is on server shutdown.
+func (c *TrackingController) LiveEvents() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseLiveFilter(r)
+		if err != nil {
+			c.Logger.Println("Invalid live filter", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query", err)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Streaming unsupported", nil)
+			return
+		}
+
+		subscription := c.Live.Subscribe(filter)
+		defer c.Live.Unsubscribe(subscription)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 3000\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(liveHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-subscription.Closed():
+				return
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			case event := <-subscription.Events():
+				err = writeLiveEvent(w, subscription, event)
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Helper function to write one event. Once the buffer has drained, any events dropped
+// while it was full are reported after it.
+func writeLiveEvent(w http.ResponseWriter, subscription *events.Subscription, event model.FenceEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	if len(subscription.Events()) > 0 {
+		return nil
+	}
+	if dropped := subscription.Dropped(); dropped > 0 {
+		_, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped)
+	}
+	return err
+}
+
+// Helper function to build a live feed filter from query parameters.
+func parseLiveFilter(r *http.Request) (events.Filter, error) {
+	values := r.URL.Query()
+	filter := events.Filter{EventTypes: defaultLiveEventTypes}
+	var err error
+	for name, target := range map[string]*int64{
+		"store_id": &filter.StoreID,
+		"metro_id": &filter.MetroID,
+		"zone_id":  &filter.ZoneID,
+	} {
+		if value := values.Get(name); value != "" {
+			if *target, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return filter, err
+			}
+		}
+	}
+	if value := values.Get("event_type"); value != "" {
+		filter.EventTypes = nil
+		for _, eventType := range strings.Split(value, ",") {
+			switch eventType = strings.ToUpper(strings.TrimSpace(eventType)); eventType {
+			case model.EnterEvent, model.ExitEvent, model.DwellEvent, model.MatchEvent:
+				filter.EventTypes = append(filter.EventTypes, eventType)
+			default:
+				return filter, fmt.Errorf("unknown event_type %q", eventType)
+			}
+		}
+	}
+	return filter, nil
+}
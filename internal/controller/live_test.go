@@ -0,0 +1,92 @@
+package controller_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geofence/internal/controller"
+	"github.com/geofence/internal/events"
+	"github.com/geofence/internal/model"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Helper function to read lines of a live feed until the next data line, returning its payload.
+func nextLiveData(t *testing.T, lines *bufio.Scanner) string {
+	t.Helper()
+	for lines.Scan() {
+		if data := strings.TrimPrefix(lines.Text(), "data: "); data != lines.Text() {
+			return data
+		}
+	}
+	t.Fatalf("live feed ended before a data line: %v", lines.Err())
+	return ""
+}
+
+func TestLiveEvents(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	bus := events.NewBus()
+	broker := events.NewBroker(bus, 10)
+	trackingController := controller.NewTrackingController(validator.New(), *logger, nil, nil, broker)
+	handler := trackingController.LiveEvents()
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/track/live?event_type=bogus", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("unknown event_type status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	server.Config.RegisterOnShutdown(broker.Close)
+	server.Start()
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "?store_id=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	lines := bufio.NewScanner(response.Body)
+	if !lines.Scan() || lines.Text() != "retry: 3000" {
+		t.Fatalf("first line = %q, want the retry interval", lines.Text())
+	}
+
+	// Another store's event and a MATCH event, which is not sent by default, are filtered out.
+	bus.Publish(
+		model.FenceEvent{DeviceID: "other", EventType: model.EnterEvent, StoreID: 8},
+		model.FenceEvent{DeviceID: "match", EventType: model.MatchEvent, StoreID: 7},
+		model.FenceEvent{DeviceID: "phone", EventType: model.EnterEvent, StoreID: 7, LocationID: 3},
+	)
+	var event model.FenceEvent
+	if err := json.Unmarshal([]byte(nextLiveData(t, lines)), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.DeviceID != "phone" || event.EventType != model.EnterEvent || event.LocationID != 3 {
+		t.Errorf("event = %+v, want phone entering location 3", event)
+	}
+
+	// Shutting down ends the stream rather than waiting for the client to leave.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := server.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v after %v with a live feed open", err, time.Since(start))
+	}
+	if _, err := io.Copy(ioutil.Discard, response.Body); err != nil {
+		t.Errorf("live feed ended with %v, want a clean end", err)
+	}
+	if broker.Len() != 0 {
+		t.Errorf("%d subscriptions left after the feed ended", broker.Len())
+	}
+}
@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/geofence/internal/helpers"
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/repository"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// The largest CSV accepted by an import request.
+const maxImportBytes = 64 << 20
+
+type LocationController struct {
+	*helpers.ResponseWritingController
+	Validator  *validator.Validate
+	Repository repository.PolygonRepository
+	Importer   *importer.Importer
+	Fences     *index.FenceIndex
+}
+
+func NewLocationController(validator *validator.Validate, log log.Logger, repo repository.PolygonRepository, importer *importer.Importer, fences *index.FenceIndex) *LocationController {
+	return &LocationController{
+		ResponseWritingController: &helpers.ResponseWritingController{
+			Logger: log,
+		},
+		Validator:  validator,
+		Repository: repo,
+		Importer:   importer,
+		Fences:     fences,
+	}
+}
+
+// GetLocation returns a location's columns by name. Soft-deleted locations are only found with include_deleted=true.
+func (c *LocationController) GetLocation() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		withDeleted, err := includeDeleted(r)
+		if err != nil {
+			c.Logger.Println("Invalid include_deleted", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query", err)
+			return
+		}
+		c.writeLocation(w, id, withDeleted, http.StatusOK)
+	}
+}
+
+// CreateLocation stores a new location under the ID in the path. The body is an object of column values, which
+// must include name, store_id, longitude and latitude. An ID already in use, even by a deleted location, is a 409.
+func (c *LocationController) CreateLocation() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, fields, ok := c.readLocation(w, r, true)
+		if !ok {
+			return
+		}
+		created, err := c.Repository.CreateLocation(id, fields)
+		if err != nil {
+			c.Logger.Println("Failed to insert into table", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Insert Failed", err)
+			return
+		}
+		if !created {
+			c.WriteErrorResponse(w, http.StatusConflict, "Location already exists", nil)
+			return
+		}
+		c.writeLocation(w, id, false, http.StatusCreated)
+	}
+}
+
+// ReplaceLocation overwrites every column of a location; columns missing from the body are set to null.
+func (c *LocationController) ReplaceLocation() func(w http.ResponseWriter, r *http.Request) {
+	return c.update(true, c.Repository.ReplaceLocation)
+}
+
+// UpdateLocation sets only the columns present in the body.
+func (c *LocationController) UpdateLocation() func(w http.ResponseWriter, r *http.Request) {
+	return c.update(false, c.Repository.UpdateLocation)
+}
+
+// Helper function to handle PUT and PATCH, which differ in how missing columns are treated.
+func (c *LocationController) update(complete bool, write func(int, repository.LocationFields) (bool, error)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, fields, ok := c.readLocation(w, r, complete)
+		if !ok {
+			return
+		}
+		found, err := write(id, fields)
+		if err != nil {
+			c.Logger.Println("Failed to update table", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Update Failed", err)
+			return
+		}
+		if !found {
+			c.WriteErrorResponse(w, http.StatusNotFound, "No matching location", nil)
+			return
+		}
+		c.refresh(id)
+		c.writeLocation(w, id, false, http.StatusOK)
+	}
+}
+
+// DeleteLocation soft deletes a location: it is kept with deleted_at set and left out of every query and the
+// fence index.
+func (c *LocationController) DeleteLocation() func(w http.ResponseWriter, r *http.Request) {
+	return c.setDeleted(c.Repository.DeleteLocation, http.StatusNoContent)
+}
+
+// RestoreLocation undoes a soft delete.
+func (c *LocationController) RestoreLocation() func(w http.ResponseWriter, r *http.Request) {
+	return c.setDeleted(c.Repository.RestoreLocation, http.StatusOK)
+}
+
+func (c *LocationController) setDeleted(write func(int) (bool, error), status int) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		found, err := write(id)
+		if err != nil {
+			c.Logger.Println("Failed to update table", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Update Failed", err)
+			return
+		}
+		if !found {
+			c.WriteErrorResponse(w, http.StatusNotFound, "No matching location", nil)
+			return
+		}
+		c.refresh(id)
+		if status == http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		c.writeLocation(w, id, false, status)
+	}
+}
+
+// Helper function to read the path ID and the body's column values, writing an error response if either is invalid.
+func (c *LocationController) readLocation(w http.ResponseWriter, r *http.Request, complete bool) (int, repository.LocationFields, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+		return 0, nil, false
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		c.Logger.Println("Unprocessable request body", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+		return 0, nil, false
+	}
+	fields, err := repository.ParseLocationFields(body)
+	if err == nil {
+		err = fields.Validate(complete)
+	}
+	if err != nil {
+		c.Logger.Println("Unprocessable Request Body", err)
+		c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+		return 0, nil, false
+	}
+	return id, fields, true
+}
+
+// Helper function to respond with a location as it is now stored.
+func (c *LocationController) writeLocation(w http.ResponseWriter, id int, includeDeleted bool, status int) {
+	location, found, err := c.Repository.GetLocation(id, includeDeleted)
+	if err != nil {
+		c.Logger.Println("Database Query Failed", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+		return
+	}
+	if !found {
+		c.WriteErrorResponse(w, http.StatusNotFound, "No matching location", nil)
+		return
+	}
+	responseBody, err := json.Marshal(repository.LocationFieldsOf(location))
+	if err != nil {
+		c.Logger.Println("Location Marshal failed", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+		return
+	}
+	c.WriteResponse(w, status, responseBody)
+}
+
+// Helper function to bring the fence index up to date after a location changes.
+func (c *LocationController) refresh(id int) {
+	if err := c.Fences.Refresh(id); err != nil {
+		c.Logger.Println("Failed to refresh fence index", err)
+	}
+}
+
+// The response to an import that failed part way through: the error, and the report of the rows handled before
+// it, which were written unless it was a dry run.
+type ImportFailure struct {
+	Error  helpers.ErrorDetails `json:"error"`
+	Report importer.Report      `json:"report"`
+}
+
+// Import upserts store locations from a CSV sent as the request body or as the "file" part of a multipart form.
+// With dry_run=true the rows are only validated. The response reports every rejected row, and if the import fails
+// part way through it is an ImportFailure reporting the rows handled so far.
+func (c *LocationController) Import() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dryRun := false
+		if value := r.URL.Query().Get("dry_run"); value != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(value); err != nil {
+				c.Logger.Println("Invalid dry_run", err)
+				c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query Parameter", err)
+				return
+			}
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+		var input io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				c.Logger.Println("Import file missing", err)
+				c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Upload", err)
+				return
+			}
+			defer file.Close()
+			input = file
+		}
+
+		report, err := c.Importer.Import(input, dryRun)
+		var headerError *importer.HeaderError
+		if errors.As(err, &headerError) {
+			c.Logger.Println("Invalid CSV header", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid CSV", err)
+			return
+		}
+		// Batches are committed as they are written, so rows may have changed even if the import failed.
+		if !dryRun && report.Imported > 0 {
+			if err := c.Fences.Load(); err != nil {
+				c.Logger.Println("Failed to reload fence index", err)
+			}
+		}
+		if err != nil {
+			c.Logger.Println("Import failed", err)
+			message := err.Error()
+			responseBody, err := json.Marshal(ImportFailure{
+				Error:  helpers.ErrorDetails{Type: "Import Failed", Message: &message},
+				Report: report,
+			})
+			if err != nil {
+				c.Logger.Println("ImportFailure Marshal failed", err)
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+				return
+			}
+			c.WriteResponse(w, http.StatusInternalServerError, responseBody)
+			return
+		}
+
+		responseBody, err := json.Marshal(report)
+		if err != nil {
+			c.Logger.Println("Import report Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
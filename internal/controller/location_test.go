@@ -0,0 +1,162 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geofence/internal/batch"
+	"github.com/geofence/internal/controller"
+	"github.com/geofence/internal/events"
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/repository"
+	routers "github.com/geofence/internal/router"
+	"github.com/geofence/internal/scoring"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Starts the V1 routes over an in-memory repository.
+func newTestServer(t *testing.T) *httptest.Server {
+	server, _ := newTestServerWithBus(t)
+	return server
+}
+
+// Starts the V1 routes over an in-memory repository, returning the bus the controllers publish events on.
+func newTestServerWithBus(t *testing.T) (*httptest.Server, *events.Bus) {
+	bus := events.NewBus()
+	logger := log.New(ioutil.Discard, "", 0)
+	polygons := repository.NewPolygonMemoryRepository()
+	fences := index.NewFenceIndex(polygons, *logger)
+	batchPool := batch.NewPool(batch.Options{MaxSize: 100, Workers: 2})
+	polyController := controller.NewPolyController(validator.New(), *logger, polygons, fences, batchPool, bus, &scoring.Scorer{Strategy: scoring.Nearest})
+	circleController := controller.NewCircleController(validator.New(), *logger, batchPool)
+	locationController := controller.NewLocationController(validator.New(), *logger, polygons, importer.NewImporter(polygons, 100), fences)
+
+	router := mux.NewRouter()
+	routers.SetGeofencerV1Routes(router, *polyController, *circleController, controller.TrackingController{}, controller.WebhookController{}, *locationController)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, bus
+}
+
+// Sends a request with a JSON body, failing the test unless the response has the wanted status.
+// The response body is decoded into result when it is not nil.
+func send(t *testing.T, server *httptest.Server, method, path, body string, status int, result interface{}) {
+	t.Helper()
+	request, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != status {
+		t.Fatalf("%s %s = %d %s, want %d", method, path, response.StatusCode, responseBody, status)
+	}
+	if result != nil {
+		if err := json.Unmarshal(responseBody, result); err != nil {
+			t.Fatalf("%s %s: %v in %s", method, path, err, responseBody)
+		}
+	}
+}
+
+const testLocation = `{"name": "Mission", "store_id": 7, "longitude": -122.42, "latitude": 37.76, "active": true}`
+
+func TestLocationLifecycle(t *testing.T) {
+	server := newTestServer(t)
+
+	var location map[string]interface{}
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, &location)
+	if location["name"] != "Mission" || location["store_id"] != 7.0 || location["created_at"] == nil {
+		t.Errorf("created location = %v", location)
+	}
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusConflict, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro"}`, http.StatusUnprocessableEntity, nil)
+
+	send(t, server, "PATCH", "/locations/1", `{"city": "San Francisco"}`, http.StatusOK, &location)
+	if location["city"] != "San Francisco" || location["name"] != "Mission" {
+		t.Errorf("patched location = %v", location)
+	}
+	send(t, server, "PUT", "/locations/1", `{"name": "Valencia", "store_id": 7, "longitude": -122.42, "latitude": 37.76}`, http.StatusOK, &location)
+	if location["name"] != "Valencia" || location["city"] != nil || location["active"] != nil {
+		t.Errorf("replaced location = %v", location)
+	}
+
+	send(t, server, "DELETE", "/locations/1", "", http.StatusNoContent, nil)
+	send(t, server, "GET", "/locations/1", "", http.StatusNotFound, nil)
+	send(t, server, "PATCH", "/locations/1", `{"city": "Oakland"}`, http.StatusNotFound, nil)
+	send(t, server, "GET", "/locations/1?include_deleted=true", "", http.StatusOK, &location)
+	if location["deleted_at"] == nil {
+		t.Errorf("deleted location = %v", location)
+	}
+	send(t, server, "POST", "/locations/1/restore", "", http.StatusOK, &location)
+	if location["deleted_at"] != nil {
+		t.Errorf("restored location = %v", location)
+	}
+	send(t, server, "POST", "/locations/1/restore", "", http.StatusNotFound, nil)
+}
+
+func TestFeatureQueryPages(t *testing.T) {
+	server := newTestServer(t)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		send(t, server, "POST", "/locations/"+id, testLocation, http.StatusCreated, nil)
+	}
+	send(t, server, "PATCH", "/locations/2", `{"store_id": 8}`, http.StatusOK, nil)
+	send(t, server, "DELETE", "/locations/4", "", http.StatusNoContent, nil)
+
+	filter := `{"where": {"field": "store_id", "op": "eq", "value": 7}, "sort": [{"field": "id", "desc": true}]}`
+	var ids []float64
+	cursor := ""
+	for pages := 0; pages < 3; pages++ {
+		var page struct {
+			Results []struct {
+				Properties struct{ ID float64 }
+			} `json:"results"`
+			NextCursor string `json:"next_cursor"`
+		}
+		send(t, server, "POST", "/poly/find?limit=2&cursor="+cursor, filter, http.StatusOK, &page)
+		for _, feature := range page.Results {
+			ids = append(ids, feature.Properties.ID)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if len(ids) != 3 || ids[0] != 5 || ids[1] != 3 || ids[2] != 1 {
+		t.Errorf("paged IDs = %v, want [5 3 1]", ids)
+	}
+	send(t, server, "POST", "/poly/find?limit=2&cursor=bm90IGpzb24", filter, http.StatusBadRequest, nil)
+}
+
+func TestFindPolyLocationFromID(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+
+	var features []struct {
+		Properties struct{ ID float64 }
+	}
+	send(t, server, "GET", "/poly/find/1", "", http.StatusOK, &features)
+	if len(features) != 1 || features[0].Properties.ID != 1 {
+		t.Errorf("features = %+v, want location 1", features)
+	}
+	send(t, server, "GET", "/poly/find/2", "", http.StatusNoContent, nil)
+
+	send(t, server, "DELETE", "/locations/1", "", http.StatusNoContent, nil)
+	send(t, server, "GET", "/poly/find/1", "", http.StatusNoContent, nil)
+	send(t, server, "GET", "/poly/find/1?include_deleted=true", "", http.StatusOK, &features)
+	if len(features) != 1 {
+		t.Errorf("features with deleted = %+v, want location 1", features)
+	}
+}
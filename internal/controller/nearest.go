@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+// How many stores /stores/nearest returns, and how far it looks for them, unless the request says otherwise.
+// Requests can ask for up to 100 stores within 100 km.
+const (
+	defaultNearestK      = 5
+	defaultNearestMeters = 10000
+)
+
+// A store found by /stores/nearest. Rank is its 1-based position in the results.
+type NearestStore struct {
+	Rank           int                       `json:"rank"`
+	DistanceMeters float64                   `json:"distance_meters"`
+	Inside         bool                      `json:"inside"`
+	Location       repository.LocationFields `json:"location"`
+}
+
+type NearestResponse struct {
+	Stores []NearestStore `json:"stores"`
+}
+
+// NearestStores returns the k active locations nearest a point within max_meters, measured along the earth's
+// surface, nearest first, with their distance and whether their polygon contains the point. Locations as far as
+// each other rank those containing the point first. store_id restricts the search to one store's locations.
+func (c *PolyController) NearestStores() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingNearestRequest struct {
+		Point     *model.PointGeometry `json:"point" validate:"required"`
+		K         int                  `json:"k" validate:"gte=0,lte=100"`
+		MaxMeters float64              `json:"max_meters" validate:"gte=0,lte=100000"`
+		StoreID   int                  `json:"store_id" validate:"gte=0"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.Logger.Println("Unprocessable request body", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+			return
+		}
+
+		var params IncomingNearestRequest
+		err = json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingNearestRequest", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			return
+		}
+
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(params.Point.Coordinates)
+		err = validateCoordinates(point)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
+
+		query := repository.NearestQuery{Point: point, K: params.K, MaxMeters: params.MaxMeters, StoreID: params.StoreID}
+		if query.K == 0 {
+			query.K = defaultNearestK
+		}
+		if query.MaxMeters == 0 {
+			query.MaxMeters = defaultNearestMeters
+		}
+		nearest, err := c.Repository.FindNearest(query)
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+
+		response := NearestResponse{Stores: make([]NearestStore, len(nearest))}
+		for i, location := range nearest {
+			response.Stores[i] = NearestStore{
+				Rank:           i + 1,
+				DistanceMeters: location.Meters,
+				Inside:         location.Inside,
+				Location:       repository.LocationFieldsOf(location.Location),
+			}
+		}
+		responseBody, err := json.Marshal(response)
+		if err != nil {
+			c.Logger.Println("NearestResponse Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
@@ -0,0 +1,48 @@
+package controller_test
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestNearestStores(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/2", `{"name": "Castro", "store_id": 8, "longitude": -122.435, "latitude": 37.76, "active": true}`, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/3", `{"name": "Closed", "store_id": 7, "longitude": -122.42, "latitude": 37.761, "active": false}`, http.StatusCreated, nil)
+	send(t, server, "POST", "/locations/4", `{"name": "Oakland", "store_id": 7, "longitude": -122.27, "latitude": 37.80, "active": true}`, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, nil)
+
+	var response struct {
+		Stores []struct {
+			Rank           int
+			DistanceMeters float64 `json:"distance_meters"`
+			Inside         bool
+			Location       struct{ ID int }
+		}
+	}
+	point := `"point": {"type": "Point", "coordinates": [-122.421, 37.76]}`
+	send(t, server, "POST", "/stores/nearest", `{`+point+`}`, http.StatusOK, &response)
+	if len(response.Stores) != 2 {
+		t.Fatalf("nearest = %+v, want the 2 active locations within 10 km", response.Stores)
+	}
+	first, second := response.Stores[0], response.Stores[1]
+	if first.Location.ID != 1 || first.Rank != 1 || !first.Inside || second.Location.ID != 2 || second.Inside {
+		t.Errorf("nearest = %+v", response.Stores)
+	}
+	// A thousandth of a degree of longitude at 37.76°N is about 88 meters.
+	if math.Abs(first.DistanceMeters-88) > 1 {
+		t.Errorf("distance to location 1 = %v meters, want about 88", first.DistanceMeters)
+	}
+
+	send(t, server, "POST", "/stores/nearest", `{`+point+`, "k": 1, "max_meters": 100000}`, http.StatusOK, &response)
+	if len(response.Stores) != 1 || response.Stores[0].Location.ID != 1 {
+		t.Errorf("k=1 = %+v", response.Stores)
+	}
+	send(t, server, "POST", "/stores/nearest", `{`+point+`, "store_id": 7, "max_meters": 100000}`, http.StatusOK, &response)
+	if len(response.Stores) != 2 || response.Stores[1].Location.ID != 4 {
+		t.Errorf("store 7 = %+v", response.Stores)
+	}
+	send(t, server, "POST", "/stores/nearest", `{`+point+`, "k": 1000}`, http.StatusUnprocessableEntity, nil)
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/repository"
+)
+
+// The page size used when a cursor is given without a limit, and the largest page returned.
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000
+)
+
+// How many streamed rows are written between flushes.
+const streamFlushRows = 100
+
+// A page of a listing. NextCursor is passed as the cursor query parameter to fetch the following page,
+// and is omitted on the last page.
+type PageResponse struct {
+	Results    interface{} `json:"results"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// The listing mode requested by the limit, cursor, stream and include_deleted query parameters.
+type listing struct {
+	page           repository.Page
+	paged          bool
+	stream         bool
+	includeDeleted bool
+}
+
+// Helper function to read the limit, cursor and stream query parameters. Without any of them a listing is
+// returned whole, as it was before pagination existed.
+func parseListing(r *http.Request) (listing, error) {
+	values := r.URL.Query()
+	var result listing
+	var err error
+	if result.includeDeleted, err = includeDeleted(r); err != nil {
+		return result, err
+	}
+	if value := values.Get("stream"); value != "" {
+		if result.stream, err = strconv.ParseBool(value); err != nil {
+			return result, err
+		}
+	}
+	result.page.Cursor = values.Get("cursor")
+	if value := values.Get("limit"); value != "" {
+		if result.page.Limit, err = strconv.Atoi(value); err != nil {
+			return result, err
+		}
+		if result.page.Limit <= 0 {
+			return result, errors.New("limit must be positive")
+		}
+	}
+	if result.stream {
+		return result, nil
+	}
+	if result.page.Cursor != "" && result.page.Limit == 0 {
+		result.page.Limit = defaultPageSize
+	}
+	if result.page.Limit > maxPageSize {
+		result.page.Limit = maxPageSize
+	}
+	result.paged = result.page.Limit > 0
+	return result, nil
+}
+
+// Helper function to report a failed page: a cursor that cannot be used is the caller's error.
+func (c *PolyController) writeListingError(w http.ResponseWriter, err error) {
+	var filterError *repository.FilterError
+	if errors.As(err, &filterError) {
+		c.Logger.Println("Invalid cursor", err)
+		c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Cursor", err)
+		return
+	}
+	c.Logger.Println("Database Query Failed", err)
+	c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+}
+
+// Helper function to write a listing as newline delimited JSON as it is read. Headers are sent before the first row,
+// so an error part way through is reported as a final {"error": ...} line.
+func (c *PolyController) writeStream(w http.ResponseWriter, read func(visit func(interface{}) error) error) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	output := bufio.NewWriter(w)
+
+	rows := 0
+	err := read(func(row interface{}) error {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		output.Write(line)
+		if err = output.WriteByte('\n'); err != nil {
+			return err
+		}
+		rows++
+		if rows%streamFlushRows == 0 && flusher != nil {
+			if err = output.Flush(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		c.Logger.Println("Stream failed", err)
+		line, _ := json.Marshal(map[string]string{"error": err.Error()})
+		output.Write(line)
+		output.WriteByte('\n')
+	}
+	output.Flush()
+}
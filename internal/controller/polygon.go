@@ -1,11 +1,14 @@
 package controller
 
 import (
+	"github.com/geofence/internal/batch"
+	"github.com/geofence/internal/events"
 	"github.com/geofence/internal/helpers"
+	"github.com/geofence/internal/index"
 	"github.com/geofence/internal/model"
 	"github.com/geofence/internal/repository"
+	"github.com/geofence/internal/scoring"
 	"github.com/gorilla/mux"
-	"github.com/jmoiron/sqlx"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -20,7 +23,11 @@ import (
 type PolyController struct {
 	*helpers.ResponseWritingController
 	Validator *validator.Validate
-	Repository repository.PolygonPostgresRepository
+	Repository repository.PolygonRepository
+	Fences *index.FenceIndex
+	Batch *batch.Pool
+	Bus *events.Bus
+	Scorer *scoring.Scorer
 }
 
 type IncomingFindClosestRequest struct {
@@ -28,32 +35,39 @@ type IncomingFindClosestRequest struct {
 	Point *model.PointGeometry `json:"point" validate:"required"`
 }
 
+// A request for the fences containing a point. Each of store_id, metro_id and zone_id is optional and narrows the
+// search to locations with that ID.
 type IncomingFindEnclosingRequest struct {
-	StoreID int `json:"store_id" validate:"required"`
-	MetroID int `json:"metro_id" validate:"required"`
-	ZoneID int `json:"zone_id" validate:"required"`
+	StoreID int `json:"store_id" validate:"gte=0"`
+	MetroID int `json:"metro_id" validate:"gte=0"`
+	ZoneID int `json:"zone_id" validate:"gte=0"`
 	Point *model.PointGeometry `json:"point" validate:"required"`
 }
 
-func NewPolyController(validator *validator.Validate, log log.Logger, db *sqlx.DB) *PolyController {
+func NewPolyController(validator *validator.Validate, log log.Logger, repo repository.PolygonRepository, fences *index.FenceIndex, batchPool *batch.Pool, bus *events.Bus, scorer *scoring.Scorer) *PolyController {
 	return &PolyController{
 		ResponseWritingController: &helpers.ResponseWritingController{
 			Logger: log,
 		},
 		Validator: validator,
-		Repository: repository.PolygonPostgresRepository{DB: *db},
+		Repository: repo,
+		Fences: fences,
+		Batch: batchPool,
+		Bus: bus,
+		Scorer: scorer,
 	}
 }
 
 func (c *PolyController) DetermineMembership() func(w http.ResponseWriter, r *http.Request) {
 	type IncomingMessage struct {
 		Geom *model.PolyGeometry `json:"geom" validate:"required"`
-		Point *[2]float64 `json:"point" validate:"required"`
+		Point *model.Coordinate `json:"point" validate:"required"`
+		Tolerance *float64 `json:"tolerance" validate:"omitempty,gte=0"`
 	}
 
 	type PolyResponse struct {
 		Geom    *model.PolyGeometry `json:"geom"`
-		Point    *[2]float64   `json:"point"`
+		Point    *model.Coordinate   `json:"point"`
 		Position string              `json:"position"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -81,17 +95,27 @@ func (c *PolyController) DetermineMembership() func(w http.ResponseWriter, r *ht
 			return
 		}
 
-		point := params.Point
-		geom := params.Geom
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(*params.Point)
+		geom := params.Geom.WithAxisOrder(order)
+		err = validateCoordinates(point, geom)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
 
-		result := logic.InPoly(*point, geom.Coordinates[0])
-		var position string
-		if result {
-			position = "Inside"
-		} else {
-			position = "Outside"
+		locator := logic.NewLocator(logic.DefaultTolerance)
+		if params.Tolerance != nil {
+			locator = logic.NewLocator(*params.Tolerance)
 		}
-		responseBodyInfo := PolyResponse{geom, point, position}
+		position := locator.LocateGeometry(point, geom).String()
+		responseBodyInfo := PolyResponse{params.Geom, params.Point, position}
 		responseBody, err := json.Marshal(responseBodyInfo)
 		if err != nil {
 			c.Logger.Println("PolyResponse Marshal failed", err)
@@ -102,11 +126,21 @@ func (c *PolyController) DetermineMembership() func(w http.ResponseWriter, r *ht
 	}
 }
 
+// The response to /insert/poly, listing any changes made to the polygon before it was written.
+type InsertPolygonResponse struct {
+	helpers.InsertResponse
+	Repairs []string `json:"repairs,omitempty"`
+}
+
+// InsertPolygon creates or replaces a location's polygon. The geometry's rings are oriented and it is validated
+// first, and repaired if the repair query parameter is true.
 func (c PolyController) InsertPolygon() func(w http.ResponseWriter, r *http.Request) {
 
 	type IncomingPolygon struct {
-		ID      int                `json:"id"`
-		Polygon model.PolyGeometry `json:"polygon"`
+		ID        int                `json:"id"`
+		Polygon   model.PolyGeometry `json:"polygon"`
+		ChangedBy string             `json:"changed_by"`
+		Reason    string             `json:"reason"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -130,13 +164,21 @@ func (c PolyController) InsertPolygon() func(w http.ResponseWriter, r *http.Requ
 			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
 			return
 		}
-		err = c.Repository.InsertPolygon(params.ID, params.Polygon)
+		polygon, repairs, ok := c.checkPolygon(w, r, params.Polygon)
+		if !ok {
+			return
+		}
+		err = c.Repository.InsertPolygon(params.ID, polygon, repository.PolygonChange{ChangedBy: params.ChangedBy, Reason: params.Reason})
 		if err != nil {
 			c.Logger.Println("Failed to insert into table")
 			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Insert Request", err)
 			return
 		}
-		result := helpers.InsertResponse{"Insert Success!"}
+		err = c.Fences.Refresh(params.ID)
+		if err != nil {
+			c.Logger.Println("Failed to refresh fence index", err)
+		}
+		result := InsertPolygonResponse{helpers.InsertResponse{"Insert Success!"}, repairs}
 		responseBody, err := json.Marshal(result)
 		if err != nil {
 			c.Logger.Println("Response Marshal failed", err)
@@ -149,10 +191,47 @@ func (c PolyController) InsertPolygon() func(w http.ResponseWriter, r *http.Requ
 
 
 
+// Ping lists every location with a polygon, and soft-deleted ones too with include_deleted=true. The limit and
+// cursor query parameters return it a page at a time, and stream=true writes it as newline delimited JSON while
+// it is read.
 func (c PolyController) Ping() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		listing, err := parseListing(r)
+		if err != nil {
+			c.Logger.Println("Invalid listing parameters", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query", err)
+			return
+		}
+		if listing.stream {
+			err = repository.LocationFilter{}.CheckPage(listing.page)
+			if err != nil {
+				c.writeListingError(w, err)
+				return
+			}
+			c.writeStream(w, func(visit func(interface{}) error) error {
+				return c.Repository.StreamFences(listing.page, listing.includeDeleted, func(location repository.PolyLocationResponseCleaned) error {
+					return visit(location)
+				})
+			})
+			return
+		}
+		if listing.paged {
+			result, nextCursor, err := c.Repository.GetFencesPage(listing.page, listing.includeDeleted)
+			if err != nil {
+				c.writeListingError(w, err)
+				return
+			}
+			responseBody, err := json.Marshal(PageResponse{result, nextCursor})
+			if err != nil {
+				c.Logger.Println("PageResponse Marshal failed", err)
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+				return
+			}
+			c.WriteResponse(w, http.StatusOK, responseBody)
+			return
+		}
 
-		result, err := c.Repository.GetAll()
+		result, err := c.Repository.GetAll(listing.includeDeleted)
 		if err != nil {
 			c.Logger.Println("Failed to get all from table")
 			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid get all Request", err)
@@ -205,13 +284,26 @@ func (c *PolyController) DetermineGeogMembership() func(w http.ResponseWriter, r
 			return
 		}
 
-		point := params.Point
-		geom := params.Geom
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := params.Point.WithAxisOrder(order)
+		geom := params.Geom.WithAxisOrder(order)
+		err = validateCoordinates(point, geom)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
 
 		geomJSON, err:= json.Marshal(geom)
 		if err != nil {
 			c.Logger.Println("Failed to Marshal geomJSON object")
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal geomJSON", err)
+			return
 		}
 		geomString := string(geomJSON)
 
@@ -219,6 +311,7 @@ func (c *PolyController) DetermineGeogMembership() func(w http.ResponseWriter, r
 		if err != nil {
 			c.Logger.Println("Failed to Marshal pointJSON object")
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal geomJSON", err)
+			return
 		}
 		pointString := string(pointJSON)
 
@@ -227,6 +320,7 @@ func (c *PolyController) DetermineGeogMembership() func(w http.ResponseWriter, r
 		if err != nil {
 			c.Logger.Println("DB Query failed")
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query failed", err)
+			return
 		}
 		var position string
 		if result {
@@ -234,7 +328,7 @@ func (c *PolyController) DetermineGeogMembership() func(w http.ResponseWriter, r
 		} else {
 			position = "Outside"
 		}
-		responseBodyInfo := PolyResponse{geom, point, position}
+		responseBodyInfo := PolyResponse{params.Geom, params.Point, position}
 		responseBody, err := json.Marshal(responseBodyInfo)
 		if err != nil {
 			c.Logger.Println("PolyResponse Marshal failed", err)
@@ -285,26 +379,53 @@ func (c *PolyController) DetermineGeogMembershipFromID() func(w http.ResponseWri
 			return
 		}
 
-		point := params.Point
-		pointJSON, err := json.Marshal(point)
+		order, err := axisOrder(r)
 		if err != nil {
-			c.Logger.Println("Failed to Marshal pointJSON object")
-			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal geomJSON", err)
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
 			return
 		}
-		pointString := string(pointJSON)
-		queriedPolygon, err := c.Repository.GetPolygonFromID(intID)
+		point := params.Point.WithAxisOrder(order)
+		err = validateCoordinates(point)
 		if err != nil {
-			c.Logger.Println("Failed to retrieve polygon from given ID")
-			c.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve polygon from given ID", err)
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
 			return
 		}
 
-		result, err := c.Repository.Intersects(queriedPolygon, pointString)
-		if err != nil {
-			c.Logger.Println("DB Intersects Query failed")
-			c.WriteErrorResponse(w, http.StatusInternalServerError, "Intersects Query failed", err)
-			return
+		var result bool
+		var resultGeom model.PolyGeometry
+		if fence, ok := c.Fences.Get(intID); ok {
+			resultGeom = fence.Geometry
+			result = logic.InGeometry(point.Coordinates, fence.Geometry)
+		} else {
+			pointJSON, err := json.Marshal(point)
+			if err != nil {
+				c.Logger.Println("Failed to Marshal pointJSON object")
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal geomJSON", err)
+				return
+			}
+			pointString := string(pointJSON)
+			queriedPolygon, err := c.Repository.GetPolygonFromID(intID)
+			if err != nil {
+				c.Logger.Println("Failed to retrieve polygon from given ID")
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve polygon from given ID", err)
+				return
+			}
+
+			result, err = c.Repository.Intersects(queriedPolygon, pointString)
+			if err != nil {
+				c.Logger.Println("DB Intersects Query failed")
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Intersects Query failed", err)
+				return
+			}
+
+			err = json.Unmarshal([]byte(queriedPolygon), &resultGeom)
+			if err != nil {
+				c.Logger.Println("Failed to unmarshal response into polygon object")
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal geomJSON", err)
+				return
+			}
 		}
 
 		var position string
@@ -313,14 +434,8 @@ func (c *PolyController) DetermineGeogMembershipFromID() func(w http.ResponseWri
 		} else {
 			position = "Outside"
 		}
-		var resultGeom model.PolyGeometry
-		err = json.Unmarshal([]byte(queriedPolygon), &resultGeom)
-		if err != nil {
-			c.Logger.Println("Failed to unmarshal response into polygon object")
-			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal geomJSON", err)
-			return
-		}
-		responseBodyInfo := PolyResponse{&resultGeom, point, position}
+		resultGeom = resultGeom.WithAxisOrder(order)
+		responseBodyInfo := PolyResponse{&resultGeom, params.Point, position}
 		responseBody, err := json.Marshal(responseBodyInfo)
 		if err != nil {
 			c.Logger.Println("PolyResponse Marshal failed", err)
@@ -332,7 +447,16 @@ func (c *PolyController) DetermineGeogMembershipFromID() func(w http.ResponseWri
 	}
 }
 
+// FindMostProbableStore decides which active location a point belongs to. Candidates are the locations within
+// max_meters of the point and those whose fence contains it, optionally only of store_id. Every candidate is scored
+// and explained, and the decision is made as scoring.Scorer.Decide makes it, with the tie_break strategy or the
+// configured one. A point without candidates is a 404.
 func (c *PolyController) FindMostProbableStore() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingClosestRequest struct {
+		IncomingFindClosestRequest
+		TieBreak  string  `json:"tie_break"`
+		MaxMeters float64 `json:"max_meters" validate:"gte=0,lte=100000"`
+	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
@@ -343,7 +467,7 @@ func (c *PolyController) FindMostProbableStore() func(w http.ResponseWriter, r *
 			return
 		}
 
-		var params IncomingFindClosestRequest
+		var params IncomingClosestRequest
 		err = json.Unmarshal(body, &params)
 		if err != nil {
 			c.Logger.Println("Failed to unmarshal IncomingPolyMessage", err)
@@ -357,27 +481,64 @@ func (c *PolyController) FindMostProbableStore() func(w http.ResponseWriter, r *
 			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
 			return
 		}
+		if params.TieBreak != "" {
+			if _, err = scoring.ParseStrategy(params.TieBreak); err != nil {
+				c.Logger.Println("Invalid tie_break", err)
+				c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+				return
+			}
+		}
+		if params.MaxMeters == 0 {
+			params.MaxMeters = defaultNearestMeters
+		}
 
-		result, err := c.Repository.FindClosest(params.StoreID, params.Point.Coordinates[0], params.Point.Coordinates[1])
+		order, err := axisOrder(r)
 		if err != nil {
-			c.Logger.Println("DB Query failed")
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(params.Point.Coordinates)
+		err = validateCoordinates(point)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
+
+		candidates, err := c.closestCandidates(point, params.StoreID, params.MaxMeters)
+		if err != nil {
+			c.Logger.Println("DB Query failed", err)
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "DB Query failed", err)
 			return
 		}
-		if result == (repository.LocationRow{}) {
-			response := helpers.InsertResponse{"Unable to determine exact store"}
-			responseBody, err := json.Marshal(response)
-			if err != nil {
-				c.Logger.Println("Message Marshal failed", err)
-				c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
-				return
-			}
-			c.WriteResponse(w, http.StatusMultipleChoices, responseBody)
+		if len(candidates) == 0 {
+			c.WriteErrorResponse(w, http.StatusNotFound, "No candidate store", nil)
 			return
 		}
-		responseBody, err := json.Marshal(result)
+
+		decision := c.Scorer.Decide(point, candidates, params.MaxMeters, params.TieBreak)
+		response := ClosestResponse{
+			Basis:      decision.Basis,
+			Strategy:   decision.Strategy,
+			Contenders: decision.Contenders,
+			Candidates: make([]ClosestCandidate, len(decision.Candidates)),
+		}
+		for i, candidate := range decision.Candidates {
+			response.Candidates[i] = ClosestCandidate{
+				Rank:           i + 1,
+				Location:       repository.LocationFieldsOf(candidate.Location),
+				Inside:         candidate.Inside,
+				DistanceMeters: candidate.Meters,
+				OverlapCount:   candidate.Overlaps,
+				Priority:       candidate.Priority,
+				Score:          candidate.Score,
+			}
+		}
+		response.Decision = response.Candidates[decision.Chosen]
+		responseBody, err := json.Marshal(response)
 		if err != nil {
-			c.Logger.Println("LocationRow Marshal failed", err)
+			c.Logger.Println("ClosestResponse Marshal failed", err)
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
 			return
 		}
@@ -385,6 +546,12 @@ func (c *PolyController) FindMostProbableStore() func(w http.ResponseWriter, r *
 	}
 }
 
+type EnclosingResponse struct {
+	Locations []repository.LocationFields `json:"locations"`
+}
+
+// FindEnclosingPolygon returns every location that has not been deleted whose polygon contains a point, ordered by
+// ID, or 404 if there are none. Fences may overlap, so callers choosing a single store should look at /poly/closest.
 func (c*PolyController) FindEnclosingPolygon() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
@@ -410,26 +577,43 @@ func (c*PolyController) FindEnclosingPolygon() func(w http.ResponseWriter, r *ht
 			return
 		}
 
-		result, err := c.Repository.FindEnclosingPolygon(params.Point.Coordinates[0], params.Point.Coordinates[1], params.StoreID, params.MetroID, params.ZoneID)
+		order, err := axisOrder(r)
 		if err != nil {
-			c.Logger.Println("DB Query failed")
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(params.Point.Coordinates)
+		err = validateCoordinates(point)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
+
+		enclosing, err := c.Repository.FindEnclosingPolygon(repository.EnclosingQuery{
+			Point:   point,
+			StoreID: params.StoreID,
+			MetroID: params.MetroID,
+			ZoneID:  params.ZoneID,
+		})
+		if err != nil {
+			c.Logger.Println("DB Query failed", err)
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "DB Query failed", err)
 			return
 		}
-		if result == (repository.LocationRow{}) {
-			response := helpers.InsertResponse{"Unable to determine exact store"}
-			responseBody, err := json.Marshal(response)
-			if err != nil {
-				c.Logger.Println("Message Marshal failed", err)
-				c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
-				return
-			}
-			c.WriteResponse(w, http.StatusMultipleChoices, responseBody)
+		if len(enclosing) == 0 {
+			c.WriteErrorResponse(w, http.StatusNotFound, "No enclosing fence", nil)
 			return
 		}
-		responseBody, err := json.Marshal(result)
+
+		response := EnclosingResponse{Locations: make([]repository.LocationFields, len(enclosing))}
+		for i, location := range enclosing {
+			response.Locations[i] = repository.LocationFieldsOf(location)
+		}
+		responseBody, err := json.Marshal(response)
 		if err != nil {
-			c.Logger.Println("LocationRow Marshal failed", err)
+			c.Logger.Println("EnclosingResponse Marshal failed", err)
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
 			return
 		}
@@ -481,6 +665,8 @@ func (c *PolyController) Echo() func(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// FeatureQuery returns the locations matching a repository.LocationFilter as GeoJSON features.
+// Unknown keys, fields and operators are rejected with a 400.
 func (c *PolyController) FeatureQuery() func(w http.ResponseWriter, r *http.Request) {
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -492,26 +678,63 @@ func (c *PolyController) FeatureQuery() func(w http.ResponseWriter, r *http.Requ
 			return
 		}
 
-		var params repository.LocationQuery
-		err = json.Unmarshal(body, &params)
+		params, err := repository.ParseLocationFilter(body)
 		if err != nil {
-			c.Logger.Println("Failed to unmarshal LocationQuery", err)
-			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			c.Logger.Println("Invalid LocationFilter", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Filter", err)
 			return
 		}
 
+		order, err := axisOrder(r)
 		if err != nil {
-			c.Logger.Println("Unprocessable Request Body", err)
-			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
 			return
 		}
 
-		locationList, err := c.Repository.QueryDatabase(params)
+		params = params.WithAxisOrder(order)
+
+		listing, err := parseListing(r)
+		if err != nil {
+			c.Logger.Println("Invalid listing parameters", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query", err)
+			return
+		}
+		if listing.stream {
+			err = params.CheckPage(listing.page)
+			if err != nil {
+				c.writeListingError(w, err)
+				return
+			}
+			c.writeStream(w, func(visit func(interface{}) error) error {
+				return c.Repository.StreamLocations(params, listing.page, func(location repository.PolyLocationResponseCleaned) error {
+					return visit(helpers.AsGeoJSONPointFeature(location))
+				})
+			})
+			return
+		}
+		if listing.paged {
+			locationList, nextCursor, err := c.Repository.FindLocationsPage(params, listing.page)
+			if err != nil {
+				c.writeListingError(w, err)
+				return
+			}
+			responseBody, err := json.Marshal(PageResponse{helpers.ListToGeoJSONPointFeatures(locationList, c.Logger), nextCursor})
+			if err != nil {
+				c.Logger.Println("PageResponse Marshal failed", err)
+				c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+				return
+			}
+			c.WriteResponse(w, http.StatusOK, responseBody)
+			return
+		}
+
+		locationList, err := c.Repository.FindLocations(params)
 		if err != nil {
 			c.Logger.Println("Database Query Failed", err)
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
 		}
-		c.Logger.Println(locationList)
 		var featureList []interface{}
 		featureList = helpers.ListToGeoJSONPointFeatures(locationList, c.Logger)
 
@@ -535,15 +758,28 @@ func (c *PolyController) FindPolyLocationFromID() func(w http.ResponseWriter, r
 			return
 		}
 		intID := int(id)
+		withDeleted, err := includeDeleted(r)
+		if err != nil {
+			c.Logger.Println("Invalid include_deleted", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query", err)
+			return
+		}
 
-		locationList, err := c.Repository.GetPolyLocationFromID(intID)
+		var locationList []repository.PolyLocationResponseCleaned
+		if withDeleted {
+			locationList, err = c.Repository.FindLocations(repository.LocationFilter{LocationQuery: repository.LocationQuery{ID: intID}, IncludeDeleted: true})
+		} else {
+			locationList, err = c.Repository.GetPolyLocationFromID(intID)
+		}
 		if err != nil {
 			c.Logger.Println("Database Query Failed", err)
 			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
 		}
 		if len(locationList) == 0 {
 			c.Logger.Println("No matching records found")
 			c.WriteErrorResponse(w, http.StatusNoContent, "No matching record", nil)
+			return
 		}
 		var feature []interface{}
 		feature = helpers.ListToGeoJSONPointFeatures(locationList, c.Logger)
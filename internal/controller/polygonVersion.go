@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// A polygon version with its geometry, which is omitted for a version that deleted the polygon.
+// Repairs lists the changes made to the polygon before it was written, such as rings reversed.
+type PolygonVersionResponse struct {
+	repository.PolygonVersion
+	Polygon *model.PolyGeometry `json:"polygon,omitempty"`
+	Repairs []string            `json:"repairs,omitempty"`
+}
+
+// GetPolygon returns a location's current polygon and the version it is at.
+func (c *PolyController) GetPolygon() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		version, found, err := c.Repository.GetPolygon(id)
+		c.writePolygonVersion(w, version, found, err, order, nil)
+	}
+}
+
+// ReplacePolygon creates or replaces a location's polygon. changed_by is required and is kept with reason
+// in the polygon's history. The geometry is validated first, and repaired if the repair query parameter is true.
+func (c *PolyController) ReplacePolygon() func(w http.ResponseWriter, r *http.Request) {
+
+	type IncomingPolygonChange struct {
+		Polygon   *model.PolyGeometry `json:"polygon" validate:"required"`
+		ChangedBy string              `json:"changed_by" validate:"required"`
+		Reason    string              `json:"reason"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		var params IncomingPolygonChange
+		if !c.readPolygonChange(w, r, &params) {
+			return
+		}
+		polygon, repairs, ok := c.checkPolygon(w, r, params.Polygon.WithAxisOrder(order))
+		if !ok {
+			return
+		}
+
+		version, found, err := c.Repository.SavePolygon(id, polygon, repository.PolygonChange{ChangedBy: params.ChangedBy, Reason: params.Reason})
+		if err == nil && found {
+			c.refreshFence(id)
+		}
+		c.writePolygonVersion(w, version, found, err, order, repairs)
+	}
+}
+
+// DeletePolygon removes a location's polygon. The changed_by query parameter is required, and reason is optional.
+// The deleted shape stays in the polygon's history and can be rolled back to.
+func (c *PolyController) DeletePolygon() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		change := repository.PolygonChange{ChangedBy: r.URL.Query().Get("changed_by"), Reason: r.URL.Query().Get("reason")}
+		if change.ChangedBy == "" {
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "changed_by is required", nil)
+			return
+		}
+
+		version, found, err := c.Repository.DeletePolygon(id, change)
+		if err == nil && found {
+			c.refreshFence(id)
+		}
+		c.writePolygonVersion(w, version, found, err, order, nil)
+	}
+}
+
+// ListPolygonVersions returns a polygon's history, newest first, without geometry.
+func (c *PolyController) ListPolygonVersions() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		versions, err := c.Repository.ListPolygonVersions(id)
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+		if len(versions) == 0 {
+			c.WriteErrorResponse(w, http.StatusNotFound, "No matching polygon", nil)
+			return
+		}
+		responseBody, err := json.Marshal(versions)
+		if err != nil {
+			c.Logger.Println("PolygonVersion Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// GetPolygonVersion returns one version of a polygon with its geometry.
+func (c *PolyController) GetPolygonVersion() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		number, err := strconv.Atoi(mux.Vars(r)["version"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		version, found, err := c.Repository.GetPolygonVersion(id, number)
+		c.writePolygonVersion(w, version, found, err, order, nil)
+	}
+}
+
+// RollbackPolygon restores a polygon to an earlier version. The rollback is itself recorded as a new version,
+// so it can be undone the same way.
+func (c *PolyController) RollbackPolygon() func(w http.ResponseWriter, r *http.Request) {
+
+	type IncomingRollback struct {
+		Version   int    `json:"version" validate:"required,min=1"`
+		ChangedBy string `json:"changed_by" validate:"required"`
+		Reason    string `json:"reason"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		var params IncomingRollback
+		if !c.readPolygonChange(w, r, &params) {
+			return
+		}
+
+		version, found, err := c.Repository.RollbackPolygon(id, params.Version, repository.PolygonChange{ChangedBy: params.ChangedBy, Reason: params.Reason})
+		if err == nil && found {
+			c.refreshFence(id)
+		}
+		c.writePolygonVersion(w, version, found, err, order, nil)
+	}
+}
+
+// Helper function to read and validate a request body, writing an error response if it is invalid.
+func (c *PolyController) readPolygonChange(w http.ResponseWriter, r *http.Request, params interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		c.Logger.Println("Unprocessable request body", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+		return false
+	}
+	err = json.Unmarshal(body, params)
+	if err != nil {
+		c.Logger.Println("Failed to unmarshal polygon change", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+		return false
+	}
+	err = c.Validator.Struct(params)
+	if err != nil {
+		c.Logger.Println("Unprocessable Request Body", err)
+		c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+		return false
+	}
+	return true
+}
+
+// Helper function to respond with a polygon version, its geometry in the requested axis order.
+func (c *PolyController) writePolygonVersion(w http.ResponseWriter, version repository.PolygonVersion, found bool, err error, order model.AxisOrder, repairs []string) {
+	if err != nil {
+		c.Logger.Println("Database Query Failed", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+		return
+	}
+	if !found {
+		c.WriteErrorResponse(w, http.StatusNotFound, "No matching polygon", nil)
+		return
+	}
+	response := PolygonVersionResponse{PolygonVersion: version, Repairs: repairs}
+	if version.Polygon != nil {
+		var polygon model.PolyGeometry
+		err = json.Unmarshal([]byte(*version.Polygon), &polygon)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal stored polygon", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal geomJSON", err)
+			return
+		}
+		polygon = polygon.WithAxisOrder(order)
+		response.Polygon = &polygon
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		c.Logger.Println("PolygonVersionResponse Marshal failed", err)
+		c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+		return
+	}
+	c.WriteResponse(w, http.StatusOK, responseBody)
+}
+
+// Helper function to bring the fence index up to date after a polygon changes.
+func (c *PolyController) refreshFence(id int) {
+	if err := c.Fences.Refresh(id); err != nil {
+		c.Logger.Println("Failed to refresh fence index", err)
+	}
+}
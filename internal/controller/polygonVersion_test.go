@@ -0,0 +1,135 @@
+package controller_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const (
+	squarePolygon = `{"type": "Polygon", "coordinates": [[[-122.43, 37.75], [-122.41, 37.75], [-122.41, 37.77], [-122.43, 37.77], [-122.43, 37.75]]]}`
+	widerPolygon  = `{"type": "Polygon", "coordinates": [[[-122.44, 37.75], [-122.41, 37.75], [-122.41, 37.77], [-122.44, 37.77], [-122.44, 37.75]]]}`
+	bowtiePolygon = `{"type": "Polygon", "coordinates": [[[-122.43, 37.75], [-122.41, 37.77], [-122.41, 37.75], [-122.43, 37.77], [-122.43, 37.75]]]}`
+)
+
+type polygonVersion struct {
+	Version      int
+	Action       string
+	RolledBackTo *int `json:"rolled_back_to"`
+	Polygon      *struct {
+		Type        string
+		Coordinates interface{}
+	}
+	Repairs []string
+}
+
+func TestPolygonVersions(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+	send(t, server, "PUT", "/polygons/2", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusNotFound, nil)
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`}`, http.StatusUnprocessableEntity, nil)
+
+	var version, first polygonVersion
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, &first)
+	if first.Version != 1 || first.Action != "create" {
+		t.Errorf("first version = %+v", first)
+	}
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+widerPolygon+`, "changed_by": "ana"}`, http.StatusOK, &version)
+	if version.Version != 2 || version.Action != "replace" {
+		t.Errorf("second version = %+v", version)
+	}
+
+	var contains struct{ Features []interface{} }
+	point := `{"point": {"type": "Point", "coordinates": [-122.435, 37.76]}}`
+	send(t, server, "POST", "/poly/contains", point, http.StatusOK, &contains)
+	if len(contains.Features) != 1 {
+		t.Errorf("fences containing a point in the wider polygon = %d, want 1", len(contains.Features))
+	}
+
+	send(t, server, "POST", "/polygons/1/rollback", `{"version": 9, "changed_by": "ben"}`, http.StatusNotFound, nil)
+	send(t, server, "POST", "/polygons/1/rollback", `{"version": 1, "changed_by": "ben", "reason": "too wide"}`, http.StatusOK, &version)
+	if version.Version != 3 || version.Action != "rollback" || version.RolledBackTo == nil || *version.RolledBackTo != 1 {
+		t.Errorf("rollback version = %+v", version)
+	}
+	send(t, server, "GET", "/polygons/1", "", http.StatusOK, &version)
+	if version.Version != 3 || !reflect.DeepEqual(version.Polygon, first.Polygon) {
+		t.Errorf("current polygon = %+v, want the first version's geometry", version)
+	}
+	send(t, server, "POST", "/poly/contains", point, http.StatusOK, &contains)
+	if len(contains.Features) != 0 {
+		t.Errorf("fences containing a point outside the rolled back polygon = %d, want 0", len(contains.Features))
+	}
+
+	send(t, server, "DELETE", "/polygons/1", "", http.StatusUnprocessableEntity, nil)
+	version = polygonVersion{}
+	send(t, server, "DELETE", "/polygons/1?changed_by=ben", "", http.StatusOK, &version)
+	if version.Version != 4 || version.Action != "delete" || version.Polygon != nil {
+		t.Errorf("delete version = %+v", version)
+	}
+	send(t, server, "GET", "/polygons/1", "", http.StatusNotFound, nil)
+	version = polygonVersion{}
+	send(t, server, "GET", "/polygons/1/versions/2", "", http.StatusOK, &version)
+	if version.Action != "replace" || version.Polygon == nil {
+		t.Errorf("version 2 = %+v", version)
+	}
+
+	var versions []polygonVersion
+	send(t, server, "GET", "/polygons/1/versions", "", http.StatusOK, &versions)
+	var actions []string
+	for _, listed := range versions {
+		actions = append(actions, listed.Action)
+	}
+	if want := []string{"delete", "rollback", "replace", "create"}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("version actions = %v, want %v", actions, want)
+	}
+}
+
+func TestReplacePolygonRepair(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+
+	var invalid struct {
+		Error struct {
+			Type   string
+			Fields []struct{ Field, Reason string }
+		}
+	}
+	body := `{"polygon": ` + bowtiePolygon + `, "changed_by": "ana"}`
+	send(t, server, "PUT", "/polygons/1", body, http.StatusUnprocessableEntity, &invalid)
+	if invalid.Error.Type != "Invalid Geometry" || len(invalid.Error.Fields) == 0 || invalid.Error.Fields[0].Field != "coordinates[0]" {
+		t.Errorf("invalid geometry response = %+v", invalid)
+	}
+	send(t, server, "PUT", "/polygons/1?repair=maybe", body, http.StatusBadRequest, nil)
+
+	var version polygonVersion
+	send(t, server, "PUT", "/polygons/1?repair=true", body, http.StatusOK, &version)
+	if version.Polygon == nil || version.Polygon.Type != "MultiPolygon" || len(version.Repairs) == 0 {
+		t.Errorf("repaired version = %+v", version)
+	}
+}
+
+func TestReplacePolygonOrientation(t *testing.T) {
+	server := newTestServer(t)
+	send(t, server, "POST", "/locations/1", testLocation, http.StatusCreated, nil)
+
+	// A clockwise exterior is stored anticlockwise without repair=true, and the reversal is reported.
+	clockwise := `{"type": "Polygon", "coordinates": [[[-122.43, 37.75], [-122.43, 37.77], [-122.41, 37.77], [-122.41, 37.75], [-122.43, 37.75]]]}`
+	var version polygonVersion
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+clockwise+`, "changed_by": "ana"}`, http.StatusOK, &version)
+	if !reflect.DeepEqual(version.Repairs, []string{"reversed coordinates[0]"}) {
+		t.Errorf("repairs = %q, want the exterior reversed", version.Repairs)
+	}
+	want := []interface{}{[]interface{}{
+		[]interface{}{-122.43, 37.75}, []interface{}{-122.41, 37.75}, []interface{}{-122.41, 37.77},
+		[]interface{}{-122.43, 37.77}, []interface{}{-122.43, 37.75},
+	}}
+	if version.Polygon == nil || !reflect.DeepEqual(version.Polygon.Coordinates, want) {
+		t.Errorf("stored polygon = %+v, want %v", version.Polygon, want)
+	}
+
+	var unchanged polygonVersion
+	send(t, server, "PUT", "/polygons/1", `{"polygon": `+squarePolygon+`, "changed_by": "ana"}`, http.StatusOK, &unchanged)
+	if len(unchanged.Repairs) != 0 {
+		t.Errorf("repairs = %q for an anticlockwise polygon, want none", unchanged.Repairs)
+	}
+}
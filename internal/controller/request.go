@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/geofence/internal/model"
+)
+
+// Reads the axis_order query option. Coordinates in request bodies, and any echoed back in responses,
+// follow this order; everything past the controller works in model.LonLat.
+// GeoJSON Features and FeatureCollections in responses are always [lon, lat] as the spec requires.
+func axisOrder(r *http.Request) (model.AxisOrder, error) {
+	return model.ParseAxisOrder(r.URL.Query().Get("axis_order"))
+}
+
+// Reads the include_deleted query option. Soft-deleted locations are left out of responses unless it is true.
+func includeDeleted(r *http.Request) (bool, error) {
+	return boolQuery(r, "include_deleted", false)
+}
+
+// Reads a boolean query option, which is defaultValue when it is not given.
+func boolQuery(r *http.Request, name string, defaultValue bool) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+type coordinateValidator interface {
+	Validate() error
+}
+
+// Checks that every given coordinate or geometry is within longitude and latitude range.
+func validateCoordinates(values ...coordinateValidator) error {
+	for _, value := range values {
+		if err := value.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/repository"
+	"github.com/gorilla/mux"
+)
+
+// ListStorePriorities returns the priority of every store that has one, which /poly/closest scores candidates and
+// breaks ties with. Stores without one have priority 0.
+func (c *PolyController) ListStorePriorities() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		priorities, err := c.Repository.ListStorePriorities()
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+		responseBody, err := json.Marshal(priorities)
+		if err != nil {
+			c.Logger.Println("StorePriority Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// SetStorePriority sets the priority of the store in the path from a body of {"priority": n}. Higher priorities win.
+func (c *PolyController) SetStorePriority() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingPriorityRequest struct {
+		Priority *int `json:"priority" validate:"required"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		storeID, err := strconv.ParseInt(mux.Vars(r)["store_id"], 10, 64)
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.Logger.Println("Unprocessable request body", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+			return
+		}
+
+		var params IncomingPriorityRequest
+		err = json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingPriorityRequest", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Could not unmarshal input", err)
+			return
+		}
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		priority := repository.StorePriority{StoreID: storeID, Priority: *params.Priority}
+		err = c.Repository.SetStorePriority(priority)
+		if err != nil {
+			c.Logger.Println("Failed to set store priority", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Update Failed", err)
+			return
+		}
+		responseBody, err := json.Marshal(priority)
+		if err != nil {
+			c.Logger.Println("StorePriority Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
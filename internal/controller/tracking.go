@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/geofence/internal/events"
+	"github.com/geofence/internal/helpers"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/geofence/internal/tracking"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// The default and maximum number of events returned by QueryEvents.
+const (
+	defaultEventLimit = 100
+	maxEventLimit     = 1000
+)
+
+type TrackingController struct {
+	*helpers.ResponseWritingController
+	Validator *validator.Validate
+	Tracker *tracking.Tracker
+	Events repository.EventRepository
+	Live *events.Broker
+}
+
+func NewTrackingController(validator *validator.Validate, log log.Logger, tracker *tracking.Tracker, events repository.EventRepository, live *events.Broker) *TrackingController {
+	return &TrackingController{
+		ResponseWritingController: &helpers.ResponseWritingController{
+			Logger: log,
+		},
+		Validator: validator,
+		Tracker: tracker,
+		Events: events,
+		Live: live,
+	}
+}
+
+// Ping records a device location and returns the fence events it caused.
+func (c *TrackingController) Ping() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingPing struct {
+		DeviceID  string               `json:"device_id" validate:"required"`
+		Point     *model.PointGeometry `json:"point" validate:"required"`
+		Timestamp *time.Time           `json:"timestamp"`
+	}
+
+	type PingResponse struct {
+		DeviceID string             `json:"device_id"`
+		Fences   []int              `json:"fences"`
+		Events   []model.FenceEvent `json:"events"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.Logger.Println("Unprocessable request body", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+			return
+		}
+
+		var params IncomingPing
+		err = json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingPing", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			return
+		}
+
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		order, err := axisOrder(r)
+		if err != nil {
+			c.Logger.Println("Invalid axis_order", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid axis_order", err)
+			return
+		}
+		point := order.Convert(params.Point.Coordinates)
+		err = validateCoordinates(point)
+		if err != nil {
+			c.Logger.Println("Invalid coordinates", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Coordinates", err)
+			return
+		}
+
+		timestamp := time.Now().UTC()
+		if params.Timestamp != nil {
+			timestamp = *params.Timestamp
+		}
+		events, err := c.Tracker.Ping(tracking.Ping{DeviceID: params.DeviceID, Point: point, Timestamp: timestamp})
+		if err == tracking.ErrStalePing {
+			c.WriteErrorResponse(w, http.StatusConflict, "Stale Ping", err)
+			return
+		}
+		if err != nil {
+			c.Logger.Println("Failed to track ping", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to track ping", err)
+			return
+		}
+
+		fences, _ := c.Tracker.Membership(params.DeviceID)
+		responseBody, err := json.Marshal(PingResponse{params.DeviceID, fences, events})
+		if err != nil {
+			c.Logger.Println("PingResponse Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// QueryEvents lists stored fence events, newest first, filtered by the device_id, event_type, location_id,
+// store_id, metro_id, zone_id, since, until (RFC 3339) and limit query parameters.
+func (c *TrackingController) QueryEvents() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseEventQuery(r)
+		if err != nil {
+			c.Logger.Println("Invalid event query", err)
+			c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid Query", err)
+			return
+		}
+
+		events, err := c.Events.QueryEvents(query)
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+		responseBody, err := json.Marshal(events)
+		if err != nil {
+			c.Logger.Println("FenceEvent Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// Helper function to build an EventQuery from query parameters.
+func parseEventQuery(r *http.Request) (repository.EventQuery, error) {
+	values := r.URL.Query()
+	query := repository.EventQuery{
+		DeviceID:  values.Get("device_id"),
+		EventType: values.Get("event_type"),
+		Limit:     defaultEventLimit,
+	}
+	var err error
+	for name, target := range map[string]*int64{
+		"store_id": &query.StoreID,
+		"metro_id": &query.MetroID,
+		"zone_id":  &query.ZoneID,
+	} {
+		if value := values.Get(name); value != "" {
+			if *target, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return query, err
+			}
+		}
+	}
+	if value := values.Get("location_id"); value != "" {
+		if query.LocationID, err = strconv.Atoi(value); err != nil {
+			return query, err
+		}
+	}
+	if value := values.Get("since"); value != "" {
+		if query.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			return query, err
+		}
+	}
+	if value := values.Get("until"); value != "" {
+		if query.Until, err = time.Parse(time.RFC3339, value); err != nil {
+			return query, err
+		}
+	}
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil {
+			return query, err
+		}
+		if query.Limit <= 0 {
+			return query, errors.New("limit must be positive")
+		}
+		if query.Limit > maxEventLimit {
+			query.Limit = maxEventLimit
+		}
+	}
+	return query, nil
+}
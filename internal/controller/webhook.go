@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/geofence/internal/helpers"
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/repository"
+	"github.com/geofence/internal/webhook"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type WebhookController struct {
+	*helpers.ResponseWritingController
+	Validator  *validator.Validate
+	Repository repository.WebhookRepository
+	Dispatcher *webhook.Dispatcher
+}
+
+func NewWebhookController(validator *validator.Validate, log log.Logger, repo repository.WebhookRepository, dispatcher *webhook.Dispatcher) *WebhookController {
+	return &WebhookController{
+		ResponseWritingController: &helpers.ResponseWritingController{
+			Logger: log,
+		},
+		Validator:  validator,
+		Repository: repo,
+		Dispatcher: dispatcher,
+	}
+}
+
+func (c *WebhookController) ListSubscriptions() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscriptions, err := c.Repository.ListSubscriptions()
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+		responseBody, err := json.Marshal(subscriptions)
+		if err != nil {
+			c.Logger.Println("WebhookSubscription Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// CreateSubscription registers a webhook. The secret is used to sign deliveries and is never returned.
+func (c *WebhookController) CreateSubscription() func(w http.ResponseWriter, r *http.Request) {
+	type IncomingSubscription struct {
+		URL        string   `json:"url" validate:"required,url"`
+		Secret     string   `json:"secret" validate:"required,min=16"`
+		StoreID    int64    `json:"store_id"`
+		MetroID    int64    `json:"metro_id"`
+		ZoneID     int64    `json:"zone_id"`
+		EventTypes []string `json:"event_types" validate:"dive,oneof=ENTER EXIT DWELL MATCH"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			c.Logger.Println("Unprocessable request body", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not read body", err)
+			return
+		}
+
+		var params IncomingSubscription
+		err = json.Unmarshal(body, &params)
+		if err != nil {
+			c.Logger.Println("Failed to unmarshal IncomingSubscription", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not unmarshal input", err)
+			return
+		}
+
+		err = c.Validator.Struct(params)
+		if err != nil {
+			c.Logger.Println("Unprocessable Request Body", err)
+			c.WriteErrorResponse(w, http.StatusUnprocessableEntity, "Invalid Request Body", err)
+			return
+		}
+
+		subscription := repository.WebhookSubscription{
+			URL:        params.URL,
+			Secret:     params.Secret,
+			StoreID:    params.StoreID,
+			MetroID:    params.MetroID,
+			ZoneID:     params.ZoneID,
+			EventTypes: params.EventTypes,
+		}
+		err = c.Repository.CreateSubscription(&subscription)
+		if err != nil {
+			c.Logger.Println("Failed to insert into table", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Invalid Insert Request", err)
+			return
+		}
+		c.reload()
+
+		responseBody, err := json.Marshal(subscription)
+		if err != nil {
+			c.Logger.Println("WebhookSubscription Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusCreated, responseBody)
+	}
+}
+
+func (c *WebhookController) DeleteSubscription() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idParams := mux.Vars(r)
+		id, err := strconv.ParseInt(idParams["id"], 10, 64)
+		if err != nil {
+			c.WriteErrorResponse(w, http.StatusNotFound, "Invalid Path", err)
+			return
+		}
+
+		deleted, err := c.Repository.DeleteSubscription(id)
+		if err != nil {
+			c.Logger.Println("Failed to delete from table", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Delete Failed", err)
+			return
+		}
+		if !deleted {
+			c.WriteErrorResponse(w, http.StatusNotFound, "No matching subscription", nil)
+			return
+		}
+		c.reload()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListDeadLetters returns the most recent failed deliveries, up to the limit query parameter.
+func (c *WebhookController) ListDeadLetters() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultEventLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				c.WriteErrorResponse(w, http.StatusBadRequest, "Invalid limit", err)
+				return
+			}
+			if parsed < maxEventLimit {
+				limit = parsed
+			} else {
+				limit = maxEventLimit
+			}
+		}
+
+		deadLetters, err := c.Repository.ListDeadLetters(limit)
+		if err != nil {
+			c.Logger.Println("Database Query Failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Query Failed", err)
+			return
+		}
+		responseBody, err := json.Marshal(deadLetters)
+		if err != nil {
+			c.Logger.Println("WebhookDeadLetter Marshal failed", err)
+			c.WriteErrorResponse(w, http.StatusInternalServerError, "Could not marshal response", err)
+			return
+		}
+		c.WriteResponse(w, http.StatusOK, responseBody)
+	}
+}
+
+// Helper function to make the dispatcher pick up subscription changes.
+func (c *WebhookController) reload() {
+	if err := c.Dispatcher.Reload(); err != nil {
+		c.Logger.Println("Failed to reload webhook subscriptions", err)
+	}
+}
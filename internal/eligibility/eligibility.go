@@ -0,0 +1,103 @@
+package eligibility
+
+import (
+	"time"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+// Why a store cannot serve an order. A store can have several reasons, which are listed in this order.
+const (
+	Deleted         = "deleted"
+	Inactive        = "inactive"
+	NoFence         = "no_fence"
+	OutsideFence    = "outside_fence"
+	UnknownTimeZone = "unknown_time_zone"
+	UnknownHours    = "unknown_hours"
+	Closed          = "closed"
+	NoPickup        = "no_pickup"
+	NoAlcohol       = "no_alcohol"
+	NotTaxExempt    = "not_tax_exempt"
+)
+
+// Requirements are what an order needs of the store serving it.
+type Requirements struct {
+	Pickup    bool `json:"pickup"`
+	Alcohol   bool `json:"alcohol"`
+	TaxExempt bool `json:"tax_exempt"`
+}
+
+// Decision says whether a location can serve an order, and if not why not. LocalTime is when the order is placed in
+// the store's time zone, which is zero when the zone is unknown.
+type Decision struct {
+	Location  repository.LocationRowNull
+	Eligible  bool
+	Reasons   []string
+	LocalTime time.Time
+}
+
+// Decide works out whether a location, whose fence is the GeoJSON polygon, can serve an order for the point placed
+// at the given time. The store must be active and not deleted, its polygon must contain the point, it must be open
+// at that time and it must offer whatever the order requires. A NULL flag counts as false.
+//
+// Hours are whole hours of the store's local time, in its time_zone or else its state's zone. A store is open from
+// opening_hour up to closing_hour; hours that close before they open run past midnight, and equal hours are open
+// around the clock. A store missing either hour is rejected as UnknownHours rather than taken to open at midnight.
+func Decide(location repository.LocationRowNull, polygon string, point model.Coordinate, at time.Time, requirements Requirements) Decision {
+	decision := Decision{Location: location}
+	reject := func(reason string) {
+		decision.Reasons = append(decision.Reasons, reason)
+	}
+
+	if location.DeletedAt.Valid {
+		reject(Deleted)
+	}
+	if !location.Active.Bool {
+		reject(Inactive)
+	}
+	var geometry model.PolyGeometry
+	switch {
+	case polygon == "" || json.Unmarshal([]byte(polygon), &geometry) != nil:
+		reject(NoFence)
+	case !logic.InGeometry(point, geometry):
+		reject(OutsideFence)
+	}
+	if timeZone, err := StoreTimeZone(location.TimeZone.String, location.State.String); err != nil {
+		reject(UnknownTimeZone)
+	} else {
+		decision.LocalTime = at.In(timeZone)
+		switch {
+		case !location.OpeningHour.Valid || !location.ClosingHour.Valid:
+			reject(UnknownHours)
+		case !open(location.OpeningHour.Int64, location.ClosingHour.Int64, decision.LocalTime):
+			reject(Closed)
+		}
+	}
+	if requirements.Pickup && !location.AllowsPickup.Bool {
+		reject(NoPickup)
+	}
+	if requirements.Alcohol && !location.SellsAlcohol.Bool {
+		reject(NoAlcohol)
+	}
+	if requirements.TaxExempt && !location.TaxExempt.Bool {
+		reject(NotTaxExempt)
+	}
+	decision.Eligible = len(decision.Reasons) == 0
+	return decision
+}
+
+// Helper function to decide whether hours from opening up to closing include the hour of local.
+func open(opening, closing int64, local time.Time) bool {
+	hour := int64(local.Hour())
+	switch {
+	case opening == closing:
+		return true
+	case opening < closing:
+		return opening <= hour && hour < closing
+	default:
+		return hour >= opening || hour < closing
+	}
+}
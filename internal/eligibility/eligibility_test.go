@@ -0,0 +1,89 @@
+package eligibility
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/lib/pq"
+)
+
+const square = `{"type": "Polygon", "coordinates": [[[-122.43, 37.75], [-122.41, 37.75], [-122.41, 37.77], [-122.43, 37.77], [-122.43, 37.75]]]}`
+
+func TestDecide(t *testing.T) {
+	store := repository.LocationRowNull{
+		ID:           1,
+		State:        sql.NullString{String: "CA", Valid: true},
+		Active:       sql.NullBool{Bool: true, Valid: true},
+		OpeningHour:  sql.NullInt64{Int64: 8, Valid: true},
+		ClosingHour:  sql.NullInt64{Int64: 22, Valid: true},
+		AllowsPickup: sql.NullBool{Bool: true, Valid: true},
+		SellsAlcohol: sql.NullBool{Bool: false, Valid: true},
+	}
+	inside := model.NewCoordinate(-122.42, 37.76)
+	// 15:00 UTC is 08:00 in San Francisco during daylight saving time.
+	morning := time.Date(2026, 7, 1, 15, 0, 0, 0, time.UTC)
+	hours := func(opening, closing int64) func(l *repository.LocationRowNull) {
+		return func(l *repository.LocationRowNull) {
+			l.OpeningHour = sql.NullInt64{Int64: opening, Valid: true}
+			l.ClosingHour = sql.NullInt64{Int64: closing, Valid: true}
+		}
+	}
+
+	tests := []struct {
+		name         string
+		change       func(location *repository.LocationRowNull)
+		point        model.Coordinate
+		at           time.Time
+		requirements Requirements
+		reasons      []string
+	}{
+		{"eligible", nil, inside, morning, Requirements{Pickup: true}, nil},
+		{"before opening", nil, inside, morning.Add(-time.Minute), Requirements{}, []string{Closed}},
+		{"at closing", nil, inside, morning.Add(14 * time.Hour), Requirements{}, []string{Closed}},
+		{"outside", nil, model.NewCoordinate(-122.40, 37.76), morning, Requirements{}, []string{OutsideFence}},
+		{"alcohol", nil, inside, morning, Requirements{Alcohol: true, TaxExempt: true}, []string{NoAlcohol, NotTaxExempt}},
+		{"overnight", hours(20, 4), inside, morning.Add(-12 * time.Hour), Requirements{}, nil},
+		{"closed overnight store", hours(20, 4), inside, morning, Requirements{}, []string{Closed}},
+		{"open from midnight", hours(0, 12), inside, morning.Add(-8 * time.Hour), Requirements{}, nil},
+		{"deleted and inactive", func(l *repository.LocationRowNull) {
+			l.DeletedAt, l.Active = pq.NullTime{Time: morning, Valid: true}, sql.NullBool{}
+		}, inside, morning, Requirements{}, []string{Deleted, Inactive}},
+		{"unknown state", func(l *repository.LocationRowNull) { l.State = sql.NullString{} },
+			inside, morning, Requirements{}, []string{UnknownTimeZone}},
+		// An hour later in Denver than in San Francisco, so the store has opened.
+		{"time zone column", func(l *repository.LocationRowNull) {
+			l.TimeZone = sql.NullString{String: "America/Denver", Valid: true}
+		}, inside, morning.Add(-time.Minute), Requirements{}, nil},
+		{"time zone column without a state", func(l *repository.LocationRowNull) {
+			l.State, l.TimeZone = sql.NullString{}, sql.NullString{String: "America/Denver", Valid: true}
+		}, inside, morning.Add(-time.Minute), Requirements{}, nil},
+		{"unknown time zone column", func(l *repository.LocationRowNull) {
+			l.TimeZone = sql.NullString{String: "America/Nowhere", Valid: true}
+		}, inside, morning, Requirements{}, []string{UnknownTimeZone}},
+		// NULL hours are not midnight, which with equal hours would be open around the clock.
+		{"no hours", func(l *repository.LocationRowNull) { l.OpeningHour, l.ClosingHour = sql.NullInt64{}, sql.NullInt64{} },
+			inside, morning, Requirements{}, []string{UnknownHours}},
+		{"no closing hour", func(l *repository.LocationRowNull) { l.ClosingHour = sql.NullInt64{} },
+			inside, morning, Requirements{}, []string{UnknownHours}},
+		{"no pickup flag", func(l *repository.LocationRowNull) { l.AllowsPickup = sql.NullBool{} },
+			inside, morning, Requirements{Pickup: true}, []string{NoPickup}},
+	}
+	for _, test := range tests {
+		location := store
+		if test.change != nil {
+			test.change(&location)
+		}
+		decision := Decide(location, square, test.point, test.at, test.requirements)
+		if !reflect.DeepEqual(decision.Reasons, test.reasons) || decision.Eligible != (test.reasons == nil) {
+			t.Errorf("%s: decision = %v %v, want reasons %v", test.name, decision.Eligible, decision.Reasons, test.reasons)
+		}
+	}
+
+	if decision := Decide(store, "", inside, morning, Requirements{}); !reflect.DeepEqual(decision.Reasons, []string{NoFence}) {
+		t.Errorf("no fence: reasons = %v, want %v", decision.Reasons, []string{NoFence})
+	}
+}
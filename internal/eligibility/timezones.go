@@ -0,0 +1,108 @@
+package eligibility
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The time zone of each US state and territory, by postal abbreviation. States spanning more than one zone use the
+// zone most of their population is in, so stores in the other zone need their time_zone column set.
+var stateTimeZones = map[string]string{
+	"AL": "America/Chicago",
+	"AK": "America/Anchorage",
+	"AZ": "America/Phoenix",
+	"AR": "America/Chicago",
+	"CA": "America/Los_Angeles",
+	"CO": "America/Denver",
+	"CT": "America/New_York",
+	"DE": "America/New_York",
+	"DC": "America/New_York",
+	"FL": "America/New_York",
+	"GA": "America/New_York",
+	"HI": "Pacific/Honolulu",
+	"ID": "America/Boise",
+	"IL": "America/Chicago",
+	"IN": "America/Indiana/Indianapolis",
+	"IA": "America/Chicago",
+	"KS": "America/Chicago",
+	"KY": "America/New_York",
+	"LA": "America/Chicago",
+	"ME": "America/New_York",
+	"MD": "America/New_York",
+	"MA": "America/New_York",
+	"MI": "America/Detroit",
+	"MN": "America/Chicago",
+	"MS": "America/Chicago",
+	"MO": "America/Chicago",
+	"MT": "America/Denver",
+	"NE": "America/Chicago",
+	"NV": "America/Los_Angeles",
+	"NH": "America/New_York",
+	"NJ": "America/New_York",
+	"NM": "America/Denver",
+	"NY": "America/New_York",
+	"NC": "America/New_York",
+	"ND": "America/Chicago",
+	"OH": "America/New_York",
+	"OK": "America/Chicago",
+	"OR": "America/Los_Angeles",
+	"PA": "America/New_York",
+	"RI": "America/New_York",
+	"SC": "America/New_York",
+	"SD": "America/Chicago",
+	"TN": "America/Chicago",
+	"TX": "America/Chicago",
+	"UT": "America/Denver",
+	"VT": "America/New_York",
+	"VA": "America/New_York",
+	"WA": "America/Los_Angeles",
+	"WV": "America/New_York",
+	"WI": "America/Chicago",
+	"WY": "America/Denver",
+	"PR": "America/Puerto_Rico",
+	"VI": "America/St_Thomas",
+	"GU": "Pacific/Guam",
+	"AS": "Pacific/Pago_Pago",
+	"MP": "Pacific/Saipan",
+}
+
+var (
+	locationsMutex sync.Mutex
+	locations      = map[string]*time.Location{}
+)
+
+// StoreTimeZone returns the time zone a store keeps its hours in: the IANA zone named by its time_zone column, or
+// when that is empty the zone of its state.
+func StoreTimeZone(timeZone, state string) (*time.Location, error) {
+	if name := strings.TrimSpace(timeZone); name != "" {
+		return loadZone(name)
+	}
+	return TimeZoneOf(state)
+}
+
+// TimeZoneOf returns the time zone of a US state or territory given by its postal abbreviation, in any case.
+func TimeZoneOf(state string) (*time.Location, error) {
+	state = strings.ToUpper(strings.TrimSpace(state))
+	name, ok := stateTimeZones[state]
+	if !ok {
+		return nil, fmt.Errorf("no time zone is known for state %q", state)
+	}
+	return loadZone(name)
+}
+
+// Helper function to load a zone from the IANA database once.
+func loadZone(name string) (*time.Location, error) {
+	locationsMutex.Lock()
+	defer locationsMutex.Unlock()
+	if location, ok := locations[name]; ok {
+		return location, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations[name] = location
+	return location, nil
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/geofence/internal/model"
+)
+
+// Filter narrows the events delivered to a subscription. Zero values match every event.
+type Filter struct {
+	StoreID    int64
+	MetroID    int64
+	ZoneID     int64
+	EventTypes []string
+}
+
+// Matches reports whether an event satisfies every field set on the filter.
+func (f Filter) Matches(event model.FenceEvent) bool {
+	if f.StoreID != 0 && event.StoreID != f.StoreID {
+		return false
+	}
+	if f.MetroID != 0 && event.MetroID != f.MetroID {
+		return false
+	}
+	if f.ZoneID != 0 && event.ZoneID != f.ZoneID {
+		return false
+	}
+	if len(f.EventTypes) == 0 {
+		return true
+	}
+	for _, eventType := range f.EventTypes {
+		if eventType == event.EventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription is one consumer of a Broker. Events are buffered per subscription;
+// when the buffer is full new events are dropped and counted rather than blocking the publisher.
+type Subscription struct {
+	filter  Filter
+	events  chan model.FenceEvent
+	dropped uint64
+	closed  <-chan struct{}
+}
+
+// Events returns the channel matching events are delivered on. It is never closed.
+func (s *Subscription) Events() <-chan model.FenceEvent {
+	return s.events
+}
+
+// Closed returns a channel that is closed once the broker is closed, so consumers stop waiting for events.
+func (s *Subscription) Closed() <-chan struct{} {
+	return s.closed
+}
+
+// Dropped returns and resets the number of events dropped since the last call.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.SwapUint64(&s.dropped, 0)
+}
+
+func (s *Subscription) offer(event model.FenceEvent) {
+	if !s.filter.Matches(event) {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Broker fans published events out to any number of independently buffered subscriptions.
+type Broker struct {
+	bufferSize    int
+	mutex         sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+// NewBroker returns a Broker subscribed to the bus whose subscriptions buffer up to bufferSize events each.
+func NewBroker(bus *Bus, bufferSize int) *Broker {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	broker := &Broker{
+		bufferSize:    bufferSize,
+		subscriptions: map[*Subscription]struct{}{},
+		closed:        make(chan struct{}),
+	}
+	bus.Subscribe(broker.Publish)
+	return broker
+}
+
+func (b *Broker) Subscribe(filter Filter) *Subscription {
+	subscription := &Subscription{filter: filter, events: make(chan model.FenceEvent, b.bufferSize), closed: b.closed}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+func (b *Broker) Unsubscribe(subscription *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.subscriptions, subscription)
+}
+
+// Close closes every subscription, including any made later, so long-lived consumers such as live feeds end
+// instead of holding up a server shutdown.
+func (b *Broker) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+}
+
+// Len returns the number of open subscriptions.
+func (b *Broker) Len() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return len(b.subscriptions)
+}
+
+// Publish offers the events to every subscription without blocking.
+func (b *Broker) Publish(events ...model.FenceEvent) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for subscription := range b.subscriptions {
+		for _, event := range events {
+			subscription.offer(event)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/geofence/internal/model"
+)
+
+// Helper function to take every event currently buffered on a subscription.
+func drain(subscription *Subscription) []model.FenceEvent {
+	var received []model.FenceEvent
+	for {
+		select {
+		case event := <-subscription.Events():
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
+
+func TestBrokerFansOutToMatchingSubscriptions(t *testing.T) {
+	bus := NewBus()
+	broker := NewBroker(bus, 10)
+	everything := broker.Subscribe(Filter{})
+	store := broker.Subscribe(Filter{StoreID: 7})
+	exits := broker.Subscribe(Filter{MetroID: 2, EventTypes: []string{model.ExitEvent}})
+
+	bus.Publish(
+		model.FenceEvent{DeviceID: "a", EventType: model.EnterEvent, StoreID: 7, MetroID: 2},
+		model.FenceEvent{DeviceID: "b", EventType: model.ExitEvent, StoreID: 8, MetroID: 2},
+		model.FenceEvent{DeviceID: "c", EventType: model.ExitEvent, StoreID: 7, MetroID: 3},
+	)
+
+	for name, test := range map[string]struct {
+		subscription *Subscription
+		want         string
+	}{
+		"everything": {everything, "abc"},
+		"store":      {store, "ac"},
+		"exits":      {exits, "b"},
+	} {
+		var devices string
+		for _, event := range drain(test.subscription) {
+			devices += event.DeviceID
+		}
+		if devices != test.want {
+			t.Errorf("%s received %q, want %q", name, devices, test.want)
+		}
+	}
+
+	broker.Unsubscribe(store)
+	if broker.Len() != 2 {
+		t.Errorf("Len = %d after unsubscribing, want 2", broker.Len())
+	}
+	bus.Publish(model.FenceEvent{DeviceID: "d", StoreID: 7})
+	if received := drain(store); len(received) != 0 {
+		t.Errorf("unsubscribed subscription received %v", received)
+	}
+}
+
+func TestSubscriptionCountsDroppedEvents(t *testing.T) {
+	broker := NewBroker(NewBus(), 2)
+	slow := broker.Subscribe(Filter{})
+	fast := broker.Subscribe(Filter{})
+
+	for i := 0; i < 5; i++ {
+		broker.Publish(model.FenceEvent{LocationID: i})
+		drain(fast)
+	}
+	received := drain(slow)
+	if len(received) != 2 || received[0].LocationID != 0 || received[1].LocationID != 1 {
+		t.Errorf("slow subscription received %v, want the first 2 events", received)
+	}
+	if dropped := slow.Dropped(); dropped != 3 {
+		t.Errorf("Dropped = %d, want 3", dropped)
+	}
+	if dropped := slow.Dropped(); dropped != 0 {
+		t.Errorf("Dropped = %d after reading it, want it reset to 0", dropped)
+	}
+	if dropped := fast.Dropped(); dropped != 0 {
+		t.Errorf("a subscription keeping up dropped %d events", dropped)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	broker := NewBroker(NewBus(), 1)
+	before := broker.Subscribe(Filter{})
+	broker.Close()
+	broker.Close()
+	after := broker.Subscribe(Filter{})
+	for name, subscription := range map[string]*Subscription{"before": before, "after": after} {
+		select {
+		case <-subscription.Closed():
+		default:
+			t.Errorf("subscription made %s Close is not closed", name)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/geofence/internal/model"
+)
+
+// Listener receives published events. Listeners are called synchronously by Publish and must not block.
+type Listener func(events ...model.FenceEvent)
+
+// Bus fans fence events out to every subscribed listener.
+type Bus struct {
+	mutex     sync.RWMutex
+	listeners []Listener
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(listener Listener) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.listeners = append(b.listeners, listener)
+}
+
+// Publish passes the events to every listener. A nil Bus discards them.
+func (b *Bus) Publish(events ...model.FenceEvent) {
+	if b == nil || len(events) == 0 {
+		return
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, listener := range b.listeners {
+		listener(events...)
+	}
+}
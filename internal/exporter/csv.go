@@ -0,0 +1,63 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/model"
+)
+
+// Helper function to write fences as CSV with a row per location, its columns followed by its polygon as WKT.
+// NULL columns are written as importer.NullCell, as location CSVs write them.
+func writeCSV(w io.Writer, fences []Fence) error {
+	writer := csv.NewWriter(w)
+	var header []string
+	for _, attribute := range (Fence{}).Attributes() {
+		header = append(header, attribute.Column)
+	}
+	if err := writer.Write(append(header, "wkt")); err != nil {
+		return err
+	}
+	for _, fence := range fences {
+		attributes := fence.Attributes()
+		row := make([]string, 0, len(attributes)+1)
+		for _, attribute := range attributes {
+			cell := importer.NullCell
+			if attribute.Value != nil {
+				cell = attributeText(attribute.Value)
+			}
+			row = append(row, cell)
+		}
+		if err := writer.Write(append(row, WKT(fence.Geometry))); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WKT writes a geometry as Well-Known Text, a POLYGON or MULTIPOLYGON with lon lat positions.
+func WKT(geometry model.PolyGeometry) string {
+	polygons := make([]string, len(geometry.Polygons))
+	for p, rings := range geometry.Polygons {
+		texts := make([]string, len(rings))
+		for r, ring := range rings {
+			positions := make([]string, len(ring))
+			for i, position := range ring {
+				positions[i] = strconv.FormatFloat(position.Lon(), 'f', -1, 64) + " " + strconv.FormatFloat(position.Lat(), 'f', -1, 64)
+			}
+			texts[r] = "(" + strings.Join(positions, ", ") + ")"
+		}
+		polygons[p] = "(" + strings.Join(texts, ", ") + ")"
+	}
+	if geometry.Type == model.PolygonType && len(polygons) == 1 {
+		return "POLYGON " + polygons[0]
+	}
+	if len(polygons) == 0 {
+		return "MULTIPOLYGON EMPTY"
+	}
+	return "MULTIPOLYGON (" + strings.Join(polygons, ", ") + ")"
+}
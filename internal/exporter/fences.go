@@ -0,0 +1,131 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+// The formats fences can be exported to. Every format but CSV can be imported back with importer.ReadFeatures.
+const (
+	GeoJSONFormat   = importer.GeoJSONFormat
+	KMLFormat       = importer.KMLFormat
+	CSVFormat       = "csv"
+	ShapefileFormat = importer.ShapefileFormat
+)
+
+// Fence is a location with its parsed polygon.
+type Fence struct {
+	Location repository.PolyLocationResponseCleaned
+	Geometry model.PolyGeometry
+}
+
+// Attribute is a column value of an exported location. A nil value is NULL.
+type Attribute struct {
+	Column string
+	Value  interface{}
+}
+
+// Format writes fences in one file format, served with ContentType and saved with Extension.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	write       func(w io.Writer, fences []Fence) error
+}
+
+var formats = []Format{
+	{GeoJSONFormat, "application/geo+json", ".geojson", writeGeoJSON},
+	{KMLFormat, "application/vnd.google-earth.kml+xml", ".kml", writeKML},
+	{CSVFormat, "text/csv; charset=utf-8", ".csv", writeCSV},
+	{ShapefileFormat, "application/zip", ".zip", writeShapefile},
+}
+
+// FormatNamed returns the format with the given name, GeoJSON if it is empty.
+func FormatNamed(name string) (Format, error) {
+	if name == "" {
+		name = GeoJSONFormat
+	}
+	for _, format := range formats {
+		if format.Name == name {
+			return format, nil
+		}
+	}
+	return Format{}, fmt.Errorf("unknown export format %q, expected geojson, kml, csv or shapefile", name)
+}
+
+// FormatOfFile returns the name of the format a file name's extension names, or an empty string if it names none.
+func FormatOfFile(name string) string {
+	extension := strings.ToLower(path.Ext(name))
+	for _, format := range formats {
+		if format.Extension == extension {
+			return format.Name
+		}
+	}
+	return ""
+}
+
+// Write writes the fences in the format.
+func (f Format) Write(w io.Writer, fences []Fence) error {
+	return f.write(w, fences)
+}
+
+// Fences parses the polygons of locations, leaving out the locations that have none.
+func Fences(locations []repository.PolyLocationResponseCleaned) ([]Fence, error) {
+	fences := []Fence{}
+	for _, location := range locations {
+		if location.Polygon == "" {
+			continue
+		}
+		var geometry model.PolyGeometry
+		if err := json.Unmarshal([]byte(location.Polygon), &geometry); err != nil {
+			return nil, fmt.Errorf("location %d has an invalid polygon: %v", location.ID, err)
+		}
+		fences = append(fences, Fence{Location: location, Geometry: geometry})
+	}
+	return fences, nil
+}
+
+// Attributes returns the column values of the fence's location in column order, without its polygon. Times are
+// RFC 3339 text, and a zero time, as a location that is not deleted has for deleted_at, is NULL.
+func (f Fence) Attributes() []Attribute {
+	value := reflect.ValueOf(f.Location)
+	attributes := make([]Attribute, 0, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		column := value.Type().Field(i).Tag.Get("db")
+		if column == "polygon" {
+			continue
+		}
+		attribute := Attribute{Column: column, Value: value.Field(i).Interface()}
+		if t, ok := attribute.Value.(time.Time); ok {
+			attribute.Value = nil
+			if !t.IsZero() {
+				attribute.Value = t.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+// Helper function to write an attribute value as text, as KML and CSV cells hold them. NULL is empty.
+func attributeText(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,112 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/geofence/internal/importer"
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+func testFences() []Fence {
+	exterior := []model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}
+	hole := []model.Coordinate{{2, 2}, {2, 4}, {4, 4}, {4, 2}, {2, 2}}
+	other := []model.Coordinate{{20, 0}, {21, 0}, {21, 1}, {20, 1}, {20, 0}}
+	return []Fence{
+		{
+			Location: repository.PolyLocationResponseCleaned{ID: 7, Name: "Mission & Valencia", StoreID: 70, Longitude: -122.421234567, Active: true},
+			Geometry: model.NewPolygon(exterior, hole),
+		},
+		{
+			Location: repository.PolyLocationResponseCleaned{ID: 8, Name: "Castro", StoreID: 80, Longitude: -122.43},
+			Geometry: model.NewMultiPolygon([][]model.Coordinate{exterior}, [][]model.Coordinate{other}),
+		},
+	}
+}
+
+// Every format but CSV must read back as the fences it was written from.
+func TestExportRoundTrips(t *testing.T) {
+	fences := testFences()
+	for _, name := range []string{GeoJSONFormat, KMLFormat, ShapefileFormat} {
+		format, err := FormatNamed(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var export bytes.Buffer
+		if err := format.Write(&export, fences); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		features, err := importer.ReadFeatures(export.Bytes(), name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(features) != len(fences) {
+			t.Fatalf("%s: read %d features, want %d", name, len(features), len(fences))
+		}
+		for i, feature := range features {
+			if feature.Problem != "" {
+				t.Errorf("%s: feature %d: %s", name, feature.Index, feature.Problem)
+			}
+			if err := logic.ValidateGeometry(feature.Geometry); err != nil {
+				t.Errorf("%s: feature %d: %v", name, feature.Index, err)
+			}
+			if feature.Geometry.Type != fences[i].Geometry.Type || len(feature.Geometry.Polygons) != len(fences[i].Geometry.Polygons) {
+				t.Errorf("%s: feature %d geometry = %+v", name, feature.Index, feature.Geometry)
+			}
+			storeID := featureValue(feature, "store_id")
+			if want := []string{"70", "80"}[i]; storeID != want {
+				t.Errorf("%s: feature %d store_id = %q, want %q", name, feature.Index, storeID, want)
+			}
+		}
+		if longitude := featureValue(features[0], "longitude"); longitude != "-122.421234567" {
+			t.Errorf("%s: longitude = %q", name, longitude)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	format, err := FormatNamed(CSVFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export bytes.Buffer
+	if err := format.Write(&export, testFences()); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&export).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("wrote %d rows, want a header and 2 fences", len(rows))
+	}
+	header, row := rows[0], rows[1]
+	cells := map[string]string{}
+	for c, column := range header {
+		cells[column] = row[c]
+	}
+	if cells["name"] != "Mission & Valencia" || cells["deleted_at"] != importer.NullCell {
+		t.Errorf("row = %v", cells)
+	}
+	want := "POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 2 4, 4 4, 4 2, 2 2))"
+	if cells["wkt"] != want {
+		t.Errorf("wkt = %s, want %s", cells["wkt"], want)
+	}
+	if wkt := rows[2][len(header)-1]; wkt != "MULTIPOLYGON (((0 0, 10 0, 10 10, 0 10, 0 0)), ((20 0, 21 0, 21 1, 20 1, 20 0)))" {
+		t.Errorf("multipolygon wkt = %s", wkt)
+	}
+}
+
+// Helper function to read a property as the file wrote it, ignoring case and the ten character dBASE limit.
+func featureValue(feature importer.Feature, name string) string {
+	for property, value := range feature.Properties {
+		if strings.EqualFold(property, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/paulmach/go.geojson"
+)
+
+// Helper function to write fences as a GeoJSON FeatureCollection whose features have the location ID as their id
+// and its columns as their properties.
+func writeGeoJSON(w io.Writer, fences []Fence) error {
+	collection := geojson.NewFeatureCollection()
+	for _, fence := range fences {
+		var feature *geojson.Feature
+		polygons := make([][][][]float64, len(fence.Geometry.Polygons))
+		for p, rings := range fence.Geometry.Polygons {
+			polygons[p] = positions(logic.OrientRings(rings, true))
+		}
+		if fence.Geometry.Type == model.PolygonType && len(polygons) == 1 {
+			feature = geojson.NewPolygonFeature(polygons[0])
+		} else {
+			feature = geojson.NewMultiPolygonFeature(polygons...)
+		}
+		feature.ID = fence.Location.ID
+		for _, attribute := range fence.Attributes() {
+			feature.SetProperty(attribute.Column, attribute.Value)
+		}
+		collection.AddFeature(feature)
+	}
+	return json.NewEncoder(w).Encode(collection)
+}
+
+// Helper function to convert rings to the positions go.geojson takes.
+func positions(rings [][]model.Coordinate) [][][]float64 {
+	converted := make([][][]float64, len(rings))
+	for r, ring := range rings {
+		converted[r] = make([][]float64, len(ring))
+		for i, position := range ring {
+			converted[r][i] = []float64{position.Lon(), position.Lat()}
+		}
+	}
+	return converted
+}
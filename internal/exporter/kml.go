@@ -0,0 +1,90 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"kml"`
+	Namespace  string         `xml:"xmlns,attr"`
+	Name       string         `xml:"Document>name"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlPlacemark struct {
+	ID      string            `xml:"id,attr"`
+	Name    string            `xml:"name"`
+	Data    []kmlData         `xml:"ExtendedData>Data"`
+	Polygon *kmlPolygon       `xml:"Polygon,omitempty"`
+	Multi   *kmlMultiGeometry `xml:"MultiGeometry,omitempty"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlMultiGeometry struct {
+	Polygons []kmlPolygon `xml:"Polygon"`
+}
+
+type kmlPolygon struct {
+	Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+// Helper function to write fences as a KML document of Placemarks named after their locations, with the location
+// columns as extended data. NULL columns are left out.
+func writeKML(w io.Writer, fences []Fence) error {
+	document := kmlDocument{Namespace: "http://www.opengis.net/kml/2.2", Name: "fences"}
+	for _, fence := range fences {
+		placemark := kmlPlacemark{ID: fmt.Sprintf("location-%d", fence.Location.ID), Name: fence.Location.Name}
+		for _, attribute := range fence.Attributes() {
+			if attribute.Value != nil {
+				placemark.Data = append(placemark.Data, kmlData{attribute.Column, attributeText(attribute.Value)})
+			}
+		}
+		var polygons []kmlPolygon
+		for _, rings := range fence.Geometry.Polygons {
+			rings = logic.OrientRings(rings, true)
+			polygon := kmlPolygon{Outer: kmlCoordinates(rings[0])}
+			for _, hole := range rings[1:] {
+				polygon.Inner = append(polygon.Inner, kmlCoordinates(hole))
+			}
+			polygons = append(polygons, polygon)
+		}
+		if fence.Geometry.Type == model.PolygonType && len(polygons) == 1 {
+			placemark.Polygon = &polygons[0]
+		} else {
+			placemark.Multi = &kmlMultiGeometry{Polygons: polygons}
+		}
+		document.Placemarks = append(document.Placemarks, placemark)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Helper function to write a ring as KML coordinates, a space separated list of lon,lat tuples.
+func kmlCoordinates(ring []model.Coordinate) string {
+	tuples := make([]string, len(ring))
+	for i, position := range ring {
+		tuples[i] = strconv.FormatFloat(position.Lon(), 'f', -1, 64) + "," + strconv.FormatFloat(position.Lat(), 'f', -1, 64)
+	}
+	return strings.Join(tuples, " ")
+}
@@ -0,0 +1,226 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+const shapePolygon = 5
+
+// The .prj of WGS 84 longitudes and latitudes, which is what fences are stored in.
+const wgs84Projection = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],` +
+	`PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+
+// The widest a dBASE field can be, and the most digits written after the decimal point of a numeric one.
+const (
+	maxDBFWidth    = 254
+	maxDBFDecimals = 15
+)
+
+// Helper function to write fences as a zipped Shapefile of polygon shapes, exteriors clockwise and holes
+// anticlockwise as the format requires, with the location columns as attributes. dBASE limits field names to ten
+// characters, so longer column names are cut short, and text to 254 bytes.
+func writeShapefile(w io.Writer, fences []Fence) error {
+	shp, shx := writeShapes(fences)
+	archive := zip.NewWriter(w)
+	members := []struct {
+		name    string
+		content []byte
+	}{
+		{"fences.shp", shp},
+		{"fences.shx", shx},
+		{"fences.dbf", writeDBF(fences)},
+		{"fences.prj", []byte(wgs84Projection)},
+		{"fences.cpg", []byte("UTF-8")},
+	}
+	for _, member := range members {
+		file, err := archive.Create(member.name)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(member.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Helper function to write the .shp file of fences and its .shx index.
+func writeShapes(fences []Fence) ([]byte, []byte) {
+	var shp, shx bytes.Buffer
+	shp.Write(make([]byte, 100))
+	shx.Write(make([]byte, 100))
+	bounds := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for f, fence := range fences {
+		var rings [][]model.Coordinate
+		for _, polygon := range fence.Geometry.Polygons {
+			rings = append(rings, logic.OrientRings(polygon, false)...)
+		}
+		box := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		points := 0
+		for _, ring := range rings {
+			points += len(ring)
+			for _, position := range ring {
+				box[0], box[1] = math.Min(box[0], position.Lon()), math.Min(box[1], position.Lat())
+				box[2], box[3] = math.Max(box[2], position.Lon()), math.Max(box[3], position.Lat())
+			}
+		}
+		bounds[0], bounds[1] = math.Min(bounds[0], box[0]), math.Min(bounds[1], box[1])
+		bounds[2], bounds[3] = math.Max(bounds[2], box[2]), math.Max(bounds[3], box[3])
+
+		var content bytes.Buffer
+		binary.Write(&content, binary.LittleEndian, int32(shapePolygon))
+		binary.Write(&content, binary.LittleEndian, box)
+		binary.Write(&content, binary.LittleEndian, int32(len(rings)))
+		binary.Write(&content, binary.LittleEndian, int32(points))
+		start := 0
+		for _, ring := range rings {
+			binary.Write(&content, binary.LittleEndian, int32(start))
+			start += len(ring)
+		}
+		for _, ring := range rings {
+			for _, position := range ring {
+				binary.Write(&content, binary.LittleEndian, []float64{position.Lon(), position.Lat()})
+			}
+		}
+
+		binary.Write(&shx, binary.BigEndian, []int32{int32(shp.Len() / 2), int32(content.Len() / 2)})
+		binary.Write(&shp, binary.BigEndian, []int32{int32(f + 1), int32(content.Len() / 2)})
+		shp.Write(content.Bytes())
+	}
+	if len(fences) == 0 {
+		bounds = make([]float64, 4)
+	}
+	return shapeHeader(shp.Bytes(), bounds), shapeHeader(shx.Bytes(), bounds)
+}
+
+// Helper function to fill in the 100 byte header a .shp and a .shx file share, returning the file.
+func shapeHeader(file []byte, bounds []float64) []byte {
+	binary.BigEndian.PutUint32(file[0:4], 9994)
+	binary.BigEndian.PutUint32(file[24:28], uint32(len(file)/2))
+	binary.LittleEndian.PutUint32(file[28:32], 1000)
+	binary.LittleEndian.PutUint32(file[32:36], shapePolygon)
+	for i, bound := range bounds {
+		binary.LittleEndian.PutUint64(file[36+8*i:44+8*i], math.Float64bits(bound))
+	}
+	return file
+}
+
+// A dBASE field and how its values are written.
+type dbfField struct {
+	name     string
+	kind     byte
+	width    int
+	decimals int
+}
+
+// Helper function to write the .dbf file of the fences' attributes. Text is a character field, numbers are numeric
+// fields as wide as their widest value and booleans are logical fields. NULL values are blank.
+func writeDBF(fences []Fence) []byte {
+	columns := (Fence{}).Attributes()
+	rows := make([][]Attribute, len(fences))
+	for f, fence := range fences {
+		rows[f] = fence.Attributes()
+	}
+	fields := make([]dbfField, len(columns))
+	for c, column := range columns {
+		field := dbfField{name: column.Column, kind: 'C', width: 1}
+		if len(field.name) > 10 {
+			field.name = field.name[:10]
+		}
+		for _, row := range rows {
+			switch value := row[c].Value.(type) {
+			case int, int64:
+				field.kind = 'N'
+			case float64:
+				field.kind = 'N'
+				text := strconv.FormatFloat(value, 'f', -1, 64)
+				if point := strings.IndexByte(text, '.'); point >= 0 && len(text)-point-1 > field.decimals {
+					field.decimals = len(text) - point - 1
+				}
+			case bool:
+				field.kind = 'L'
+			}
+		}
+		if field.decimals > maxDBFDecimals {
+			field.decimals = maxDBFDecimals
+		}
+		for _, row := range rows {
+			if width := len(field.format(row[c].Value)); width > field.width {
+				field.width = width
+			}
+		}
+		if field.width > maxDBFWidth {
+			field.width = maxDBFWidth
+		}
+		fields[c] = field
+	}
+
+	var dbf bytes.Buffer
+	recordLength := 1
+	for _, field := range fields {
+		recordLength += field.width
+	}
+	now := time.Now()
+	dbf.Write([]byte{3, byte(now.Year() - 1900), byte(now.Month()), byte(now.Day())})
+	binary.Write(&dbf, binary.LittleEndian, uint32(len(rows)))
+	binary.Write(&dbf, binary.LittleEndian, uint16(32+32*len(fields)+1))
+	binary.Write(&dbf, binary.LittleEndian, uint16(recordLength))
+	dbf.Write(make([]byte, 20))
+	for _, field := range fields {
+		descriptor := make([]byte, 32)
+		copy(descriptor, field.name)
+		descriptor[11] = field.kind
+		descriptor[16] = byte(field.width)
+		descriptor[17] = byte(field.decimals)
+		dbf.Write(descriptor)
+	}
+	dbf.WriteByte(0x0D)
+	for _, row := range rows {
+		dbf.WriteByte(' ')
+		for c, field := range fields {
+			value := field.format(row[c].Value)
+			padding := strings.Repeat(" ", field.width-len(value))
+			if field.kind == 'N' {
+				dbf.WriteString(padding + value)
+			} else {
+				dbf.WriteString(value + padding)
+			}
+		}
+	}
+	dbf.WriteByte(0x1A)
+	return dbf.Bytes()
+}
+
+// Helper function to write a value as the field holds it, cut to maxDBFWidth bytes without splitting a character.
+func (f dbfField) format(value interface{}) string {
+	var text string
+	switch value := value.(type) {
+	case nil:
+		text = ""
+	case float64:
+		text = strconv.FormatFloat(value, 'f', f.decimals, 64)
+	case bool:
+		text = "F"
+		if value {
+			text = "T"
+		}
+	default:
+		text = attributeText(value)
+	}
+	for len(text) > maxDBFWidth {
+		_, size := utf8.DecodeLastRuneInString(text)
+		text = text[:len(text)-size]
+	}
+	return text
+}
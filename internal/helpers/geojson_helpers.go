@@ -7,8 +7,8 @@ import (
 	"log"
 )
 
-func AsGeoJSONPolyFeature(polyLocation repository.PolyLocationResponseCleaned, logger log.Logger) (repository.GeoJSONPolyFeature, error) {
-	featureProperties := repository.FeatureProperties{
+func asFeatureProperties(polyLocation repository.PolyLocationResponseCleaned) repository.FeatureProperties {
+	return repository.FeatureProperties{
 		ID: polyLocation.ID,
 		Name:    polyLocation.Name,
 		Street1: polyLocation.Street1,
@@ -24,6 +24,10 @@ func AsGeoJSONPolyFeature(polyLocation repository.PolyLocationResponseCleaned, l
 		Latitude: polyLocation.Latitude,
 		Polygon: polyLocation.Polygon,
 	}
+}
+
+func AsGeoJSONPolyFeature(polyLocation repository.PolyLocationResponseCleaned, logger log.Logger) (repository.GeoJSONPolyFeature, error) {
+	featureProperties := asFeatureProperties(polyLocation)
 
 	var geometry model.PolyGeometry
 	err := json.Unmarshal([]byte(polyLocation.Polygon), &geometry)
@@ -39,23 +43,8 @@ func AsGeoJSONPolyFeature(polyLocation repository.PolyLocationResponseCleaned, l
 }
 
 func AsGeoJSONPointFeature(polyLocation repository.PolyLocationResponseCleaned) (repository.GeoJSONPointFeature) {
-	featureProperties := repository.FeatureProperties{
-		ID: polyLocation.ID,
-		Name:    polyLocation.Name,
-		Street1: polyLocation.Street1,
-		Zip:     polyLocation.Zip,
-		City:    polyLocation.City,
-		State:   polyLocation.State,
-		MetroID: polyLocation.MetroID,
-		ZoneID: polyLocation.ZoneID,
-		StoreID: polyLocation.StoreID,
-		County: polyLocation.County,
-		OpeningHour: polyLocation.OpeningHour,
-		Longitude: polyLocation.Longitude,
-		Latitude: polyLocation.Latitude,
-		Polygon: polyLocation.Polygon,
-	}
-	geometry := model.PointGeometry{Type: "Point", Coordinates: [2]float64{polyLocation.Longitude, polyLocation.Latitude}}
+	featureProperties := asFeatureProperties(polyLocation)
+	geometry := model.PointGeometry{Type: "Point", Coordinates: model.NewCoordinate(polyLocation.Longitude, polyLocation.Latitude)}
 	return repository.GeoJSONPointFeature{
 		Type: "Feature",
 		Properties: featureProperties,
@@ -87,3 +76,22 @@ func ListToGeoJSONPointFeatures(responses []repository.PolyLocationResponseClean
 	}
 	return results
 }
+
+// Builds a polygon feature from a location whose polygon has already been parsed.
+func AsGeoJSONFenceFeature(polyLocation repository.PolyLocationResponseCleaned, geometry model.PolyGeometry) repository.GeoJSONPolyFeature {
+	return repository.GeoJSONPolyFeature{
+		Type: "Feature",
+		Properties: asFeatureProperties(polyLocation),
+		Geometry: geometry,
+	}
+}
+
+func AsGeoJSONFeatureCollection(features []interface{}) repository.GeoJSONFeatureCollection {
+	if features == nil {
+		features = []interface{}{}
+	}
+	return repository.GeoJSONFeatureCollection{
+		Type: "FeatureCollection",
+		Features: features,
+	}
+}
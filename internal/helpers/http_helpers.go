@@ -12,6 +12,7 @@ type ErrorPayload struct {
 type ErrorDetails struct {
 	Message *string `json:"message"`
 	Type    string  `json:"type"`
+	Fields  interface{} `json:"fields,omitempty"`
 }
 
 func safeError(e error) *string {
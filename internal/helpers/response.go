@@ -43,5 +43,22 @@ func (c *ResponseWritingController) WriteErrorResponse(w http.ResponseWriter, st
 	c.WriteResponse(w, status, b)
 }
 
+// WriteFieldErrorResponse writes an error response that also lists the problem with each field of the request.
+func (c *ResponseWritingController) WriteFieldErrorResponse(w http.ResponseWriter, status int, message string, responseErr error, fields interface{}) {
+	payload := ErrorPayload{
+		Error: ErrorDetails{
+			Type:    message,
+			Message: safeError(responseErr),
+			Fields:  fields,
+		},
+	}
 
+	b, err := json.Marshal(payload)
+	if err != nil {
+		c.Logger.Println("Could not marshal error response payload", err)
+		c.WriteResponse(w, http.StatusInternalServerError, []byte(err.Error()))
+		return
+	}
 
+	c.WriteResponse(w, status, b)
+}
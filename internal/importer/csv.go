@@ -0,0 +1,296 @@
+package importer
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/lib/pq"
+)
+
+// NullCell is the literal written for a NULL value in exported location CSVs.
+const NullCell = "NULL"
+
+// The columns every row must have a value for.
+var requiredColumns = append([]string{"id"}, repository.RequiredLocationColumns...)
+
+// Timestamp layouts accepted in CSV cells, as written by Postgres and by encoding/json.
+var timeLayouts = []string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", time.RFC3339Nano}
+
+// Store writes a batch of locations, as repository.PolygonPostgresRepository.UpsertLocations does.
+type Store interface {
+	UpsertLocations(rows []repository.LocationRowNull) ([]error, error)
+}
+
+// RowError is a problem with one CSV row. Line is the 1-based line of the file, counting the header.
+type RowError struct {
+	Line   int    `json:"line"`
+	ID     string `json:"id,omitempty"`
+	Column string `json:"column,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Report describes an import. Rows counts data rows read; Imported and Rejected split them.
+type Report struct {
+	Rows     int        `json:"rows"`
+	Imported int        `json:"imported"`
+	Rejected int        `json:"rejected"`
+	DryRun   bool       `json:"dry_run"`
+	Errors   []RowError `json:"errors"`
+}
+
+// HeaderError reports a CSV whose header cannot be imported, in which case nothing is read.
+type HeaderError struct {
+	Reason string
+}
+
+func (e *HeaderError) Error() string {
+	return "invalid header: " + e.Reason
+}
+
+// A parsed row waiting to be written.
+type pendingRow struct {
+	line     int
+	location repository.LocationRowNull
+}
+
+// Importer reads store_locations rows from CSV and upserts them by id in batches.
+type Importer struct {
+	Store     Store
+	BatchSize int
+}
+
+func NewImporter(store Store, batchSize int) *Importer {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &Importer{Store: store, BatchSize: batchSize}
+}
+
+// Import validates every row and writes the valid ones, unless dryRun is set. Rows are rejected for unparseable
+// cells, missing required values, coordinates out of range and ids already seen earlier in the file.
+// A HeaderError is returned if the header is unusable; other errors stop the import part way through and the
+// report covers the rows handled so far.
+func (i *Importer) Import(input io.Reader, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun, Errors: []RowError{}}
+	reader := csv.NewReader(input)
+	reader.ReuseRecord = true
+
+	record, err := reader.Read()
+	if err == io.EOF {
+		return report, &HeaderError{"the file is empty"}
+	}
+	if err != nil {
+		return report, &HeaderError{err.Error()}
+	}
+	// The reader reuses its record slice, so the header is kept in a copy.
+	header := append([]string(nil), record...)
+	fields, err := columnFields(header)
+	if err != nil {
+		return report, err
+	}
+
+	seen := map[int]int{}
+	batch := make([]pendingRow, 0, i.BatchSize)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// FieldPos is only valid after a successful Read, so the line of a bad row comes from the error.
+			var parseError *csv.ParseError
+			if !errors.As(err, &parseError) {
+				return report, err
+			}
+			report.Rows++
+			report.reject(RowError{Line: parseError.StartLine, Reason: err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		report.Rows++
+
+		location, rowError := parseRow(header, fields, record)
+		if rowError != nil {
+			rowError.Line = line
+			report.reject(*rowError)
+			continue
+		}
+		if first, ok := seen[location.ID]; ok {
+			report.reject(RowError{Line: line, ID: strconv.Itoa(location.ID), Column: "id",
+				Reason: fmt.Sprintf("duplicate id, first seen on line %d", first)})
+			continue
+		}
+		seen[location.ID] = line
+
+		batch = append(batch, pendingRow{line, location})
+		if len(batch) == i.BatchSize {
+			if err := i.write(batch, &report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+	return report, i.write(batch, &report)
+}
+
+func (r *Report) reject(rowError RowError) {
+	r.Rejected++
+	r.Errors = append(r.Errors, rowError)
+}
+
+// Helper function to write a batch, or only count it on a dry run.
+func (i *Importer) write(batch []pendingRow, report *Report) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if report.DryRun {
+		report.Imported += len(batch)
+		return nil
+	}
+	locations := make([]repository.LocationRowNull, len(batch))
+	for j, row := range batch {
+		locations[j] = row.location
+	}
+	rowErrors, err := i.Store.UpsertLocations(locations)
+	if err != nil {
+		return fmt.Errorf("writing rows from line %d: %v", batch[0].line, err)
+	}
+	for j, rowErr := range rowErrors {
+		if rowErr != nil {
+			report.reject(RowError{Line: batch[j].line, ID: strconv.Itoa(batch[j].location.ID), Reason: rowErr.Error()})
+		} else {
+			report.Imported++
+		}
+	}
+	return nil
+}
+
+// Helper function to match each header column to a LocationRowNull field by its db tag.
+func columnFields(header []string) ([]int, error) {
+	fields := map[string]int{}
+	rowType := reflect.TypeOf(repository.LocationRowNull{})
+	for f := 0; f < rowType.NumField(); f++ {
+		fields[rowType.Field(f).Tag.Get("db")] = f
+	}
+
+	indexes := make([]int, len(header))
+	present := map[string]bool{}
+	for c, column := range header {
+		column = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+		header[c] = column
+		index, ok := fields[column]
+		if !ok {
+			return nil, &HeaderError{fmt.Sprintf("unknown column %q", column)}
+		}
+		if present[column] {
+			return nil, &HeaderError{fmt.Sprintf("column %q appears twice", column)}
+		}
+		present[column] = true
+		indexes[c] = index
+	}
+	for _, column := range requiredColumns {
+		if !present[column] {
+			return nil, &HeaderError{fmt.Sprintf("missing required column %q", column)}
+		}
+	}
+	return indexes, nil
+}
+
+// Helper function to parse one record, returning the first problem found.
+func parseRow(header []string, fields []int, record []string) (repository.LocationRowNull, *RowError) {
+	var location repository.LocationRowNull
+	row := reflect.ValueOf(&location).Elem()
+	id := ""
+	for c, cell := range record {
+		if header[c] == "id" {
+			id = cell
+		}
+	}
+
+	values := map[string]string{}
+	for c, cell := range record {
+		values[header[c]] = cell
+		// An empty cell is an empty string for text columns and NULL for any other type.
+		field := row.Field(fields[c])
+		if cell == NullCell || (strings.TrimSpace(cell) == "" && field.Type() != reflect.TypeOf(sql.NullString{})) {
+			continue
+		}
+		if err := setField(field, cell); err != nil {
+			return location, &RowError{ID: id, Column: header[c], Reason: err.Error()}
+		}
+	}
+	for _, column := range requiredColumns {
+		if value := strings.TrimSpace(values[column]); value == "" || value == NullCell {
+			return location, &RowError{ID: id, Column: column, Reason: "missing required value"}
+		}
+	}
+	coordinate := model.NewCoordinate(location.Longitude.Float64, location.Latitude.Float64)
+	if err := coordinate.Validate(); err != nil {
+		return location, &RowError{ID: id, Column: "longitude", Reason: err.Error()}
+	}
+	if coordinate.Lon() == 0 && coordinate.Lat() == 0 {
+		return location, &RowError{ID: id, Column: "longitude", Reason: "coordinates are 0, 0"}
+	}
+	if location.ID <= 0 {
+		return location, &RowError{ID: id, Column: "id", Reason: "id must be positive"}
+	}
+	// An empty time zone is not a zone, so it is taken as NULL: the store's state decides.
+	if strings.TrimSpace(location.TimeZone.String) == "" {
+		location.TimeZone = sql.NullString{}
+	} else if err := repository.ValidateTimeZone(location.TimeZone.String); err != nil {
+		return location, &RowError{ID: id, Column: "time_zone", Reason: err.Error()}
+	}
+	return location, nil
+}
+
+// Helper function to parse a cell into one of the field types used by LocationRowNull.
+func setField(field reflect.Value, cell string) error {
+	switch target := field.Addr().Interface().(type) {
+	case *int:
+		value, err := strconv.Atoi(strings.TrimSpace(cell))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", cell)
+		}
+		*target = value
+	case *sql.NullString:
+		*target = sql.NullString{String: cell, Valid: true}
+	case *sql.NullInt64:
+		value, err := strconv.ParseInt(strings.TrimSpace(cell), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", cell)
+		}
+		*target = sql.NullInt64{Int64: value, Valid: true}
+	case *sql.NullFloat64:
+		value, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", cell)
+		}
+		*target = sql.NullFloat64{Float64: value, Valid: true}
+	case *sql.NullBool:
+		value, err := strconv.ParseBool(strings.TrimSpace(cell))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", cell)
+		}
+		*target = sql.NullBool{Bool: value, Valid: true}
+	case *pq.NullTime:
+		for _, layout := range timeLayouts {
+			if value, err := time.Parse(layout, strings.TrimSpace(cell)); err == nil {
+				*target = pq.NullTime{Time: value, Valid: true}
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid timestamp %q", cell)
+	default:
+		return fmt.Errorf("unsupported column type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geofence/internal/repository"
+)
+
+// A Store that keeps every batch it is sent, rejects the ids in reject, and fails the batch numbered failBatch.
+type batchStore struct {
+	batches   [][]repository.LocationRowNull
+	reject    map[int]bool
+	failBatch int
+}
+
+func (s *batchStore) UpsertLocations(rows []repository.LocationRowNull) ([]error, error) {
+	if len(s.batches)+1 == s.failBatch {
+		return nil, errors.New("connection reset")
+	}
+	s.batches = append(s.batches, rows)
+	rowErrors := make([]error, len(rows))
+	for i, row := range rows {
+		if s.reject[row.ID] {
+			rowErrors[i] = errors.New("violates check constraint")
+		}
+	}
+	return rowErrors, nil
+}
+
+func TestImport(t *testing.T) {
+	input := strings.Join([]string{
+		"id,name,store_id,longitude,latitude,county,store_number,metro_id,active",
+		`1,Mission,7,-122.42,37.76,NULL,,,true`,
+		`2,Castro,7,-122.43,37.76,San Francisco,12,3,`,
+		`3,NULL,7,-122.43,37.76,,,,`,
+		`1,Mission again,7,-122.42,37.76,,,,`,
+		`4,Nowhere,7,200,37.76,,,,`,
+		`5,Null Island,7,0,0,,,,`,
+		`-6,Negative,7,-122.4,37.7,,,,`,
+		`7,Bad metro,7,-122.4,37.7,,,three,`,
+		`8,Short,7`,
+		`9,Rejected by the store,7,-122.4,37.7,,,,false`,
+		`10"486,Bare quote,7,-122.4,37.7,,,,`,
+		`11,After the bare quote,7,-122.4,37.7,,,,`,
+	}, "\n")
+	store := &batchStore{reject: map[int]bool{9: true}}
+	report, err := NewImporter(store, 2).Import(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantErrors := []RowError{
+		{Line: 4, ID: "3", Column: "name", Reason: "missing required value"},
+		{Line: 5, ID: "1", Column: "id", Reason: "duplicate id, first seen on line 2"},
+		{Line: 6, ID: "4", Column: "longitude"},
+		{Line: 7, ID: "5", Column: "longitude", Reason: "coordinates are 0, 0"},
+		{Line: 8, ID: "-6", Column: "id", Reason: "id must be positive"},
+		{Line: 9, ID: "7", Column: "metro_id", Reason: `invalid integer "three"`},
+		{Line: 10}, // the csv reader rejects the short row
+		{Line: 12, Reason: `parse error on line 12, column 3: bare " in non-quoted-field`},
+		// Rows the store rejects are reported once their batch is written.
+		{Line: 11, ID: "9", Reason: "violates check constraint"},
+	}
+	if report.Rows != 12 || report.Imported != 3 || report.Rejected != len(wantErrors) || len(report.Errors) != len(wantErrors) {
+		t.Fatalf("report = %+v", report)
+	}
+	for i, want := range wantErrors {
+		got := report.Errors[i]
+		if want.Reason == "" {
+			want.Reason = got.Reason
+		}
+		if got != want {
+			t.Errorf("error %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	// Valid rows are written in batches of two, with NULL and empty cells as the column type needs.
+	if len(store.batches) != 2 || len(store.batches[0]) != 2 || len(store.batches[1]) != 2 {
+		t.Fatalf("batches = %+v", store.batches)
+	}
+	mission, castro := store.batches[0][0], store.batches[0][1]
+	if mission.County.Valid || !mission.StoreNumber.Valid || mission.StoreNumber.String != "" || mission.MetroID.Valid ||
+		mission.Active != (sql.NullBool{Bool: true, Valid: true}) {
+		t.Errorf("Mission = %+v", mission)
+	}
+	if castro.County.String != "San Francisco" || castro.MetroID.Int64 != 3 || castro.Active.Valid || castro.Longitude.Float64 != -122.43 {
+		t.Errorf("Castro = %+v", castro)
+	}
+}
+
+func TestImportStoreFailure(t *testing.T) {
+	input := "id,name,store_id,longitude,latitude\n" +
+		"1,A,7,-122.4,37.7\n2,B,7,-122.4,37.7\n3,C,7,-122.4,37.7\n4,D,7,-122.4,37.7\n5,E,7,-122.4,37.7\n"
+	store := &batchStore{failBatch: 2}
+	report, err := NewImporter(store, 2).Import(strings.NewReader(input), false)
+	if err == nil || !strings.Contains(err.Error(), "writing rows from line 4") {
+		t.Fatalf("error = %v, want the failed batch", err)
+	}
+	// The report covers the batch written before the failure.
+	if report.Imported != 2 || report.Rows != 4 || len(store.batches) != 1 {
+		t.Errorf("report = %+v after %d batches", report, len(store.batches))
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	input := "id,name,store_id,longitude,latitude\n1,A,7,-122.4,37.7\n2,,7,-122.4,37.7\n"
+	store := &batchStore{}
+	report, err := NewImporter(store, 100).Import(strings.NewReader(input), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Report{Rows: 2, Imported: 1, Rejected: 1, DryRun: true,
+		Errors: []RowError{{Line: 3, ID: "2", Column: "name", Reason: "missing required value"}}}
+	if !reflect.DeepEqual(report, want) || len(store.batches) != 0 {
+		t.Errorf("report = %+v with %d batches written, want %+v and none", report, len(store.batches), want)
+	}
+}
+
+func TestImportHeader(t *testing.T) {
+	cases := map[string]string{
+		"id,name,store_id,longitude,latitude,polygon":  `unknown column "polygon"`,
+		"id,name,store_id,longitude,latitude,name":     `column "name" appears twice`,
+		"id,name,longitude,latitude":                   `missing required column "store_id"`,
+		"\ufeffid, name ,store_id,longitude,latitude,": `unknown column ""`,
+	}
+	for header, reason := range cases {
+		_, err := NewImporter(&batchStore{}, 10).Import(strings.NewReader(header+"\n1,A,7,-122.4,37.7\n"), false)
+		var headerError *HeaderError
+		if !errors.As(err, &headerError) || !strings.Contains(err.Error(), reason) {
+			t.Errorf("header %q: error = %v, want a HeaderError containing %q", header, err, reason)
+		}
+	}
+
+	if _, err := NewImporter(&batchStore{}, 10).Import(strings.NewReader(""), false); err == nil || err.Error() != "invalid header: the file is empty" {
+		t.Errorf("empty file: error = %v", err)
+	}
+
+	// A byte order mark and spaces around column names are ignored.
+	report, err := NewImporter(&batchStore{}, 10).Import(strings.NewReader("\ufeffid, name ,store_id,longitude,latitude\n1,A,7,-122.4,37.7\n"), false)
+	if err != nil || report.Imported != 1 {
+		t.Errorf("import with a byte order mark = %+v, %v", report, err)
+	}
+}
+
+func TestImportTimeZone(t *testing.T) {
+	input := "id,name,store_id,longitude,latitude,time_zone\n" +
+		"1,El Paso,7,-106.44,31.76,America/Denver\n2,Austin,7,-97.74,30.27,\n3,Nowhere,7,-97.74,30.27,America/Nowhere\n"
+	store := &batchStore{}
+	report, err := NewImporter(store, 10).Import(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantError := RowError{Line: 4, ID: "3", Column: "time_zone", Reason: `unknown time zone "America/Nowhere"`}
+	if report.Imported != 2 || len(report.Errors) != 1 || report.Errors[0] != wantError {
+		t.Fatalf("report = %+v", report)
+	}
+	// An empty time zone is NULL, leaving the store's state to decide.
+	rows := store.batches[0]
+	if rows[0].TimeZone != (sql.NullString{String: "America/Denver", Valid: true}) || rows[1].TimeZone.Valid {
+		t.Errorf("time zones = %+v, %+v", rows[0].TimeZone, rows[1].TimeZone)
+	}
+}
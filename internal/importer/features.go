@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+// The formats fences can be imported from.
+const (
+	GeoJSONFormat   = "geojson"
+	KMLFormat       = "kml"
+	ShapefileFormat = "shapefile"
+)
+
+// Feature is a polygon read from a fence file with its attributes. Index is its 1-based position in the file.
+// Properties hold attribute values as text, and Problem says why the feature cannot be imported, if it cannot.
+type Feature struct {
+	Index      int
+	Name       string
+	Properties map[string]string
+	Geometry   model.PolyGeometry
+	Problem    string
+}
+
+// FormatError reports a fence file that cannot be read at all, in which case nothing is imported.
+type FormatError struct {
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	return "invalid fence file: " + e.Reason
+}
+
+// ReadFeatures reads the features of a GeoJSON FeatureCollection, a KML or KMZ document, or a zipped Shapefile.
+// The format is detected from the content when it is empty.
+func ReadFeatures(data []byte, format string) ([]Feature, error) {
+	if format == "" {
+		format = detectFormat(data)
+	}
+	switch format {
+	case GeoJSONFormat:
+		return readGeoJSON(data)
+	case KMLFormat:
+		if bytes.HasPrefix(data, zipMagic) {
+			return readZip(data)
+		}
+		return readKML(data)
+	case ShapefileFormat:
+		return readZip(data)
+	}
+	return nil, &FormatError{"unknown format " + strconv.Quote(format)}
+}
+
+// The formats named by file extensions.
+var formatsByExtension = map[string]string{
+	".geojson": GeoJSONFormat,
+	".json":    GeoJSONFormat,
+	".kml":     KMLFormat,
+	".kmz":     KMLFormat,
+	".zip":     ShapefileFormat,
+}
+
+// FormatOfFile returns the format a file name's extension names, or an empty string if it names none.
+func FormatOfFile(name string) string {
+	return formatsByExtension[strings.ToLower(path.Ext(name))]
+}
+
+// Every zip archive, and so every zipped Shapefile and KMZ, starts with a local file header.
+var zipMagic = []byte("PK\x03\x04")
+
+// Helper function to guess the format of a file from its first bytes.
+func detectFormat(data []byte) string {
+	if bytes.HasPrefix(data, zipMagic) {
+		return ShapefileFormat
+	}
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\ufeff")), " \t\r\n")
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		return KMLFormat
+	}
+	return GeoJSONFormat
+}
+
+// Helper function to read a GeoJSON FeatureCollection. A feature's id is used as its "id" property when its
+// properties have none. Rings are oriented as RFC 7946 requires, which not every writer follows.
+func readGeoJSON(data []byte) ([]Feature, error) {
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			ID         interface{}            `json:"id"`
+			Geometry   json.RawMessage        `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	decoder.UseNumber()
+	err := decoder.Decode(&collection)
+	if err != nil {
+		return nil, &FormatError{"invalid GeoJSON: " + err.Error()}
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, &FormatError{"expected a GeoJSON FeatureCollection"}
+	}
+
+	features := make([]Feature, len(collection.Features))
+	for i, item := range collection.Features {
+		feature := Feature{Index: i + 1, Properties: map[string]string{}}
+		for name, value := range item.Properties {
+			if text, ok := propertyText(value); ok {
+				feature.Properties[name] = text
+			}
+		}
+		if _, ok := feature.Properties["id"]; !ok {
+			if text, ok := propertyText(item.ID); ok {
+				feature.Properties["id"] = text
+			}
+		}
+		feature.Name = feature.Properties["name"]
+
+		var probe struct {
+			Type string `json:"type"`
+		}
+		switch {
+		case len(item.Geometry) == 0 || string(item.Geometry) == "null":
+			feature.Problem = "feature has no geometry"
+		case json.Unmarshal(item.Geometry, &probe) != nil:
+			feature.Problem = "invalid geometry"
+		case probe.Type != model.PolygonType && probe.Type != model.MultiPolygonType:
+			feature.Problem = "geometry is a " + probe.Type + ", not a Polygon or MultiPolygon"
+		default:
+			err = json.Unmarshal(item.Geometry, &feature.Geometry)
+			if err != nil {
+				feature.Problem = "invalid geometry: " + err.Error()
+			}
+			for p, rings := range feature.Geometry.Polygons {
+				feature.Geometry.Polygons[p] = logic.OrientRings(rings, true)
+			}
+		}
+		features[i] = feature
+	}
+	return features, nil
+}
+
+// Helper function for the text of a scalar property value. Objects, arrays and null have none.
+func propertyText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+func TestReadKML(t *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document><Folder>
+  <Placemark id="p1">
+    <name>Mission</name>
+    <ExtendedData><Data name="store_id"><value>7</value></Data></ExtendedData>
+    <Polygon><outerBoundaryIs><LinearRing><coordinates>
+      0,0,0 0,1,0 1,1,0 1,0,0 0,0,0
+    </coordinates></LinearRing></outerBoundaryIs></Polygon>
+  </Placemark>
+  <Placemark><name>Pin</name><Point><coordinates>0,0</coordinates></Point></Placemark>
+</Folder></Document></kml>`
+
+	features, err := ReadFeatures([]byte(document), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 2 {
+		t.Fatalf("read %d features, want 2", len(features))
+	}
+	mission := features[0]
+	want := map[string]string{"id": "p1", "name": "Mission", "store_id": "7"}
+	if !reflect.DeepEqual(mission.Properties, want) || mission.Problem != "" {
+		t.Errorf("Mission = %+v, want properties %v", mission, want)
+	}
+	if _, reversed := logic.OrientGeometry(mission.Geometry); len(reversed) != 0 {
+		t.Errorf("clockwise KML ring was not turned anticlockwise: %q", reversed)
+	}
+	if features[1].Problem == "" {
+		t.Errorf("a Point placemark was accepted")
+	}
+}
+
+func TestReadShapefile(t *testing.T) {
+	// Shapefile exteriors are clockwise and holes anticlockwise.
+	exterior := []model.Coordinate{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}
+	hole := []model.Coordinate{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}}
+	other := []model.Coordinate{{20, 0}, {20, 1}, {21, 1}, {21, 0}, {20, 0}}
+	data := zipShapefile(t, [][][]model.Coordinate{{exterior, hole}, {exterior, other}}, []string{"7", "8.000"})
+
+	features, err := ReadFeatures(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 2 {
+		t.Fatalf("read %d features, want 2", len(features))
+	}
+	if features[0].Properties["STORE_ID"] != "7" || features[1].Properties["STORE_ID"] != "8" {
+		t.Errorf("properties = %v, %v", features[0].Properties, features[1].Properties)
+	}
+	if polygon := features[0].Geometry; polygon.Type != model.PolygonType || len(polygon.Polygons) != 1 || len(polygon.Polygons[0]) != 2 {
+		t.Errorf("shape with a hole = %+v", polygon)
+	}
+	if multi := features[1].Geometry; multi.Type != model.MultiPolygonType || len(multi.Polygons) != 2 {
+		t.Errorf("shape with two exteriors = %+v", multi)
+	}
+	for _, feature := range features {
+		if err := logic.ValidateGeometry(feature.Geometry); err != nil {
+			t.Errorf("feature %d: %v", feature.Index, err)
+		}
+		if _, reversed := logic.OrientGeometry(feature.Geometry); len(reversed) != 0 {
+			t.Errorf("feature %d: rings not oriented: %q", feature.Index, reversed)
+		}
+	}
+}
+
+func TestReadGeoJSON(t *testing.T) {
+	// The exterior is clockwise and the hole anticlockwise, the opposite of what RFC 7946 requires.
+	collection := `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "id": 7, "properties": {"name": "Mission"}, "geometry": {"type": "Polygon", "coordinates": [
+			[[0, 0], [0, 10], [10, 10], [10, 0], [0, 0]],
+			[[2, 2], [4, 2], [4, 4], [2, 4], [2, 2]]
+		]}},
+		{"type": "Feature", "properties": {"id": "8"}, "geometry": {"type": "Point", "coordinates": [0, 0]}}
+	]}`
+
+	features, err := ReadFeatures([]byte(collection), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 2 {
+		t.Fatalf("read %d features, want 2", len(features))
+	}
+	mission := features[0]
+	if want := map[string]string{"id": "7", "name": "Mission"}; !reflect.DeepEqual(mission.Properties, want) || mission.Problem != "" {
+		t.Errorf("Mission = %+v, want properties %v", mission, want)
+	}
+	want := model.NewPolygon(
+		[]model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+		[]model.Coordinate{{2, 2}, {2, 4}, {4, 4}, {4, 2}, {2, 2}},
+	)
+	if !reflect.DeepEqual(mission.Geometry, want) {
+		t.Errorf("Mission geometry = %v, want %v", mission.Geometry.Polygons, want.Polygons)
+	}
+	if features[1].Problem == "" {
+		t.Errorf("a Point feature was accepted")
+	}
+}
+
+// Builds a zipped Shapefile of polygon shapes, each a list of rings, with a numeric STORE_ID attribute.
+func zipShapefile(t *testing.T, shapes [][][]model.Coordinate, storeIDs []string) []byte {
+	var shp bytes.Buffer
+	shp.Write(make([]byte, 100))
+	for s, rings := range shapes {
+		var content bytes.Buffer
+		points := 0
+		for _, ring := range rings {
+			points += len(ring)
+		}
+		binary.Write(&content, binary.LittleEndian, int32(shapePolygon))
+		content.Write(make([]byte, 32))
+		binary.Write(&content, binary.LittleEndian, int32(len(rings)))
+		binary.Write(&content, binary.LittleEndian, int32(points))
+		start := 0
+		for _, ring := range rings {
+			binary.Write(&content, binary.LittleEndian, int32(start))
+			start += len(ring)
+		}
+		for _, ring := range rings {
+			for _, position := range ring {
+				binary.Write(&content, binary.LittleEndian, math.Float64bits(position.Lon()))
+				binary.Write(&content, binary.LittleEndian, math.Float64bits(position.Lat()))
+			}
+		}
+		binary.Write(&shp, binary.BigEndian, int32(s+1))
+		binary.Write(&shp, binary.BigEndian, int32(content.Len()/2))
+		shp.Write(content.Bytes())
+	}
+	header := shp.Bytes()
+	binary.BigEndian.PutUint32(header[0:4], 9994)
+	binary.LittleEndian.PutUint32(header[32:36], shapePolygon)
+
+	var dbf bytes.Buffer
+	dbf.Write([]byte{3, 124, 1, 1})
+	binary.Write(&dbf, binary.LittleEndian, uint32(len(storeIDs)))
+	binary.Write(&dbf, binary.LittleEndian, uint16(32+32+1))
+	binary.Write(&dbf, binary.LittleEndian, uint16(1+10))
+	dbf.Write(make([]byte, 20))
+	descriptor := make([]byte, 32)
+	copy(descriptor, "STORE_ID")
+	descriptor[11] = 'N'
+	descriptor[16] = 10
+	dbf.Write(descriptor)
+	dbf.WriteByte(0x0D)
+	for _, storeID := range storeIDs {
+		dbf.WriteString(" " + string(bytes.Repeat([]byte(" "), 10-len(storeID))) + storeID)
+	}
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for name, content := range map[string][]byte{"fences.shp": shp.Bytes(), "fences.dbf": dbf.Bytes()} {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Bytes()
+}
@@ -0,0 +1,284 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+// What a fence import does to a location's polygon, or that it rejected the feature.
+const (
+	FenceCreated   = "created"
+	FenceUpdated   = "updated"
+	FenceUnchanged = "unchanged"
+	FenceRejected  = "rejected"
+)
+
+// Positions closer than this in both coordinates are the same, so that fences that went through PostGIS, which
+// keeps fewer digits than a file may have, are not reported as updated.
+const fenceTolerance = 1e-9
+
+// FenceStore finds locations and saves polygons, as repository.PolygonRepository does.
+type FenceStore interface {
+	FindLocations(filter repository.LocationFilter) ([]repository.PolyLocationResponseCleaned, error)
+	MakeValid(polygonObject model.PolyGeometry) (model.PolyGeometry, error)
+	SavePolygons(polygons map[int]model.PolyGeometry, change repository.PolygonChange) ([]repository.PolygonVersion, []int, error)
+}
+
+// FenceOptions controls a fence import. Features are matched to locations by the Key column, whose value each
+// feature has in its Property attribute, Key by default. Repair normalizes and makes valid geometries as
+// /polygons/{id}?repair=true does; rings that wind the wrong way are reversed either way. Nothing is written on a
+// dry run.
+type FenceOptions struct {
+	Key      string
+	Property string
+	Repair   bool
+	DryRun   bool
+	Change   repository.PolygonChange
+}
+
+// FenceResult is what an import does with one feature. Reason says why it was rejected, and Version is the
+// polygon version written once it is applied.
+type FenceResult struct {
+	Feature    int      `json:"feature"`
+	Name       string   `json:"name,omitempty"`
+	Key        string   `json:"key,omitempty"`
+	LocationID int      `json:"location_id,omitempty"`
+	Change     string   `json:"change"`
+	Repairs    []string `json:"repairs,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	Version    int      `json:"version,omitempty"`
+}
+
+// FenceReport describes a fence import as a diff of the fences it creates, updates and leaves unchanged. An import
+// is applied only if no feature is rejected, and then every change is written at once.
+type FenceReport struct {
+	Features  int           `json:"features"`
+	Created   int           `json:"created"`
+	Updated   int           `json:"updated"`
+	Unchanged int           `json:"unchanged"`
+	Rejected  int           `json:"rejected"`
+	DryRun    bool          `json:"dry_run"`
+	Applied   bool          `json:"applied"`
+	Fences    []FenceResult `json:"fences"`
+}
+
+// FenceImporter imports polygons for existing locations from GeoJSON, KML and Shapefiles.
+type FenceImporter struct {
+	Store FenceStore
+}
+
+func NewFenceImporter(store FenceStore) *FenceImporter {
+	return &FenceImporter{Store: store}
+}
+
+// Import reads the features of a fence file, as ReadFeatures does, and matches each to a location to work out the
+// change it makes. Unless it is a dry run, the changes are then written at once if no feature was rejected.
+// A FormatError is returned if the file cannot be read; other errors are the store's.
+func (i *FenceImporter) Import(data []byte, format string, options FenceOptions) (FenceReport, error) {
+	report := FenceReport{DryRun: options.DryRun, Fences: []FenceResult{}}
+	if options.Key == "" {
+		options.Key = "id"
+	}
+	if options.Property == "" {
+		options.Property = options.Key
+	}
+	if !repository.IsLocationColumn(options.Key) {
+		return report, &FormatError{fmt.Sprintf("unknown location column %q to match features on", options.Key)}
+	}
+	features, err := ReadFeatures(data, format)
+	if err != nil {
+		return report, err
+	}
+
+	polygons := map[int]model.PolyGeometry{}
+	matched := map[int]int{}
+	for _, feature := range features {
+		result := FenceResult{Feature: feature.Index, Name: feature.Name}
+		key, ok := featureProperty(feature, options.Property)
+		result.Key = key
+		switch {
+		case feature.Problem != "":
+			result.Reason = feature.Problem
+		case !ok:
+			result.Reason = fmt.Sprintf("feature has no %q property", options.Property)
+		default:
+			var geometry model.PolyGeometry
+			geometry, err = i.match(feature, key, options, &result)
+			if err != nil {
+				return report, err
+			}
+			if first, ok := matched[result.LocationID]; ok && result.Reason == "" {
+				result.Reason = fmt.Sprintf("location %d is also matched by feature %d", result.LocationID, first)
+			}
+			if result.Reason == "" {
+				matched[result.LocationID] = feature.Index
+				if result.Change != FenceUnchanged {
+					polygons[result.LocationID] = geometry
+				}
+			}
+		}
+		report.add(result)
+	}
+
+	if report.DryRun || report.Rejected > 0 || len(polygons) == 0 {
+		return report, nil
+	}
+	versions, missing, err := i.Store.SavePolygons(polygons, options.Change)
+	if err != nil {
+		return report, err
+	}
+	if len(missing) > 0 {
+		report.reject(missing)
+		return report, nil
+	}
+	report.Applied = true
+	written := map[int]int{}
+	for _, version := range versions {
+		written[version.PolygonID] = version.Version
+	}
+	for f := range report.Fences {
+		report.Fences[f].Version = written[report.Fences[f].LocationID]
+	}
+	return report, nil
+}
+
+// Helper function to find the location a feature is for and check its geometry, recording the change it makes in
+// result, or why it cannot be made. Returns the geometry to store.
+func (i *FenceImporter) match(feature Feature, key string, options FenceOptions, result *FenceResult) (model.PolyGeometry, error) {
+	value, err := repository.LocationValueJSON(options.Key, key)
+	if err != nil {
+		result.Reason = err.Error()
+		return model.PolyGeometry{}, nil
+	}
+	locations, err := i.Store.FindLocations(repository.LocationFilter{
+		Where: &repository.Condition{Field: options.Key, Op: "eq", Value: value},
+	})
+	if err != nil {
+		return model.PolyGeometry{}, err
+	}
+	if len(locations) != 1 {
+		result.Reason = fmt.Sprintf("no location has %s %s", options.Key, key)
+		if len(locations) > 1 {
+			result.Reason = fmt.Sprintf("%d locations have %s %s", len(locations), options.Key, key)
+		}
+		return model.PolyGeometry{}, nil
+	}
+	location := locations[0]
+	result.LocationID = location.ID
+
+	geometry := feature.Geometry
+	if options.Repair {
+		geometry, result.Repairs = logic.RepairGeometry(geometry)
+		if logic.SelfIntersects(geometry) {
+			valid, err := i.Store.MakeValid(geometry)
+			if err != nil {
+				return model.PolyGeometry{}, err
+			}
+			geometry, _ = logic.RepairGeometry(valid)
+			result.Repairs = append(result.Repairs, "split self-intersecting rings into valid polygons")
+		}
+	}
+	geometry, reversed := logic.OrientGeometry(geometry)
+	result.Repairs = append(result.Repairs, reversed...)
+	if err := logic.ValidateGeometry(geometry); err != nil {
+		result.Reason = err.Error()
+		return model.PolyGeometry{}, nil
+	}
+
+	result.Change = FenceCreated
+	if location.Polygon != "" {
+		var current model.PolyGeometry
+		if err := json.Unmarshal([]byte(location.Polygon), &current); err != nil {
+			return model.PolyGeometry{}, err
+		}
+		result.Change = FenceUpdated
+		if sameGeometry(current, geometry) {
+			result.Change = FenceUnchanged
+		}
+	}
+	return geometry, nil
+}
+
+// Helper function to look up a feature's property, ignoring case if no property matches exactly, as Shapefile
+// attribute names are often upper case.
+func featureProperty(feature Feature, name string) (string, bool) {
+	if value, ok := feature.Properties[name]; ok {
+		return value, true
+	}
+	for property, value := range feature.Properties {
+		if strings.EqualFold(property, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Helper function to compare two geometries position by position, within fenceTolerance.
+func sameGeometry(a, b model.PolyGeometry) bool {
+	if a.Type != b.Type || len(a.Polygons) != len(b.Polygons) {
+		return false
+	}
+	for p := range a.Polygons {
+		if len(a.Polygons[p]) != len(b.Polygons[p]) {
+			return false
+		}
+		for r := range a.Polygons[p] {
+			if len(a.Polygons[p][r]) != len(b.Polygons[p][r]) {
+				return false
+			}
+			for i, position := range a.Polygons[p][r] {
+				other := b.Polygons[p][r][i]
+				if math.Abs(position.Lon()-other.Lon()) > fenceTolerance || math.Abs(position.Lat()-other.Lat()) > fenceTolerance {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (r *FenceReport) add(result FenceResult) {
+	if result.Reason != "" {
+		result.Change = FenceRejected
+	}
+	r.Features++
+	switch result.Change {
+	case FenceCreated:
+		r.Created++
+	case FenceUpdated:
+		r.Updated++
+	case FenceUnchanged:
+		r.Unchanged++
+	case FenceRejected:
+		r.Rejected++
+	}
+	r.Fences = append(r.Fences, result)
+}
+
+// Helper function to reject the features for locations that were deleted after they were matched, when nothing
+// was written because of them.
+func (r *FenceReport) reject(missing []int) {
+	sort.Ints(missing)
+	for f, result := range r.Fences {
+		j := sort.SearchInts(missing, result.LocationID)
+		if result.Change == FenceRejected || j == len(missing) || missing[j] != result.LocationID {
+			continue
+		}
+		switch result.Change {
+		case FenceCreated:
+			r.Created--
+		case FenceUpdated:
+			r.Updated--
+		}
+		r.Rejected++
+		r.Fences[f].Change = FenceRejected
+		r.Fences[f].Reason = fmt.Sprintf("location %d was deleted during the import", result.LocationID)
+	}
+}
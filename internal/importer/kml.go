@@ -0,0 +1,148 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+// A KML Placemark, with the attributes and geometries a fence can be read from. Elements match in any namespace.
+type kmlPlacemark struct {
+	ID          string             `xml:"id,attr"`
+	Name        string             `xml:"name"`
+	Data        []kmlData          `xml:"ExtendedData>Data"`
+	SimpleData  []kmlSimpleData    `xml:"ExtendedData>SchemaData>SimpleData"`
+	Polygons    []kmlPolygon       `xml:"Polygon"`
+	Multi       []kmlMultiGeometry `xml:"MultiGeometry"`
+	Points      []struct{}         `xml:"Point"`
+	LineStrings []struct{}         `xml:"LineString"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlSimpleData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type kmlMultiGeometry struct {
+	Polygons []kmlPolygon       `xml:"Polygon"`
+	Multi    []kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+type kmlPolygon struct {
+	Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+// Helper function to read every Placemark of a KML document, however deeply it is nested in folders. A Placemark's
+// name is its "name" property and its id attribute its "id" property, unless its extended data sets them.
+func readKML(data []byte) ([]Feature, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var features []Feature
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &FormatError{"invalid KML: " + err.Error()}
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+		var placemark kmlPlacemark
+		err = decoder.DecodeElement(&placemark, &start)
+		if err != nil {
+			return nil, &FormatError{"invalid KML: " + err.Error()}
+		}
+		features = append(features, placemark.feature(len(features)+1))
+	}
+	if features == nil {
+		return nil, &FormatError{"the KML has no placemarks"}
+	}
+	return features, nil
+}
+
+// Helper function to convert a Placemark to a Feature. Its polygons, including those in multi-geometries, make a
+// Polygon if there is one and a MultiPolygon otherwise.
+func (p kmlPlacemark) feature(index int) Feature {
+	feature := Feature{Index: index, Name: strings.TrimSpace(p.Name), Properties: map[string]string{}}
+	if p.ID != "" {
+		feature.Properties["id"] = p.ID
+	}
+	if feature.Name != "" {
+		feature.Properties["name"] = feature.Name
+	}
+	for _, data := range p.Data {
+		feature.Properties[data.Name] = strings.TrimSpace(data.Value)
+	}
+	for _, data := range p.SimpleData {
+		feature.Properties[data.Name] = strings.TrimSpace(data.Value)
+	}
+
+	polygons := p.Polygons
+	for len(p.Multi) > 0 {
+		multi := p.Multi[0]
+		p.Multi = append(p.Multi[1:], multi.Multi...)
+		polygons = append(polygons, multi.Polygons...)
+	}
+	if len(polygons) == 0 {
+		switch {
+		case len(p.Points) > 0:
+			feature.Problem = "geometry is a Point, not a Polygon or MultiPolygon"
+		case len(p.LineStrings) > 0:
+			feature.Problem = "geometry is a LineString, not a Polygon or MultiPolygon"
+		default:
+			feature.Problem = "placemark has no polygon"
+		}
+		return feature
+	}
+
+	feature.Geometry = model.PolyGeometry{Type: model.PolygonType}
+	if len(polygons) > 1 {
+		feature.Geometry.Type = model.MultiPolygonType
+	}
+	for i, polygon := range polygons {
+		var rings [][]model.Coordinate
+		for _, text := range append([]string{polygon.Outer}, polygon.Inner...) {
+			ring, err := parsePositions(text)
+			if err != nil {
+				feature.Problem = fmt.Sprintf("polygon %d: %v", i+1, err)
+				return feature
+			}
+			rings = append(rings, ring)
+		}
+		feature.Geometry.Polygons = append(feature.Geometry.Polygons, logic.OrientRings(rings, true))
+	}
+	return feature
+}
+
+// Helper function to parse whitespace separated positions of comma separated numbers, as KML coordinates are
+// written. Altitudes are dropped.
+func parsePositions(text string) ([]model.Coordinate, error) {
+	var ring []model.Coordinate
+	for _, tuple := range strings.Fields(text) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid coordinates %q", tuple)
+		}
+		lon, lonErr := strconv.ParseFloat(parts[0], 64)
+		lat, latErr := strconv.ParseFloat(parts[1], 64)
+		if lonErr != nil || latErr != nil {
+			return nil, fmt.Errorf("invalid coordinates %q", tuple)
+		}
+		ring = append(ring, model.NewCoordinate(lon, lat))
+	}
+	return ring, nil
+}
@@ -0,0 +1,266 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+// Shapefile shape types that hold polygons. Z and M values are ignored.
+const (
+	shapeNull     = 0
+	shapePolygon  = 5
+	shapePolygonZ = 15
+	shapePolygonM = 25
+)
+
+// Helper function to read a zip holding a Shapefile, or a KMZ holding a KML document. A Shapefile needs its .shp and
+// .dbf members; its .prj, if any, must describe geographic coordinates, as projected ones cannot be converted.
+func readZip(data []byte) ([]Feature, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, &FormatError{"invalid zip: " + err.Error()}
+	}
+	members := map[string][]*zip.File{}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		extension := strings.ToLower(path.Ext(file.Name))
+		members[extension] = append(members[extension], file)
+	}
+
+	switch {
+	case len(members[".shp"]) > 1:
+		return nil, &FormatError{fmt.Sprintf("the zip holds %d shapefiles; import them one at a time", len(members[".shp"]))}
+	case len(members[".shp"]) == 0 && len(members[".kml"]) > 0:
+		document, err := readMember(members[".kml"][0])
+		if err != nil {
+			return nil, err
+		}
+		return readKML(document)
+	case len(members[".shp"]) == 0:
+		return nil, &FormatError{"the zip holds no .shp file"}
+	case len(members[".dbf"]) != 1:
+		return nil, &FormatError{"the zip must hold the shapefile's .dbf file"}
+	}
+	if len(members[".prj"]) > 0 {
+		projection, err := readMember(members[".prj"][0])
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(projection, []byte("PROJCS")) {
+			return nil, &FormatError{"the shapefile has projected coordinates; export it in WGS 84 (EPSG:4326)"}
+		}
+	}
+
+	shapes, err := readMember(members[".shp"][0])
+	if err != nil {
+		return nil, err
+	}
+	table, err := readMember(members[".dbf"][0])
+	if err != nil {
+		return nil, err
+	}
+	features, err := readShapes(shapes)
+	if err != nil {
+		return nil, err
+	}
+	records, deleted, err := readDBF(table)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != len(features) {
+		return nil, &FormatError{fmt.Sprintf("the .shp has %d shapes but the .dbf has %d records", len(features), len(records))}
+	}
+
+	var kept []Feature
+	for i, feature := range features {
+		if deleted[i] {
+			continue
+		}
+		feature.Properties = records[i]
+		feature.Name = records[i]["name"]
+		kept = append(kept, feature)
+	}
+	return kept, nil
+}
+
+func readMember(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, &FormatError{"cannot open " + file.Name + ": " + err.Error()}
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, &FormatError{"cannot read " + file.Name + ": " + err.Error()}
+	}
+	return data, nil
+}
+
+// Helper function to read the shapes of a .shp file, in record order.
+func readShapes(data []byte) ([]Feature, error) {
+	if len(data) < 100 || binary.BigEndian.Uint32(data[0:4]) != 9994 {
+		return nil, &FormatError{"the .shp file has no shapefile header"}
+	}
+	var features []Feature
+	for offset := 100; offset+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset+4:offset+8])) * 2
+		start := offset + 8
+		if length < 4 || start+length > len(data) {
+			return nil, &FormatError{fmt.Sprintf("shape %d is truncated", len(features)+1)}
+		}
+		feature := Feature{Index: len(features) + 1}
+		geometry, problem := readPolygonShape(data[start : start+length])
+		if problem != "" {
+			feature.Problem = problem
+		} else {
+			feature.Geometry = geometry
+		}
+		features = append(features, feature)
+		offset = start + length
+	}
+	return features, nil
+}
+
+// Helper function to read one polygon record. Shapefiles list rings without saying which polygon they belong to:
+// exteriors are clockwise and holes anticlockwise, and each hole belongs to the exterior around it.
+func readPolygonShape(content []byte) (model.PolyGeometry, string) {
+	shapeType := binary.LittleEndian.Uint32(content[0:4])
+	switch shapeType {
+	case shapeNull:
+		return model.PolyGeometry{}, "feature has no geometry"
+	case shapePolygon, shapePolygonZ, shapePolygonM:
+	default:
+		return model.PolyGeometry{}, fmt.Sprintf("shape type %d is not a polygon", shapeType)
+	}
+	if len(content) < 44 {
+		return model.PolyGeometry{}, "polygon record is truncated"
+	}
+	numParts := int(binary.LittleEndian.Uint32(content[36:40]))
+	numPoints := int(binary.LittleEndian.Uint32(content[40:44]))
+	pointsStart := 44 + 4*numParts
+	if numParts < 1 || numPoints < 1 || pointsStart+16*numPoints > len(content) {
+		return model.PolyGeometry{}, "polygon record is truncated"
+	}
+
+	var exteriors, holes [][]model.Coordinate
+	for part := 0; part < numParts; part++ {
+		first := int(binary.LittleEndian.Uint32(content[44+4*part:]))
+		last := numPoints
+		if part+1 < numParts {
+			last = int(binary.LittleEndian.Uint32(content[44+4*(part+1):]))
+		}
+		if first < 0 || first > last || last > numPoints {
+			return model.PolyGeometry{}, "polygon record has invalid parts"
+		}
+		ring := make([]model.Coordinate, 0, last-first)
+		for i := first; i < last; i++ {
+			x := math.Float64frombits(binary.LittleEndian.Uint64(content[pointsStart+16*i:]))
+			y := math.Float64frombits(binary.LittleEndian.Uint64(content[pointsStart+16*i+8:]))
+			ring = append(ring, model.NewCoordinate(x, y))
+		}
+		if logic.SignedArea(ring) > 0 {
+			holes = append(holes, ring)
+		} else {
+			exteriors = append(exteriors, ring)
+		}
+	}
+	// Some writers get the orientation backwards; with no clockwise ring, every ring is taken as an exterior.
+	if len(exteriors) == 0 {
+		exteriors, holes = holes, nil
+	}
+
+	polygons := make([][][]model.Coordinate, len(exteriors))
+	for i, exterior := range exteriors {
+		polygons[i] = [][]model.Coordinate{exterior}
+	}
+	for _, hole := range holes {
+		owner := 0
+		for i, exterior := range exteriors {
+			if logic.InPoly(hole[0], exterior) {
+				owner = i
+				break
+			}
+		}
+		polygons[owner] = append(polygons[owner], hole)
+	}
+	geometry := model.PolyGeometry{Type: model.PolygonType}
+	if len(polygons) > 1 {
+		geometry.Type = model.MultiPolygonType
+	}
+	for _, rings := range polygons {
+		geometry.Polygons = append(geometry.Polygons, logic.OrientRings(rings, true))
+	}
+	return geometry, ""
+}
+
+// Helper function to read the records of a dBASE table as text by column name, with whether each is marked deleted.
+// Numbers are written in their shortest form, so 7.000 is "7", and empty values are left out.
+func readDBF(data []byte) ([]map[string]string, []bool, error) {
+	if len(data) < 32 {
+		return nil, nil, &FormatError{"the .dbf file has no header"}
+	}
+	count := int(binary.LittleEndian.Uint32(data[4:8]))
+	headerLength := int(binary.LittleEndian.Uint16(data[8:10]))
+	recordLength := int(binary.LittleEndian.Uint16(data[10:12]))
+
+	type column struct {
+		name   string
+		kind   byte
+		offset int
+		length int
+	}
+	var columns []column
+	offset := 1
+	for descriptor := 32; descriptor+32 <= headerLength && descriptor < len(data) && data[descriptor] != 0x0D; descriptor += 32 {
+		name := string(bytes.TrimRight(data[descriptor:descriptor+11], "\x00"))
+		length := int(data[descriptor+16])
+		columns = append(columns, column{name, data[descriptor+11], offset, length})
+		offset += length
+	}
+	if offset > recordLength || headerLength+count*recordLength > len(data) {
+		return nil, nil, &FormatError{"the .dbf file is truncated"}
+	}
+
+	records := make([]map[string]string, count)
+	deleted := make([]bool, count)
+	for r := 0; r < count; r++ {
+		record := data[headerLength+r*recordLength : headerLength+(r+1)*recordLength]
+		deleted[r] = record[0] == '*'
+		values := map[string]string{}
+		for _, column := range columns {
+			value := strings.TrimSpace(string(record[column.offset : column.offset+column.length]))
+			switch column.kind {
+			case 'N', 'F':
+				if number, err := strconv.ParseFloat(value, 64); err == nil {
+					value = strconv.FormatFloat(number, 'f', -1, 64)
+				}
+			case 'L':
+				switch strings.ToUpper(value) {
+				case "T", "Y":
+					value = "true"
+				case "F", "N":
+					value = "false"
+				default:
+					value = ""
+				}
+			}
+			if value != "" {
+				values[column.name] = value
+			}
+		}
+		records[r] = values
+	}
+	return records, deleted, nil
+}
@@ -0,0 +1,210 @@
+package index
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/pkg/errors"
+)
+
+// Fence is a stored polygon together with the location it belongs to.
+type Fence struct {
+	Location repository.PolyLocationResponseCleaned
+	Geometry model.PolyGeometry
+	Bounds   Bounds
+}
+
+// Source provides the fences loaded into a FenceIndex.
+type Source interface {
+	GetAllFences() ([]repository.PolyLocationResponseCleaned, error)
+	GetPolyLocationFromID(id int) ([]repository.PolyLocationResponseCleaned, error)
+}
+
+// FenceIndex holds every stored fence in memory so that membership can be answered without a database round trip.
+// Reads never block on a write: writes build a new snapshot, tree included, outside of anything readers wait on,
+// then swap it in.
+type FenceIndex struct {
+	source Source
+	logger log.Logger
+	// Serializes writes so that one cannot swap in a snapshot built without another's change.
+	writeMutex sync.Mutex
+	current    atomic.Pointer[snapshot]
+}
+
+// The fences in a FenceIndex at one moment. A snapshot is never changed once it has been swapped in.
+type snapshot struct {
+	fences  map[int]*Fence
+	tree    *node
+	skipped int
+}
+
+// Helper function to build a snapshot of the fences, with a tree over them.
+func newSnapshot(fences map[int]*Fence, skipped int) *snapshot {
+	list := make([]*Fence, 0, len(fences))
+	for _, fence := range fences {
+		list = append(list, fence)
+	}
+	return &snapshot{fences: fences, tree: buildTree(list), skipped: skipped}
+}
+
+func NewFenceIndex(source Source, logger log.Logger) *FenceIndex {
+	fenceIndex := &FenceIndex{
+		source: source,
+		logger: logger,
+	}
+	fenceIndex.current.Store(newSnapshot(map[int]*Fence{}, 0))
+	return fenceIndex
+}
+
+// Helper function to parse a location's GeoJSON polygon into a Fence.
+func newFence(location repository.PolyLocationResponseCleaned) (*Fence, error) {
+	var geometry model.PolyGeometry
+	err := json.Unmarshal([]byte(location.Polygon), &geometry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid polygon for location %d", location.ID)
+	}
+	return &Fence{
+		Location: location,
+		Geometry: geometry,
+		Bounds:   BoundsOf(geometry),
+	}, nil
+}
+
+// Load replaces the contents of the index with every fence in the source. A polygon that cannot be parsed is
+// logged and left out rather than failing the load, so one bad row cannot keep the rest of the fences out.
+func (i *FenceIndex) Load() error {
+	locations, err := i.source.GetAllFences()
+	if err != nil {
+		return errors.Wrap(err, "failed loading fences")
+	}
+	fences := make(map[int]*Fence, len(locations))
+	skipped := 0
+	for _, location := range locations {
+		fence, err := newFence(location)
+		if err != nil {
+			i.logger.Println("Skipping fence", err)
+			skipped++
+			continue
+		}
+		fences[location.ID] = fence
+	}
+
+	next := newSnapshot(fences, skipped)
+	i.writeMutex.Lock()
+	defer i.writeMutex.Unlock()
+	i.current.Store(next)
+	return nil
+}
+
+// Refresh reloads a single fence from the source, removing it if it no longer has a polygon.
+func (i *FenceIndex) Refresh(id int) error {
+	locations, err := i.source.GetPolyLocationFromID(id)
+	if err != nil {
+		return errors.Wrapf(err, "failed loading fence %d", id)
+	}
+	if len(locations) == 0 || locations[0].Polygon == "" {
+		i.Remove(id)
+		return nil
+	}
+	fence, err := newFence(locations[0])
+	if err != nil {
+		return err
+	}
+
+	i.update(func(fences map[int]*Fence) bool {
+		fences[id] = fence
+		return true
+	})
+	return nil
+}
+
+// Remove drops a fence from the index.
+func (i *FenceIndex) Remove(id int) {
+	i.update(func(fences map[int]*Fence) bool {
+		if _, ok := fences[id]; !ok {
+			return false
+		}
+		delete(fences, id)
+		return true
+	})
+}
+
+// Helper function to apply a change to a copy of the current fences and swap in a snapshot of the result.
+// The change returns false to leave the index as it is.
+func (i *FenceIndex) update(change func(fences map[int]*Fence) bool) {
+	i.writeMutex.Lock()
+	defer i.writeMutex.Unlock()
+	current := i.current.Load()
+	fences := make(map[int]*Fence, len(current.fences)+1)
+	for id, fence := range current.fences {
+		fences[id] = fence
+	}
+	if change(fences) {
+		i.current.Store(newSnapshot(fences, current.skipped))
+	}
+}
+
+// Get returns the fence with the given location ID.
+func (i *FenceIndex) Get(id int) (Fence, bool) {
+	fence, ok := i.current.Load().fences[id]
+	if !ok {
+		return Fence{}, false
+	}
+	return *fence, true
+}
+
+// Len returns the number of fences in the index.
+func (i *FenceIndex) Len() int {
+	return len(i.current.Load().fences)
+}
+
+// Skipped returns the number of fences the last Load left out because their polygon could not be parsed.
+func (i *FenceIndex) Skipped() int {
+	return i.current.Load().skipped
+}
+
+// Filter narrows the fences returned by a lookup. Zero values match every fence.
+type Filter struct {
+	StoreID int64 `json:"store_id"`
+	MetroID int64 `json:"metro_id"`
+	ZoneID  int64 `json:"zone_id"`
+	Active  *bool `json:"active"`
+}
+
+// Matches reports whether a location satisfies every field set on the filter.
+func (f Filter) Matches(location repository.PolyLocationResponseCleaned) bool {
+	if f.StoreID != 0 && location.StoreID != f.StoreID {
+		return false
+	}
+	if f.MetroID != 0 && location.MetroID != f.MetroID {
+		return false
+	}
+	if f.ZoneID != 0 && location.ZoneID != f.ZoneID {
+		return false
+	}
+	if f.Active != nil && location.Active != *f.Active {
+		return false
+	}
+	return true
+}
+
+// Containing returns every fence matching the filter that contains the point,
+// including fences it lies on the boundary of, ordered by ID.
+func (i *FenceIndex) Containing(point model.Coordinate, filter Filter) []Fence {
+	results := []Fence{}
+	i.current.Load().tree.search(point, func(fence *Fence) {
+		if filter.Matches(fence.Location) && logic.InGeometry(point, fence.Geometry) {
+			results = append(results, *fence)
+		}
+	})
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Location.ID < results[b].Location.ID
+	})
+	return results
+}
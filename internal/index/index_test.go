@@ -0,0 +1,257 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/pkg/errors"
+)
+
+type fakeSource struct {
+	locations map[int]repository.PolyLocationResponseCleaned
+	err       error
+}
+
+func (s *fakeSource) GetAllFences() ([]repository.PolyLocationResponseCleaned, error) {
+	var locations []repository.PolyLocationResponseCleaned
+	for _, location := range s.locations {
+		locations = append(locations, location)
+	}
+	return locations, s.err
+}
+
+func (s *fakeSource) GetPolyLocationFromID(id int) ([]repository.PolyLocationResponseCleaned, error) {
+	location, ok := s.locations[id]
+	if !ok {
+		return nil, nil
+	}
+	return []repository.PolyLocationResponseCleaned{location}, nil
+}
+
+// Returns a location whose polygon is the square of the given size with its south west corner at lon, lat.
+func square(id int, lon, lat, size float64) repository.PolyLocationResponseCleaned {
+	return repository.PolyLocationResponseCleaned{
+		ID:      id,
+		StoreID: int64(id % 3),
+		Polygon: fmt.Sprintf(`{"type": "Polygon", "coordinates": [[[%v, %v], [%v, %v], [%v, %v], [%v, %v], [%v, %v]]]}`,
+			lon, lat, lon+size, lat, lon+size, lat+size, lon, lat+size, lon, lat),
+	}
+}
+
+func newIndex(source *fakeSource) *FenceIndex {
+	return NewFenceIndex(source, *log.New(ioutil.Discard, "", 0))
+}
+
+func ids(fences []Fence) []int {
+	result := []int{}
+	for _, fence := range fences {
+		result = append(result, fence.Location.ID)
+	}
+	return result
+}
+
+func TestTree(t *testing.T) {
+	// A 30 by 30 grid of unit squares, each overlapping its neighbours by half, packs into several levels.
+	source := &fakeSource{locations: map[int]repository.PolyLocationResponseCleaned{}}
+	for x := 0; x < 30; x++ {
+		for y := 0; y < 30; y++ {
+			id := x*30 + y + 1
+			source.locations[id] = square(id, float64(x)/2, float64(y)/2, 1)
+		}
+	}
+	fences := newIndex(source)
+	if err := fences.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	depth := 0
+	var check func(n *node, level int)
+	check = func(n *node, level int) {
+		if level > depth {
+			depth = level
+		}
+		if len(n.children)+len(n.fences) > nodeCapacity {
+			t.Errorf("node holds %d entries, more than %d", len(n.children)+len(n.fences), nodeCapacity)
+		}
+		for _, child := range n.children {
+			if child.bounds.extend(n.bounds) != n.bounds {
+				t.Errorf("node bounds %+v do not cover child bounds %+v", n.bounds, child.bounds)
+			}
+			check(child, level+1)
+		}
+		for _, fence := range n.fences {
+			if fence.Bounds.extend(n.bounds) != n.bounds {
+				t.Errorf("leaf bounds %+v do not cover fence bounds %+v", n.bounds, fence.Bounds)
+			}
+		}
+	}
+	check(fences.current.Load().tree, 1)
+	if depth < 3 {
+		t.Errorf("tree of %d fences is %d levels deep, want at least 3", fences.Len(), depth)
+	}
+
+	// Every lookup matches a scan of every fence.
+	for _, point := range []model.Coordinate{
+		model.NewCoordinate(0.25, 0.25), model.NewCoordinate(7.3, 4.9), model.NewCoordinate(14.5, 15),
+		model.NewCoordinate(0.5, 0.5), model.NewCoordinate(-1, 3), model.NewCoordinate(15.6, 2),
+	} {
+		var want []int
+		for id := 1; id <= len(source.locations); id++ {
+			fence, _ := fences.Get(id)
+			if fence.Bounds.Contains(point) {
+				want = append(want, id)
+			}
+		}
+		got := ids(fences.Containing(point, Filter{}))
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Containing(%v) = %v, want %v", point, got, want)
+		}
+	}
+
+	if got := ids(fences.Containing(model.NewCoordinate(0.75, 0.75), Filter{StoreID: 2})); fmt.Sprint(got) != "[2 32]" {
+		t.Errorf("Containing with store 2 = %v, want [2 32]", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	source := &fakeSource{locations: map[int]repository.PolyLocationResponseCleaned{
+		1: square(1, 0, 0, 1),
+		2: {ID: 2, Polygon: `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0]`},
+		3: square(3, 0.5, 0.5, 1),
+	}}
+	fences := newIndex(source)
+	if err := fences.Load(); err != nil {
+		t.Fatalf("Load with a bad polygon failed: %v", err)
+	}
+	if fences.Len() != 2 || fences.Skipped() != 1 {
+		t.Errorf("Load kept %d fences and skipped %d, want 2 and 1", fences.Len(), fences.Skipped())
+	}
+	if got := ids(fences.Containing(model.NewCoordinate(0.75, 0.75), Filter{})); fmt.Sprint(got) != "[1 3]" {
+		t.Errorf("Containing after Load = %v, want [1 3]", got)
+	}
+
+	source.err = errors.New("connection refused")
+	if err := fences.Load(); err == nil {
+		t.Errorf("Load succeeded although the source failed")
+	}
+	if fences.Len() != 2 {
+		t.Errorf("failed Load changed the index to %d fences", fences.Len())
+	}
+
+	source.err = nil
+	delete(source.locations, 2)
+	if err := fences.Load(); err != nil || fences.Skipped() != 0 {
+		t.Errorf("Load after fixing the source = %v with %d skipped", err, fences.Skipped())
+	}
+}
+
+func TestRefreshAndRemove(t *testing.T) {
+	source := &fakeSource{locations: map[int]repository.PolyLocationResponseCleaned{
+		1: square(1, 0, 0, 1),
+		2: square(2, 5, 5, 1),
+	}}
+	fences := newIndex(source)
+	if err := fences.Load(); err != nil {
+		t.Fatal(err)
+	}
+	point := model.NewCoordinate(5.5, 5.5)
+
+	source.locations[1] = square(1, 5, 5, 2)
+	source.locations[3] = square(3, 5.25, 5.25, 1)
+	if err := fences.Refresh(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fences.Refresh(3); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(fences.Containing(point, Filter{})); fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("Containing after Refresh = %v, want [1 2 3]", got)
+	}
+
+	delete(source.locations, 2)
+	if err := fences.Refresh(2); err != nil {
+		t.Fatal(err)
+	}
+	fences.Remove(3)
+	fences.Remove(4)
+	if got := ids(fences.Containing(point, Filter{})); fmt.Sprint(got) != "[1]" || fences.Len() != 1 {
+		t.Errorf("Containing after removals = %v of %d fences, want [1] of 1", got, fences.Len())
+	}
+
+	source.locations[1] = repository.PolyLocationResponseCleaned{ID: 1, Polygon: "not json"}
+	if err := fences.Refresh(1); err == nil {
+		t.Errorf("Refresh of a bad polygon succeeded")
+	}
+	if _, ok := fences.Get(1); !ok {
+		t.Errorf("failed Refresh removed the fence")
+	}
+}
+
+func TestReadsDoNotWaitForWrites(t *testing.T) {
+	source := &fakeSource{locations: map[int]repository.PolyLocationResponseCleaned{1: square(1, 0, 0, 1)}}
+	fences := newIndex(source)
+	if err := fences.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write in progress holds writeMutex while it builds the next tree.
+	fences.writeMutex.Lock()
+	read := make(chan []int)
+	go func() {
+		_, ok := fences.Get(1)
+		if !ok || fences.Len() != 1 {
+			t.Errorf("Get and Len during a write did not see fence 1")
+		}
+		read <- ids(fences.Containing(model.NewCoordinate(0.5, 0.5), Filter{}))
+	}()
+	select {
+	case got := <-read:
+		if fmt.Sprint(got) != "[1]" {
+			t.Errorf("Containing during a write = %v, want [1]", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("a read waited for a write")
+	}
+	fences.writeMutex.Unlock()
+}
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	source := &fakeSource{locations: map[int]repository.PolyLocationResponseCleaned{}}
+	for id := 1; id <= 20; id++ {
+		source.locations[id] = square(id, 0, 0, 1)
+	}
+	fences := newIndex(source)
+	if err := fences.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for id := 1; id <= 20; id++ {
+		wg.Add(2)
+		go func(id int) {
+			defer wg.Done()
+			if id%2 == 0 {
+				fences.Remove(id)
+			} else if err := fences.Refresh(id); err != nil {
+				t.Error(err)
+			}
+		}(id)
+		go func() {
+			defer wg.Done()
+			// Fences with odd IDs are only ever refreshed, so every snapshot has them.
+			if got := fences.Containing(model.NewCoordinate(0.5, 0.5), Filter{}); len(got) < 10 {
+				t.Errorf("Containing during writes = %v, missing refreshed fences", ids(got))
+			}
+		}()
+	}
+	wg.Wait()
+	if got := ids(fences.Containing(model.NewCoordinate(0.5, 0.5), Filter{})); len(got) != 10 || fences.Len() != 10 {
+		t.Errorf("Containing after concurrent writes = %v of %d fences, want the 10 odd IDs", got, fences.Len())
+	}
+}
@@ -0,0 +1,160 @@
+package index
+
+import (
+	"math"
+	"sort"
+
+	"github.com/geofence/internal/model"
+)
+
+// The maximum number of entries held by a node of the tree.
+const nodeCapacity = 16
+
+// Bounds is an axis aligned bounding box in longitude and latitude.
+type Bounds struct {
+	MinLon float64 `json:"min_lon"`
+	MinLat float64 `json:"min_lat"`
+	MaxLon float64 `json:"max_lon"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+func emptyBounds() Bounds {
+	return Bounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+}
+
+// BoundsOf returns the bounding box of every coordinate in a geometry.
+func BoundsOf(geom model.PolyGeometry) Bounds {
+	bounds := emptyBounds()
+	for _, rings := range geom.Polygons {
+		for _, ring := range rings {
+			for _, coordinate := range ring {
+				bounds.MinLon = math.Min(bounds.MinLon, coordinate.Lon())
+				bounds.MinLat = math.Min(bounds.MinLat, coordinate.Lat())
+				bounds.MaxLon = math.Max(bounds.MaxLon, coordinate.Lon())
+				bounds.MaxLat = math.Max(bounds.MaxLat, coordinate.Lat())
+			}
+		}
+	}
+	return bounds
+}
+
+// Contains reports whether a coordinate lies within or on the edge of the box.
+func (b Bounds) Contains(c model.Coordinate) bool {
+	return c.Lon() >= b.MinLon && c.Lon() <= b.MaxLon && c.Lat() >= b.MinLat && c.Lat() <= b.MaxLat
+}
+
+func (b Bounds) extend(other Bounds) Bounds {
+	return Bounds{
+		MinLon: math.Min(b.MinLon, other.MinLon),
+		MinLat: math.Min(b.MinLat, other.MinLat),
+		MaxLon: math.Max(b.MaxLon, other.MaxLon),
+		MaxLat: math.Max(b.MaxLat, other.MaxLat),
+	}
+}
+
+func (b Bounds) center() (float64, float64) {
+	return (b.MinLon + b.MaxLon) / 2, (b.MinLat + b.MaxLat) / 2
+}
+
+// A node of a static R-tree. Leaves hold fences, inner nodes hold children.
+type node struct {
+	bounds   Bounds
+	children []*node
+	fences   []*Fence
+}
+
+// Helper function to bulk load a tree using Sort-Tile-Recursive packing.
+// The tree is immutable once built; writes build a new tree.
+func buildTree(fences []*Fence) *node {
+	if len(fences) == 0 {
+		return nil
+	}
+	leaves := make([]*node, 0, len(fences)/nodeCapacity+1)
+	for _, group := range strPartition(len(fences), func(i int) Bounds { return fences[i].Bounds }, func(i, j int) {
+		fences[i], fences[j] = fences[j], fences[i]
+	}) {
+		leaf := &node{bounds: emptyBounds(), fences: append([]*Fence(nil), fences[group[0]:group[1]]...)}
+		for _, fence := range leaf.fences {
+			leaf.bounds = leaf.bounds.extend(fence.Bounds)
+		}
+		leaves = append(leaves, leaf)
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		nodes := level
+		var parents []*node
+		for _, group := range strPartition(len(nodes), func(i int) Bounds { return nodes[i].bounds }, func(i, j int) {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}) {
+			parent := &node{bounds: emptyBounds(), children: append([]*node(nil), nodes[group[0]:group[1]]...)}
+			for _, child := range parent.children {
+				parent.bounds = parent.bounds.extend(child.bounds)
+			}
+			parents = append(parents, parent)
+		}
+		level = parents
+	}
+	return level[0]
+}
+
+// Helper function to order n entries into tiles and return the [start, end) range of each node.
+// Entries are sorted by longitude into vertical slices, then each slice is sorted by latitude and cut into nodes.
+func strPartition(n int, bounds func(i int) Bounds, swap func(i, j int)) [][2]int {
+	nodeCount := int(math.Ceil(float64(n) / nodeCapacity))
+	sliceCount := int(math.Ceil(math.Sqrt(float64(nodeCount))))
+	sliceSize := sliceCount * nodeCapacity
+
+	sort.Sort(sorter{n, swap, func(i, j int) bool {
+		lonI, _ := bounds(i).center()
+		lonJ, _ := bounds(j).center()
+		return lonI < lonJ
+	}})
+
+	var groups [][2]int
+	for start := 0; start < n; start += sliceSize {
+		end := start + sliceSize
+		if end > n {
+			end = n
+		}
+		offset := start
+		sort.Sort(sorter{end - start, func(i, j int) { swap(offset+i, offset+j) }, func(i, j int) bool {
+			_, latI := bounds(offset + i).center()
+			_, latJ := bounds(offset + j).center()
+			return latI < latJ
+		}})
+		for nodeStart := start; nodeStart < end; nodeStart += nodeCapacity {
+			nodeEnd := nodeStart + nodeCapacity
+			if nodeEnd > end {
+				nodeEnd = end
+			}
+			groups = append(groups, [2]int{nodeStart, nodeEnd})
+		}
+	}
+	return groups
+}
+
+type sorter struct {
+	n    int
+	swap func(i, j int)
+	less func(i, j int) bool
+}
+
+func (s sorter) Len() int           { return s.n }
+func (s sorter) Swap(i, j int)      { s.swap(i, j) }
+func (s sorter) Less(i, j int) bool { return s.less(i, j) }
+
+// Calls visit for every fence whose bounding box contains the coordinate.
+func (n *node) search(c model.Coordinate, visit func(*Fence)) {
+	if n == nil || !n.bounds.Contains(c) {
+		return
+	}
+	for _, fence := range n.fences {
+		if fence.Bounds.Contains(c) {
+			visit(fence)
+		}
+	}
+	for _, child := range n.children {
+		child.search(c, visit)
+	}
+}
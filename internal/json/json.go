@@ -1,9 +1,16 @@
 package json
 
-import "github.com/pquerna/ffjson/ffjson"
+import (
+	"encoding/json"
+
+	"github.com/pquerna/ffjson/ffjson"
+)
 
 var DefaultMarshal = ffjson.Marshal
 var Marshal = DefaultMarshal
 
 var DefaultUnmarshal = ffjson.Unmarshal
 var Unmarshal = DefaultUnmarshal
+
+// RawMessage is an encoded JSON value passed through without decoding.
+type RawMessage = json.RawMessage
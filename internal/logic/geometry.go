@@ -0,0 +1,395 @@
+package logic
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/geofence/internal/model"
+)
+
+// The smallest area, in square degrees, a ring may enclose. Roughly a square meter at the equator.
+const MinimumRingArea = 1e-10
+
+// GeometryError is a problem with one part of a geometry. Field is a path into the GeoJSON object, such as
+// "coordinates[0][2]" for the third position of a Polygon's exterior ring.
+type GeometryError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// GeometryErrors is every problem found in a geometry.
+type GeometryErrors []GeometryError
+
+func (e GeometryErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, geometryError := range e {
+		messages[i] = geometryError.Field + ": " + geometryError.Reason
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Helper function for the path to a ring, which depends on whether the geometry is a Polygon or MultiPolygon.
+func ringField(geom model.PolyGeometry, p, r int) string {
+	if geom.Type == model.PolygonType {
+		return fmt.Sprintf("coordinates[%d]", r)
+	}
+	return fmt.Sprintf("coordinates[%d][%d]", p, r)
+}
+
+// SignedArea returns the area a ring encloses by the shoelace formula, in square degrees. It is positive for an
+// anticlockwise ring and negative for a clockwise one. The ring may be closed or not.
+func SignedArea(ring []model.Coordinate) float64 {
+	area := 0.0
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		area += ring[i][0]*ring[j][1] - ring[j][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+// Helper function to return the ring's distinct consecutive positions, without the closing position.
+func ringVertices(ring []model.Coordinate) []model.Coordinate {
+	vertices := make([]model.Coordinate, 0, len(ring))
+	for _, position := range ring {
+		if len(vertices) == 0 || position != vertices[len(vertices)-1] {
+			vertices = append(vertices, position)
+		}
+	}
+	for len(vertices) > 1 && vertices[len(vertices)-1] == vertices[0] {
+		vertices = vertices[:len(vertices)-1]
+	}
+	return vertices
+}
+
+// Helper function to determine if p lies on the segment a-b, given that the three are collinear.
+func withinSegment(p, a, b model.Coordinate) bool {
+	return p[0] >= math.Min(a[0], b[0]) && p[0] <= math.Max(a[0], b[0]) &&
+		p[1] >= math.Min(a[1], b[1]) && p[1] <= math.Max(a[1], b[1])
+}
+
+// Helper function to determine if the segments a-b and c-d share any point.
+func segmentsIntersect(a, b, c, d model.Coordinate) bool {
+	d1 := isLeft(c, d, a)
+	d2 := isLeft(c, d, b)
+	d3 := isLeft(a, b, c)
+	d4 := isLeft(a, b, d)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && withinSegment(a, c, d)) || (d2 == 0 && withinSegment(b, c, d)) ||
+		(d3 == 0 && withinSegment(c, a, b)) || (d4 == 0 && withinSegment(d, a, b))
+}
+
+// Helper function to find where a ring touches or crosses itself. It returns the indexes into vertices of the
+// first two edges found to meet, where edge i runs from vertices[i] to the next vertex, or false if none do.
+// Adjacent edges only meet at their shared vertex unless the ring doubles back on itself.
+func selfIntersection(vertices []model.Coordinate) (int, int, bool) {
+	n := len(vertices)
+	if n < 3 {
+		return 0, 0, false
+	}
+	for i := 0; i < n; i++ {
+		a, b := vertices[i], vertices[(i+1)%n]
+		next := vertices[(i+2)%n]
+		// A spike: the next edge is collinear and points back along this one.
+		if isLeft(a, b, next) == 0 && (b[0]-a[0])*(next[0]-b[0])+(b[1]-a[1])*(next[1]-b[1]) < 0 {
+			return i, (i + 1) % n, true
+		}
+		for j := i + 2; j < n; j++ {
+			if i == 0 && j == n-1 {
+				continue
+			}
+			if segmentsIntersect(a, b, vertices[j], vertices[(j+1)%n]) {
+				return i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// ValidateGeometry checks a geometry can be stored as a fence. Every ring must be closed, have at least four
+// positions with no position repeated consecutively, enclose at least MinimumRingArea and not touch or cross
+// itself. Winding is not checked, as OrientGeometry corrects it. It returns GeometryErrors describing every
+// problem, or nil.
+func ValidateGeometry(geom model.PolyGeometry) error {
+	var errs GeometryErrors
+	if geom.Type != model.PolygonType && geom.Type != model.MultiPolygonType {
+		return GeometryErrors{{"type", "must be Polygon or MultiPolygon"}}
+	}
+	if len(geom.Polygons) == 0 {
+		return GeometryErrors{{"coordinates", "must contain at least one polygon"}}
+	}
+	if geom.Type == model.PolygonType && len(geom.Polygons) > 1 {
+		return GeometryErrors{{"type", "a Polygon holds a single polygon; use MultiPolygon"}}
+	}
+
+	for p, rings := range geom.Polygons {
+		if len(rings) == 0 {
+			errs = append(errs, GeometryError{fmt.Sprintf("coordinates[%d]", p), "polygon has no rings"})
+			continue
+		}
+		for r, ring := range rings {
+			errs = append(errs, validateRing(ringField(geom, p, r), ring)...)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Helper function to check a single ring, named by field.
+func validateRing(field string, ring []model.Coordinate) GeometryErrors {
+	var errs GeometryErrors
+	for i, position := range ring {
+		if err := position.Validate(); err != nil {
+			errs = append(errs, GeometryError{fmt.Sprintf("%s[%d]", field, i), err.Error()})
+		}
+	}
+	if len(ring) < 4 {
+		return append(errs, GeometryError{field, "ring must have at least 4 positions"})
+	}
+	if ring[0] != ring[len(ring)-1] {
+		errs = append(errs, GeometryError{field, "ring is not closed: the last position must repeat the first"})
+	}
+	for i := 1; i < len(ring); i++ {
+		if ring[i] == ring[i-1] {
+			errs = append(errs, GeometryError{fmt.Sprintf("%s[%d]", field, i), "repeats the previous position"})
+		}
+	}
+
+	vertices := ringVertices(ring)
+	if len(vertices) < 3 || math.Abs(SignedArea(vertices)) < MinimumRingArea {
+		return append(errs, GeometryError{field, "ring encloses no area"})
+	}
+	if i, j, ok := selfIntersection(vertices); ok {
+		errs = append(errs, GeometryError{field, fmt.Sprintf("ring intersects itself between edges starting at %v and %v", vertices[i], vertices[j])})
+	}
+	return errs
+}
+
+// OrientRings returns a polygon's rings with the exterior turned anticlockwise when exteriorAnticlockwise is set
+// and clockwise otherwise, and holes the other way. RFC 7946 and KML want exteriors anticlockwise, Shapefiles
+// clockwise. Rings that enclose less than MinimumRingArea are left as they are, and rings is not modified.
+func OrientRings(rings [][]model.Coordinate, exteriorAnticlockwise bool) [][]model.Coordinate {
+	oriented, _ := orientRings(rings, exteriorAnticlockwise)
+	return oriented
+}
+
+// Helper function for OrientRings that also returns the indexes of the rings it reversed.
+func orientRings(rings [][]model.Coordinate, exteriorAnticlockwise bool) ([][]model.Coordinate, []int) {
+	var reversedRings []int
+	oriented := make([][]model.Coordinate, len(rings))
+	for r, ring := range rings {
+		oriented[r] = ring
+		area := SignedArea(ring)
+		if math.Abs(area) < MinimumRingArea || (area > 0) == (exteriorAnticlockwise == (r == 0)) {
+			continue
+		}
+		oriented[r] = reverseRing(ring)
+		reversedRings = append(reversedRings, r)
+	}
+	return oriented, reversedRings
+}
+
+// Helper function to return a reversed copy of a ring.
+func reverseRing(ring []model.Coordinate) []model.Coordinate {
+	reversed := make([]model.Coordinate, len(ring))
+	for i, position := range ring {
+		reversed[len(ring)-1-i] = position
+	}
+	return reversed
+}
+
+// OrientGeometry turns each ring that winds the wrong way to the orientation RFC 7946 requires: exterior rings
+// anticlockwise and holes clockwise. Rings that enclose no area are left as they are for ValidateGeometry to
+// reject. It returns the oriented copy and a description of each ring reversed.
+func OrientGeometry(geom model.PolyGeometry) (model.PolyGeometry, []string) {
+	changes := []string{}
+	oriented := model.PolyGeometry{Type: geom.Type, Polygons: make([][][]model.Coordinate, len(geom.Polygons))}
+	for p, rings := range geom.Polygons {
+		var reversed []int
+		oriented.Polygons[p], reversed = orientRings(rings, true)
+		for _, r := range reversed {
+			changes = append(changes, "reversed "+ringField(geom, p, r))
+		}
+	}
+	return oriented, changes
+}
+
+// SelfIntersects reports whether any ring of the geometry touches or crosses itself.
+func SelfIntersects(geom model.PolyGeometry) bool {
+	for _, rings := range geom.Polygons {
+		for _, ring := range rings {
+			if _, _, ok := selfIntersection(ringVertices(ring)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RepairGeometry normalizes a geometry: repeated positions are removed, rings are closed and turned to the
+// orientation RFC 7946 requires, and holes, or polygons of a MultiPolygon, that enclose no area are dropped.
+// It returns the repaired copy and a description of each change. Self-intersections are not repaired.
+func RepairGeometry(geom model.PolyGeometry) (model.PolyGeometry, []string) {
+	changes := []string{}
+	repaired := model.PolyGeometry{Type: geom.Type}
+	for p, rings := range geom.Polygons {
+		var polygon [][]model.Coordinate
+		for r, ring := range rings {
+			field := ringField(geom, p, r)
+			vertices := ringVertices(ring)
+			closed := len(ring) > 0 && ring[0] == ring[len(ring)-1]
+			removed := len(ring) - len(vertices)
+			if closed {
+				removed--
+			} else if len(ring) > 0 {
+				changes = append(changes, "closed "+field)
+			}
+			if removed > 0 {
+				changes = append(changes, fmt.Sprintf("removed %d repeated positions from %s", removed, field))
+			}
+
+			area := SignedArea(vertices)
+			if len(vertices) < 3 || math.Abs(area) < MinimumRingArea {
+				if r > 0 || len(geom.Polygons) > 1 {
+					changes = append(changes, "removed "+field+" as it encloses no area")
+					if r == 0 {
+						break
+					}
+					continue
+				}
+			}
+			if (r == 0 && area < 0) || (r > 0 && area > 0) {
+				vertices = reverseRing(vertices)
+				changes = append(changes, "reversed "+field)
+			}
+			if len(vertices) > 0 {
+				vertices = append(vertices, vertices[0])
+			}
+			polygon = append(polygon, vertices)
+		}
+		if len(polygon) > 0 {
+			repaired.Polygons = append(repaired.Polygons, polygon)
+		}
+	}
+	return repaired, changes
+}
+
+// GeometriesIntersect reports whether two geometries share any point, boundaries included.
+func GeometriesIntersect(a, b model.PolyGeometry) bool {
+	for _, pair := range [][2]model.PolyGeometry{{a, b}, {b, a}} {
+		for _, rings := range pair[0].Polygons {
+			for _, ring := range rings {
+				for _, position := range ring {
+					if InGeometry(position, pair[1]) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	for _, ringA := range geometryRings(a) {
+		for _, ringB := range geometryRings(b) {
+			for i := 0; i+1 < len(ringA); i++ {
+				for j := 0; j+1 < len(ringB); j++ {
+					if segmentsIntersect(ringA[i], ringA[i+1], ringB[j], ringB[j+1]) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Helper function to list every ring of a geometry, closed so that each consecutive pair of positions is an edge.
+func geometryRings(geom model.PolyGeometry) [][]model.Coordinate {
+	var rings [][]model.Coordinate
+	for _, polygon := range geom.Polygons {
+		for _, ring := range polygon {
+			if vertices := ringVertices(ring); len(vertices) > 0 {
+				rings = append(rings, append(vertices, vertices[0]))
+			}
+		}
+	}
+	return rings
+}
+
+// SplitSelfIntersections makes a geometry whose rings touch or cross themselves valid, much as PostGIS's
+// ST_MakeValid does. Each ring is cut at the points where it meets itself into simple rings, and any that enclose
+// no area, such as spikes, are dropped. The pieces of an exterior ring each become a polygon, keeping the holes that
+// lie inside them. A Polygon that is split becomes a MultiPolygon. Orientation is left to RepairGeometry.
+func SplitSelfIntersections(geom model.PolyGeometry) model.PolyGeometry {
+	split := model.PolyGeometry{Type: geom.Type}
+	for _, rings := range geom.Polygons {
+		if len(rings) == 0 {
+			continue
+		}
+		var holes [][]model.Coordinate
+		for _, hole := range rings[1:] {
+			holes = append(holes, splitRing(ringVertices(hole), len(hole))...)
+		}
+		for _, exterior := range splitRing(ringVertices(rings[0]), len(rings[0])) {
+			polygon := [][]model.Coordinate{exterior}
+			for _, hole := range holes {
+				if InPoly(hole[0], exterior) {
+					polygon = append(polygon, hole)
+				}
+			}
+			split.Polygons = append(split.Polygons, polygon)
+		}
+	}
+	if len(split.Polygons) > 1 {
+		split.Type = model.MultiPolygonType
+	}
+	return split
+}
+
+// Helper function to cut a ring, given as its vertices, into simple closed rings that enclose some area.
+// Each cut leaves fewer crossings in either piece; budget bounds the number of cuts in case rounding of the
+// points where edges cross ever keeps that from being so.
+func splitRing(vertices []model.Coordinate, budget int) [][]model.Coordinate {
+	if len(vertices) < 3 {
+		return nil
+	}
+	i, j, ok := selfIntersection(vertices)
+	if !ok || budget <= 0 {
+		if math.Abs(SignedArea(vertices)) < MinimumRingArea {
+			return nil
+		}
+		return [][]model.Coordinate{append(vertices, vertices[0])}
+	}
+
+	n := len(vertices)
+	if j == (i+1)%n {
+		// A spike: drop its tip.
+		pieces := append(append([]model.Coordinate{}, vertices[:j]...), vertices[j+1:]...)
+		return splitRing(ringVertices(pieces), budget-1)
+	}
+	point := crossing(vertices[i], vertices[i+1], vertices[j], vertices[(j+1)%n])
+	inner := append(append([]model.Coordinate{point}, vertices[i+1:j+1]...), point)
+	outer := append(append(append([]model.Coordinate{}, vertices[:i+1]...), point), vertices[j+1:]...)
+	return append(splitRing(ringVertices(inner), budget-1), splitRing(ringVertices(outer), budget-1)...)
+}
+
+// Helper function for a point shared by the segments a-b and c-d, given that they intersect. Where the segments
+// cross that is the crossing point; where they touch or overlap, it is an endpoint of one lying on the other.
+func crossing(a, b, c, d model.Coordinate) model.Coordinate {
+	d1 := isLeft(c, d, a)
+	d2 := isLeft(c, d, b)
+	switch {
+	case d1 == 0 && withinSegment(a, c, d):
+		return a
+	case d2 == 0 && withinSegment(b, c, d):
+		return b
+	case isLeft(a, b, c) == 0 && withinSegment(c, a, b):
+		return c
+	case isLeft(a, b, d) == 0 && withinSegment(d, a, b):
+		return d
+	}
+	t := d1 / (d1 - d2)
+	return model.NewCoordinate(a[0]+t*(b[0]-a[0]), a[1]+t*(b[1]-a[1]))
+}
@@ -0,0 +1,223 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/geofence/internal/model"
+)
+
+var (
+	holeCW   = []model.Coordinate{{4, 4}, {4, 6}, {6, 6}, {6, 4}, {4, 4}}
+	bowtie   = []model.Coordinate{{0, 0}, {10, 10}, {10, 0}, {0, 10}, {0, 0}}
+	unclosed = []model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	repeated = []model.Coordinate{{0, 0}, {10, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}
+	flat     = []model.Coordinate{{0, 0}, {5, 0}, {10, 0}, {0, 0}}
+	spike    = []model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {10, 15}, {10, 10}, {0, 10}, {0, 0}}
+)
+
+func geometryFields(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var fields []string
+	for _, geometryError := range err.(GeometryErrors) {
+		fields = append(fields, geometryError.Field+": "+geometryError.Reason)
+	}
+	return fields
+}
+
+func TestValidateGeometry(t *testing.T) {
+	cases := []struct {
+		name string
+		geom model.PolyGeometry
+		want []string
+	}{
+		{"valid polygon", model.NewPolygon(squareCCW), nil},
+		{"valid polygon with hole", model.NewPolygon(squareCCW, holeCW), nil},
+		{"valid multipolygon", model.NewMultiPolygon([][]model.Coordinate{squareCCW}, [][]model.Coordinate{squareCCW}), nil},
+		{"wrong type", model.PolyGeometry{Type: "LineString"}, []string{"type: must be Polygon or MultiPolygon"}},
+		{"no polygons", model.PolyGeometry{Type: model.PolygonType}, []string{"coordinates: must contain at least one polygon"}},
+		{"unclosed ring", model.NewPolygon(unclosed), []string{"coordinates[0]: ring is not closed: the last position must repeat the first"}},
+		{"repeated position", model.NewPolygon(repeated), []string{"coordinates[0][2]: repeats the previous position"}},
+		{"clockwise exterior", model.NewPolygon(squareCW), nil},
+		{"anticlockwise hole", model.NewPolygon(squareCCW, hole), nil},
+		{"zero area", model.NewPolygon(flat), []string{"coordinates[0]: ring encloses no area"}},
+		{"too few positions", model.NewPolygon(squareCCW[:3]), []string{"coordinates[0]: ring must have at least 4 positions"}},
+		{"out of range", model.NewPolygon([]model.Coordinate{{0, 0}, {200, 0}, {200, 10}, {0, 0}}), []string{
+			"coordinates[0][1]: longitude 200 out of range [-180, 180]",
+			"coordinates[0][2]: longitude 200 out of range [-180, 180]",
+		}},
+		{"multipolygon paths", model.NewMultiPolygon([][]model.Coordinate{squareCCW}, [][]model.Coordinate{flat}), []string{
+			"coordinates[1][0]: ring encloses no area",
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := geometryFields(ValidateGeometry(c.geom))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("ValidateGeometry() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateGeometrySelfIntersection(t *testing.T) {
+	for name, ring := range map[string][]model.Coordinate{"bowtie": bowtie, "spike": spike} {
+		geom := model.NewPolygon(ring)
+		if !SelfIntersects(geom) {
+			t.Errorf("%s: SelfIntersects() = false, want true", name)
+		}
+		if err := ValidateGeometry(geom); err == nil {
+			t.Errorf("%s: ValidateGeometry() = nil, want an error", name)
+		}
+	}
+	if SelfIntersects(model.NewPolygon(zigzag)) {
+		t.Error("zigzag: SelfIntersects() = true, want false")
+	}
+}
+
+func TestRepairGeometry(t *testing.T) {
+	cases := []struct {
+		name    string
+		geom    model.PolyGeometry
+		want    model.PolyGeometry
+		changes []string
+	}{
+		{"valid is unchanged", model.NewPolygon(squareCCW, holeCW), model.NewPolygon(squareCCW, holeCW), []string{}},
+		{"closes ring", model.NewPolygon(unclosed), model.NewPolygon(squareCCW), []string{"closed coordinates[0]"}},
+		{"removes repeated positions", model.NewPolygon(repeated), model.NewPolygon(squareCCW), []string{"removed 1 repeated positions from coordinates[0]"}},
+		{"reverses rings", model.NewPolygon(squareCW, hole), model.NewPolygon(
+			[]model.Coordinate{{10, 0}, {10, 10}, {0, 10}, {0, 0}, {10, 0}},
+			[]model.Coordinate{{4, 6}, {6, 6}, {6, 4}, {4, 4}, {4, 6}},
+		), []string{"reversed coordinates[0]", "reversed coordinates[1]"}},
+		{"drops empty hole", model.NewPolygon(squareCCW, flat), model.NewPolygon(squareCCW), []string{"removed coordinates[1] as it encloses no area"}},
+		{"drops empty polygon", model.NewMultiPolygon([][]model.Coordinate{flat}, [][]model.Coordinate{squareCCW}),
+			model.NewMultiPolygon([][]model.Coordinate{squareCCW}), []string{"removed coordinates[0][0] as it encloses no area"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, changes := RepairGeometry(c.geom)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("RepairGeometry() = %v, want %v", got.Polygons, c.want.Polygons)
+			}
+			if !reflect.DeepEqual(changes, c.changes) {
+				t.Errorf("RepairGeometry() changes = %q, want %q", changes, c.changes)
+			}
+			if err := ValidateGeometry(got); err != nil {
+				t.Errorf("repaired geometry is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestOrientGeometry(t *testing.T) {
+	cases := []struct {
+		name    string
+		geom    model.PolyGeometry
+		want    model.PolyGeometry
+		changes []string
+	}{
+		{"oriented is unchanged", model.NewPolygon(squareCCW, holeCW), model.NewPolygon(squareCCW, holeCW), []string{}},
+		{"reverses rings", model.NewPolygon(squareCW, hole), model.NewPolygon(
+			[]model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+			[]model.Coordinate{{4, 4}, {4, 6}, {6, 6}, {6, 4}, {4, 4}},
+		), []string{"reversed coordinates[0]", "reversed coordinates[1]"}},
+		{"multipolygon paths", model.NewMultiPolygon([][]model.Coordinate{squareCCW}, [][]model.Coordinate{squareCW}),
+			model.NewMultiPolygon([][]model.Coordinate{squareCCW}, [][]model.Coordinate{squareCCW}), []string{"reversed coordinates[1][0]"}},
+		{"leaves rings with no area", model.NewPolygon(flat), model.NewPolygon(flat), []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			original := model.NewPolygon(append([]model.Coordinate(nil), c.geom.Polygons[0][0]...))
+			got, changes := OrientGeometry(c.geom)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("OrientGeometry() = %v, want %v", got.Polygons, c.want.Polygons)
+			}
+			if !reflect.DeepEqual(changes, c.changes) {
+				t.Errorf("OrientGeometry() changes = %q, want %q", changes, c.changes)
+			}
+			if !reflect.DeepEqual(c.geom.Polygons[0][0], original.Polygons[0][0]) {
+				t.Errorf("OrientGeometry() changed its argument")
+			}
+		})
+	}
+}
+
+func TestOrientRings(t *testing.T) {
+	rings := [][]model.Coordinate{squareCCW, holeCW}
+	if got := OrientRings(rings, true); !reflect.DeepEqual(got, rings) {
+		t.Errorf("OrientRings(anticlockwise) = %v, want it unchanged", got)
+	}
+	// Shapefiles wind exteriors clockwise and holes anticlockwise.
+	want := [][]model.Coordinate{
+		{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}},
+		{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}},
+	}
+	if got := OrientRings(rings, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("OrientRings(clockwise) = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(rings, [][]model.Coordinate{squareCCW, holeCW}) || SignedArea(squareCCW) != 100 {
+		t.Errorf("OrientRings() changed its argument: %v", rings)
+	}
+}
+
+func TestGeometriesIntersect(t *testing.T) {
+	shifted := func(ring []model.Coordinate, dx float64) []model.Coordinate {
+		moved := make([]model.Coordinate, len(ring))
+		for i, position := range ring {
+			moved[i] = model.NewCoordinate(position[0]+dx, position[1])
+		}
+		return moved
+	}
+	cases := []struct {
+		name string
+		a, b model.PolyGeometry
+		want bool
+	}{
+		{"overlapping", model.NewPolygon(squareCCW), model.NewPolygon(shifted(squareCCW, 5)), true},
+		{"sharing an edge", model.NewPolygon(squareCCW), model.NewPolygon(shifted(squareCCW, 10)), true},
+		{"disjoint", model.NewPolygon(squareCCW), model.NewPolygon(shifted(squareCCW, 20)), false},
+		{"contained", model.NewPolygon(squareCCW), model.NewPolygon(holeCW), true},
+		{"within a hole", model.NewPolygon(squareCCW, holeCW), model.NewPolygon([]model.Coordinate{{4.5, 4.5}, {5.5, 4.5}, {5.5, 5.5}, {4.5, 4.5}}), false},
+		{"edges crossing", model.NewPolygon([]model.Coordinate{{-1, 4}, {11, 4}, {11, 6}, {-1, 6}, {-1, 4}}), model.NewPolygon([]model.Coordinate{{4, -1}, {6, -1}, {6, 11}, {4, 11}, {4, -1}}), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := GeometriesIntersect(c.a, c.b); got != c.want {
+				t.Errorf("GeometriesIntersect() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSplitSelfIntersections(t *testing.T) {
+	cases := []struct {
+		name string
+		geom model.PolyGeometry
+		want model.PolyGeometry
+	}{
+		{"valid is unchanged", model.NewPolygon(squareCCW, holeCW), model.NewPolygon(squareCCW, holeCW)},
+		{"bowtie", model.NewPolygon(bowtie), model.NewMultiPolygon(
+			[][]model.Coordinate{{{5, 5}, {10, 10}, {10, 0}, {5, 5}}},
+			[][]model.Coordinate{{{0, 0}, {5, 5}, {0, 10}, {0, 0}}},
+		)},
+		{"spike", model.NewPolygon(spike), model.NewPolygon([]model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}})},
+		{"holes follow their piece", model.NewPolygon(bowtie, []model.Coordinate{{8, 4}, {8, 6}, {9, 5}, {8, 4}}), model.NewMultiPolygon(
+			[][]model.Coordinate{{{5, 5}, {10, 10}, {10, 0}, {5, 5}}, {{8, 4}, {8, 6}, {9, 5}, {8, 4}}},
+			[][]model.Coordinate{{{0, 0}, {5, 5}, {0, 10}, {0, 0}}},
+		)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := SplitSelfIntersections(c.geom)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("SplitSelfIntersections() = %s %v, want %s %v", got.Type, got.Polygons, c.want.Type, c.want.Polygons)
+			}
+			repaired, _ := RepairGeometry(got)
+			if err := ValidateGeometry(repaired); err != nil {
+				t.Errorf("repaired geometry is invalid: %v", err)
+			}
+		})
+	}
+}
@@ -1,12 +1,13 @@
 package logic
 
 import (
+	"github.com/geofence/internal/model"
 	"math"
 )
 
-// A circle with a center and a radius
+// A circle with a center and a radius in kilometers.
 type RadialFence struct{
-	Center [2]float64	`json:"center"`
+	Center model.Coordinate	`json:"center"`
 	Radius float64	`json:"radius"`
 }
 
@@ -15,12 +16,12 @@ func degreesToRadians(d float64) float64 {
 	return d * math.Pi / 180
 }
 
-// Determine the distance between 2 coordinates on the globe.
-func radialDistance(c1, c2 [2]float64) float64 {
-	lat1 := degreesToRadians(c1[0])
-	lon1 := degreesToRadians(c1[1])
-	lat2 := degreesToRadians(c2[0])
-	lon2 := degreesToRadians(c2[1])
+// Determine the great circle distance in kilometers between 2 coordinates on the globe.
+func radialDistance(c1, c2 model.Coordinate) float64 {
+	lat1 := degreesToRadians(c1.Lat())
+	lon1 := degreesToRadians(c1.Lon())
+	lat2 := degreesToRadians(c2.Lat())
+	lon2 := degreesToRadians(c2.Lon())
 
 	diffLat := lat2 - lat1
 	diffLon := lon2 - lon1
@@ -35,131 +36,182 @@ func radialDistance(c1, c2 [2]float64) float64 {
 	return distance
 }
 
+// Determine the great circle distance in meters between 2 coordinates on the globe.
+func Distance(c1, c2 model.Coordinate) float64 {
+	return radialDistance(c1, c2) * 1000
+}
+
 // Determines if a coordinate lies within a RadialFence.
-func InRadius(coordinate [2]float64, fence RadialFence, ) bool{
+func InRadius(coordinate model.Coordinate, fence RadialFence, ) bool{
 	if radialDistance(fence.Center, coordinate) <= fence.Radius {
 		return true
 	}
 	return false
 }
 
-// Creates a line from 2 coordinates.
-func makeLine(c1 , c2 [2]float64) [2][2]float64 {
-	return [2][2]float64{c1, c2}
-}
+// The position of a point relative to a polygon.
+type Position int
 
-// Helper function to determine if a point intersects a line.
-func intersectsLine(coordinate [2]float64, line [2][2]float64) float64 {
-	gradient := gradient(line)
+const (
+	Outside Position = iota
+	Inside
+	OnBoundary
+)
 
-	// Determine the high and low points of the line
-	yHighIndex := 0
-	yHigh := line[0][1]
-	if line[1][1] > yHigh {
-		yHighIndex = 1
-		yHigh = line[1][1]
+func (p Position) String() string {
+	switch p {
+	case Inside:
+		return "Inside"
+	case OnBoundary:
+		return "OnBoundary"
+	default:
+		return "Outside"
 	}
+}
 
-	// Now we have yHighIndex.
-	var xHighIndex int
-	if gradient > 0 {
-		xHighIndex = yHighIndex
-	} else if gradient < 0 {
-		xHighIndex = 1 - yHighIndex
-	} else {
-		//GRADIENT IS ZERO => Consider as no intersections (even if ray covers line)
-		return 0
-	}
+// The default distance, in coordinate units (degrees), within which a point is considered to lie on an edge.
+// Roughly 0.1mm at the equator, so it only absorbs floating point noise.
+const DefaultTolerance = 1e-9
 
-	if coordinate[1] > line[yHighIndex][1] || coordinate[1] < line[1-yHighIndex][1] {
-		return 0
-	}
+// A Locator determines the position of points relative to polygons using the non-zero winding rule.
+// Rings may be given in either orientation, closed or unclosed. Points within Tolerance of an edge are OnBoundary.
+type Locator struct {
+	Tolerance float64
+}
 
-	//BUG this returns 0.5 for points to the left as well.
-	if coordinate[1] == line[0][1] || coordinate[1] == line[1][1] {
-		return handleVerticeIntersection(coordinate, line, yHighIndex)
+// Creates a Locator, falling back to DefaultTolerance for a negative tolerance.
+func NewLocator(tolerance float64) Locator {
+	if tolerance < 0 {
+		tolerance = DefaultTolerance
 	}
+	return Locator{Tolerance: tolerance}
+}
 
-	if coordinate[0] <= line[xHighIndex][0] && coordinate[0] <= line[1-xHighIndex][0] {
-		return 1
+var defaultLocator = NewLocator(DefaultTolerance)
+
+// Helper function for the signed area of the triangle (a, b, p).
+// Positive when p lies to the left of the directed line a->b, negative when to the right and zero when collinear.
+func isLeft(a, b, p model.Coordinate) float64 {
+	return (b[0]-a[0])*(p[1]-a[1]) - (p[0]-a[0])*(b[1]-a[1])
+}
+
+// Helper function to determine if p lies on the segment a-b, or within tolerance of it.
+func (l Locator) onSegment(p, a, b model.Coordinate) bool {
+	if isLeft(a, b, p) == 0 &&
+		p[0] >= math.Min(a[0], b[0]) && p[0] <= math.Max(a[0], b[0]) &&
+		p[1] >= math.Min(a[1], b[1]) && p[1] <= math.Max(a[1], b[1]) {
+		return true
 	}
+	if l.Tolerance == 0 {
+		return false
+	}
+	return segmentDistance(p, a, b) <= l.Tolerance
+}
 
-	deltaX := coordinate[0]-line[1-xHighIndex][0]
-	yLine := line[1-xHighIndex][1] + gradient*deltaX
-	return intersectsLineToRight(yLine, coordinate[1], gradient)
+// Helper function for the planar distance between p and the closest point on the segment a-b.
+func segmentDistance(p, a, b model.Coordinate) float64 {
+	dx := b[0] - a[0]
+	dy := b[1] - a[1]
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / lengthSq
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
 }
 
-// Helper function to determine if intersection should count given a point where the ray from a line intersects the tip of a line.
-// Intersection should only count when the line is to the right of the point AND the ray intersects the top of the line.
-// E.g. (5, 5) intersects Line{(10, 5), (15, 3)} and Line{(10, 3), (15, 5)} but not Line{(10,10), (15, 5)}
-func handleVerticeIntersection(coordinate [2]float64, line [2][2]float64, yHighIndex int) float64 {
-	if coordinate[1] == line[yHighIndex][1] {
-		if coordinate[0] > line[yHighIndex][0] {
-			return 0
-		} else {
-			return 1
+// Determine the position of a point relative to a single ring.
+// Edges are treated as half open in y so a vertex shared by two edges is counted exactly once,
+// and horizontal edges never cross the ray. Rings with fewer than 3 vertices have no interior.
+func (l Locator) LocateRing(point model.Coordinate, ring []model.Coordinate) Position {
+	winding := 0
+	for i := range ring {
+		a := ring[i]
+		b := ring[(i+1)%len(ring)]
+		if l.onSegment(point, a, b) {
+			return OnBoundary
 		}
-	} else {
-		return 0
+		if a[1] <= point[1] {
+			if b[1] > point[1] && isLeft(a, b, point) > 0 {
+				winding++
+			}
+		} else if b[1] <= point[1] && isLeft(a, b, point) < 0 {
+			winding--
+		}
+	}
+	if winding != 0 {
+		return Inside
 	}
+	return Outside
 }
 
-// Helper function to determine whether a point (xPoint, yPoint) intersects a line to its right.
-// yLine refers to the y value of the line at xPoint.
-func intersectsLineToRight (yLine float64, yPoint float64, gradient float64) float64 {
-	if yLine == yPoint {
-		return 1
-	} else if yLine < yPoint {
-		if gradient > 0 {
-			return 1
-		} else {
-			return 0
+// Determine the position of a point relative to the rings of a GeoJSON polygon.
+// The first ring is the exterior; any further rings are holes, and a point inside a hole lies outside the polygon.
+func (l Locator) LocatePolygon(point model.Coordinate, rings [][]model.Coordinate) Position {
+	if len(rings) == 0 {
+		return Outside
+	}
+	position := l.LocateRing(point, rings[0])
+	if position != Inside {
+		return position
+	}
+	for _, hole := range rings[1:] {
+		switch l.LocateRing(point, hole) {
+		case Inside:
+			return Outside
+		case OnBoundary:
+			return OnBoundary
 		}
-	} else {
-		if gradient > 0 {
-			return 0
-		} else {
-			return 1
+	}
+	return Inside
+}
+
+// Determine the position of a point relative to a list of polygons.
+// Inside any polygon wins over lying on the boundary of another.
+func (l Locator) LocateMultiPolygon(point model.Coordinate, polygons [][][]model.Coordinate) Position {
+	result := Outside
+	for _, rings := range polygons {
+		switch l.LocatePolygon(point, rings) {
+		case Inside:
+			return Inside
+		case OnBoundary:
+			result = OnBoundary
 		}
 	}
+	return result
 }
 
-// Helper function to generate a list of lines given a list of coordinates that make up a polygon
-// Coordinates must be given in anticlockwise fashion.
-func generateLines(coordinates [][2]float64) [][2][2]float64 {
-	var lines [][2][2]float64
+// Determine the position of a point relative to a Polygon or MultiPolygon geometry.
+func (l Locator) LocateGeometry(point model.Coordinate, geom model.PolyGeometry) Position {
+	return l.LocateMultiPolygon(point, geom.Polygons)
+}
 
-	for index, coordinate := range coordinates {
-		newLine := [2][2]float64{coordinate, coordinates[(index+1)%len(coordinates)]}
-		lines = append(lines, newLine)
-	}
-	return lines
+// Determine the position of a point relative to a geometry using DefaultTolerance.
+func Locate(point model.Coordinate, geom model.PolyGeometry) Position {
+	return defaultLocator.LocateGeometry(point, geom)
 }
 
-// Helper function to determine the gradient of a line
-func gradient(line [2][2]float64) float64 {
-	return (line[1][1]-line[0][1])/(line[1][0]-line[0][0])
+// Given a point and a list of coordinates that make up a polygon ring, determine if the point lies inside the polygon.
+// Points on the boundary count as inside.
+func InPoly(point model.Coordinate, coordinates []model.Coordinate) bool {
+	return defaultLocator.LocateRing(point, coordinates) != Outside
 }
 
-// Given a point and a list of coordinates that make up a polygon, determine the number of lines that the point (extended) would intersect
-// Helper function for inOrOut
-func countIntersects(point [2]float64, coordinates [][2]float64) float64 {
-	result := 0.0
-	lines := generateLines(coordinates)
-	for _, line := range lines {
-		result += intersectsLine(point, line)
-	}
-	return result
+// Given a point and the rings of a GeoJSON polygon, determine if the point lies inside the polygon.
+// Points on the boundary count as inside.
+func InPolygon(point model.Coordinate, rings [][]model.Coordinate) bool {
+	return defaultLocator.LocatePolygon(point, rings) != Outside
 }
 
-// Given a point and a list of coordinates that make up a polygon, determine if the point lies inside the polygon.
-// Coordinates must be ordered in anticlockwise fashion.
-func InPoly(point [2]float64, coordinates [][2]float64) bool {
-	intersects := int(countIntersects(point, coordinates))
-	if intersects%2 > 0 {
-		return true
-	} else {
-		return false
-	}
+// Given a point and a list of polygons, determine if the point lies inside any of them.
+// Points on the boundary count as inside.
+func InMultiPolygon(point model.Coordinate, polygons [][][]model.Coordinate) bool {
+	return defaultLocator.LocateMultiPolygon(point, polygons) != Outside
+}
 
+// Determines if a point lies within a Polygon or MultiPolygon geometry.
+// Points on the boundary count as inside.
+func InGeometry(point model.Coordinate, geom model.PolyGeometry) bool {
+	return Locate(point, geom) != Outside
 }
@@ -0,0 +1,127 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/geofence/internal/model"
+)
+
+var (
+	squareCCW = []model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}
+	squareCW  = []model.Coordinate{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}
+	hole      = []model.Coordinate{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}}
+	// A square with two V shaped notches cut from the top, leaving valley vertices at y=5 and a peak at (5, 10).
+	zigzag = []model.Coordinate{{0, 0}, {10, 0}, {10, 10}, {7, 5}, {5, 10}, {3, 5}, {0, 10}}
+)
+
+func TestLocateRing(t *testing.T) {
+	locator := NewLocator(0)
+	cases := []struct {
+		name  string
+		point model.Coordinate
+		ring  []model.Coordinate
+		want  Position
+	}{
+		{"inside anticlockwise", model.Coordinate{5, 5}, squareCCW, Inside},
+		{"inside clockwise", model.Coordinate{5, 5}, squareCW, Inside},
+		{"outside left", model.Coordinate{-1, 5}, squareCCW, Outside},
+		{"outside right", model.Coordinate{11, 5}, squareCCW, Outside},
+		{"outside above", model.Coordinate{5, 11}, squareCW, Outside},
+		{"on vertex", model.Coordinate{10, 10}, squareCCW, OnBoundary},
+		{"on horizontal edge", model.Coordinate{5, 0}, squareCCW, OnBoundary},
+		{"on vertical edge", model.Coordinate{0, 5}, squareCW, OnBoundary},
+		{"ray along horizontal edge outside", model.Coordinate{-5, 0}, squareCCW, Outside},
+		{"on top edge clockwise", model.Coordinate{5, 10}, squareCW, OnBoundary},
+		{"ray through valley vertices from inside", model.Coordinate{1, 5}, zigzag, Inside},
+		{"ray through valley vertices from outside", model.Coordinate{-1, 5}, zigzag, Outside},
+		{"ray through peak vertex", model.Coordinate{0.5, 10}, zigzag, Outside},
+		{"inside peak", model.Coordinate{5, 9}, zigzag, Inside},
+		{"inside notch", model.Coordinate{3, 9}, zigzag, Outside},
+		{"below valleys", model.Coordinate{5, 4}, zigzag, Inside},
+		{"on valley vertex", model.Coordinate{3, 5}, zigzag, OnBoundary},
+		{"unclosed ring", model.Coordinate{5, 5}, squareCCW[:4], Inside},
+		{"unclosed ring boundary", model.Coordinate{0, 5}, squareCCW[:4], OnBoundary},
+		{"duplicate vertices", model.Coordinate{5, 5}, []model.Coordinate{{0, 0}, {0, 0}, {10, 0}, {10, 10}, {10, 10}, {0, 10}, {0, 0}}, Inside},
+		{"empty ring", model.Coordinate{0, 0}, nil, Outside},
+		{"single vertex", model.Coordinate{1, 1}, []model.Coordinate{{1, 1}}, OnBoundary},
+		{"collinear ring interior", model.Coordinate{5, 1}, []model.Coordinate{{0, 0}, {10, 0}, {0, 0}}, Outside},
+		{"collinear ring on segment", model.Coordinate{5, 0}, []model.Coordinate{{0, 0}, {10, 0}, {0, 0}}, OnBoundary},
+		{"triangle with vertical edge", model.Coordinate{1, 1}, []model.Coordinate{{0, 0}, {4, 0}, {0, 4}, {0, 0}}, Inside},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := locator.LocateRing(tc.point, tc.ring); got != tc.want {
+				t.Errorf("LocateRing(%v) = %v, want %v", tc.point, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLocateTolerance(t *testing.T) {
+	cases := []struct {
+		name      string
+		tolerance float64
+		point     model.Coordinate
+		want      Position
+	}{
+		{"exact just inside", 0, model.Coordinate{1e-7, 5}, Inside},
+		{"exact just outside", 0, model.Coordinate{-1e-7, 5}, Outside},
+		{"tolerant just inside", 1e-6, model.Coordinate{1e-7, 5}, OnBoundary},
+		{"tolerant just outside", 1e-6, model.Coordinate{-1e-7, 5}, OnBoundary},
+		{"tolerant near vertex", 1e-6, model.Coordinate{10 + 1e-7, 10 + 1e-7}, OnBoundary},
+		{"tolerant beyond", 1e-6, model.Coordinate{-1e-5, 5}, Outside},
+		{"negative uses default", -1, model.Coordinate{-1e-10, 5}, OnBoundary},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			locator := NewLocator(tc.tolerance)
+			if got := locator.LocateRing(tc.point, squareCCW); got != tc.want {
+				t.Errorf("LocateRing(%v) = %v, want %v", tc.point, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLocateGeometry(t *testing.T) {
+	withHole := model.NewPolygon(squareCCW, hole)
+	multi := model.NewMultiPolygon(
+		[][]model.Coordinate{squareCW},
+		[][]model.Coordinate{{{20, 20}, {30, 20}, {30, 30}, {20, 30}, {20, 20}}},
+	)
+	touching := model.NewMultiPolygon(
+		[][]model.Coordinate{squareCCW},
+		[][]model.Coordinate{{{10, 0}, {20, 0}, {20, 10}, {10, 10}, {10, 0}}},
+	)
+	cases := []struct {
+		name  string
+		point model.Coordinate
+		geom  model.PolyGeometry
+		want  Position
+	}{
+		{"inside shell", model.Coordinate{2, 2}, withHole, Inside},
+		{"inside hole", model.Coordinate{5, 5}, withHole, Outside},
+		{"on hole boundary", model.Coordinate{4, 5}, withHole, OnBoundary},
+		{"first member", model.Coordinate{5, 5}, multi, Inside},
+		{"second member", model.Coordinate{25, 25}, multi, Inside},
+		{"between members", model.Coordinate{15, 15}, multi, Outside},
+		{"shared edge", model.Coordinate{10, 5}, touching, OnBoundary},
+		{"empty geometry", model.Coordinate{0, 0}, model.PolyGeometry{Type: model.PolygonType}, Outside},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Locate(tc.point, tc.geom); got != tc.want {
+				t.Errorf("Locate(%v) = %v, want %v", tc.point, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInGeometryCountsBoundaryAsInside(t *testing.T) {
+	geom := model.NewPolygon(squareCCW)
+	if !InGeometry(model.Coordinate{0, 5}, geom) {
+		t.Error("expected boundary point to be inside")
+	}
+	if InGeometry(model.Coordinate{-1, 5}, geom) {
+		t.Error("expected exterior point to be outside")
+	}
+}
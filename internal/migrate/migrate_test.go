@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFromOrdersByVersion(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/10_ten.up.sql":     {Data: []byte("create table ten ();")},
+		"migrations/10_ten.down.sql":   {Data: []byte("drop table ten;")},
+		"migrations/0002_two.up.sql":   {Data: []byte("create table two ();")},
+		"migrations/0002_two.down.sql": {Data: []byte("drop table two;")},
+		"migrations/1_one.up.sql":      {Data: []byte("create table one ();")},
+		"migrations/1_one.down.sql":    {Data: []byte("drop table one;")},
+		"migrations/README.md":         {Data: []byte("not a migration")},
+	}
+	migrations, err := loadFrom(files, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, migration := range migrations {
+		names = append(names, migration.Name)
+	}
+	if strings.Join(names, ",") != "one,two,ten" {
+		t.Fatalf("migrations = %v, want one,two,ten", names)
+	}
+	if migrations[1].Version != 2 || migrations[1].Up != "create table two ();" || migrations[1].Down != "drop table two;" {
+		t.Errorf("second migration = %+v", migrations[1])
+	}
+}
+
+func TestLoadFromRejectsBadMigrations(t *testing.T) {
+	for name, test := range map[string]struct {
+		files fstest.MapFS
+		want  string
+	}{
+		"no version": {
+			files: fstest.MapFS{
+				"migrations/one.up.sql":   {Data: []byte("select 1;")},
+				"migrations/one.down.sql": {Data: []byte("select 1;")},
+			},
+			want: "is not named <version>_<name>",
+		},
+		"version not a number": {
+			files: fstest.MapFS{
+				"migrations/first_one.up.sql":   {Data: []byte("select 1;")},
+				"migrations/first_one.down.sql": {Data: []byte("select 1;")},
+			},
+			want: "is not named <version>_<name>",
+		},
+		"missing down": {
+			files: fstest.MapFS{
+				"migrations/1_one.up.sql": {Data: []byte("select 1;")},
+			},
+			want: "needs both an up and a down file",
+		},
+		"two names for a version": {
+			files: fstest.MapFS{
+				"migrations/1_one.up.sql":   {Data: []byte("select 1;")},
+				"migrations/1_uno.down.sql": {Data: []byte("select 1;")},
+			},
+			want: "has more than one name",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadFrom(test.files, "migrations")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("loadFrom error = %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d has version %d, want versions numbered from 1 without gaps", i, migration.Version)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+-- IF NOT EXISTS lets databases created by hand before migrations existed adopt this version.
+CREATE TABLE IF NOT EXISTS store_locations (
+	id integer PRIMARY KEY,
+	name text,
+	created_at timestamp,
+	updated_at timestamp,
+	street1 text,
+	zip text,
+	city text,
+	state text,
+	metro_id bigint,
+	longitude double precision,
+	latitude double precision,
+	street2 text,
+	zone_id bigint,
+	store_id bigint,
+	county text,
+	deleted_at timestamp,
+	opening_hour integer,
+	closing_hour integer,
+	store_number text,
+	store_group text,
+	active boolean,
+	allows_pickup boolean,
+	is_envoy_only boolean,
+	service_area_id bigint,
+	sells_alcohol boolean,
+	tax_exempt boolean
+);
+
+CREATE INDEX IF NOT EXISTS store_locations_store_id_idx ON store_locations (store_id);
+CREATE INDEX IF NOT EXISTS store_locations_metro_id_idx ON store_locations (metro_id);
+CREATE INDEX IF NOT EXISTS store_locations_zone_id_idx ON store_locations (zone_id);
+
+-- FindClosest searches with ST_DWithin(ST_MakePoint(longitude, latitude), ...).
+CREATE INDEX IF NOT EXISTS store_locations_point_idx ON store_locations USING gist (ST_MakePoint(longitude, latitude));
@@ -0,0 +1,7 @@
+-- polygon holds a Polygon or MultiPolygon, written with ST_GeomFromGeoJSON.
+CREATE TABLE IF NOT EXISTS store_polygons (
+	id integer PRIMARY KEY REFERENCES store_locations (id) ON DELETE CASCADE,
+	polygon geometry NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS store_polygons_polygon_idx ON store_polygons USING gist (polygon);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS fence_events;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS fence_events (
+	id bigserial PRIMARY KEY,
+	device_id text NOT NULL,
+	event_type text NOT NULL,
+	location_id integer NOT NULL,
+	store_id bigint NOT NULL DEFAULT 0,
+	metro_id bigint NOT NULL DEFAULT 0,
+	zone_id bigint NOT NULL DEFAULT 0,
+	longitude double precision NOT NULL,
+	latitude double precision NOT NULL,
+	occurred_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS fence_events_occurred_at_idx ON fence_events (occurred_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS fence_events_device_id_idx ON fence_events (device_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS fence_events_location_id_idx ON fence_events (location_id, occurred_at DESC);
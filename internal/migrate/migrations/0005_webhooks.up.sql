@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id bigserial PRIMARY KEY,
+	url text NOT NULL,
+	secret text NOT NULL,
+	store_id bigint NOT NULL DEFAULT 0,
+	metro_id bigint NOT NULL DEFAULT 0,
+	zone_id bigint NOT NULL DEFAULT 0,
+	event_types text[],
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Dead letters outlive the subscription they were sent to, so subscription_id is not a foreign key.
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+	id bigserial PRIMARY KEY,
+	subscription_id bigint NOT NULL,
+	payload text NOT NULL,
+	attempts integer NOT NULL,
+	last_error text NOT NULL,
+	failed_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_dead_letters_failed_at_idx ON webhook_dead_letters (failed_at DESC, id DESC);
@@ -0,0 +1,18 @@
+-- Every change to store_polygons, numbered per polygon. polygon is NULL for a version recording a delete.
+-- Versions outlive the polygon they describe, so polygon_id is not a foreign key.
+CREATE TABLE IF NOT EXISTS polygon_versions (
+	polygon_id integer NOT NULL,
+	version integer NOT NULL,
+	action text NOT NULL,
+	polygon geometry,
+	changed_by text NOT NULL DEFAULT '',
+	reason text NOT NULL DEFAULT '',
+	rolled_back_to integer,
+	changed_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (polygon_id, version)
+);
+
+-- Existing polygons start with a first version so that their next change can be rolled back.
+INSERT INTO polygon_versions (polygon_id, version, action, polygon, reason)
+SELECT id, 1, 'create', polygon, 'stored before version history' FROM store_polygons
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+-- How /poly/closest ranks a store's locations against other stores' when it cannot tell them apart. Higher wins;
+-- stores without a row have priority 0.
+CREATE TABLE IF NOT EXISTS store_priorities (
+	store_id bigint PRIMARY KEY,
+	priority integer NOT NULL DEFAULT 0,
+	updated_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1 @@
+ALTER TABLE store_locations DROP COLUMN IF EXISTS time_zone;
@@ -0,0 +1,3 @@
+-- The IANA time zone a store keeps its hours in, such as America/Chicago. Where it is NULL the zone is taken
+-- from the store's state, which is wrong for stores in the minority zone of a state spanning two.
+ALTER TABLE store_locations ADD COLUMN IF NOT EXISTS time_zone text;
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"fmt"
+)
+
+// Coordinate is a position in GeoJSON order: [longitude, latitude], i.e. x then y.
+// This is the only ordering used inside the service and in PostGIS (ST_MakePoint(x, y)).
+type Coordinate [2]float64
+
+func NewCoordinate(lon, lat float64) Coordinate {
+	return Coordinate{lon, lat}
+}
+
+func (c Coordinate) Lon() float64 {
+	return c[0]
+}
+
+func (c Coordinate) Lat() float64 {
+	return c[1]
+}
+
+// Swap exchanges the axes, converting between [lon, lat] and [lat, lon].
+func (c Coordinate) Swap() Coordinate {
+	return Coordinate{c[1], c[0]}
+}
+
+// Validate checks that the longitude and latitude are within range.
+func (c Coordinate) Validate() error {
+	if c.Lon() < -180 || c.Lon() > 180 {
+		return fmt.Errorf("longitude %v out of range [-180, 180]", c.Lon())
+	}
+	if c.Lat() < -90 || c.Lat() > 90 {
+		return fmt.Errorf("latitude %v out of range [-90, 90]", c.Lat())
+	}
+	return nil
+}
+
+// AxisOrder describes the order in which a client sends and receives coordinates.
+type AxisOrder string
+
+const (
+	LonLat AxisOrder = "lonlat"
+	LatLon AxisOrder = "latlon"
+)
+
+// ParseAxisOrder parses the axis_order request option. An empty value means LonLat.
+func ParseAxisOrder(value string) (AxisOrder, error) {
+	switch AxisOrder(value) {
+	case "", LonLat:
+		return LonLat, nil
+	case LatLon:
+		return LatLon, nil
+	}
+	return "", fmt.Errorf("unknown axis_order %q, expected %q or %q", value, LonLat, LatLon)
+}
+
+// Convert translates a coordinate between this order and LonLat. The conversion is its own inverse.
+func (o AxisOrder) Convert(c Coordinate) Coordinate {
+	if o == LatLon {
+		return c.Swap()
+	}
+	return c
+}
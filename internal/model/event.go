@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	EnterEvent = "ENTER"
+	ExitEvent  = "EXIT"
+	DwellEvent = "DWELL"
+	// A point was found inside a fence by a membership lookup. Match events have no device and are not stored.
+	MatchEvent = "MATCH"
+)
+
+// FenceEvent records a device crossing into, out of, or lingering in a stored fence.
+// LocationID is the store_locations id the fence belongs to.
+type FenceEvent struct {
+	ID         int64     `json:"id" db:"id"`
+	DeviceID   string    `json:"device_id" db:"device_id"`
+	EventType  string    `json:"event_type" db:"event_type"`
+	LocationID int       `json:"location_id" db:"location_id"`
+	StoreID    int64     `json:"store_id" db:"store_id"`
+	MetroID    int64     `json:"metro_id" db:"metro_id"`
+	ZoneID     int64     `json:"zone_id" db:"zone_id"`
+	Longitude  float64   `json:"longitude" db:"longitude"`
+	Latitude   float64   `json:"latitude" db:"latitude"`
+	OccurredAt time.Time `json:"occurred_at" db:"occurred_at"`
+}
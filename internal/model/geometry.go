@@ -1,5 +1,16 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	PolygonType      = "Polygon"
+	MultiPolygonType = "MultiPolygon"
+	PointType        = "Point"
+)
+
 type Polygon struct {
 	Name	string `json:"name" validate:"required"`
 	Polygon PolyGeometry `json:"polygon" validate:"required"`
@@ -7,12 +18,109 @@ type Polygon struct {
 
 type Geometry interface {}
 
+// PolyGeometry is a GeoJSON Polygon or MultiPolygon.
+// Each member of Polygons is a list of rings: the exterior ring followed by any interior rings (holes).
+// A Polygon is held as a single member so both types can be evaluated the same way.
 type PolyGeometry struct {
-	Type string `json:"type" validate:"required"`
-	Coordinates [][][2]float64 `json:"coordinates" validate:"required"`
+	Type string `json:"type" validate:"required,oneof=Polygon MultiPolygon"`
+	Polygons [][][]Coordinate `json:"-" validate:"required,min=1"`
 }
 
 type PointGeometry struct {
 	Type string `json:"type" validate:"required"`
-	Coordinates [2]float64 `json:"coordinates" validate:"required"`
-}
\ No newline at end of file
+	Coordinates Coordinate `json:"coordinates" validate:"required"`
+}
+
+// The GeoJSON wire format of a PolyGeometry, whose coordinates depend on the type.
+type polyGeometryJSON struct {
+	Type string `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates,omitempty"`
+}
+
+// NewPolygon builds a Polygon geometry from an exterior ring and optional holes.
+func NewPolygon(rings ...[]Coordinate) PolyGeometry {
+	return PolyGeometry{Type: PolygonType, Polygons: [][][]Coordinate{rings}}
+}
+
+// NewMultiPolygon builds a MultiPolygon geometry from a list of polygons.
+func NewMultiPolygon(polygons ...[][]Coordinate) PolyGeometry {
+	return PolyGeometry{Type: MultiPolygonType, Polygons: polygons}
+}
+
+func (g PolyGeometry) MarshalJSON() ([]byte, error) {
+	var coordinates interface{} = g.Polygons
+	if g.Type == PolygonType && len(g.Polygons) > 0 {
+		coordinates = g.Polygons[0]
+	}
+	raw, err := json.Marshal(coordinates)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(polyGeometryJSON{Type: g.Type, Coordinates: raw})
+}
+
+// Unknown types are kept without coordinates so that validation rejects them.
+func (g *PolyGeometry) UnmarshalJSON(data []byte) error {
+	var wire polyGeometryJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	g.Type = wire.Type
+	g.Polygons = nil
+	if len(wire.Coordinates) == 0 || string(wire.Coordinates) == "null" {
+		return nil
+	}
+
+	switch wire.Type {
+	case PolygonType:
+		var rings [][]Coordinate
+		if err := json.Unmarshal(wire.Coordinates, &rings); err != nil {
+			return err
+		}
+		if rings != nil {
+			g.Polygons = [][][]Coordinate{rings}
+		}
+	case MultiPolygonType:
+		if err := json.Unmarshal(wire.Coordinates, &g.Polygons); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks every coordinate of the geometry is within range.
+func (g PolyGeometry) Validate() error {
+	for p, rings := range g.Polygons {
+		for r, ring := range rings {
+			for i, coordinate := range ring {
+				if err := coordinate.Validate(); err != nil {
+					return fmt.Errorf("polygon %d ring %d position %d: %v", p, r, i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WithAxisOrder returns a copy of the geometry with every coordinate converted by the given order.
+func (g PolyGeometry) WithAxisOrder(order AxisOrder) PolyGeometry {
+	polygons := make([][][]Coordinate, len(g.Polygons))
+	for p, rings := range g.Polygons {
+		polygons[p] = make([][]Coordinate, len(rings))
+		for r, ring := range rings {
+			polygons[p][r] = make([]Coordinate, len(ring))
+			for i, coordinate := range ring {
+				polygons[p][r][i] = order.Convert(coordinate)
+			}
+		}
+	}
+	return PolyGeometry{Type: g.Type, Polygons: polygons}
+}
+
+func (g PointGeometry) Validate() error {
+	return g.Coordinates.Validate()
+}
+
+func (g PointGeometry) WithAxisOrder(order AxisOrder) PointGeometry {
+	return PointGeometry{Type: g.Type, Coordinates: order.Convert(g.Coordinates)}
+}
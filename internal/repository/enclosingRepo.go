@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"github.com/geofence/internal/model"
+)
+
+// EnclosingQuery asks for the locations that have not been deleted whose polygon contains Point. Each non-zero
+// StoreID, MetroID and ZoneID restricts the search to locations with that ID.
+type EnclosingQuery struct {
+	Point   model.Coordinate
+	StoreID int
+	MetroID int
+	ZoneID  int
+}
+
+// FindEnclosingPolygon returns the locations an EnclosingQuery asks for, ordered by ID. Fences may overlap, so there
+// can be any number of them.
+func (c *PolygonPostgresRepository) FindEnclosingPolygon(query EnclosingQuery) ([]LocationRowNull, error) {
+	querySQL := `SELECT sl.* FROM store_locations sl JOIN store_polygons sp ON sp.id = sl.id
+				WHERE sl.deleted_at IS NULL AND ($3 = 0 OR sl.store_id = $3) AND ($4 = 0 OR sl.metro_id = $4)
+					AND ($5 = 0 OR sl.zone_id = $5) AND ST_Intersects(sp.polygon, ST_MakePoint($1, $2))
+				ORDER BY sl.id`
+	results := []LocationRowNull{}
+	err := c.DB.Select(&results, querySQL, query.Point.Lon(), query.Point.Lat(), query.StoreID, query.MetroID, query.ZoneID)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
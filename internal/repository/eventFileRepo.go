@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+	"github.com/pkg/errors"
+)
+
+// The file an EventFileRepository appends events to, one JSON object per line.
+const eventsFileName = "events.jsonl"
+
+// EventFileRepository keeps fence events in memory and appends them to events.jsonl in its directory, which is
+// read back when the repository is opened. Queries scan every event, so it suits the small volumes of a single store.
+type EventFileRepository struct {
+	mutex  sync.RWMutex
+	file   *os.File
+	events []model.FenceEvent
+}
+
+var _ EventRepository = (*EventFileRepository)(nil)
+
+// NewEventFileRepository opens the events kept in dir, creating the directory if it does not exist. A last line
+// left incomplete by a crash is discarded.
+func NewEventFileRepository(dir string) (*EventFileRepository, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, eventsFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	repo := &EventFileRepository{file: file}
+	read := 0
+	for line := 1; read < len(data); line++ {
+		end := bytes.IndexByte(data[read:], '\n')
+		if end < 0 {
+			break
+		}
+		var event model.FenceEvent
+		err = json.Unmarshal(data[read:read+end], &event)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "invalid event on line %d of %s", line, eventsFileName)
+		}
+		repo.events = append(repo.events, event)
+		read += end + 1
+	}
+	if read < len(data) {
+		err = file.Truncate(int64(read))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// Appends the events in a single write, filling in their IDs.
+func (c *EventFileRepository) InsertEvents(events []model.FenceEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	nextID := int64(1)
+	if len(c.events) > 0 {
+		nextID = c.events[len(c.events)-1].ID + 1
+	}
+	var lines bytes.Buffer
+	for i := range events {
+		events[i].ID = nextID + int64(i)
+		line, err := json.Marshal(events[i])
+		if err != nil {
+			return err
+		}
+		lines.Write(line)
+		lines.WriteByte('\n')
+	}
+	_, err := c.file.Write(lines.Bytes())
+	if err != nil {
+		return err
+	}
+	c.events = append(c.events, events...)
+	return nil
+}
+
+// Returns the events matching the query, newest first.
+func (c *EventFileRepository) QueryEvents(query EventQuery) ([]model.FenceEvent, error) {
+	c.mutex.RLock()
+	results := []model.FenceEvent{}
+	for _, event := range c.events {
+		if query.matches(event) {
+			results = append(results, event)
+		}
+	}
+	c.mutex.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].OccurredAt.Equal(results[j].OccurredAt) {
+			return results[i].OccurredAt.After(results[j].OccurredAt)
+		}
+		return results[i].ID > results[j].ID
+	})
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+// Close closes the events file.
+func (c *EventFileRepository) Close() error {
+	return c.file.Close()
+}
+
+// Helper function to determine whether an event satisfies the query, as the query built from it would.
+func (q EventQuery) matches(event model.FenceEvent) bool {
+	switch {
+	case q.DeviceID != "" && event.DeviceID != q.DeviceID,
+		q.EventType != "" && event.EventType != q.EventType,
+		q.LocationID != 0 && event.LocationID != q.LocationID,
+		q.StoreID != 0 && event.StoreID != q.StoreID,
+		q.MetroID != 0 && event.MetroID != q.MetroID,
+		q.ZoneID != 0 && event.ZoneID != q.ZoneID,
+		!q.Since.IsZero() && event.OccurredAt.Before(q.Since),
+		!q.Until.IsZero() && !event.OccurredAt.Before(q.Until):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geofence/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// EventRepository stores fence events and queries them back.
+type EventRepository interface {
+	InsertEvents(events []model.FenceEvent) error
+	QueryEvents(query EventQuery) ([]model.FenceEvent, error)
+}
+
+var _ EventRepository = (*EventPostgresRepository)(nil)
+
+// EventPostgresRepository stores fence events in the fence_events table, which has a bigserial id
+// followed by one column for every other field of model.FenceEvent.
+type EventPostgresRepository struct {
+	DB sqlx.DB
+}
+
+func NewEventRepository(db sqlx.DB) *EventPostgresRepository {
+	return &EventPostgresRepository{
+		DB: db,
+	}
+}
+
+// EventQuery filters fence events. Zero values match every event.
+type EventQuery struct {
+	DeviceID   string
+	EventType  string
+	LocationID int
+	StoreID    int64
+	MetroID    int64
+	ZoneID     int64
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// Inserts the events in a single transaction, filling in their generated IDs.
+func (c *EventPostgresRepository) InsertEvents(events []model.FenceEvent) error {
+	insertSQL := `INSERT INTO fence_events (
+		device_id,
+		event_type,
+		location_id,
+		store_id,
+		metro_id,
+		zone_id,
+		longitude,
+		latitude,
+		occurred_at
+	)
+	VALUES (
+		:device_id,
+		:event_type,
+		:location_id,
+		:store_id,
+		:metro_id,
+		:zone_id,
+		:longitude,
+		:latitude,
+		:occurred_at
+	)
+	RETURNING id
+	`
+	if len(events) == 0 {
+		return nil
+	}
+	transaction, err := c.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	rollback := false
+
+	defer func() {
+		if rollback {
+			transaction.Rollback()
+		} else {
+			_ = transaction.Commit()
+		}
+	}()
+
+	statement, err := transaction.PrepareNamed(insertSQL)
+	if err != nil {
+		rollback = true
+		return err
+	}
+	defer statement.Close()
+	for i := range events {
+		err = statement.Get(&events[i].ID, events[i])
+		if err != nil {
+			rollback = true
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the events matching the query, newest first.
+func (c *EventPostgresRepository) QueryEvents(query EventQuery) ([]model.FenceEvent, error) {
+	var clauses []string
+	var args []interface{}
+	addClause := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		clauses = append(clauses, clause+` $`+strconv.Itoa(len(args)))
+	}
+	if query.DeviceID != "" {
+		addClause(`device_id =`, query.DeviceID)
+	}
+	if query.EventType != "" {
+		addClause(`event_type =`, query.EventType)
+	}
+	if query.LocationID != 0 {
+		addClause(`location_id =`, query.LocationID)
+	}
+	if query.StoreID != 0 {
+		addClause(`store_id =`, query.StoreID)
+	}
+	if query.MetroID != 0 {
+		addClause(`metro_id =`, query.MetroID)
+	}
+	if query.ZoneID != 0 {
+		addClause(`zone_id =`, query.ZoneID)
+	}
+	if !query.Since.IsZero() {
+		addClause(`occurred_at >=`, query.Since)
+	}
+	if !query.Until.IsZero() {
+		addClause(`occurred_at <`, query.Until)
+	}
+
+	querySQL := `SELECT * FROM fence_events`
+	if len(clauses) > 0 {
+		querySQL += ` WHERE ` + strings.Join(clauses, ` AND `)
+	}
+	querySQL += ` ORDER BY occurred_at DESC, id DESC`
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		querySQL += ` LIMIT $` + strconv.Itoa(len(args))
+	}
+
+	results := []model.FenceEvent{}
+	err := c.DB.Select(&results, querySQL, args...)
+	if err != nil {
+		return []model.FenceEvent{}, err
+	}
+	return results, nil
+}
@@ -0,0 +1,444 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geofence/internal/model"
+)
+
+// Limits on the size of a LocationFilter, so a single request cannot build an arbitrarily large query.
+const (
+	maxFilterDepth      = 8
+	maxFilterConditions = 100
+	maxFilterListLength = 1000
+)
+
+// The type of value a store_locations column holds, used to decode and check filter values.
+type columnKind int
+
+const (
+	intColumn columnKind = iota
+	floatColumn
+	stringColumn
+	boolColumn
+	timeColumn
+)
+
+// The store_locations columns a LocationFilter may reference. Anything else is rejected.
+var locationColumns = map[string]columnKind{
+	"id":              intColumn,
+	"name":            stringColumn,
+	"created_at":      timeColumn,
+	"updated_at":      timeColumn,
+	"street1":         stringColumn,
+	"street2":         stringColumn,
+	"zip":             stringColumn,
+	"city":            stringColumn,
+	"state":           stringColumn,
+	"county":          stringColumn,
+	"metro_id":        intColumn,
+	"zone_id":         intColumn,
+	"store_id":        intColumn,
+	"longitude":       floatColumn,
+	"latitude":        floatColumn,
+	"deleted_at":      timeColumn,
+	"opening_hour":    intColumn,
+	"closing_hour":    intColumn,
+	"store_number":    stringColumn,
+	"store_group":     stringColumn,
+	"active":          boolColumn,
+	"allows_pickup":   boolColumn,
+	"is_envoy_only":   boolColumn,
+	"service_area_id": intColumn,
+	"sells_alcohol":   boolColumn,
+	"tax_exempt":      boolColumn,
+	"time_zone":       stringColumn,
+}
+
+// The comparison operators a Condition may use.
+var comparisonOperators = map[string]string{
+	"eq":  "=",
+	"ne":  "<>",
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+}
+
+// DistanceSortField sorts results by distance from Within.Point.
+const DistanceSortField = "distance"
+
+// FilterError reports a LocationFilter that cannot be turned into a query.
+type FilterError struct {
+	Reason string
+}
+
+func (e *FilterError) Error() string {
+	return "invalid filter: " + e.Reason
+}
+
+func filterErrorf(format string, args ...interface{}) error {
+	return &FilterError{fmt.Sprintf(format, args...)}
+}
+
+// LocationFilter selects store_locations rows. The LocationQuery fields are kept for existing callers and are
+// ANDed with Where and Within. Soft-deleted rows are left out unless IncludeDeleted is set.
+type LocationFilter struct {
+	LocationQuery
+	Where          *Condition     `json:"where"`
+	Within         *SpatialFilter `json:"within"`
+	Sort           []SortField    `json:"sort"`
+	IncludeDeleted bool           `json:"include_deleted"`
+}
+
+// Condition is a node of a filter expression. It is either a combination of other conditions (exactly one of And,
+// Or or Not) or a comparison of Field using Op:
+//
+//	eq, ne, lt, lte, gt, gte  Value is a single value of the column's type
+//	in, not_in                Value is a list of values
+//	between                   Value is a [low, high] pair, both inclusive
+//	is_null                   Value is true for IS NULL or false for IS NOT NULL
+type Condition struct {
+	And   []Condition     `json:"and,omitempty"`
+	Or    []Condition     `json:"or,omitempty"`
+	Not   *Condition      `json:"not,omitempty"`
+	Field string          `json:"field,omitempty"`
+	Op    string          `json:"op,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SpatialFilter restricts locations to a bounding box, or to within Meters of Point. Point is in model.LonLat.
+type SpatialFilter struct {
+	BBox   *BoundingBox      `json:"bbox"`
+	Point  *model.Coordinate `json:"point"`
+	Meters float64           `json:"meters"`
+}
+
+type BoundingBox struct {
+	MinLon float64 `json:"min_lon"`
+	MinLat float64 `json:"min_lat"`
+	MaxLon float64 `json:"max_lon"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// ParseLocationFilter decodes a LocationFilter, rejecting unknown keys, and checks it can be built into a query.
+func ParseLocationFilter(body []byte) (LocationFilter, error) {
+	var filter LocationFilter
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&filter); err != nil {
+		return LocationFilter{}, &FilterError{err.Error()}
+	}
+	if _, err := filter.build(); err != nil {
+		return LocationFilter{}, err
+	}
+	return filter, nil
+}
+
+// WithAxisOrder returns a copy of the filter with its spatial coordinates converted by the given order.
+func (f LocationFilter) WithAxisOrder(order model.AxisOrder) LocationFilter {
+	if f.Within == nil {
+		return f
+	}
+	within := *f.Within
+	if within.Point != nil {
+		point := order.Convert(*within.Point)
+		within.Point = &point
+	}
+	if within.BBox != nil && order == model.LatLon {
+		within.BBox = &BoundingBox{
+			MinLon: within.BBox.MinLat,
+			MinLat: within.BBox.MinLon,
+			MaxLon: within.BBox.MaxLat,
+			MaxLat: within.BBox.MaxLon,
+		}
+	}
+	f.Within = &within
+	return f
+}
+
+// A parameterized query built from a LocationFilter. Values are only ever passed as args.
+type locationQuery struct {
+	clauses   []string
+	orderKeys []orderKey
+	args      []interface{}
+}
+
+// An expression results are ordered by. The last key is always sl.id, so the order is total.
+type orderKey struct {
+	expression string
+	desc       bool
+}
+
+// Helper function to add an argument and return its placeholder.
+func (q *locationQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return `$` + strconv.Itoa(len(q.args))
+}
+
+// Helper function to assemble the query, selecting from store_locations as sl joined to store_polygons as sp.
+func (q *locationQuery) sql(selectSQL string) string {
+	querySQL := selectSQL
+	if len(q.clauses) > 0 {
+		querySQL += ` WHERE ` + strings.Join(q.clauses, ` AND `)
+	}
+	orderBy := make([]string, len(q.orderKeys))
+	for i, key := range q.orderKeys {
+		orderBy[i] = key.expression
+		if key.desc {
+			orderBy[i] += ` DESC`
+		}
+	}
+	return querySQL + ` ORDER BY ` + strings.Join(orderBy, `, `)
+}
+
+func (f LocationFilter) build() (*locationQuery, error) {
+	q := &locationQuery{}
+	if !f.IncludeDeleted {
+		q.clauses = append(q.clauses, `sl.deleted_at IS NULL`)
+	}
+	legacy := []struct {
+		column string
+		set    bool
+		value  interface{}
+	}{
+		{"id", f.ID != 0, f.ID},
+		{"store_id", f.StoreID != 0, f.StoreID},
+		{"metro_id", f.MetroID != 0, f.MetroID},
+		{"zone_id", f.ZoneID != 0, f.ZoneID},
+		{"city", f.City != "", f.City},
+		{"state", f.State != "", f.State},
+	}
+	for _, field := range legacy {
+		if field.set {
+			q.clauses = append(q.clauses, `sl.`+field.column+` = `+q.arg(field.value))
+		}
+	}
+
+	if f.Where != nil {
+		count := 0
+		clause, err := f.Where.build(q, 1, &count)
+		if err != nil {
+			return nil, err
+		}
+		q.clauses = append(q.clauses, clause)
+	}
+
+	if f.Within != nil {
+		clause, err := f.Within.build(q)
+		if err != nil {
+			return nil, err
+		}
+		q.clauses = append(q.clauses, clause)
+	}
+
+	for _, sort := range f.Sort {
+		if sort.Field == DistanceSortField {
+			if f.Within == nil || f.Within.Point == nil {
+				return nil, filterErrorf("sorting by distance requires within.point")
+			}
+			q.orderKeys = append(q.orderKeys, orderKey{`ST_Distance(` + locationGeography + `, ` + pointGeography(q, *f.Within.Point) + `)`, sort.Desc})
+			continue
+		}
+		if _, ok := locationColumns[sort.Field]; !ok {
+			return nil, filterErrorf("unknown sort field %q", sort.Field)
+		}
+		q.orderKeys = append(q.orderKeys, orderKey{`sl.` + sort.Field, sort.Desc})
+	}
+	q.orderKeys = append(q.orderKeys, orderKey{`sl.id`, false})
+	return q, nil
+}
+
+func (c Condition) build(q *locationQuery, depth int, count *int) (string, error) {
+	if depth > maxFilterDepth {
+		return "", filterErrorf("conditions nested deeper than %d", maxFilterDepth)
+	}
+	*count++
+	if *count > maxFilterConditions {
+		return "", filterErrorf("more than %d conditions", maxFilterConditions)
+	}
+
+	forms := 0
+	for _, set := range []bool{c.And != nil, c.Or != nil, c.Not != nil, c.Field != ""} {
+		if set {
+			forms++
+		}
+	}
+	if forms != 1 {
+		return "", filterErrorf("a condition must have exactly one of and, or, not or field")
+	}
+
+	switch {
+	case c.And != nil:
+		return buildGroup(q, c.And, ` AND `, depth, count)
+	case c.Or != nil:
+		return buildGroup(q, c.Or, ` OR `, depth, count)
+	case c.Not != nil:
+		clause, err := c.Not.build(q, depth+1, count)
+		if err != nil {
+			return "", err
+		}
+		return `NOT (` + clause + `)`, nil
+	}
+	return c.buildComparison(q)
+}
+
+func buildGroup(q *locationQuery, conditions []Condition, separator string, depth int, count *int) (string, error) {
+	if len(conditions) == 0 {
+		return "", filterErrorf("and/or must contain at least one condition")
+	}
+	clauses := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		clause, err := condition.build(q, depth+1, count)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, clause)
+	}
+	return `(` + strings.Join(clauses, separator) + `)`, nil
+}
+
+func (c Condition) buildComparison(q *locationQuery) (string, error) {
+	kind, ok := locationColumns[c.Field]
+	if !ok {
+		return "", filterErrorf("unknown field %q", c.Field)
+	}
+	column := `sl.` + c.Field
+
+	if operator, ok := comparisonOperators[c.Op]; ok {
+		if kind == boolColumn && c.Op != "eq" && c.Op != "ne" {
+			return "", filterErrorf("%s on boolean field %q", c.Op, c.Field)
+		}
+		value, err := decodeValue(c.Field, kind, c.Value)
+		if err != nil {
+			return "", err
+		}
+		return column + ` ` + operator + ` ` + q.arg(value), nil
+	}
+
+	switch c.Op {
+	case "in", "not_in":
+		var raw []json.RawMessage
+		if err := json.Unmarshal(c.Value, &raw); err != nil || len(raw) == 0 {
+			return "", filterErrorf("%s on %q needs a non-empty list", c.Op, c.Field)
+		}
+		if len(raw) > maxFilterListLength {
+			return "", filterErrorf("%s on %q has more than %d values", c.Op, c.Field, maxFilterListLength)
+		}
+		placeholders := make([]string, len(raw))
+		for i, item := range raw {
+			value, err := decodeValue(c.Field, kind, item)
+			if err != nil {
+				return "", err
+			}
+			placeholders[i] = q.arg(value)
+		}
+		operator := ` IN (`
+		if c.Op == "not_in" {
+			operator = ` NOT IN (`
+		}
+		return column + operator + strings.Join(placeholders, `, `) + `)`, nil
+	case "between":
+		var raw []json.RawMessage
+		if err := json.Unmarshal(c.Value, &raw); err != nil || len(raw) != 2 {
+			return "", filterErrorf("between on %q needs a [low, high] pair", c.Field)
+		}
+		if kind == boolColumn {
+			return "", filterErrorf("between on boolean field %q", c.Field)
+		}
+		low, err := decodeValue(c.Field, kind, raw[0])
+		if err != nil {
+			return "", err
+		}
+		high, err := decodeValue(c.Field, kind, raw[1])
+		if err != nil {
+			return "", err
+		}
+		return column + ` BETWEEN ` + q.arg(low) + ` AND ` + q.arg(high), nil
+	case "is_null":
+		var isNull bool
+		if err := json.Unmarshal(c.Value, &isNull); err != nil {
+			return "", filterErrorf("is_null on %q needs true or false", c.Field)
+		}
+		if isNull {
+			return column + ` IS NULL`, nil
+		}
+		return column + ` IS NOT NULL`, nil
+	}
+	return "", filterErrorf("unknown op %q", c.Op)
+}
+
+// Helper function to decode a filter value as the Go type matching the column.
+func decodeValue(field string, kind columnKind, raw json.RawMessage) (interface{}, error) {
+	var err error
+	var value interface{}
+	switch kind {
+	case intColumn:
+		var v int64
+		err = json.Unmarshal(raw, &v)
+		value = v
+	case floatColumn:
+		var v float64
+		err = json.Unmarshal(raw, &v)
+		value = v
+	case stringColumn:
+		var v string
+		err = json.Unmarshal(raw, &v)
+		value = v
+	case boolColumn:
+		var v bool
+		err = json.Unmarshal(raw, &v)
+		value = v
+	case timeColumn:
+		var v time.Time
+		err = json.Unmarshal(raw, &v)
+		value = v
+	}
+	if err != nil || len(raw) == 0 || string(raw) == "null" {
+		return nil, filterErrorf("missing or invalid value %s for field %q", string(raw), field)
+	}
+	return value, nil
+}
+
+// A store location's coordinates as a geography, for distances in meters.
+const locationGeography = `ST_SetSRID(ST_MakePoint(sl.longitude, sl.latitude), 4326)::geography`
+
+func pointGeography(q *locationQuery, point model.Coordinate) string {
+	return `ST_SetSRID(ST_MakePoint(` + q.arg(point.Lon()) + `, ` + q.arg(point.Lat()) + `), 4326)::geography`
+}
+
+func (s SpatialFilter) build(q *locationQuery) (string, error) {
+	if (s.BBox == nil) == (s.Point == nil) {
+		return "", filterErrorf("within needs exactly one of bbox or point")
+	}
+	if s.BBox != nil {
+		box := s.BBox
+		for _, corner := range []model.Coordinate{model.NewCoordinate(box.MinLon, box.MinLat), model.NewCoordinate(box.MaxLon, box.MaxLat)} {
+			if err := corner.Validate(); err != nil {
+				return "", filterErrorf("bbox: %v", err)
+			}
+		}
+		if box.MinLon > box.MaxLon || box.MinLat > box.MaxLat {
+			return "", filterErrorf("bbox minimums must not exceed maximums")
+		}
+		return `ST_MakePoint(sl.longitude, sl.latitude) && ST_MakeEnvelope(` + q.arg(box.MinLon) + `, ` + q.arg(box.MinLat) +
+			`, ` + q.arg(box.MaxLon) + `, ` + q.arg(box.MaxLat) + `)`, nil
+	}
+	if err := s.Point.Validate(); err != nil {
+		return "", filterErrorf("point: %v", err)
+	}
+	if s.Meters <= 0 {
+		return "", filterErrorf("within.point needs a positive meters")
+	}
+	return `ST_DWithin(` + locationGeography + `, ` + pointGeography(q, *s.Point) + `, ` + q.arg(s.Meters) + `)`, nil
+}
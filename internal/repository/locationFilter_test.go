@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a condition nested depth levels deep, counting the comparison at the bottom.
+func nested(depth int) string {
+	condition := `{"field": "id", "op": "eq", "value": 1}`
+	for i := 1; i < depth; i++ {
+		condition = `{"not": ` + condition + `}`
+	}
+	return condition
+}
+
+// Returns an and of n comparisons, which is n+1 conditions.
+func conditions(n int) string {
+	comparisons := make([]string, n)
+	for i := range comparisons {
+		comparisons[i] = fmt.Sprintf(`{"field": "id", "op": "eq", "value": %d}`, i)
+	}
+	return `{"and": [` + strings.Join(comparisons, ", ") + `]}`
+}
+
+func list(n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = fmt.Sprint(i)
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+func TestParseLocationFilterRejects(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		reason string
+	}{
+		{"unknown key", `{"wehre": {"field": "id", "op": "eq", "value": 1}}`, `unknown field "wehre"`},
+		{"unknown condition key", `{"where": {"field": "id", "op": "eq", "value": 1, "column": "x"}}`, `unknown field "column"`},
+		{"unknown column", `{"where": {"field": "polygon", "op": "eq", "value": "x"}}`, `unknown field "polygon"`},
+		{"column injection", `{"where": {"field": "id = 1 OR 1", "op": "eq", "value": 1}}`, `unknown field "id = 1 OR 1"`},
+		{"unknown op", `{"where": {"field": "id", "op": "like", "value": 1}}`, `unknown op "like"`},
+		{"operator injection", `{"where": {"field": "id", "op": "= 1 OR 1 =", "value": 1}}`, `unknown op "= 1 OR 1 ="`},
+		{"ordering a boolean", `{"where": {"field": "active", "op": "gt", "value": true}}`, `gt on boolean field "active"`},
+		{"between a boolean", `{"where": {"field": "active", "op": "between", "value": [false, true]}}`, `between on boolean field "active"`},
+		{"wrong value type", `{"where": {"field": "id", "op": "eq", "value": "1"}}`, `invalid value "1" for field "id"`},
+		{"null value", `{"where": {"field": "name", "op": "eq", "value": null}}`, `missing or invalid value null`},
+		{"missing value", `{"where": {"field": "name", "op": "eq"}}`, `missing or invalid value`},
+		{"empty in", `{"where": {"field": "id", "op": "in", "value": []}}`, `in on "id" needs a non-empty list`},
+		{"long in", `{"where": {"field": "id", "op": "not_in", "value": ` + list(1001) + `}}`, `not_in on "id" has more than 1000 values`},
+		{"between one value", `{"where": {"field": "id", "op": "between", "value": [1]}}`, `needs a [low, high] pair`},
+		{"is_null not bool", `{"where": {"field": "city", "op": "is_null", "value": "yes"}}`, `is_null on "city" needs true or false`},
+		{"two forms", `{"where": {"and": [], "field": "id", "op": "eq", "value": 1}}`, `exactly one of and, or, not or field`},
+		{"empty condition", `{"where": {}}`, `exactly one of and, or, not or field`},
+		{"empty and", `{"where": {"and": []}}`, `at least one condition`},
+		{"too deep", `{"where": ` + nested(9) + `}`, `nested deeper than 8`},
+		{"too many", `{"where": ` + conditions(100) + `}`, `more than 100 conditions`},
+		{"unknown sort", `{"sort": [{"field": "polygon"}]}`, `unknown sort field "polygon"`},
+		{"distance without point", `{"sort": [{"field": "distance"}]}`, `sorting by distance requires within.point`},
+		{"within both", `{"within": {"bbox": {"max_lon": 1, "max_lat": 1}, "point": [0, 0], "meters": 5}}`, `exactly one of bbox or point`},
+		{"within neither", `{"within": {}}`, `exactly one of bbox or point`},
+		{"inverted bbox", `{"within": {"bbox": {"min_lon": 1, "max_lon": 0}}}`, `minimums must not exceed maximums`},
+		{"bbox out of range", `{"within": {"bbox": {"min_lon": -200, "max_lon": 0}}}`, `bbox:`},
+		{"no meters", `{"within": {"point": [0, 0]}}`, `positive meters`},
+		{"not json", `{"where": `, `unexpected EOF`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseLocationFilter([]byte(c.body))
+			if _, ok := err.(*FilterError); !ok || !strings.Contains(err.Error(), c.reason) {
+				t.Errorf("error = %v, want a FilterError containing %q", err, c.reason)
+			}
+		})
+	}
+
+	for _, body := range []string{`{"where": ` + nested(8) + `}`, `{"where": ` + conditions(99) + `}`, `{"where": {"field": "id", "op": "in", "value": ` + list(1000) + `}}`} {
+		if _, err := ParseLocationFilter([]byte(body)); err != nil {
+			t.Errorf("filter at the limits was rejected: %v", err)
+		}
+	}
+}
+
+func TestLocationFilterSQL(t *testing.T) {
+	const selectSQL = `SELECT sl.* FROM store_locations sl`
+	opened := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		name string
+		body string
+		sql  string
+		args []interface{}
+	}{
+		{
+			"empty",
+			`{}`,
+			selectSQL + ` WHERE sl.deleted_at IS NULL ORDER BY sl.id`,
+			nil,
+		},
+		{
+			"legacy fields and deleted",
+			`{"store_id": 7, "city": "Austin", "include_deleted": true}`,
+			selectSQL + ` WHERE sl.store_id = $1 AND sl.city = $2 ORDER BY sl.id`,
+			[]interface{}{7, "Austin"},
+		},
+		{
+			"values are only ever arguments",
+			`{"where": {"or": [{"field": "name", "op": "eq", "value": "x' OR '1'='1"}, {"not": {"field": "created_at", "op": "lt", "value": "2020-01-02T03:04:05Z"}}]}}`,
+			selectSQL + ` WHERE sl.deleted_at IS NULL AND (sl.name = $1 OR NOT (sl.created_at < $2)) ORDER BY sl.id`,
+			[]interface{}{"x' OR '1'='1", opened},
+		},
+		{
+			"lists, ranges and nulls",
+			`{"where": {"and": [{"field": "zone_id", "op": "not_in", "value": [1, 2]}, {"field": "latitude", "op": "between", "value": [30, 31.5]}, {"field": "county", "op": "is_null", "value": false}, {"field": "active", "op": "ne", "value": false}]}}`,
+			selectSQL + ` WHERE sl.deleted_at IS NULL AND (sl.zone_id NOT IN ($1, $2) AND sl.latitude BETWEEN $3 AND $4 AND sl.county IS NOT NULL AND sl.active <> $5) ORDER BY sl.id`,
+			[]interface{}{int64(1), int64(2), 30.0, 31.5, false},
+		},
+		{
+			"bbox and sort",
+			`{"within": {"bbox": {"min_lon": -98, "min_lat": 30, "max_lon": -97, "max_lat": 31}}, "sort": [{"field": "name", "desc": true}]}`,
+			selectSQL + ` WHERE sl.deleted_at IS NULL AND ST_MakePoint(sl.longitude, sl.latitude) && ST_MakeEnvelope($1, $2, $3, $4) ORDER BY sl.name DESC, sl.id`,
+			[]interface{}{-98.0, 30.0, -97.0, 31.0},
+		},
+		{
+			"distance",
+			`{"within": {"point": [-97.7, 30.3], "meters": 500}, "sort": [{"field": "distance"}]}`,
+			selectSQL + ` WHERE sl.deleted_at IS NULL AND ST_DWithin(` + locationGeography + `, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3)` +
+				` ORDER BY ST_Distance(` + locationGeography + `, ST_SetSRID(ST_MakePoint($4, $5), 4326)::geography), sl.id`,
+			[]interface{}{-97.7, 30.3, 500.0, -97.7, 30.3},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := ParseLocationFilter([]byte(c.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, err := filter.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := query.sql(selectSQL); got != c.sql {
+				t.Errorf("sql =\n%s\nwant\n%s", got, c.sql)
+			}
+			if !reflect.DeepEqual(query.args, c.args) {
+				t.Errorf("args = %#v, want %#v", query.args, c.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geofence/internal/model"
+)
+
+// The store_locations columns in table order, matching the db tags of LocationRowNull.
+var locationColumnNames = []string{
+	"id", "name", "created_at", "updated_at", "street1", "zip", "city", "state", "metro_id", "longitude", "latitude",
+	"street2", "zone_id", "store_id", "county", "deleted_at", "opening_hour", "closing_hour", "store_number",
+	"store_group", "active", "allows_pickup", "is_envoy_only", "service_area_id", "sells_alcohol", "tax_exempt",
+	"time_zone",
+}
+
+// Helper function to build an upsert by id that sets every column, including to NULL.
+func upsertLocationSQL() string {
+	values := make([]string, len(locationColumnNames))
+	updates := make([]string, 0, len(locationColumnNames)-1)
+	for i, column := range locationColumnNames {
+		values[i] = ":" + column
+		if column != "id" {
+			updates = append(updates, column+" = EXCLUDED."+column)
+		}
+	}
+	return `INSERT INTO store_locations (` + strings.Join(locationColumnNames, ", ") + `)
+	VALUES (` + strings.Join(values, ", ") + `)
+	ON CONFLICT (id) DO UPDATE SET ` + strings.Join(updates, ", ")
+}
+
+// UpsertLocations inserts or replaces each location by id in a single transaction. A row that fails is rolled back
+// to a savepoint so the rest of the batch is still written; its error is returned at its index in rowErrors.
+// err is only set when the batch as a whole could not be written.
+func (c *PolygonPostgresRepository) UpsertLocations(rows []LocationRowNull) (rowErrors []error, err error) {
+	rowErrors = make([]error, len(rows))
+	transaction, err := c.DB.Beginx()
+	if err != nil {
+		return rowErrors, err
+	}
+	rollback := false
+
+	defer func() {
+		if rollback {
+			transaction.Rollback()
+		} else {
+			err = transaction.Commit()
+		}
+	}()
+
+	statement, err := transaction.PrepareNamed(upsertLocationSQL())
+	if err != nil {
+		rollback = true
+		return rowErrors, err
+	}
+	defer statement.Close()
+
+	for i, row := range rows {
+		_, err = transaction.Exec(`SAVEPOINT location_row`)
+		if err != nil {
+			rollback = true
+			return rowErrors, err
+		}
+		_, rowErrors[i] = statement.Exec(row)
+		if rowErrors[i] != nil {
+			_, err = transaction.Exec(`ROLLBACK TO SAVEPOINT location_row`)
+		} else {
+			_, err = transaction.Exec(`RELEASE SAVEPOINT location_row`)
+		}
+		if err != nil {
+			rollback = true
+			return rowErrors, err
+		}
+	}
+	return rowErrors, nil
+}
+
+// RequiredLocationColumns must have a value in every stored location.
+var RequiredLocationColumns = []string{"name", "store_id", "longitude", "latitude"}
+
+// LocationFields holds store_locations values by column name, as JSON clients send and receive them.
+// A nil value is NULL.
+type LocationFields map[string]interface{}
+
+// Columns clients cannot set: id comes from the path and the timestamps are kept by the repository.
+var managedLocationColumns = map[string]bool{"id": true, "created_at": true, "updated_at": true, "deleted_at": true}
+
+// ParseLocationFields decodes a JSON object of column values. Unknown and managed columns are rejected.
+func ParseLocationFields(body []byte) (LocationFields, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, errors.New("expected a JSON object")
+	}
+	return decodeLocationFields(raw, false)
+}
+
+// Helper function to decode column values by name. Managed columns are rejected unless allowManaged is set.
+func decodeLocationFields(raw map[string]json.RawMessage, allowManaged bool) (LocationFields, error) {
+	fields := LocationFields{}
+	for column, value := range raw {
+		kind, ok := locationColumns[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", column)
+		}
+		if managedLocationColumns[column] && !allowManaged {
+			return nil, fmt.Errorf("field %q cannot be set", column)
+		}
+		if string(value) == "null" {
+			fields[column] = nil
+			continue
+		}
+		decoded, err := decodeValue(column, kind, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s for field %q", string(value), column)
+		}
+		fields[column] = decoded
+	}
+	return fields, nil
+}
+
+// IsLocationColumn reports whether column is a column of store_locations.
+func IsLocationColumn(column string) bool {
+	_, ok := locationColumns[column]
+	return ok
+}
+
+// LocationValueJSON converts a column value written as text, as files hold attributes, to the JSON value a filter
+// compares the column with. Text columns take it as it is; other columns must parse as their type.
+func LocationValueJSON(column, text string) (json.RawMessage, error) {
+	kind, ok := locationColumns[column]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", column)
+	}
+	var value interface{} = text
+	var err error
+	trimmed := strings.TrimSpace(text)
+	switch kind {
+	case intColumn:
+		value, err = strconv.ParseInt(trimmed, 10, 64)
+	case floatColumn:
+		value, err = strconv.ParseFloat(trimmed, 64)
+	case boolColumn:
+		value, err = strconv.ParseBool(trimmed)
+	case timeColumn:
+		value, err = time.Parse(time.RFC3339Nano, trimmed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for field %q", text, column)
+	}
+	return json.Marshal(value)
+}
+
+// Validate checks the fields can be written. complete is set when they replace a whole location,
+// so every required column must be present rather than only not set to NULL.
+func (f LocationFields) Validate(complete bool) error {
+	for _, column := range RequiredLocationColumns {
+		value, ok := f[column]
+		if (complete || ok) && value == nil {
+			return fmt.Errorf("field %q is required", column)
+		}
+	}
+	if lon, ok := f["longitude"].(float64); ok {
+		if err := model.NewCoordinate(lon, 0).Validate(); err != nil {
+			return err
+		}
+	}
+	if lat, ok := f["latitude"].(float64); ok {
+		if err := model.NewCoordinate(0, lat).Validate(); err != nil {
+			return err
+		}
+	}
+	if name, ok := f["time_zone"].(string); ok {
+		if err := ValidateTimeZone(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateTimeZone checks a time_zone value names a zone in the IANA database, such as America/Chicago.
+func ValidateTimeZone(name string) error {
+	if _, err := time.LoadLocation(name); err != nil || name == "" || name == "Local" {
+		return fmt.Errorf("unknown time zone %q", name)
+	}
+	return nil
+}
+
+// LocationFieldsOf returns a row's values by column name.
+func LocationFieldsOf(row LocationRowNull) LocationFields {
+	fields := LocationFields{}
+	value := reflect.ValueOf(row)
+	for i := 0; i < value.NumField(); i++ {
+		column := value.Type().Field(i).Tag.Get("db")
+		field := value.Field(i).Interface()
+		if valuer, ok := field.(driver.Valuer); ok {
+			field, _ = valuer.Value()
+		}
+		fields[column] = field
+	}
+	return fields
+}
+
+// GetLocation returns the location with the given ID and whether it exists. Soft-deleted locations are only
+// returned if includeDeleted is set.
+func (c *PolygonPostgresRepository) GetLocation(id int, includeDeleted bool) (LocationRowNull, bool, error) {
+	querySQL := `SELECT * FROM store_locations WHERE id = $1`
+	if !includeDeleted {
+		querySQL += ` AND deleted_at IS NULL`
+	}
+	var results []LocationRowNull
+	err := c.DB.Select(&results, querySQL, id)
+	if err != nil || len(results) == 0 {
+		return LocationRowNull{}, false, err
+	}
+	return results[0], true, nil
+}
+
+// CreateLocation inserts a location, returning false if one with the ID already exists, even if it was deleted.
+func (c *PolygonPostgresRepository) CreateLocation(id int, fields LocationFields) (bool, error) {
+	columns := []string{"id", "created_at", "updated_at"}
+	values := []string{"$1", "now()", "now()"}
+	args := []interface{}{id}
+	for _, column := range locationColumnNames {
+		if value, ok := fields[column]; ok && !managedLocationColumns[column] {
+			args = append(args, value)
+			columns = append(columns, column)
+			values = append(values, "$"+strconv.Itoa(len(args)))
+		}
+	}
+	result, err := c.DB.Exec(`INSERT INTO store_locations (`+strings.Join(columns, ", ")+`)
+		VALUES (`+strings.Join(values, ", ")+`)
+		ON CONFLICT (id) DO NOTHING`, args...)
+	if err != nil {
+		return false, err
+	}
+	created, err := result.RowsAffected()
+	return created > 0, err
+}
+
+// ReplaceLocation overwrites every column of a location that has not been deleted, setting those missing from
+// fields to NULL. It returns false if there is no such location.
+func (c *PolygonPostgresRepository) ReplaceLocation(id int, fields LocationFields) (bool, error) {
+	return c.UpdateLocation(id, fields.complete())
+}
+
+// Helper function to add every column clients can set that is missing from the fields, as NULL.
+func (f LocationFields) complete() LocationFields {
+	complete := LocationFields{}
+	for _, column := range locationColumnNames {
+		if !managedLocationColumns[column] {
+			complete[column] = f[column]
+		}
+	}
+	return complete
+}
+
+// UpdateLocation sets the given columns of a location that has not been deleted, leaving the rest unchanged.
+// It returns false if there is no such location.
+func (c *PolygonPostgresRepository) UpdateLocation(id int, fields LocationFields) (bool, error) {
+	updates := []string{"updated_at = now()"}
+	args := []interface{}{id}
+	for _, column := range locationColumnNames {
+		if value, ok := fields[column]; ok && !managedLocationColumns[column] {
+			args = append(args, value)
+			updates = append(updates, column+" = $"+strconv.Itoa(len(args)))
+		}
+	}
+	return c.execLocation(`UPDATE store_locations SET `+strings.Join(updates, ", ")+
+		` WHERE id = $1 AND deleted_at IS NULL`, args...)
+}
+
+// DeleteLocation soft deletes a location by setting deleted_at. It returns false if there is no location
+// with the ID or it was already deleted.
+func (c *PolygonPostgresRepository) DeleteLocation(id int) (bool, error) {
+	return c.execLocation(`UPDATE store_locations SET deleted_at = now(), updated_at = now()
+		WHERE id = $1 AND deleted_at IS NULL`, id)
+}
+
+// RestoreLocation clears deleted_at on a soft-deleted location. It returns false if the location is not deleted.
+func (c *PolygonPostgresRepository) RestoreLocation(id int) (bool, error) {
+	return c.execLocation(`UPDATE store_locations SET deleted_at = NULL, updated_at = now()
+		WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+}
+
+// Helper function to run a single row write, reporting whether the row was found.
+func (c *PolygonPostgresRepository) execLocation(querySQL string, args ...interface{}) (bool, error) {
+	result, err := c.DB.Exec(querySQL, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
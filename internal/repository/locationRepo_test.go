@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// A database/sql driver that records the statements run on its connection. Inserting a row whose id is in
+// rejectIDs fails, as does any statement starting with failOn.
+type recordingDriver struct {
+	mutex     sync.Mutex
+	log       []string
+	rejectIDs map[int64]bool
+	failOn    string
+}
+
+func (d *recordingDriver) record(entry string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.log = append(d.log, entry)
+	if d.failOn != "" && strings.HasPrefix(entry, d.failOn) {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+type recordingConn struct{ driver *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.driver, query}, nil
+}
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return recordingTx{c.driver}, c.driver.record("BEGIN")
+}
+
+type recordingTx struct{ driver *recordingDriver }
+
+func (t recordingTx) Commit() error   { return t.driver.record("COMMIT") }
+func (t recordingTx) Rollback() error { return t.driver.record("ROLLBACK") }
+
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(s.query, "INSERT") {
+		return driver.RowsAffected(0), s.driver.record(s.query)
+	}
+	id := args[0].(int64)
+	if err := s.driver.record("INSERT " + strconv.FormatInt(id, 10)); err != nil {
+		return nil, err
+	}
+	if s.driver.rejectIDs[id] {
+		return nil, errors.New("violates check constraint")
+	}
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var registerOnce sync.Once
+var drivers = map[string]*recordingDriver{}
+
+// Helper function to open a repository on a fresh recordingDriver.
+func recordingRepository(t *testing.T, d *recordingDriver) *PolygonPostgresRepository {
+	registerOnce.Do(func() { sql.Register("recording", dispatchDriver{}) })
+	drivers[t.Name()] = d
+	db, err := sql.Open("recording", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return NewPolygonRepository(*sqlx.NewDb(db, "postgres"))
+}
+
+// Drivers can only be registered once, so connections are routed to each test's driver by name.
+type dispatchDriver struct{}
+
+func (dispatchDriver) Open(name string) (driver.Conn, error) { return drivers[name].Open(name) }
+
+func locationRows(ids ...int) []LocationRowNull {
+	rows := make([]LocationRowNull, len(ids))
+	for i, id := range ids {
+		rows[i] = LocationRowNull{ID: id, Name: sql.NullString{String: "Store", Valid: true}}
+	}
+	return rows
+}
+
+func TestUpsertLocations(t *testing.T) {
+	d := &recordingDriver{rejectIDs: map[int64]bool{2: true}}
+	rowErrors, err := recordingRepository(t, d).UpsertLocations(locationRows(1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rowErrors[0] != nil || rowErrors[1] == nil || rowErrors[2] != nil {
+		t.Errorf("rowErrors = %v, want only the second row rejected", rowErrors)
+	}
+
+	// Each row gets its own savepoint, so the rejected row is rolled back and the others are committed.
+	want := []string{
+		"BEGIN",
+		"SAVEPOINT location_row", "INSERT 1", "RELEASE SAVEPOINT location_row",
+		"SAVEPOINT location_row", "INSERT 2", "ROLLBACK TO SAVEPOINT location_row",
+		"SAVEPOINT location_row", "INSERT 3", "RELEASE SAVEPOINT location_row",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(d.log, want) {
+		t.Errorf("statements = %q, want %q", d.log, want)
+	}
+}
+
+func TestUpsertLocationsFailure(t *testing.T) {
+	d := &recordingDriver{rejectIDs: map[int64]bool{2: true}, failOn: "ROLLBACK TO"}
+	_, err := recordingRepository(t, d).UpsertLocations(locationRows(1, 2, 3))
+	if err == nil {
+		t.Fatal("expected the failed savepoint rollback to fail the batch")
+	}
+
+	// The batch is abandoned at the failure and nothing is committed.
+	want := []string{
+		"BEGIN",
+		"SAVEPOINT location_row", "INSERT 1", "RELEASE SAVEPOINT location_row",
+		"SAVEPOINT location_row", "INSERT 2", "ROLLBACK TO SAVEPOINT location_row",
+		"ROLLBACK",
+	}
+	if !reflect.DeepEqual(d.log, want) {
+		t.Errorf("statements = %q, want %q", d.log, want)
+	}
+}
@@ -0,0 +1,396 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+)
+
+// The result of a condition under SQL's three-valued logic, in which a comparison with NULL is neither true nor
+// false. Ordered so that AND is the minimum of its operands, OR the maximum and NOT the complement.
+type truth int
+
+const (
+	sqlFalse truth = iota
+	sqlNull
+	sqlTrue
+)
+
+func truthOf(value bool) truth {
+	if value {
+		return sqlTrue
+	}
+	return sqlFalse
+}
+
+// A location matching a listing, with the values it is ordered by.
+type memoryListing struct {
+	location PolyLocationResponseCleaned
+	keys     []interface{}
+}
+
+// FindLocations returns every location matching the filter, with its polygon when it has one.
+func (c *PolygonMemoryRepository) FindLocations(filter LocationFilter) ([]PolyLocationResponseCleaned, error) {
+	results, _, err := c.listPage(filter, Page{}, false)
+	return results, err
+}
+
+// FindLocationsPage returns a page of the locations matching the filter and the cursor of the next page,
+// which is empty when there are no more rows.
+func (c *PolygonMemoryRepository) FindLocationsPage(filter LocationFilter, page Page) ([]PolyLocationResponseCleaned, string, error) {
+	return c.listPage(filter, page, false)
+}
+
+// StreamLocations calls visit for each location matching the filter.
+func (c *PolygonMemoryRepository) StreamLocations(filter LocationFilter, page Page, visit func(PolyLocationResponseCleaned) error) error {
+	return c.stream(filter, page, false, visit)
+}
+
+// GetFencesPage returns a page of the locations that have a polygon, ordered by ID.
+func (c *PolygonMemoryRepository) GetFencesPage(page Page, includeDeleted bool) ([]PolyLocationResponseCleaned, string, error) {
+	return c.listPage(LocationFilter{IncludeDeleted: includeDeleted}, page, true)
+}
+
+// StreamFences calls visit for each location that has a polygon, ordered by ID.
+func (c *PolygonMemoryRepository) StreamFences(page Page, includeDeleted bool, visit func(PolyLocationResponseCleaned) error) error {
+	return c.stream(LocationFilter{IncludeDeleted: includeDeleted}, page, true, visit)
+}
+
+func (c *PolygonMemoryRepository) listPage(filter LocationFilter, page Page, fences bool) ([]PolyLocationResponseCleaned, string, error) {
+	listings, err := c.list(filter, page, fences)
+	if err != nil {
+		return []PolyLocationResponseCleaned{}, "", err
+	}
+	var nextCursor string
+	if page.Limit > 0 && len(listings) > page.Limit {
+		listings = listings[:page.Limit]
+		sortKey, err := json.Marshal(listings[len(listings)-1].keys)
+		if err != nil {
+			return []PolyLocationResponseCleaned{}, "", err
+		}
+		nextCursor = encodeCursor(string(sortKey))
+	}
+	results := make([]PolyLocationResponseCleaned, len(listings))
+	for i, listing := range listings {
+		results[i] = listing.location
+	}
+	return results, nextCursor, nil
+}
+
+func (c *PolygonMemoryRepository) stream(filter LocationFilter, page Page, fences bool, visit func(PolyLocationResponseCleaned) error) error {
+	listings, err := c.list(filter, page, fences)
+	if err != nil {
+		return err
+	}
+	if page.Limit > 0 && len(listings) > page.Limit {
+		listings = listings[:page.Limit]
+	}
+	for _, listing := range listings {
+		err = visit(listing.location)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper function to list the locations matching the filter, in the order it asks for, after the page's cursor.
+// Only locations with a polygon are listed if fences is set. The cursor holds the order key values of the row it
+// was taken from, with times as Unix nanoseconds, so cursors cannot be used with the Postgres repository.
+func (c *PolygonMemoryRepository) list(filter LocationFilter, page Page, fences bool) ([]memoryListing, error) {
+	err := filter.CheckPage(page)
+	if err != nil {
+		return nil, err
+	}
+	var after []interface{}
+	if page.Cursor != "" {
+		after = decodeMemoryCursor(page.Cursor)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var listings []memoryListing
+	for id, row := range c.locations {
+		polygon, hasPolygon := c.polygons[id]
+		if fences && !hasPolygon {
+			continue
+		}
+		values := locationValues(row)
+		if !filter.matches(values) {
+			continue
+		}
+		keys := filter.sortKeys(values)
+		if after != nil && filter.compareKeys(keys, after) <= 0 {
+			continue
+		}
+		listings = append(listings, memoryListing{toPolyLocation(row, polygon.geoJSON), keys})
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		return filter.compareKeys(listings[i].keys, listings[j].keys) < 0
+	})
+	return listings, nil
+}
+
+// Helper function to decode a cursor already checked by CheckPage into its order key values.
+func decodeMemoryCursor(cursor string) []interface{} {
+	decoded, _ := base64.RawURLEncoding.DecodeString(cursor)
+	var values []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.UseNumber()
+	decoder.Decode(&values)
+	for i, value := range values {
+		if number, ok := value.(json.Number); ok {
+			if integer, err := number.Int64(); err == nil {
+				values[i] = integer
+			} else {
+				values[i], _ = number.Float64()
+			}
+		}
+	}
+	return values
+}
+
+// Helper function for a location's values by column, typed as decodeValue decodes filter values. NULL is nil.
+func locationValues(row LocationRowNull) LocationFields {
+	values := LocationFieldsOf(row)
+	values["id"] = int64(row.ID)
+	return values
+}
+
+// Helper function to determine whether a location's values satisfy the filter, as the query built from it would.
+func (f LocationFilter) matches(values LocationFields) bool {
+	if !f.IncludeDeleted && values["deleted_at"] != nil {
+		return false
+	}
+	legacy := []struct {
+		column string
+		set    bool
+		value  interface{}
+	}{
+		{"id", f.ID != 0, int64(f.ID)},
+		{"store_id", f.StoreID != 0, int64(f.StoreID)},
+		{"metro_id", f.MetroID != 0, int64(f.MetroID)},
+		{"zone_id", f.ZoneID != 0, int64(f.ZoneID)},
+		{"city", f.City != "", f.City},
+		{"state", f.State != "", f.State},
+	}
+	for _, field := range legacy {
+		if field.set && compareTruth(values[field.column], field.value, "eq") != sqlTrue {
+			return false
+		}
+	}
+	if f.Where != nil && f.Where.evaluate(values) != sqlTrue {
+		return false
+	}
+	return f.Within == nil || f.Within.evaluate(values) == sqlTrue
+}
+
+func (c Condition) evaluate(values LocationFields) truth {
+	switch {
+	case c.And != nil:
+		result := sqlTrue
+		for _, condition := range c.And {
+			if operand := condition.evaluate(values); operand < result {
+				result = operand
+			}
+		}
+		return result
+	case c.Or != nil:
+		result := sqlFalse
+		for _, condition := range c.Or {
+			if operand := condition.evaluate(values); operand > result {
+				result = operand
+			}
+		}
+		return result
+	case c.Not != nil:
+		return sqlTrue - c.Not.evaluate(values)
+	}
+
+	kind := locationColumns[c.Field]
+	value := values[c.Field]
+	if _, ok := comparisonOperators[c.Op]; ok {
+		target, _ := decodeValue(c.Field, kind, c.Value)
+		return compareTruth(value, target, c.Op)
+	}
+	switch c.Op {
+	case "in", "not_in":
+		if value == nil {
+			return sqlNull
+		}
+		var raw []json.RawMessage
+		json.Unmarshal(c.Value, &raw)
+		found := sqlFalse
+		for _, item := range raw {
+			target, _ := decodeValue(c.Field, kind, item)
+			if compareValues(value, target) == 0 {
+				found = sqlTrue
+				break
+			}
+		}
+		if c.Op == "not_in" {
+			return sqlTrue - found
+		}
+		return found
+	case "between":
+		if value == nil {
+			return sqlNull
+		}
+		var raw []json.RawMessage
+		json.Unmarshal(c.Value, &raw)
+		low, _ := decodeValue(c.Field, kind, raw[0])
+		high, _ := decodeValue(c.Field, kind, raw[1])
+		return truthOf(compareValues(value, low) >= 0 && compareValues(value, high) <= 0)
+	case "is_null":
+		var isNull bool
+		json.Unmarshal(c.Value, &isNull)
+		return truthOf((value == nil) == isNull)
+	}
+	return sqlNull
+}
+
+// Helper function to compare a column value with a filter value by one of the comparisonOperators.
+func compareTruth(value, target interface{}, op string) truth {
+	if value == nil {
+		return sqlNull
+	}
+	comparison := compareValues(value, target)
+	switch op {
+	case "eq":
+		return truthOf(comparison == 0)
+	case "ne":
+		return truthOf(comparison != 0)
+	case "lt":
+		return truthOf(comparison < 0)
+	case "lte":
+		return truthOf(comparison <= 0)
+	case "gt":
+		return truthOf(comparison > 0)
+	}
+	return truthOf(comparison >= 0)
+}
+
+func (s SpatialFilter) evaluate(values LocationFields) truth {
+	lon, lonOK := values["longitude"].(float64)
+	lat, latOK := values["latitude"].(float64)
+	if !lonOK || !latOK {
+		return sqlNull
+	}
+	if s.BBox != nil {
+		return truthOf(lon >= s.BBox.MinLon && lon <= s.BBox.MaxLon && lat >= s.BBox.MinLat && lat <= s.BBox.MaxLat)
+	}
+	return truthOf(logic.Distance(*s.Point, model.NewCoordinate(lon, lat)) <= s.Meters)
+}
+
+// Helper function for the values a location is ordered by: one for each sort field, then the ID.
+func (f LocationFilter) sortKeys(values LocationFields) []interface{} {
+	keys := make([]interface{}, 0, len(f.Sort)+1)
+	for _, sort := range f.Sort {
+		var key interface{}
+		if sort.Field == DistanceSortField {
+			lon, lonOK := values["longitude"].(float64)
+			lat, latOK := values["latitude"].(float64)
+			if lonOK && latOK {
+				key = logic.Distance(*f.Within.Point, model.NewCoordinate(lon, lat))
+			}
+		} else {
+			key = values[sort.Field]
+		}
+		if t, ok := key.(time.Time); ok {
+			key = t.UnixNano()
+		}
+		keys = append(keys, key)
+	}
+	return append(keys, values["id"])
+}
+
+// Helper function to order two locations by their sort keys. As in Postgres, NULL sorts after every value in
+// ascending order and before every value in descending order.
+func (f LocationFilter) compareKeys(a, b []interface{}) int {
+	for i := range a {
+		comparison := 0
+		switch {
+		case a[i] == nil && b[i] == nil:
+		case a[i] == nil:
+			comparison = 1
+		case b[i] == nil:
+			comparison = -1
+		default:
+			comparison = compareValues(a[i], b[i])
+		}
+		if i < len(f.Sort) && f.Sort[i].Desc {
+			comparison = -comparison
+		}
+		if comparison != 0 {
+			return comparison
+		}
+	}
+	return 0
+}
+
+// Helper function to compare two values that are not NULL, returning -1, 0 or 1. Integers and floats compare
+// numerically with each other.
+func compareValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case string:
+		y, _ := b.(string)
+		return strings.Compare(x, y)
+	case bool:
+		y, _ := b.(bool)
+		return compareFloats(boolValue(x), boolValue(y))
+	case time.Time:
+		y, _ := b.(time.Time)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+		return 0
+	case int64:
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return compareFloats(floatValue(a), floatValue(b))
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func floatValue(value interface{}) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryFindLocations(t *testing.T) {
+	repo := NewPolygonMemoryRepository()
+	repo.UpsertLocations([]LocationRowNull{
+		{ID: 1, City: sql.NullString{String: "Austin", Valid: true}, MetroID: sql.NullInt64{Int64: 3, Valid: true}},
+		{ID: 2, City: sql.NullString{String: "Dallas", Valid: true}},
+		{ID: 3, MetroID: sql.NullInt64{Int64: 1, Valid: true}},
+		{ID: 4, City: sql.NullString{String: "Austin", Valid: true}, MetroID: sql.NullInt64{Int64: 2, Valid: true}},
+	})
+	repo.DeleteLocation(4)
+
+	cases := []struct {
+		name   string
+		filter string
+		want   []int
+	}{
+		{"everything", `{}`, []int{1, 2, 3}},
+		{"including deleted", `{"include_deleted": true}`, []int{1, 2, 3, 4}},
+		{"legacy fields", `{"city": "Austin"}`, []int{1}},
+		{"comparison skips null", `{"where": {"field": "city", "op": "ne", "value": "Austin"}}`, []int{2}},
+		{"not of null is not true", `{"where": {"not": {"field": "metro_id", "op": "gt", "value": 2}}}`, []int{3}},
+		{"or with null", `{"where": {"or": [{"field": "metro_id", "op": "eq", "value": 1}, {"field": "city", "op": "eq", "value": "Dallas"}]}}`, []int{2, 3}},
+		{"not in", `{"where": {"field": "city", "op": "not_in", "value": ["Dallas"]}}`, []int{1}},
+		{"is null", `{"where": {"field": "city", "op": "is_null", "value": true}}`, []int{3}},
+		{"nulls sort last ascending", `{"sort": [{"field": "metro_id"}]}`, []int{3, 1, 2}},
+		{"nulls sort first descending", `{"sort": [{"field": "metro_id", "desc": true}]}`, []int{2, 1, 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := ParseLocationFilter([]byte(c.filter))
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := repo.FindLocations(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			if !reflect.DeepEqual(ids, c.want) {
+				t.Errorf("FindLocations() = %v, want %v", ids, c.want)
+			}
+		})
+	}
+}
+
+func TestMemoryFindLocationsPage(t *testing.T) {
+	repo := NewPolygonMemoryRepository()
+	repo.UpsertLocations([]LocationRowNull{
+		{ID: 1, MetroID: sql.NullInt64{Int64: 2, Valid: true}},
+		{ID: 2},
+		{ID: 3, MetroID: sql.NullInt64{Int64: 1, Valid: true}},
+		{ID: 4},
+		{ID: 5, MetroID: sql.NullInt64{Int64: 2, Valid: true}},
+	})
+	filter := LocationFilter{Sort: []SortField{{Field: "metro_id"}}}
+
+	var ids []int
+	page := Page{Limit: 2}
+	for {
+		results, next, err := repo.FindLocationsPage(filter, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+	if want := []int{3, 1, 5, 2, 4}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("paged IDs = %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,594 @@
+package repository
+
+import (
+	"database/sql"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/logic"
+	"github.com/geofence/internal/model"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// A stored polygon, kept both parsed for spatial predicates and as the GeoJSON listings return.
+type memoryPolygon struct {
+	geometry model.PolyGeometry
+	geoJSON  string
+}
+
+// PolygonMemoryRepository is a PolygonRepository held in memory, for running the service without a database.
+// Spatial predicates are answered by the logic package, so points on a polygon's boundary are inside it and
+// distances are great circle rather than spheroidal, as they are in PostGIS.
+type PolygonMemoryRepository struct {
+	mutex      sync.RWMutex
+	locations  map[int]LocationRowNull
+	polygons   map[int]memoryPolygon
+	versions   map[int][]PolygonVersion
+	priorities map[int64]int
+}
+
+var _ PolygonRepository = (*PolygonMemoryRepository)(nil)
+
+func NewPolygonMemoryRepository() *PolygonMemoryRepository {
+	return &PolygonMemoryRepository{
+		locations:  map[int]LocationRowNull{},
+		polygons:   map[int]memoryPolygon{},
+		versions:   map[int][]PolygonVersion{},
+		priorities: map[int64]int{},
+	}
+}
+
+// Helper function for the time a write is made, at the precision Postgres keeps timestamps.
+func memoryNow() pq.NullTime {
+	return pq.NullTime{Time: time.Now().UTC().Truncate(time.Microsecond), Valid: true}
+}
+
+// Helper function to parse GeoJSON that is either a Point, or a Polygon or MultiPolygon.
+func parseMemoryGeometry(item string) (model.PolyGeometry, *model.Coordinate, error) {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal([]byte(item), &probe)
+	if err != nil {
+		return model.PolyGeometry{}, nil, err
+	}
+	switch probe.Type {
+	case model.PointType:
+		var point model.PointGeometry
+		err = json.Unmarshal([]byte(item), &point)
+		return model.PolyGeometry{}, &point.Coordinates, err
+	case model.PolygonType, model.MultiPolygonType:
+		var geom model.PolyGeometry
+		err = json.Unmarshal([]byte(item), &geom)
+		return geom, nil, err
+	}
+	return model.PolyGeometry{}, nil, errors.Errorf("unsupported geometry type %q", probe.Type)
+}
+
+// Intersects takes in 2 strings which represent Point, Polygon or MultiPolygon geometries and returns if they
+// intersect or not.
+func (c *PolygonMemoryRepository) Intersects(item1 string, item2 string) (bool, error) {
+	geom1, point1, err := parseMemoryGeometry(item1)
+	if err != nil {
+		return false, err
+	}
+	geom2, point2, err := parseMemoryGeometry(item2)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case point1 != nil && point2 != nil:
+		return *point1 == *point2, nil
+	case point1 != nil:
+		return logic.InGeometry(*point1, geom2), nil
+	case point2 != nil:
+		return logic.InGeometry(*point2, geom1), nil
+	}
+	return logic.GeometriesIntersect(geom1, geom2), nil
+}
+
+// MakeValid resolves self-intersections by cutting rings where they meet themselves. A Polygon that becomes several
+// polygons is returned as a MultiPolygon.
+func (c *PolygonMemoryRepository) MakeValid(polygonObject model.PolyGeometry) (model.PolyGeometry, error) {
+	valid := logic.SplitSelfIntersections(polygonObject)
+	if polygonObject.Type == model.MultiPolygonType {
+		valid.Type = model.MultiPolygonType
+	}
+	return valid, nil
+}
+
+// FindClosest returns the active location of the store nearest the point, within a degree. A tie is broken by
+// the polygon containing the point if every tied location has one and exactly one contains it; otherwise no
+// location is returned.
+func (c *PolygonMemoryRepository) FindClosest(storeID int, long, lat float64) (LocationRow, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	point := model.NewCoordinate(long, lat)
+	var closest []LocationRowNull
+	minimum := math.Inf(1)
+	for _, row := range c.locations {
+		if row.DeletedAt.Valid || !row.Active.Bool || row.StoreID.Int64 != int64(storeID) || !row.StoreID.Valid ||
+			!row.Longitude.Valid || !row.Latitude.Valid {
+			continue
+		}
+		distance := math.Hypot(row.Longitude.Float64-long, row.Latitude.Float64-lat)
+		switch {
+		case distance > 1 || distance > minimum:
+			continue
+		case distance < minimum:
+			minimum = distance
+			closest = []LocationRowNull{row}
+		default:
+			closest = append(closest, row)
+		}
+	}
+	if len(closest) == 0 {
+		return LocationRow{}, nil
+	}
+	if len(closest) == 1 {
+		return LocationToRegularTypes(closest[0]), nil
+	}
+
+	var containing []LocationRowNull
+	for _, row := range closest {
+		polygon, ok := c.polygons[row.ID]
+		if !ok {
+			return LocationRow{}, nil
+		}
+		if logic.InGeometry(point, polygon.geometry) {
+			containing = append(containing, row)
+		}
+	}
+	if len(containing) != 1 {
+		return LocationRow{}, nil
+	}
+	return LocationToRegularTypes(containing[0]), nil
+}
+
+// FindNearest returns the locations a NearestQuery asks for, nearest first, ranked as the Postgres repository
+// ranks them.
+func (c *PolygonMemoryRepository) FindNearest(query NearestQuery) ([]NearestLocation, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	nearest := []NearestLocation{}
+	for _, row := range c.locations {
+		if row.DeletedAt.Valid || !row.Active.Bool || (query.StoreID != 0 && row.StoreID.Int64 != int64(query.StoreID)) ||
+			!row.Longitude.Valid || !row.Latitude.Valid {
+			continue
+		}
+		meters := logic.Distance(query.Point, model.NewCoordinate(row.Longitude.Float64, row.Latitude.Float64))
+		if meters > query.MaxMeters {
+			continue
+		}
+		location := NearestLocation{Location: row, Meters: meters}
+		if polygon, ok := c.polygons[row.ID]; ok {
+			location.Inside = logic.InGeometry(query.Point, polygon.geometry)
+		}
+		nearest = append(nearest, location)
+	}
+	sort.Slice(nearest, func(i, j int) bool {
+		a, b := nearest[i], nearest[j]
+		if a.Meters != b.Meters {
+			return a.Meters < b.Meters
+		}
+		if a.Inside != b.Inside {
+			return a.Inside
+		}
+		return a.Location.ID < b.Location.ID
+	})
+	if len(nearest) > query.K {
+		nearest = nearest[:query.K]
+	}
+	return nearest, nil
+}
+
+// ListStorePriorities returns every priority that has been set, ordered by store ID.
+func (c *PolygonMemoryRepository) ListStorePriorities() ([]StorePriority, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	priorities := make([]StorePriority, 0, len(c.priorities))
+	for storeID, priority := range c.priorities {
+		priorities = append(priorities, StorePriority{StoreID: storeID, Priority: priority})
+	}
+	sort.Slice(priorities, func(i, j int) bool {
+		return priorities[i].StoreID < priorities[j].StoreID
+	})
+	return priorities, nil
+}
+
+// SetStorePriority sets the priority of a store.
+func (c *PolygonMemoryRepository) SetStorePriority(priority StorePriority) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.priorities[priority.StoreID] = priority.Priority
+	return nil
+}
+
+// FindEnclosingPolygon returns the locations an EnclosingQuery asks for, ordered by ID.
+func (c *PolygonMemoryRepository) FindEnclosingPolygon(query EnclosingQuery) ([]LocationRowNull, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	enclosing := []LocationRowNull{}
+	for id, polygon := range c.polygons {
+		row, ok := c.locations[id]
+		if !ok || row.DeletedAt.Valid || (query.StoreID != 0 && row.StoreID.Int64 != int64(query.StoreID)) ||
+			(query.MetroID != 0 && row.MetroID.Int64 != int64(query.MetroID)) || (query.ZoneID != 0 && row.ZoneID.Int64 != int64(query.ZoneID)) {
+			continue
+		}
+		if logic.InGeometry(query.Point, polygon.geometry) {
+			enclosing = append(enclosing, row)
+		}
+	}
+	sort.Slice(enclosing, func(i, j int) bool {
+		return enclosing[i].ID < enclosing[j].ID
+	})
+	return enclosing, nil
+}
+
+// Returns every location that has a polygon, ordered by ID. Soft-deleted locations are only included if asked for.
+func (c *PolygonMemoryRepository) GetAll(includeDeleted bool) ([]PolyLocationResponseCleaned, error) {
+	results, _, err := c.GetFencesPage(Page{}, includeDeleted)
+	return results, err
+}
+
+// Returns every location that has a polygon and has not been deleted, ordered by ID.
+func (c *PolygonMemoryRepository) GetAllFences() ([]PolyLocationResponseCleaned, error) {
+	return c.GetAll(false)
+}
+
+func (c *PolygonMemoryRepository) GetPolygonFromID(id int) (string, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	polygon, ok := c.polygons[id]
+	if !ok {
+		return "", errors.New("No polygon with that ID found")
+	}
+	return polygon.geoJSON, nil
+}
+
+// Returns the location with the given ID and its polygon, unless it has been deleted.
+func (c *PolygonMemoryRepository) GetPolyLocationFromID(id int) ([]PolyLocationResponseCleaned, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	row, ok := c.locations[id]
+	if !ok || row.DeletedAt.Valid {
+		return []PolyLocationResponseCleaned{}, nil
+	}
+	return []PolyLocationResponseCleaned{toPolyLocation(row, c.polygons[id].geoJSON)}, nil
+}
+
+// GetLocation returns the location with the given ID and whether it exists. Soft-deleted locations are only
+// returned if includeDeleted is set.
+func (c *PolygonMemoryRepository) GetLocation(id int, includeDeleted bool) (LocationRowNull, bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	row, ok := c.locations[id]
+	if !ok || (row.DeletedAt.Valid && !includeDeleted) {
+		return LocationRowNull{}, false, nil
+	}
+	return row, true, nil
+}
+
+// CreateLocation inserts a location, returning false if one with the ID already exists, even if it was deleted.
+func (c *PolygonMemoryRepository) CreateLocation(id int, fields LocationFields) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.locations[id]; ok {
+		return false, nil
+	}
+	now := memoryNow()
+	row := LocationRowNull{ID: id, CreatedAt: now, UpdatedAt: now}
+	err := setLocationFields(&row, fields, false)
+	if err != nil {
+		return false, err
+	}
+	c.locations[id] = row
+	return true, nil
+}
+
+// ReplaceLocation overwrites every column of a location that has not been deleted, setting those missing from
+// fields to NULL. It returns false if there is no such location.
+func (c *PolygonMemoryRepository) ReplaceLocation(id int, fields LocationFields) (bool, error) {
+	return c.UpdateLocation(id, fields.complete())
+}
+
+// UpdateLocation sets the given columns of a location that has not been deleted, leaving the rest unchanged.
+// It returns false if there is no such location.
+func (c *PolygonMemoryRepository) UpdateLocation(id int, fields LocationFields) (bool, error) {
+	return c.updateLocation(id, false, func(row *LocationRowNull) error {
+		return setLocationFields(row, fields, false)
+	})
+}
+
+// DeleteLocation soft deletes a location by setting deleted_at. It returns false if there is no location
+// with the ID or it was already deleted.
+func (c *PolygonMemoryRepository) DeleteLocation(id int) (bool, error) {
+	return c.updateLocation(id, false, func(row *LocationRowNull) error {
+		row.DeletedAt = memoryNow()
+		return nil
+	})
+}
+
+// RestoreLocation clears deleted_at on a soft-deleted location. It returns false if the location is not deleted.
+func (c *PolygonMemoryRepository) RestoreLocation(id int) (bool, error) {
+	return c.updateLocation(id, true, func(row *LocationRowNull) error {
+		row.DeletedAt = pq.NullTime{}
+		return nil
+	})
+}
+
+// Helper function to change a location that is deleted or not as given, reporting whether it was found.
+func (c *PolygonMemoryRepository) updateLocation(id int, deleted bool, update func(row *LocationRowNull) error) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	row, ok := c.locations[id]
+	if !ok || row.DeletedAt.Valid != deleted {
+		return false, nil
+	}
+	err := update(&row)
+	if err != nil {
+		return false, err
+	}
+	row.UpdatedAt = memoryNow()
+	c.locations[id] = row
+	return true, nil
+}
+
+// UpsertLocations inserts or replaces each location by ID. Every row is written, so rowErrors is always empty.
+func (c *PolygonMemoryRepository) UpsertLocations(rows []LocationRowNull) ([]error, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, row := range rows {
+		c.locations[row.ID] = row
+	}
+	return make([]error, len(rows)), nil
+}
+
+// Helper function to set a row's columns from fields, as an UPDATE of them would. Managed columns are skipped
+// unless includeManaged is set.
+func setLocationFields(row *LocationRowNull, fields LocationFields, includeManaged bool) error {
+	value := reflect.ValueOf(row).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		column := value.Type().Field(i).Tag.Get("db")
+		field, ok := fields[column]
+		if !ok || (managedLocationColumns[column] && !includeManaged) {
+			continue
+		}
+		err := value.Field(i).Addr().Interface().(sql.Scanner).Scan(field)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value for field %q", column)
+		}
+	}
+	return nil
+}
+
+// InsertPolygon creates or replaces a location's polygon, recording the change in its version history.
+func (c *PolygonMemoryRepository) InsertPolygon(polygonID int, polygonObject model.PolyGeometry, change PolygonChange) error {
+	_, found, err := c.SavePolygon(polygonID, polygonObject, change)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("No location with ID %d", polygonID)
+	}
+	return nil
+}
+
+// GetPolygon returns the current polygon of a location that has not been deleted, as its latest version.
+func (c *PolygonMemoryRepository) GetPolygon(id int) (PolygonVersion, bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	row, ok := c.locations[id]
+	polygon, hasPolygon := c.polygons[id]
+	versions := c.versions[id]
+	if !ok || row.DeletedAt.Valid || !hasPolygon || len(versions) == 0 {
+		return PolygonVersion{}, false, nil
+	}
+	version := versions[len(versions)-1]
+	version.Polygon = &polygon.geoJSON
+	return version, true, nil
+}
+
+// GetPolygonVersion returns one version of a polygon with its geometry.
+func (c *PolygonMemoryRepository) GetPolygonVersion(id, version int) (PolygonVersion, bool, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, stored := range c.versions[id] {
+		if stored.Version == version {
+			return stored, true, nil
+		}
+	}
+	return PolygonVersion{}, false, nil
+}
+
+// ListPolygonVersions returns a polygon's history, newest first, without geometry.
+func (c *PolygonMemoryRepository) ListPolygonVersions(id int) ([]PolygonVersion, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	stored := c.versions[id]
+	results := make([]PolygonVersion, len(stored))
+	for i, version := range stored {
+		version.Polygon = nil
+		results[len(stored)-1-i] = version
+	}
+	return results, nil
+}
+
+// SavePolygon creates or replaces a location's polygon and records the new version. It returns false if the
+// location does not exist or has been deleted.
+func (c *PolygonMemoryRepository) SavePolygon(id int, polygonObject model.PolyGeometry, change PolygonChange) (PolygonVersion, bool, error) {
+	row, err := toPolygonRow(id, polygonObject)
+	if err != nil {
+		return PolygonVersion{}, false, err
+	}
+	return c.withPolygonLock(id, func() (PolygonVersion, bool) {
+		action := PolygonCreated
+		if _, ok := c.polygons[id]; ok {
+			action = PolygonReplaced
+		}
+		c.polygons[id] = memoryPolygon{polygonObject, row.Polygon}
+		return c.recordPolygonVersion(id, action, change, nil), true
+	})
+}
+
+// SavePolygons creates or replaces the polygons of several locations at once, recording a version of each, and
+// returns the versions ordered by ID. If any of the locations does not exist or has been deleted, nothing is
+// written and missing lists them.
+func (c *PolygonMemoryRepository) SavePolygons(polygons map[int]model.PolyGeometry, change PolygonChange) ([]PolygonVersion, []int, error) {
+	ids := sortedPolygonIDs(polygons)
+	rows := make([]*PolygonRow, len(ids))
+	for i, id := range ids {
+		row, err := toPolygonRow(id, polygons[id])
+		if err != nil {
+			return nil, nil, err
+		}
+		rows[i] = row
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var missing []int
+	for _, id := range ids {
+		if row, ok := c.locations[id]; !ok || row.DeletedAt.Valid {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, missing, nil
+	}
+	versions := make([]PolygonVersion, len(rows))
+	for i, row := range rows {
+		action := PolygonCreated
+		if _, ok := c.polygons[row.ID]; ok {
+			action = PolygonReplaced
+		}
+		c.polygons[row.ID] = memoryPolygon{polygons[row.ID], row.Polygon}
+		versions[i] = c.recordPolygonVersion(row.ID, action, change, nil)
+	}
+	return versions, nil, nil
+}
+
+// DeletePolygon removes a location's polygon and records the delete as a version. It returns false if the
+// location has no polygon.
+func (c *PolygonMemoryRepository) DeletePolygon(id int, change PolygonChange) (PolygonVersion, bool, error) {
+	return c.withPolygonLock(id, func() (PolygonVersion, bool) {
+		if _, ok := c.polygons[id]; !ok {
+			return PolygonVersion{}, false
+		}
+		delete(c.polygons, id)
+		return c.recordPolygonVersion(id, PolygonDeleted, change, nil), true
+	})
+}
+
+// RollbackPolygon restores a polygon to an earlier version, recorded as a new version. Rolling back to a version
+// that deleted the polygon deletes it again. It returns false if the version does not exist.
+func (c *PolygonMemoryRepository) RollbackPolygon(id, target int, change PolygonChange) (PolygonVersion, bool, error) {
+	var err error
+	version, found, _ := c.withPolygonLock(id, func() (PolygonVersion, bool) {
+		for _, stored := range c.versions[id] {
+			if stored.Version != target {
+				continue
+			}
+			if stored.Polygon == nil {
+				delete(c.polygons, id)
+			} else {
+				restored := memoryPolygon{geoJSON: *stored.Polygon}
+				err = json.Unmarshal([]byte(*stored.Polygon), &restored.geometry)
+				if err != nil {
+					return PolygonVersion{}, false
+				}
+				c.polygons[id] = restored
+			}
+			return c.recordPolygonVersion(id, PolygonRolledBack, change, &target), true
+		}
+		return PolygonVersion{}, false
+	})
+	return version, found, err
+}
+
+// Helper function to run a change to a polygon while holding the write lock. Nothing is changed unless the
+// location exists and is not deleted.
+func (c *PolygonMemoryRepository) withPolygonLock(id int, change func() (PolygonVersion, bool)) (PolygonVersion, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	row, ok := c.locations[id]
+	if !ok || row.DeletedAt.Valid {
+		return PolygonVersion{}, false, nil
+	}
+	version, found := change()
+	return version, found, nil
+}
+
+// Helper function to record the polygon as it now is as the next version. The write lock must be held.
+func (c *PolygonMemoryRepository) recordPolygonVersion(id int, action string, change PolygonChange, rolledBackTo *int) PolygonVersion {
+	version := PolygonVersion{
+		PolygonID:    id,
+		Version:      len(c.versions[id]) + 1,
+		Action:       action,
+		ChangedBy:    change.ChangedBy,
+		Reason:       change.Reason,
+		RolledBackTo: rolledBackTo,
+		ChangedAt:    memoryNow().Time,
+	}
+	if polygon, ok := c.polygons[id]; ok {
+		geoJSON := polygon.geoJSON
+		version.Polygon = &geoJSON
+	}
+	c.versions[id] = append(c.versions[id], version)
+	return version
+}
+
+// Helper function to join a location to its polygon's GeoJSON, which is empty if it has none.
+func toPolyLocation(row LocationRowNull, polygon string) PolyLocationResponseCleaned {
+	location := LocationToRegularTypes(row)
+	return PolyLocationResponseCleaned{
+		ID:            location.ID,
+		Name:          location.Name,
+		CreatedAt:     location.CreatedAt,
+		UpdatedAt:     location.UpdatedAt,
+		Street1:       location.Street1,
+		Zip:           location.Zip,
+		City:          location.City,
+		State:         location.State,
+		MetroID:       location.MetroID,
+		Longitude:     location.Longitude,
+		Latitude:      location.Latitude,
+		Street2:       location.Street2,
+		ZoneID:        location.ZoneID,
+		StoreID:       location.StoreID,
+		County:        location.County,
+		DeletedAt:     location.DeletedAt,
+		OpeningHour:   location.OpeningHour,
+		ClosingHour:   location.ClosingHour,
+		StoreNumber:   location.StoreNumber,
+		StoreGroup:    location.StoreGroup,
+		Active:        location.Active,
+		AllowsPickup:  location.AllowsPickup,
+		IsEnvoyOnly:   location.IsEnvoyOnly,
+		ServiceAreaId: location.ServiceAreaId,
+		SellsAlcohol:  location.SellsAlcohol,
+		TaxExempt:     location.TaxExempt,
+		TimeZone:      location.TimeZone,
+		Polygon:       polygon,
+	}
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"github.com/geofence/internal/model"
+)
+
+// NearestQuery asks for the K active locations nearest Point, within MaxMeters of it along the earth's surface.
+// A non-zero StoreID restricts the search to that store's locations.
+type NearestQuery struct {
+	Point     model.Coordinate
+	K         int
+	MaxMeters float64
+	StoreID   int
+}
+
+// NearestLocation is a location found by a NearestQuery, with its geodesic distance from the point and whether its
+// polygon contains the point. A location without a polygon never contains it.
+type NearestLocation struct {
+	Location LocationRowNull
+	Meters   float64
+	Inside   bool
+}
+
+// The row a nearest query selects: a location and what is known of it relative to the point.
+type nearestRow struct {
+	LocationRowNull
+	Meters float64 `db:"distance_meters"`
+	Inside bool    `db:"inside"`
+}
+
+// FindNearest returns the locations a NearestQuery asks for, nearest first. Locations as far as each other are
+// ranked by whether their polygon contains the point, then by ID.
+func (c *PolygonPostgresRepository) FindNearest(query NearestQuery) ([]NearestLocation, error) {
+	querySQL := `SELECT sl.*,
+					ST_Distance(` + locationGeography + `, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) AS distance_meters,
+					COALESCE(ST_Intersects(sp.polygon, ST_MakePoint($1, $2)), false) AS inside
+				FROM store_locations sl LEFT JOIN store_polygons sp ON sp.id = sl.id
+				WHERE sl.deleted_at IS NULL AND sl.active AND ($4 = 0 OR sl.store_id = $4)
+					AND ST_DWithin(` + locationGeography + `, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3)
+				ORDER BY distance_meters, inside DESC, sl.id
+				LIMIT $5`
+	var rows []nearestRow
+	err := c.DB.Select(&rows, querySQL, query.Point.Lon(), query.Point.Lat(), query.MaxMeters, query.StoreID, query.K)
+	if err != nil {
+		return nil, err
+	}
+	nearest := make([]NearestLocation, len(rows))
+	for i, row := range rows {
+		nearest[i] = NearestLocation{Location: row.LocationRowNull, Meters: row.Meters, Inside: row.Inside}
+	}
+	return nearest, nil
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// Page selects part of an ordered listing. Cursor is the NextCursor of the previous page, or empty for the first
+// page. A Limit of zero returns every remaining row.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// The base queries listings are built on. Both select sort_key, the JSON encoded order key values of each row,
+// which becomes the cursor of the page ending at that row.
+const (
+	locationsSQL = `FROM store_locations as sl LEFT JOIN store_polygons as sp ON (sl.id = sp.id)`
+	fencesSQL    = `FROM store_polygons as sp JOIN store_locations as sl ON (sl.id = sp.id)`
+)
+
+type pagedLocationRow struct {
+	PolyLocationResponse
+	SortKey string `db:"sort_key"`
+}
+
+// FindLocationsPage returns a page of the locations matching the filter and the cursor of the next page,
+// which is empty when there are no more rows.
+func (c *PolygonPostgresRepository) FindLocationsPage(filter LocationFilter, page Page) ([]PolyLocationResponseCleaned, string, error) {
+	return c.listPage(locationsSQL, filter, page)
+}
+
+// StreamLocations calls visit for each location matching the filter as it is read from the database.
+func (c *PolygonPostgresRepository) StreamLocations(filter LocationFilter, page Page, visit func(PolyLocationResponseCleaned) error) error {
+	return c.stream(locationsSQL, filter, page, visit)
+}
+
+// GetFencesPage returns a page of the locations that have a polygon, ordered by ID.
+func (c *PolygonPostgresRepository) GetFencesPage(page Page, includeDeleted bool) ([]PolyLocationResponseCleaned, string, error) {
+	return c.listPage(fencesSQL, LocationFilter{IncludeDeleted: includeDeleted}, page)
+}
+
+// StreamFences calls visit for each location that has a polygon, ordered by ID, as it is read from the database.
+func (c *PolygonPostgresRepository) StreamFences(page Page, includeDeleted bool, visit func(PolyLocationResponseCleaned) error) error {
+	return c.stream(fencesSQL, LocationFilter{IncludeDeleted: includeDeleted}, page, visit)
+}
+
+// CheckPage reports whether the page's cursor can be used with the filter's sort, so that a stream
+// can be rejected before any of it is written.
+func (f LocationFilter) CheckPage(page Page) error {
+	query, err := f.build()
+	if err != nil || page.Cursor == "" {
+		return err
+	}
+	return query.after(page.Cursor)
+}
+
+// Helper function to build the query for the rows after the page's cursor, returning at most limit rows.
+func pageSQL(fromSQL string, filter LocationFilter, page Page, limit int) (string, []interface{}, error) {
+	query, err := filter.build()
+	if err != nil {
+		return "", nil, err
+	}
+	if page.Cursor != "" {
+		err = query.after(page.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	keys := make([]string, len(query.orderKeys))
+	for i, key := range query.orderKeys {
+		keys[i] = key.expression
+	}
+	querySQL := query.sql(`SELECT sl.*, ST_AsGeoJSON(sp.polygon) as polygon, json_build_array(` +
+		strings.Join(keys, `, `) + `)::text as sort_key ` + fromSQL)
+	if limit > 0 {
+		querySQL += ` LIMIT ` + query.arg(limit)
+	}
+	return querySQL, query.args, nil
+}
+
+func (c *PolygonPostgresRepository) listPage(fromSQL string, filter LocationFilter, page Page) ([]PolyLocationResponseCleaned, string, error) {
+	// One more row than the limit is requested to find out whether another page follows.
+	limit := page.Limit
+	if limit > 0 {
+		limit++
+	}
+	querySQL, args, err := pageSQL(fromSQL, filter, page, limit)
+	if err != nil {
+		return []PolyLocationResponseCleaned{}, "", err
+	}
+	var rows []pagedLocationRow
+	err = c.DB.Select(&rows, querySQL, args...)
+	if err != nil {
+		return []PolyLocationResponseCleaned{}, "", err
+	}
+
+	var nextCursor string
+	if page.Limit > 0 && len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+		nextCursor = encodeCursor(rows[len(rows)-1].SortKey)
+	}
+	results := make([]PolyLocationResponseCleaned, len(rows))
+	for i, row := range rows {
+		results[i] = PLResponseToRegularTypes(row.PolyLocationResponse)
+	}
+	return results, nextCursor, nil
+}
+
+func (c *PolygonPostgresRepository) stream(fromSQL string, filter LocationFilter, page Page, visit func(PolyLocationResponseCleaned) error) error {
+	querySQL, args, err := pageSQL(fromSQL, filter, page, page.Limit)
+	if err != nil {
+		return err
+	}
+	rows, err := c.DB.Queryx(querySQL, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row pagedLocationRow
+		err = rows.StructScan(&row)
+		if err != nil {
+			return err
+		}
+		err = visit(PLResponseToRegularTypes(row.PolyLocationResponse))
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func encodeCursor(sortKey string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sortKey))
+}
+
+// Helper function to restrict the query to rows ordered after the row a cursor was taken from.
+// Postgres sorts NULL after every value in ascending order, and before every value in descending order.
+func (q *locationQuery) after(cursor string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return filterErrorf("malformed cursor")
+	}
+	var values []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil || len(values) != len(q.orderKeys) {
+		return filterErrorf("cursor does not match the requested sort")
+	}
+
+	equal := make([]string, len(values))
+	greater := make([]string, len(values))
+	for i, value := range values {
+		key := q.orderKeys[i]
+		switch v := value.(type) {
+		case nil:
+			equal[i] = key.expression + ` IS NULL`
+			if key.desc {
+				greater[i] = key.expression + ` IS NOT NULL`
+			}
+			continue
+		case json.Number:
+			value = string(v)
+		case string, bool:
+		default:
+			return filterErrorf("cursor does not match the requested sort")
+		}
+		placeholder := q.arg(value)
+		equal[i] = key.expression + ` = ` + placeholder
+		if key.desc {
+			greater[i] = key.expression + ` < ` + placeholder
+		} else {
+			greater[i] = `(` + key.expression + ` > ` + placeholder + ` OR ` + key.expression + ` IS NULL)`
+		}
+	}
+
+	var alternatives []string
+	for i := range values {
+		if greater[i] == "" {
+			continue
+		}
+		alternative := append(append([]string{}, equal[:i]...), greater[i])
+		alternatives = append(alternatives, `(`+strings.Join(alternative, ` AND `)+`)`)
+	}
+	if len(alternatives) == 0 {
+		q.clauses = append(q.clauses, `FALSE`)
+		return nil
+	}
+	q.clauses = append(q.clauses, `(`+strings.Join(alternatives, ` OR `)+`)`)
+	return nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAfter(t *testing.T) {
+	cases := []struct {
+		name   string
+		filter string
+		cursor string
+		clause string
+		args   []interface{}
+	}{
+		{
+			"by id",
+			`{}`,
+			`[5]`,
+			`(((sl.id > $1 OR sl.id IS NULL)))`,
+			[]interface{}{"5"},
+		},
+		{
+			"after the filter's arguments",
+			`{"store_id": 7}`,
+			`[5]`,
+			`(((sl.id > $2 OR sl.id IS NULL)))`,
+			[]interface{}{7, "5"},
+		},
+		{
+			"ascending value",
+			`{"sort": [{"field": "name"}]}`,
+			`["Mission", 5]`,
+			`(((sl.name > $1 OR sl.name IS NULL)) OR (sl.name = $1 AND (sl.id > $2 OR sl.id IS NULL)))`,
+			[]interface{}{"Mission", "5"},
+		},
+		{
+			"descending value",
+			`{"sort": [{"field": "name", "desc": true}]}`,
+			`["Mission", 5]`,
+			`((sl.name < $1) OR (sl.name = $1 AND (sl.id > $2 OR sl.id IS NULL)))`,
+			[]interface{}{"Mission", "5"},
+		},
+		{
+			// NULLs sort last ascending, so only rows with the same NULL follow.
+			"ascending null",
+			`{"sort": [{"field": "name"}]}`,
+			`[null, 5]`,
+			`((sl.name IS NULL AND (sl.id > $1 OR sl.id IS NULL)))`,
+			[]interface{}{"5"},
+		},
+		{
+			// NULLs sort first descending, so every value follows.
+			"descending null",
+			`{"sort": [{"field": "name", "desc": true}]}`,
+			`[null, 5]`,
+			`((sl.name IS NOT NULL) OR (sl.name IS NULL AND (sl.id > $1 OR sl.id IS NULL)))`,
+			[]interface{}{"5"},
+		},
+		{
+			"booleans and numbers",
+			`{"sort": [{"field": "active"}, {"field": "latitude", "desc": true}]}`,
+			`[true, 30.25, 5]`,
+			`(((sl.active > $1 OR sl.active IS NULL)) OR (sl.active = $1 AND sl.latitude < $2) OR (sl.active = $1 AND sl.latitude = $2 AND (sl.id > $3 OR sl.id IS NULL)))`,
+			[]interface{}{true, "30.25", "5"},
+		},
+		{
+			"nothing follows",
+			`{}`,
+			`[null]`,
+			`FALSE`,
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := ParseLocationFilter([]byte(c.filter))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, err := filter.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := query.after(encodeCursor(c.cursor)); err != nil {
+				t.Fatal(err)
+			}
+			if got := query.clauses[len(query.clauses)-1]; got != c.clause {
+				t.Errorf("clause =\n%s\nwant\n%s", got, c.clause)
+			}
+			if !reflect.DeepEqual(query.args, c.args) {
+				t.Errorf("args = %#v, want %#v", query.args, c.args)
+			}
+		})
+	}
+}
+
+func TestCheckPage(t *testing.T) {
+	byName, err := ParseLocationFilter([]byte(`{"sort": [{"field": "name"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		filter LocationFilter
+		cursor string
+		reason string
+	}{
+		{"no cursor", byName, "", ""},
+		{"matching cursor", byName, encodeCursor(`["Mission", 5]`), ""},
+		{"not base64", byName, "not a cursor!", "malformed cursor"},
+		{"not a list", byName, encodeCursor(`{"name": "Mission"}`), "does not match the requested sort"},
+		{"cursor of another sort", byName, encodeCursor(`[5]`), "does not match the requested sort"},
+		{"cursor of a longer sort", LocationFilter{}, encodeCursor(`["Mission", 5]`), "does not match the requested sort"},
+		{"nested value", byName, encodeCursor(`[["Mission"], 5]`), "does not match the requested sort"},
+		{"invalid filter", LocationFilter{Sort: []SortField{{Field: "polygon"}}}, "", `unknown sort field "polygon"`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.filter.CheckPage(Page{Limit: 10, Cursor: c.cursor})
+			if c.reason == "" {
+				if err != nil {
+					t.Errorf("CheckPage = %v, want nil", err)
+				}
+				return
+			}
+			if _, ok := err.(*FilterError); !ok || !strings.Contains(err.Error(), c.reason) {
+				t.Errorf("CheckPage = %v, want a FilterError containing %q", err, c.reason)
+			}
+		})
+	}
+}
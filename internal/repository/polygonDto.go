@@ -35,6 +35,7 @@ type LocationRow struct {
 	ServiceAreaId int64 `db:"service_area_id"`
 	SellsAlcohol bool `db:"sells_alcohol"`
 	TaxExempt bool `db:"tax_exempt"`
+	TimeZone string `db:"time_zone"`
 }
 
 type LocationRowNull struct {
@@ -64,6 +65,7 @@ type LocationRowNull struct {
 	ServiceAreaId sql.NullInt64 `db:"service_area_id"`
 	SellsAlcohol sql.NullBool `db:"sells_alcohol"`
 	TaxExempt sql.NullBool `db:"tax_exempt"`
+	TimeZone sql.NullString `db:"time_zone"`
 }
 
 type LocationQuery struct {
@@ -112,6 +114,7 @@ type PolyLocationRow struct {
 	ServiceAreaId int64 `db:"service_area_id"`
 	SellsAlcohol bool `db:"sells_alcohol"`
 	TaxExempt bool `db:"tax_exempt"`
+	TimeZone string `db:"time_zone"`
 	Polygon model.PolyGeometry 	`json:"polygon" db:"polygon" validate:"required"`
 }
 
@@ -142,6 +145,7 @@ type PolyLocationResponse struct {
 	ServiceAreaId sql.NullInt64 `db:"service_area_id"`
 	SellsAlcohol sql.NullBool `db:"sells_alcohol"`
 	TaxExempt sql.NullBool `db:"tax_exempt"`
+	TimeZone sql.NullString `db:"time_zone"`
 	Polygon sql.NullString 	`json:"polygon" db:"polygon" validate:"required"`
 }
 
@@ -166,7 +170,13 @@ type PolyLocationResponseCleaned struct {
 	ClosingHour int64 `db:"closing_hour"`
 	StoreNumber string `db:"store_number"`
 	StoreGroup string `db:"store_group"`
+	Active bool `db:"active"`
+	AllowsPickup bool `db:"allows_pickup"`
+	IsEnvoyOnly bool `db:"is_envoy_only"`
 	ServiceAreaId int64 `db:"service_area_id"`
+	SellsAlcohol bool `db:"sells_alcohol"`
+	TaxExempt bool `db:"tax_exempt"`
+	TimeZone string `db:"time_zone"`
 	Polygon string 	`json:"polygon" db:"polygon" validate:"required"`
 }
 
@@ -243,6 +253,11 @@ type GeoJSONPolyFeature struct {
 	Geometry model.PolyGeometry `json:"geometry"`
 }
 
+type GeoJSONFeatureCollection struct {
+	Type string `json:"type"`
+	Features []interface{} `json:"features"`
+}
+
 func toPolygonRow(polygonID int, polygonObject model.PolyGeometry) (*PolygonRow, error) {
 	polyGeom, err := json.Marshal(polygonObject)
 	if err != nil {
@@ -277,7 +292,13 @@ func PLResponseToRegularTypes(response PolyLocationResponse) (PolyLocationRespon
 		ClosingHour: response.ClosingHour.Int64,
 		StoreNumber: response.StoreNumber.String,
 		StoreGroup: response.StoreGroup.String,
+		Active: response.Active.Bool,
+		AllowsPickup: response.AllowsPickup.Bool,
+		IsEnvoyOnly: response.IsEnvoyOnly.Bool,
 		ServiceAreaId: response.ServiceAreaId.Int64,
+		SellsAlcohol: response.SellsAlcohol.Bool,
+		TaxExempt: response.TaxExempt.Bool,
+		TimeZone: response.TimeZone.String,
 		Polygon: response.Polygon.String,
 	}
 }
@@ -312,7 +333,13 @@ func LocationToRegularTypes(response LocationRowNull) (LocationRow) {
 		ClosingHour: response.ClosingHour.Int64,
 		StoreNumber: response.StoreNumber.String,
 		StoreGroup: response.StoreGroup.String,
+		Active: response.Active.Bool,
+		AllowsPickup: response.AllowsPickup.Bool,
+		IsEnvoyOnly: response.IsEnvoyOnly.Bool,
 		ServiceAreaId: response.ServiceAreaId.Int64,
+		SellsAlcohol: response.SellsAlcohol.Bool,
+		TaxExempt: response.TaxExempt.Bool,
+		TimeZone: response.TimeZone.String,
 	}
 }
 
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+	"github.com/pkg/errors"
+)
+
+// The files a PolygonFileRepository keeps in its directory.
+const (
+	locationsFileName       = "locations.geojson"
+	polygonVersionsFileName = "polygon_versions.json"
+	storePrioritiesFileName = "store_priorities.json"
+)
+
+// The contents of locations.geojson.
+type locationCollection struct {
+	Type     string            `json:"type"`
+	Features []locationFeature `json:"features"`
+}
+
+// A location as stored in locations.geojson: a GeoJSON Feature whose geometry is the location's polygon, or null,
+// and whose properties are its other columns, timestamps included.
+type locationFeature struct {
+	Type       string                     `json:"type"`
+	ID         int                        `json:"id"`
+	Geometry   json.RawMessage            `json:"geometry"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+// A polygon version as stored in polygon_versions.json, with the geometry PolygonVersion leaves out of JSON.
+type fileVersion struct {
+	PolygonVersion
+	Polygon json.RawMessage `json:"polygon"`
+}
+
+// PolygonFileRepository is a PolygonMemoryRepository kept in a directory, for running the service without Postgres.
+// Locations and their polygons are a GeoJSON FeatureCollection in locations.geojson, polygon history is in
+// polygon_versions.json and store priorities are in store_priorities.json. The files are read when the repository is opened and rewritten after every write, so the
+// directory must belong to a single instance. A write that cannot be saved is reported as failed, but stays in
+// memory until the service restarts.
+type PolygonFileRepository struct {
+	*PolygonMemoryRepository
+	dir       string
+	saveMutex sync.Mutex
+}
+
+var _ PolygonRepository = (*PolygonFileRepository)(nil)
+
+// NewPolygonFileRepository opens the repository kept in dir, creating the directory if it does not exist.
+func NewPolygonFileRepository(dir string) (*PolygonFileRepository, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	repo := &PolygonFileRepository{
+		PolygonMemoryRepository: NewPolygonMemoryRepository(),
+		dir:                     dir,
+	}
+	err = repo.load()
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (c *PolygonFileRepository) CreateLocation(id int, fields LocationFields) (bool, error) {
+	created, err := c.PolygonMemoryRepository.CreateLocation(id, fields)
+	return created, c.saveIfChanged(created, err)
+}
+
+func (c *PolygonFileRepository) ReplaceLocation(id int, fields LocationFields) (bool, error) {
+	replaced, err := c.PolygonMemoryRepository.ReplaceLocation(id, fields)
+	return replaced, c.saveIfChanged(replaced, err)
+}
+
+func (c *PolygonFileRepository) UpdateLocation(id int, fields LocationFields) (bool, error) {
+	updated, err := c.PolygonMemoryRepository.UpdateLocation(id, fields)
+	return updated, c.saveIfChanged(updated, err)
+}
+
+func (c *PolygonFileRepository) DeleteLocation(id int) (bool, error) {
+	deleted, err := c.PolygonMemoryRepository.DeleteLocation(id)
+	return deleted, c.saveIfChanged(deleted, err)
+}
+
+func (c *PolygonFileRepository) RestoreLocation(id int) (bool, error) {
+	restored, err := c.PolygonMemoryRepository.RestoreLocation(id)
+	return restored, c.saveIfChanged(restored, err)
+}
+
+func (c *PolygonFileRepository) UpsertLocations(rows []LocationRowNull) ([]error, error) {
+	rowErrors, err := c.PolygonMemoryRepository.UpsertLocations(rows)
+	return rowErrors, c.saveIfChanged(len(rows) > 0, err)
+}
+
+func (c *PolygonFileRepository) InsertPolygon(polygonID int, polygonObject model.PolyGeometry, change PolygonChange) error {
+	err := c.PolygonMemoryRepository.InsertPolygon(polygonID, polygonObject, change)
+	return c.saveIfChanged(true, err)
+}
+
+func (c *PolygonFileRepository) SavePolygon(id int, polygonObject model.PolyGeometry, change PolygonChange) (PolygonVersion, bool, error) {
+	version, found, err := c.PolygonMemoryRepository.SavePolygon(id, polygonObject, change)
+	return version, found, c.saveIfChanged(found, err)
+}
+
+func (c *PolygonFileRepository) SavePolygons(polygons map[int]model.PolyGeometry, change PolygonChange) ([]PolygonVersion, []int, error) {
+	versions, missing, err := c.PolygonMemoryRepository.SavePolygons(polygons, change)
+	return versions, missing, c.saveIfChanged(len(versions) > 0, err)
+}
+
+func (c *PolygonFileRepository) DeletePolygon(id int, change PolygonChange) (PolygonVersion, bool, error) {
+	version, found, err := c.PolygonMemoryRepository.DeletePolygon(id, change)
+	return version, found, c.saveIfChanged(found, err)
+}
+
+func (c *PolygonFileRepository) RollbackPolygon(id, target int, change PolygonChange) (PolygonVersion, bool, error) {
+	version, found, err := c.PolygonMemoryRepository.RollbackPolygon(id, target, change)
+	return version, found, c.saveIfChanged(found, err)
+}
+
+func (c *PolygonFileRepository) SetStorePriority(priority StorePriority) error {
+	return c.saveIfChanged(true, c.PolygonMemoryRepository.SetStorePriority(priority))
+}
+
+// Helper function to save the repository after a write that succeeded and changed something, passing on the
+// write's error otherwise.
+func (c *PolygonFileRepository) saveIfChanged(changed bool, err error) error {
+	if err != nil || !changed {
+		return err
+	}
+	return c.save()
+}
+
+// Helper function to rewrite every file from the repository as it is now. Saves are serialized, so the last one to
+// finish always holds every write made before it started.
+func (c *PolygonFileRepository) save() error {
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+
+	collection, versions, err := c.snapshot()
+	if err != nil {
+		return err
+	}
+	err = writeJSONFile(filepath.Join(c.dir, locationsFileName), collection)
+	if err != nil {
+		return errors.Wrapf(err, "error saving %s", locationsFileName)
+	}
+	err = writeJSONFile(filepath.Join(c.dir, polygonVersionsFileName), versions)
+	if err != nil {
+		return errors.Wrapf(err, "error saving %s", polygonVersionsFileName)
+	}
+	priorities, err := c.ListStorePriorities()
+	if err != nil {
+		return err
+	}
+	err = writeJSONFile(filepath.Join(c.dir, storePrioritiesFileName), priorities)
+	return errors.Wrapf(err, "error saving %s", storePrioritiesFileName)
+}
+
+// Helper function to copy the repository into the form it is saved in, ordered by ID.
+func (c *PolygonFileRepository) snapshot() (locationCollection, []fileVersion, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	collection := locationCollection{Type: "FeatureCollection", Features: make([]locationFeature, 0, len(c.locations))}
+	for id, row := range c.locations {
+		feature := locationFeature{
+			Type:       "Feature",
+			ID:         id,
+			Geometry:   json.RawMessage("null"),
+			Properties: map[string]json.RawMessage{},
+		}
+		if polygon, ok := c.polygons[id]; ok {
+			feature.Geometry = json.RawMessage(polygon.geoJSON)
+		}
+		for column, value := range LocationFieldsOf(row) {
+			if column == "id" {
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return locationCollection{}, nil, err
+			}
+			feature.Properties[column] = encoded
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+	sort.Slice(collection.Features, func(i, j int) bool {
+		return collection.Features[i].ID < collection.Features[j].ID
+	})
+
+	ids := make([]int, 0, len(c.versions))
+	for id := range c.versions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	versions := []fileVersion{}
+	for _, id := range ids {
+		for _, version := range c.versions[id] {
+			stored := fileVersion{PolygonVersion: version, Polygon: json.RawMessage("null")}
+			if version.Polygon != nil {
+				stored.Polygon = json.RawMessage(*version.Polygon)
+			}
+			versions = append(versions, stored)
+		}
+	}
+	return collection, versions, nil
+}
+
+// Helper function to read every file into the empty repository. Missing files are an empty repository.
+func (c *PolygonFileRepository) load() error {
+	var collection locationCollection
+	_, err := readJSONFile(filepath.Join(c.dir, locationsFileName), &collection)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", locationsFileName)
+	}
+	for _, feature := range collection.Features {
+		delete(feature.Properties, "id")
+		fields, err := decodeLocationFields(feature.Properties, true)
+		if err != nil {
+			return errors.Wrapf(err, "invalid location %d in %s", feature.ID, locationsFileName)
+		}
+		row := LocationRowNull{ID: feature.ID}
+		err = setLocationFields(&row, fields, true)
+		if err != nil {
+			return errors.Wrapf(err, "invalid location %d in %s", feature.ID, locationsFileName)
+		}
+		c.locations[feature.ID] = row
+
+		if len(feature.Geometry) == 0 || string(feature.Geometry) == "null" {
+			continue
+		}
+		var geometry model.PolyGeometry
+		err = json.Unmarshal(feature.Geometry, &geometry)
+		if err != nil {
+			return errors.Wrapf(err, "invalid polygon for location %d in %s", feature.ID, locationsFileName)
+		}
+		polygon, err := toPolygonRow(feature.ID, geometry)
+		if err != nil {
+			return errors.Wrapf(err, "invalid polygon for location %d in %s", feature.ID, locationsFileName)
+		}
+		c.polygons[feature.ID] = memoryPolygon{geometry, polygon.Polygon}
+	}
+
+	var versions []fileVersion
+	_, err = readJSONFile(filepath.Join(c.dir, polygonVersionsFileName), &versions)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", polygonVersionsFileName)
+	}
+	for _, stored := range versions {
+		version := stored.PolygonVersion
+		if len(stored.Polygon) > 0 && string(stored.Polygon) != "null" {
+			geoJSON := string(stored.Polygon)
+			version.Polygon = &geoJSON
+		}
+		c.versions[version.PolygonID] = append(c.versions[version.PolygonID], version)
+	}
+
+	// Polygons added to locations.geojson by hand start with a first version, as polygons stored before version
+	// history did in Postgres, so that their next change can be rolled back.
+	for id, polygon := range c.polygons {
+		if len(c.versions[id]) > 0 {
+			continue
+		}
+		geoJSON := polygon.geoJSON
+		c.versions[id] = []PolygonVersion{{
+			PolygonID: id,
+			Version:   1,
+			Action:    PolygonCreated,
+			Polygon:   &geoJSON,
+			Reason:    "stored before version history",
+			ChangedAt: memoryNow().Time,
+		}}
+	}
+
+	var priorities []StorePriority
+	_, err = readJSONFile(filepath.Join(c.dir, storePrioritiesFileName), &priorities)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", storePrioritiesFileName)
+	}
+	for _, priority := range priorities {
+		c.priorities[priority.StoreID] = priority.Priority
+	}
+	return nil
+}
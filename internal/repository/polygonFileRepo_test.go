@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/geofence/internal/model"
+)
+
+func TestPolygonFileRepositoryReopens(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewPolygonFileRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.CreateLocation(1, LocationFields{"name": "Mission", "store_id": int64(7), "active": true})
+	repo.CreateLocation(2, LocationFields{"name": "Castro"})
+	repo.DeleteLocation(2)
+	square, _, _ := parseMemoryGeometry(`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1], [0, 0]]]}`)
+	wider, _, _ := parseMemoryGeometry(`{"type": "Polygon", "coordinates": [[[0, 0], [2, 0], [2, 1], [0, 1], [0, 0]]]}`)
+	repo.SavePolygon(1, square, PolygonChange{ChangedBy: "ana"})
+	_, _, err = repo.SavePolygon(1, wider, PolygonChange{ChangedBy: "ana", Reason: "wider"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.SetStorePriority(StorePriority{StoreID: 7, Priority: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewPolygonFileRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{1, 2} {
+		want, _, _ := repo.GetLocation(id, true)
+		got, found, _ := reopened.GetLocation(id, true)
+		if !found || !reflect.DeepEqual(LocationFieldsOf(got), LocationFieldsOf(want)) {
+			t.Errorf("reopened location %d = %+v, want %+v", id, got, want)
+		}
+	}
+	want, _ := repo.ListPolygonVersions(1)
+	got, _ := reopened.ListPolygonVersions(1)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reopened versions = %+v, want %+v", got, want)
+	}
+	priorities, _ := reopened.ListStorePriorities()
+	if !reflect.DeepEqual(priorities, []StorePriority{{StoreID: 7, Priority: 3}}) {
+		t.Errorf("reopened priorities = %+v", priorities)
+	}
+	rolledBack, found, err := reopened.RollbackPolygon(1, 1, PolygonChange{ChangedBy: "ben"})
+	if err != nil || !found || rolledBack.Version != 3 {
+		t.Fatalf("RollbackPolygon() = %+v, %v, %v", rolledBack, found, err)
+	}
+	fences, _ := reopened.GetAllFences()
+	if len(fences) != 1 || fences[0].Polygon != *rolledBack.Polygon {
+		t.Errorf("fences after rollback = %+v", fences)
+	}
+}
+
+func TestEventFileRepositoryReopens(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewEventFileRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []model.FenceEvent{
+		{DeviceID: "a", EventType: "enter", StoreID: 7, OccurredAt: start},
+		{DeviceID: "b", EventType: "enter", StoreID: 7, OccurredAt: start.Add(time.Minute)},
+		{DeviceID: "a", EventType: "exit", StoreID: 7, OccurredAt: start.Add(2 * time.Minute)},
+	}
+	err = repo.InsertEvents(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events[2].ID != 3 {
+		t.Errorf("third event ID = %d, want 3", events[2].ID)
+	}
+	repo.Close()
+
+	reopened, err := NewEventFileRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	results, _ := reopened.QueryEvents(EventQuery{DeviceID: "a", Until: start.Add(2 * time.Minute)})
+	if len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("events before the exit = %+v", results)
+	}
+	results, _ = reopened.QueryEvents(EventQuery{StoreID: 7, Limit: 2})
+	if len(results) != 2 || results[0].ID != 3 || results[1].ID != 2 {
+		t.Errorf("latest two events = %+v", results)
+	}
+}
+
+func TestWebhookFileRepositoryKeepsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewWebhookFileRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := WebhookSubscription{URL: "https://example.com/a", Secret: "shh"}
+	second := WebhookSubscription{URL: "https://example.com/b"}
+	repo.CreateSubscription(&first)
+	repo.CreateSubscription(&second)
+	repo.DeleteSubscription(second.ID)
+
+	reopened, err := NewWebhookFileRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptions, _ := reopened.ListSubscriptions()
+	if len(subscriptions) != 1 || subscriptions[0].Secret != "shh" || subscriptions[0].ID != first.ID {
+		t.Errorf("reopened subscriptions = %+v", subscriptions)
+	}
+	third := WebhookSubscription{URL: "https://example.com/c"}
+	reopened.CreateSubscription(&third)
+	if third.ID != 3 {
+		t.Errorf("subscription created after a delete has ID %d, want 3", third.ID)
+	}
+}
@@ -1,12 +1,54 @@
 package repository
 
 import (
+	"github.com/geofence/internal/json"
 	"github.com/geofence/internal/model"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
-	"strconv"
 )
 
+// PolygonRepository stores locations, their polygons and each polygon's history, and answers the queries the
+// controllers make of them. PolygonPostgresRepository keeps them in PostGIS and PolygonMemoryRepository in memory.
+type PolygonRepository interface {
+	Intersects(item1 string, item2 string) (bool, error)
+	MakeValid(polygonObject model.PolyGeometry) (model.PolyGeometry, error)
+	FindClosest(storeID int, long, lat float64) (LocationRow, error)
+	FindNearest(query NearestQuery) ([]NearestLocation, error)
+	FindEnclosingPolygon(query EnclosingQuery) ([]LocationRowNull, error)
+
+	GetAll(includeDeleted bool) ([]PolyLocationResponseCleaned, error)
+	GetAllFences() ([]PolyLocationResponseCleaned, error)
+	GetPolygonFromID(id int) (string, error)
+	GetPolyLocationFromID(id int) ([]PolyLocationResponseCleaned, error)
+	FindLocations(filter LocationFilter) ([]PolyLocationResponseCleaned, error)
+	FindLocationsPage(filter LocationFilter, page Page) ([]PolyLocationResponseCleaned, string, error)
+	StreamLocations(filter LocationFilter, page Page, visit func(PolyLocationResponseCleaned) error) error
+	GetFencesPage(page Page, includeDeleted bool) ([]PolyLocationResponseCleaned, string, error)
+	StreamFences(page Page, includeDeleted bool, visit func(PolyLocationResponseCleaned) error) error
+
+	GetLocation(id int, includeDeleted bool) (LocationRowNull, bool, error)
+	CreateLocation(id int, fields LocationFields) (bool, error)
+	ReplaceLocation(id int, fields LocationFields) (bool, error)
+	UpdateLocation(id int, fields LocationFields) (bool, error)
+	DeleteLocation(id int) (bool, error)
+	RestoreLocation(id int) (bool, error)
+	UpsertLocations(rows []LocationRowNull) ([]error, error)
+
+	InsertPolygon(polygonID int, polygonObject model.PolyGeometry, change PolygonChange) error
+	GetPolygon(id int) (PolygonVersion, bool, error)
+	GetPolygonVersion(id, version int) (PolygonVersion, bool, error)
+	ListPolygonVersions(id int) ([]PolygonVersion, error)
+	SavePolygon(id int, polygonObject model.PolyGeometry, change PolygonChange) (PolygonVersion, bool, error)
+	SavePolygons(polygons map[int]model.PolyGeometry, change PolygonChange) ([]PolygonVersion, []int, error)
+	DeletePolygon(id int, change PolygonChange) (PolygonVersion, bool, error)
+	RollbackPolygon(id, target int, change PolygonChange) (PolygonVersion, bool, error)
+
+	ListStorePriorities() ([]StorePriority, error)
+	SetStorePriority(priority StorePriority) error
+}
+
+var _ PolygonRepository = (*PolygonPostgresRepository)(nil)
+
 type PolygonPostgresRepository struct {
 	DB sqlx.DB
 }
@@ -61,7 +103,8 @@ func (c *PolygonPostgresRepository) InsertLocation(locationRequest LocationRow)
 		is_envoy_only,
 		service_area_id,
 		sells_alcohol,
-		tax_exempt
+		tax_exempt,
+		time_zone
 	)
 	VALUES (
 		:id,
@@ -89,7 +132,8 @@ func (c *PolygonPostgresRepository) InsertLocation(locationRequest LocationRow)
 		:is_envoy_only,
 		:service_area_id,
 		:sells_alcohol,
-		:tax_exempt
+		:tax_exempt,
+		:time_zone
 	)
 	`
 	transaction, err := c.DB.Beginx()
@@ -115,48 +159,35 @@ func (c *PolygonPostgresRepository) InsertLocation(locationRequest LocationRow)
 	return nil
 }
 
-func (c *PolygonPostgresRepository) InsertPolygon(polygonID int, polygonObject model.PolyGeometry) (error) {
-	insertSQL := `INSERT INTO store_polygons (
-		id,
-		polygon
-	)
-	VALUES (
-		:id,
-		ST_GeomFromGeoJSON(:polygon)
-	)
-	ON CONFLICT (id) DO UPDATE SET polygon = ST_GeomFromGeoJSON(:polygon)
-	`
-
-	row, err := toPolygonRow(polygonID, polygonObject)
+// InsertPolygon creates or replaces a location's polygon, recording the change in its version history.
+func (c *PolygonPostgresRepository) InsertPolygon(polygonID int, polygonObject model.PolyGeometry, change PolygonChange) (error) {
+	_, found, err := c.SavePolygon(polygonID, polygonObject, change)
 	if err != nil {
 		return err
 	}
-
-	transaction, err := c.DB.Beginx()
-	if err != nil {
-		return err
+	if !found {
+		return errors.Errorf("No location with ID %d", polygonID)
 	}
-	rollback := false
-
-	defer func() {
-		if rollback {
-			transaction.Rollback()
-		} else {
-			_ = transaction.Commit()
-		}
-	}()
+	return nil
+}
 
-	_, err = transaction.NamedExec(insertSQL, row)
+// Returns every location that has a polygon. Soft-deleted locations are only included if asked for.
+func (c *PolygonPostgresRepository) GetAll(includeDeleted bool) ([]PolyLocationResponseCleaned, error) {
+	querySQL := `SELECT * FROM store_polygons NATURAL JOIN store_locations`
+	if !includeDeleted {
+		querySQL += ` WHERE deleted_at IS NULL`
+	}
+	var results []PolyLocationResponse
+	err := c.DB.Select(&results, querySQL)
 	if err != nil {
-		rollback = true
-		return err
+		return []PolyLocationResponseCleaned{}, err
 	}
-
-	return nil
+	return PLResponseArrayToRegularTypes(results), nil
 }
 
-func (c *PolygonPostgresRepository) GetAll() ([]PolyLocationResponseCleaned, error) {
-	querySQL := `SELECT * FROM store_polygons NATURAL JOIN store_locations`
+// Returns every location that has a polygon and has not been deleted, with the polygon as GeoJSON.
+func (c *PolygonPostgresRepository) GetAllFences() ([]PolyLocationResponseCleaned, error) {
+	querySQL := `SELECT sl.*, ST_AsGeoJSON(sp.polygon) as polygon FROM store_polygons as sp JOIN store_locations as sl ON (sl.id = sp.id) WHERE sl.deleted_at IS NULL ORDER BY sl.id`
 	var results []PolyLocationResponse
 	err := c.DB.Select(&results, querySQL)
 	if err != nil {
@@ -178,8 +209,9 @@ func (c *PolygonPostgresRepository) GetPolygonFromID(id int) (string, error) {
 	return result, nil
 }
 
+// Returns the location with the given ID and its polygon, unless it has been deleted.
 func (c *PolygonPostgresRepository) GetPolyLocationFromID(id int) ([]PolyLocationResponseCleaned, error) {
-	querySQL := `SELECT sl.*, ST_AsGeoJSON(sp.polygon) as polygon FROM store_locations as sl LEFT JOIN store_polygons as sp ON (sl.id = sp.id) WHERE sl.id = $1`
+	querySQL := `SELECT sl.*, ST_AsGeoJSON(sp.polygon) as polygon FROM store_locations as sl LEFT JOIN store_polygons as sp ON (sl.id = sp.id) WHERE sl.id = $1 AND sl.deleted_at IS NULL`
 	var result []PolyLocationResponse
 	err := c.DB.Select(&result, querySQL, id)
 	if err != nil {
@@ -191,41 +223,22 @@ func (c *PolygonPostgresRepository) GetPolyLocationFromID(id int) ([]PolyLocatio
 	return PLResponseArrayToRegularTypes(result), nil
 }
 
+// QueryDatabase is kept for callers of the original equality-only query; see FindLocations.
 func (c *PolygonPostgresRepository) QueryDatabase(data LocationQuery) ([]PolyLocationResponseCleaned, error) {
-	var appendedCount int
-	var storeIDclause string
-	var metroIDclause string
-	var zoneIDclause string
-	var cityClause string
-	var stateClause string
-	if (data.ID != 0) {
-		return c.GetPolyLocationFromID(data.ID)
-	}
-	if (data.StoreID != 0) {
-		storeIDclause = `sl.store_id = ` + strconv.Itoa(data.StoreID)
-	}
-	if (data.MetroID != 0) {
-		metroIDclause = `sl.metro_id = ` + strconv.Itoa(data.MetroID)
-	}
-	if (data.ZoneID != 0) {
-		zoneIDclause = `sl.zone_id = ` + strconv.Itoa(data.ZoneID)
-	}
-	if (data.City != "") {
-		cityClause = `sl.city = '` + data.City + `'`
-	}
-	if (data.State != "") {
-		stateClause = `sl.state = '` + data.State + `'`
+	return c.FindLocations(LocationFilter{LocationQuery: data})
+}
+
+// Returns every location matching the filter, with its polygon when it has one.
+// Every value in the filter is passed as a query parameter.
+func (c *PolygonPostgresRepository) FindLocations(filter LocationFilter) ([]PolyLocationResponseCleaned, error) {
+	query, err := filter.build()
+	if err != nil {
+		return []PolyLocationResponseCleaned{}, err
 	}
-	baseQuery := `SELECT sl.*, ST_AsGeoJSON(sp.polygon) as polygon FROM store_locations as sl LEFT JOIN store_polygons as sp ON (sl.id = sp.id)`
-	baseQuery = appendClause(baseQuery, storeIDclause, &appendedCount)
-	baseQuery = appendClause(baseQuery, metroIDclause, &appendedCount)
-	baseQuery = appendClause(baseQuery, zoneIDclause, &appendedCount)
-	baseQuery = appendClause(baseQuery, cityClause, &appendedCount)
-	baseQuery = appendClause(baseQuery, stateClause, &appendedCount)
-	baseQuery = baseQuery + ` ORDER BY sl.id`
+	querySQL := query.sql(`SELECT sl.*, ST_AsGeoJSON(sp.polygon) as polygon FROM store_locations as sl LEFT JOIN store_polygons as sp ON (sl.id = sp.id)`)
 	var results []PolyLocationResponse
 
-	err := c.DB.Select(&results, baseQuery)
+	err = c.DB.Select(&results, querySQL, query.args...)
 	if err != nil {
 		return []PolyLocationResponseCleaned{}, err
 	}
@@ -233,25 +246,14 @@ func (c *PolygonPostgresRepository) QueryDatabase(data LocationQuery) ([]PolyLoc
 	return PLResponseArrayToRegularTypes(results), nil
 }
 
-func appendClause(baseQuery, clause string, appended *int) string {
-	if clause == "" {
-		return baseQuery
-	}
-	if *appended == 0 {
-		*appended += 1
-		return baseQuery + ` WHERE ` + clause
-	} else {
-		*appended += 1
-		return baseQuery + ` AND ` + clause
-	}
-}
-func (c*PolygonPostgresRepository) FindClosest(store_id int, lat, long float64) (LocationRow, error) {
-	querySQL := `WITH candidates (id, distance) AS (SELECT id, ST_Distance(ST_MakePoint(latitude, longitude), ST_MakePoint($2, $3)) as distance FROM store_locations 
-					WHERE ST_DWithin(ST_MakePoint(latitude, longitude), ST_MakePoint($2, $3), 1) AND active=True AND store_id= $1)
+// Points are built as ST_MakePoint(longitude, latitude), matching PostGIS's x=lon convention.
+func (c*PolygonPostgresRepository) FindClosest(store_id int, long, lat float64) (LocationRow, error) {
+	querySQL := `WITH candidates (id, distance) AS (SELECT id, ST_Distance(ST_MakePoint(longitude, latitude), ST_MakePoint($2, $3)) as distance FROM store_locations 
+					WHERE ST_DWithin(ST_MakePoint(longitude, latitude), ST_MakePoint($2, $3), 1) AND active=True AND store_id= $1 AND deleted_at IS NULL)
 					SELECT store_locations.* FROM candidates, store_locations
 					WHERE store_locations.id = candidates.id AND candidates.distance in (SELECT MIN(candidates.distance) FROM candidates)`
 	var results []LocationRowNull
-	err := c.DB.Select(&results, querySQL, store_id, lat, long)
+	err := c.DB.Select(&results, querySQL, store_id, long, lat)
 	if err != nil {
 		return LocationRow{}, err
 	}
@@ -261,7 +263,7 @@ func (c*PolygonPostgresRepository) FindClosest(store_id int, lat, long float64)
 	if len(results) == 1 {
 		return LocationToRegularTypes(results[0]), nil
 	} else {
-		result, err := c.checkPolygons(results, lat, long)
+		result, err := c.checkPolygons(results, long, lat)
 		if err != nil {
 			return LocationRow{}, err
 		}
@@ -269,7 +271,9 @@ func (c*PolygonPostgresRepository) FindClosest(store_id int, lat, long float64)
 	}
 }
 
-func (c*PolygonPostgresRepository) checkPolygons(rows []LocationRowNull, lat, long float64) (LocationRowNull, error) {
+// Helper function to break a tie between equally close locations by the polygon containing the point. Returns no
+// location unless every location has a polygon and exactly one contains the point.
+func (c*PolygonPostgresRepository) checkPolygons(rows []LocationRowNull, long, lat float64) (LocationRowNull, error) {
 	var indices []int
 	for _, row := range rows {
 		indices = append(indices, row.ID)
@@ -281,26 +285,16 @@ func (c*PolygonPostgresRepository) checkPolygons(rows []LocationRowNull, lat, lo
 	if proceed == false {
 		return LocationRowNull{}, nil
 	}
-	params := map[string]interface{}{
-		"lat": lat,
-		"long": long,
-		"ids": indices,
-
-	}
-	querySQL := `SELECT sl.* FROM store_locations sl, store_polygons sp WHERE sl.id IN (:ids) AND sp.id = sl.id AND ST_Intersects(sp.polygon, ST_MakePoint(:lat, :long))`
-	querySQL, args, err := sqlx.Named(querySQL, params)
-	if err != nil {
-		return LocationRowNull{}, err
-	}
-	querySQL, args, err = sqlx.In(querySQL, args)
+	querySQL := `SELECT sl.* FROM store_locations sl, store_polygons sp WHERE sl.id IN (?) AND sp.id = sl.id AND sl.deleted_at IS NULL AND ST_Intersects(sp.polygon, ST_MakePoint(?, ?))`
+	querySQL, args, err := sqlx.In(querySQL, indices, long, lat)
 	if err != nil {
 		return LocationRowNull{}, err
 	}
 	querySQL = c.DB.Rebind(querySQL)
 	var results []LocationRowNull
-	err = c.DB.Select(&results, querySQL)
+	err = c.DB.Select(&results, querySQL, args...)
 	if err != nil {
-		return LocationRowNull{}, nil
+		return LocationRowNull{}, err
 	}
 	if len(results) != 1 {
 		return LocationRowNull{}, nil
@@ -309,40 +303,39 @@ func (c*PolygonPostgresRepository) checkPolygons(rows []LocationRowNull, lat, lo
 }
 
 func (c*PolygonPostgresRepository) checkAllExistsInPolygonTable(indices []int) (bool, error) {
-	querySQL := `SELECT * FROM store_polygons WHERE id IN (?)`
+	querySQL := `SELECT count(*) FROM store_polygons WHERE id IN (?)`
 	query, args, err := sqlx.In(querySQL, indices)
 	if err != nil {
 		return false, err
 	}
-	c.DB.Rebind(query)
-	var records []PolygonRow
-	err = c.DB.Select(records, query, args)
+	query = c.DB.Rebind(query)
+	var count int
+	err = c.DB.Get(&count, query, args...)
 	if err != nil {
 		return false, err
 	}
-	if len(records) == len(indices) {
-		return true, nil
-	} else {
-		return false, nil
-	}
+	return count == len(indices), nil
 }
 
-// Assumes that all polygons have been drawn for
-func (c*PolygonPostgresRepository) FindEnclosingPolygon(lat, long float64, storeID, metroID, zoneID int) (LocationRow, error) {
-	querySQL := `SELECT sl.* FROM store_locations sl, store_polygons sp 
-				WHERE sl.id=sp.id AND sl.store_id=$3 AND sl.metro_id=$4 AND sl.zone_id=$5 AND ST_Intersects(ST_MakePoint($1, $2), sp.polygon)`
-	var results []LocationRow
-	err := c.DB.Select(results, querySQL, lat, long, storeID, metroID, zoneID)
+// MakeValid resolves self-intersections with PostGIS, keeping only the polygonal parts of the result. A Polygon
+// that becomes several polygons is returned as a MultiPolygon.
+func (c *PolygonPostgresRepository) MakeValid(polygonObject model.PolyGeometry) (model.PolyGeometry, error) {
+	row, err := toPolygonRow(0, polygonObject)
 	if err != nil {
-		return LocationRow{}, err
+		return model.PolyGeometry{}, err
 	}
-	if len(results) != 1 {
-		return LocationRow{}, nil
-	} else {
-		return results[0], nil
+	var result string
+	err = c.DB.Get(&result, `SELECT ST_AsGeoJSON(ST_Multi(ST_CollectionExtract(ST_MakeValid(ST_GeomFromGeoJSON($1)), 3)), 15)`, row.Polygon)
+	if err != nil {
+		return model.PolyGeometry{}, err
+	}
+	var valid model.PolyGeometry
+	err = json.Unmarshal([]byte(result), &valid)
+	if err != nil {
+		return model.PolyGeometry{}, err
+	}
+	if polygonObject.Type == model.PolygonType && len(valid.Polygons) == 1 {
+		valid.Type = model.PolygonType
 	}
+	return valid, nil
 }
-
-
-
-
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"sort"
+	"time"
+
+	"github.com/geofence/internal/model"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// The changes recorded in polygon_versions.
+const (
+	PolygonCreated    = "create"
+	PolygonReplaced   = "replace"
+	PolygonDeleted    = "delete"
+	PolygonRolledBack = "rollback"
+)
+
+// PolygonVersion is one entry in a polygon's history. Polygon is the GeoJSON stored by the change, nil when it
+// deleted the polygon or when versions are listed without their geometry.
+type PolygonVersion struct {
+	PolygonID    int       `json:"polygon_id" db:"polygon_id"`
+	Version      int       `json:"version" db:"version"`
+	Action       string    `json:"action" db:"action"`
+	Polygon      *string   `json:"-" db:"polygon"`
+	ChangedBy    string    `json:"changed_by" db:"changed_by"`
+	Reason       string    `json:"reason" db:"reason"`
+	RolledBackTo *int      `json:"rolled_back_to,omitempty" db:"rolled_back_to"`
+	ChangedAt    time.Time `json:"changed_at" db:"changed_at"`
+}
+
+// PolygonChange is who made a change to a polygon and why.
+type PolygonChange struct {
+	ChangedBy string
+	Reason    string
+}
+
+const polygonVersionColumns = `polygon_id, version, action, ST_AsGeoJSON(polygon) as polygon, changed_by, reason, rolled_back_to, changed_at`
+
+// GetPolygon returns the current polygon of a location that has not been deleted, as its latest version.
+func (c *PolygonPostgresRepository) GetPolygon(id int) (PolygonVersion, bool, error) {
+	querySQL := `SELECT v.polygon_id, v.version, v.action, ST_AsGeoJSON(sp.polygon) as polygon, v.changed_by, v.reason, v.rolled_back_to, v.changed_at
+		FROM store_polygons sp
+		JOIN store_locations sl ON (sl.id = sp.id)
+		JOIN polygon_versions v ON (v.polygon_id = sp.id)
+		WHERE sp.id = $1 AND sl.deleted_at IS NULL
+		ORDER BY v.version DESC LIMIT 1`
+	return c.getPolygonVersion(querySQL, id)
+}
+
+// GetPolygonVersion returns one version of a polygon with its geometry.
+func (c *PolygonPostgresRepository) GetPolygonVersion(id, version int) (PolygonVersion, bool, error) {
+	querySQL := `SELECT ` + polygonVersionColumns + ` FROM polygon_versions WHERE polygon_id = $1 AND version = $2`
+	return c.getPolygonVersion(querySQL, id, version)
+}
+
+func (c *PolygonPostgresRepository) getPolygonVersion(querySQL string, args ...interface{}) (PolygonVersion, bool, error) {
+	var results []PolygonVersion
+	err := c.DB.Select(&results, querySQL, args...)
+	if err != nil || len(results) == 0 {
+		return PolygonVersion{}, false, err
+	}
+	return results[0], true, nil
+}
+
+// ListPolygonVersions returns a polygon's history, newest first, without geometry.
+func (c *PolygonPostgresRepository) ListPolygonVersions(id int) ([]PolygonVersion, error) {
+	querySQL := `SELECT polygon_id, version, action, changed_by, reason, rolled_back_to, changed_at
+		FROM polygon_versions WHERE polygon_id = $1 ORDER BY version DESC`
+	results := []PolygonVersion{}
+	err := c.DB.Select(&results, querySQL, id)
+	if err != nil {
+		return []PolygonVersion{}, err
+	}
+	return results, nil
+}
+
+// SavePolygon creates or replaces a location's polygon and records the new version. It returns false if the
+// location does not exist or has been deleted.
+func (c *PolygonPostgresRepository) SavePolygon(id int, polygonObject model.PolyGeometry, change PolygonChange) (PolygonVersion, bool, error) {
+	row, err := toPolygonRow(id, polygonObject)
+	if err != nil {
+		return PolygonVersion{}, false, err
+	}
+	var version PolygonVersion
+	found, err := c.withPolygonLock(id, func(transaction *sqlx.Tx) (bool, error) {
+		version, err = savePolygonRow(transaction, row, change)
+		return true, err
+	})
+	return version, found, err
+}
+
+// SavePolygons creates or replaces the polygons of several locations in one transaction, recording a version of
+// each, and returns the versions ordered by ID. If any of the locations does not exist or has been deleted,
+// nothing is written and missing lists them.
+func (c *PolygonPostgresRepository) SavePolygons(polygons map[int]model.PolyGeometry, change PolygonChange) ([]PolygonVersion, []int, error) {
+	ids := sortedPolygonIDs(polygons)
+	rows := make([]*PolygonRow, len(ids))
+	lockIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		row, err := toPolygonRow(id, polygons[id])
+		if err != nil {
+			return nil, nil, err
+		}
+		rows[i] = row
+		lockIDs[i] = int64(id)
+	}
+
+	transaction, err := c.DB.Beginx()
+	if err != nil {
+		return nil, nil, err
+	}
+	rollback := true
+
+	defer func() {
+		if rollback {
+			transaction.Rollback()
+		}
+	}()
+
+	var locked []int
+	err = transaction.Select(&locked, `SELECT id FROM store_locations WHERE id = ANY($1) AND deleted_at IS NULL
+		ORDER BY id FOR UPDATE`, pq.Array(lockIDs))
+	if err != nil {
+		return nil, nil, err
+	}
+	if missing := missingPolygonIDs(ids, locked); len(missing) > 0 {
+		return nil, missing, nil
+	}
+	versions := make([]PolygonVersion, len(rows))
+	for i, row := range rows {
+		versions[i], err = savePolygonRow(transaction, row, change)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	rollback = false
+	return versions, nil, transaction.Commit()
+}
+
+// Helper function to write a polygon to store_polygons and record it as the next version, within a transaction
+// that holds the location's lock.
+func savePolygonRow(transaction *sqlx.Tx, row *PolygonRow, change PolygonChange) (PolygonVersion, error) {
+	var existing []int
+	err := transaction.Select(&existing, `SELECT id FROM store_polygons WHERE id = $1`, row.ID)
+	if err != nil {
+		return PolygonVersion{}, err
+	}
+	action := PolygonCreated
+	if len(existing) > 0 {
+		action = PolygonReplaced
+	}
+	_, err = transaction.Exec(`INSERT INTO store_polygons (id, polygon) VALUES ($1, ST_GeomFromGeoJSON($2))
+		ON CONFLICT (id) DO UPDATE SET polygon = EXCLUDED.polygon`, row.ID, row.Polygon)
+	if err != nil {
+		return PolygonVersion{}, err
+	}
+	return recordPolygonVersion(transaction, row.ID, action, change, nil)
+}
+
+// Helper function for the IDs of a set of polygons in ascending order, the order their locations are locked in.
+func sortedPolygonIDs(polygons map[int]model.PolyGeometry) []int {
+	ids := make([]int, 0, len(polygons))
+	for id := range polygons {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Helper function for the IDs, both sorted, that were wanted but not found.
+func missingPolygonIDs(wanted, found []int) []int {
+	var missing []int
+	for _, id := range wanted {
+		if len(found) > 0 && found[0] == id {
+			found = found[1:]
+			continue
+		}
+		missing = append(missing, id)
+	}
+	return missing
+}
+
+// DeletePolygon removes a location's polygon and records the delete as a version. It returns false if the
+// location has no polygon.
+func (c *PolygonPostgresRepository) DeletePolygon(id int, change PolygonChange) (PolygonVersion, bool, error) {
+	var version PolygonVersion
+	found, err := c.withPolygonLock(id, func(transaction *sqlx.Tx) (bool, error) {
+		result, err := transaction.Exec(`DELETE FROM store_polygons WHERE id = $1`, id)
+		if err != nil {
+			return false, err
+		}
+		if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+			return false, err
+		}
+		version, err = recordPolygonVersion(transaction, id, PolygonDeleted, change, nil)
+		return true, err
+	})
+	return version, found, err
+}
+
+// RollbackPolygon restores a polygon to an earlier version, recorded as a new version. Rolling back to a version
+// that deleted the polygon deletes it again. It returns false if the version does not exist.
+func (c *PolygonPostgresRepository) RollbackPolygon(id, target int, change PolygonChange) (PolygonVersion, bool, error) {
+	var version PolygonVersion
+	found, err := c.withPolygonLock(id, func(transaction *sqlx.Tx) (bool, error) {
+		var deleted []bool
+		err := transaction.Select(&deleted, `SELECT polygon IS NULL FROM polygon_versions WHERE polygon_id = $1 AND version = $2`, id, target)
+		if err != nil || len(deleted) == 0 {
+			return false, err
+		}
+		if deleted[0] {
+			_, err = transaction.Exec(`DELETE FROM store_polygons WHERE id = $1`, id)
+		} else {
+			_, err = transaction.Exec(`INSERT INTO store_polygons (id, polygon)
+				SELECT polygon_id, polygon FROM polygon_versions WHERE polygon_id = $1 AND version = $2
+				ON CONFLICT (id) DO UPDATE SET polygon = EXCLUDED.polygon`, id, target)
+		}
+		if err != nil {
+			return false, err
+		}
+		version, err = recordPolygonVersion(transaction, id, PolygonRolledBack, change, &target)
+		return true, err
+	})
+	return version, found, err
+}
+
+// Helper function to run fn in a transaction holding a lock on the location, so a polygon's versions are numbered
+// in the order its changes are made. Nothing is written unless the location exists, is not deleted and fn
+// returns true.
+func (c *PolygonPostgresRepository) withPolygonLock(id int, fn func(transaction *sqlx.Tx) (bool, error)) (bool, error) {
+	transaction, err := c.DB.Beginx()
+	if err != nil {
+		return false, err
+	}
+	rollback := true
+
+	defer func() {
+		if rollback {
+			transaction.Rollback()
+		}
+	}()
+
+	var locations []int
+	err = transaction.Select(&locations, `SELECT id FROM store_locations WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id)
+	if err != nil || len(locations) == 0 {
+		return false, err
+	}
+	found, err := fn(transaction)
+	if err != nil || !found {
+		return false, err
+	}
+	rollback = false
+	return true, transaction.Commit()
+}
+
+// Helper function to record the polygon as it now is in store_polygons as the next version.
+func recordPolygonVersion(transaction *sqlx.Tx, id int, action string, change PolygonChange, rolledBackTo *int) (PolygonVersion, error) {
+	insertSQL := `INSERT INTO polygon_versions (polygon_id, version, action, polygon, changed_by, reason, rolled_back_to)
+		SELECT $1, COALESCE((SELECT MAX(version) FROM polygon_versions WHERE polygon_id = $1), 0) + 1, $2,
+			(SELECT polygon FROM store_polygons WHERE id = $1), $3, $4, $5
+		RETURNING ` + polygonVersionColumns
+	var version PolygonVersion
+	err := transaction.Get(&version, insertSQL, id, action, change.ChangedBy, change.Reason, rolledBackTo)
+	return version, err
+}
@@ -0,0 +1,23 @@
+package repository
+
+// StorePriority ranks a store's locations against other stores' when /poly/closest cannot tell them apart. Higher
+// priorities win, and stores without one have priority 0.
+type StorePriority struct {
+	StoreID  int64 `json:"store_id" db:"store_id"`
+	Priority int   `json:"priority" db:"priority"`
+}
+
+// ListStorePriorities returns every priority that has been set, ordered by store ID.
+func (c *PolygonPostgresRepository) ListStorePriorities() ([]StorePriority, error) {
+	priorities := []StorePriority{}
+	err := c.DB.Select(&priorities, `SELECT store_id, priority FROM store_priorities ORDER BY store_id`)
+	return priorities, err
+}
+
+// SetStorePriority sets the priority of a store.
+func (c *PolygonPostgresRepository) SetStorePriority(priority StorePriority) error {
+	_, err := c.DB.Exec(`INSERT INTO store_priorities (store_id, priority) VALUES ($1, $2)
+				ON CONFLICT (store_id) DO UPDATE SET priority = EXCLUDED.priority, updated_at = now()`,
+		priority.StoreID, priority.Priority)
+	return err
+}
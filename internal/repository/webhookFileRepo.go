@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The file a WebhookFileRepository keeps in its directory.
+const webhooksFileName = "webhooks.json"
+
+// The contents of webhooks.json. Subscription IDs are not reused after a delete, as a sequence would not reuse them.
+type webhookFile struct {
+	LastSubscriptionID int64               `json:"last_subscription_id"`
+	Subscriptions      []fileSubscription  `json:"subscriptions"`
+	DeadLetters        []WebhookDeadLetter `json:"dead_letters"`
+}
+
+// A subscription as stored in webhooks.json, with the secret WebhookSubscription leaves out of JSON.
+type fileSubscription struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookFileRepository keeps subscriptions and dead letters in webhooks.json in its directory. The file is read
+// when the repository is opened and rewritten on every write, which fails without changing anything if the file
+// cannot be saved.
+type WebhookFileRepository struct {
+	mutex              sync.RWMutex
+	path               string
+	lastSubscriptionID int64
+	subscriptions      []WebhookSubscription
+	deadLetters        []WebhookDeadLetter
+}
+
+var _ WebhookRepository = (*WebhookFileRepository)(nil)
+
+// NewWebhookFileRepository opens the webhooks kept in dir, creating the directory if it does not exist.
+func NewWebhookFileRepository(dir string) (*WebhookFileRepository, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	repo := &WebhookFileRepository{path: filepath.Join(dir, webhooksFileName)}
+	var stored webhookFile
+	_, err = readJSONFile(repo.path, &stored)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", webhooksFileName)
+	}
+	for _, subscription := range stored.Subscriptions {
+		subscription.WebhookSubscription.Secret = subscription.Secret
+		repo.subscriptions = append(repo.subscriptions, subscription.WebhookSubscription)
+	}
+	repo.lastSubscriptionID = stored.LastSubscriptionID
+	repo.deadLetters = stored.DeadLetters
+	return repo, nil
+}
+
+func (c *WebhookFileRepository) ListSubscriptions() ([]WebhookSubscription, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return append([]WebhookSubscription{}, c.subscriptions...), nil
+}
+
+// Saves the subscription, filling in its ID and creation time.
+func (c *WebhookFileRepository) CreateSubscription(subscription *WebhookSubscription) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	created := *subscription
+	created.ID = c.lastSubscriptionID + 1
+	created.CreatedAt = memoryNow().Time
+	subscriptions := append(append([]WebhookSubscription{}, c.subscriptions...), created)
+	err := c.save(created.ID, subscriptions, c.deadLetters)
+	if err != nil {
+		return err
+	}
+	c.lastSubscriptionID = created.ID
+	c.subscriptions = subscriptions
+	*subscription = created
+	return nil
+}
+
+// Deletes the subscription, reporting whether it existed.
+func (c *WebhookFileRepository) DeleteSubscription(id int64) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	subscriptions := []WebhookSubscription{}
+	for _, subscription := range c.subscriptions {
+		if subscription.ID != id {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	if len(subscriptions) == len(c.subscriptions) {
+		return false, nil
+	}
+	err := c.save(c.lastSubscriptionID, subscriptions, c.deadLetters)
+	if err != nil {
+		return false, err
+	}
+	c.subscriptions = subscriptions
+	return true, nil
+}
+
+func (c *WebhookFileRepository) InsertDeadLetter(deadLetter WebhookDeadLetter) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	deadLetter.ID = 1
+	if len(c.deadLetters) > 0 {
+		deadLetter.ID = c.deadLetters[len(c.deadLetters)-1].ID + 1
+	}
+	deadLetters := append(append([]WebhookDeadLetter{}, c.deadLetters...), deadLetter)
+	err := c.save(c.lastSubscriptionID, c.subscriptions, deadLetters)
+	if err != nil {
+		return err
+	}
+	c.deadLetters = deadLetters
+	return nil
+}
+
+// Returns the most recent dead letters, newest first.
+func (c *WebhookFileRepository) ListDeadLetters(limit int) ([]WebhookDeadLetter, error) {
+	c.mutex.RLock()
+	results := append([]WebhookDeadLetter{}, c.deadLetters...)
+	c.mutex.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].FailedAt.Equal(results[j].FailedAt) {
+			return results[i].FailedAt.After(results[j].FailedAt)
+		}
+		return results[i].ID > results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Helper function to rewrite the file with the given contents. The write lock must be held.
+func (c *WebhookFileRepository) save(lastSubscriptionID int64, subscriptions []WebhookSubscription, deadLetters []WebhookDeadLetter) error {
+	stored := webhookFile{
+		LastSubscriptionID: lastSubscriptionID,
+		Subscriptions:      make([]fileSubscription, len(subscriptions)),
+		DeadLetters:        deadLetters,
+	}
+	if stored.DeadLetters == nil {
+		stored.DeadLetters = []WebhookDeadLetter{}
+	}
+	for i, subscription := range subscriptions {
+		stored.Subscriptions[i] = fileSubscription{subscription, subscription.Secret}
+	}
+	err := writeJSONFile(c.path, stored)
+	return errors.Wrapf(err, "error saving %s", webhooksFileName)
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/geofence/internal/model"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// WebhookSubscription asks for fence events to be POSTed to URL. StoreID, MetroID and ZoneID scope
+// the subscription when non-zero, and EventTypes limits it to those types when not empty.
+type WebhookSubscription struct {
+	ID         int64          `json:"id" db:"id"`
+	URL        string         `json:"url" db:"url"`
+	Secret     string         `json:"-" db:"secret"`
+	StoreID    int64          `json:"store_id" db:"store_id"`
+	MetroID    int64          `json:"metro_id" db:"metro_id"`
+	ZoneID     int64          `json:"zone_id" db:"zone_id"`
+	EventTypes pq.StringArray `json:"event_types" db:"event_types"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+}
+
+// Matches reports whether the event falls within the subscription's scope.
+func (s WebhookSubscription) Matches(event model.FenceEvent) bool {
+	if s.StoreID != 0 && s.StoreID != event.StoreID {
+		return false
+	}
+	if s.MetroID != 0 && s.MetroID != event.MetroID {
+		return false
+	}
+	if s.ZoneID != 0 && s.ZoneID != event.ZoneID {
+		return false
+	}
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, eventType := range s.EventTypes {
+		if eventType == event.EventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeadLetter is a delivery that failed permanently or ran out of retries.
+type WebhookDeadLetter struct {
+	ID             int64     `json:"id" db:"id"`
+	SubscriptionID int64     `json:"subscription_id" db:"subscription_id"`
+	Payload        string    `json:"payload" db:"payload"`
+	Attempts       int       `json:"attempts" db:"attempts"`
+	LastError      string    `json:"last_error" db:"last_error"`
+	FailedAt       time.Time `json:"failed_at" db:"failed_at"`
+}
+
+// WebhookRepository stores webhook subscriptions and the deliveries that failed.
+type WebhookRepository interface {
+	ListSubscriptions() ([]WebhookSubscription, error)
+	CreateSubscription(subscription *WebhookSubscription) error
+	DeleteSubscription(id int64) (bool, error)
+	InsertDeadLetter(deadLetter WebhookDeadLetter) error
+	ListDeadLetters(limit int) ([]WebhookDeadLetter, error)
+}
+
+var _ WebhookRepository = (*WebhookPostgresRepository)(nil)
+
+// WebhookPostgresRepository stores subscriptions in webhook_subscriptions and failed deliveries in webhook_dead_letters.
+type WebhookPostgresRepository struct {
+	DB sqlx.DB
+}
+
+func NewWebhookRepository(db sqlx.DB) *WebhookPostgresRepository {
+	return &WebhookPostgresRepository{
+		DB: db,
+	}
+}
+
+func (c *WebhookPostgresRepository) ListSubscriptions() ([]WebhookSubscription, error) {
+	querySQL := `SELECT * FROM webhook_subscriptions ORDER BY id`
+	results := []WebhookSubscription{}
+	err := c.DB.Select(&results, querySQL)
+	if err != nil {
+		return []WebhookSubscription{}, err
+	}
+	return results, nil
+}
+
+// Inserts the subscription, filling in its generated ID and creation time.
+func (c *WebhookPostgresRepository) CreateSubscription(subscription *WebhookSubscription) error {
+	insertSQL := `INSERT INTO webhook_subscriptions (
+		url,
+		secret,
+		store_id,
+		metro_id,
+		zone_id,
+		event_types
+	)
+	VALUES (
+		:url,
+		:secret,
+		:store_id,
+		:metro_id,
+		:zone_id,
+		:event_types
+	)
+	RETURNING id, created_at
+	`
+	records, err := c.DB.NamedQuery(insertSQL, subscription)
+	if err != nil {
+		return err
+	}
+	defer records.Close()
+	if records.Next() {
+		err = records.Scan(&subscription.ID, &subscription.CreatedAt)
+	}
+	return err
+}
+
+// Deletes the subscription, reporting whether it existed.
+func (c *WebhookPostgresRepository) DeleteSubscription(id int64) (bool, error) {
+	result, err := c.DB.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func (c *WebhookPostgresRepository) InsertDeadLetter(deadLetter WebhookDeadLetter) error {
+	insertSQL := `INSERT INTO webhook_dead_letters (
+		subscription_id,
+		payload,
+		attempts,
+		last_error,
+		failed_at
+	)
+	VALUES (
+		:subscription_id,
+		:payload,
+		:attempts,
+		:last_error,
+		:failed_at
+	)
+	`
+	_, err := c.DB.NamedExec(insertSQL, deadLetter)
+	return err
+}
+
+// Returns the most recent dead letters, newest first.
+func (c *WebhookPostgresRepository) ListDeadLetters(limit int) ([]WebhookDeadLetter, error) {
+	querySQL := `SELECT * FROM webhook_dead_letters ORDER BY failed_at DESC, id DESC LIMIT $1`
+	results := []WebhookDeadLetter{}
+	err := c.DB.Select(&results, querySQL, limit)
+	if err != nil {
+		return []WebhookDeadLetter{}, err
+	}
+	return results, nil
+}
@@ -6,21 +6,62 @@ import (
 )
 
 // SetGeofencerV1Routes sets V1 routes
-func SetGeofencerV1Routes(router *mux.Router, polyController controller.PolyController, circleController controller.CircleController) {
+func SetGeofencerV1Routes(router *mux.Router, polyController controller.PolyController, circleController controller.CircleController, trackingController controller.TrackingController, webhookController controller.WebhookController, locationController controller.LocationController) {
 	polyRouter := router.PathPrefix("/poly").Subrouter()
 
 	polyRouter.Path("/").HandlerFunc(polyController.DetermineMembership()).Methods("POST")
 	polyRouter.Path("/all").HandlerFunc(polyController.Ping()).Methods("POST")
 	polyRouter.Path("/find/{id}").HandlerFunc(polyController.FindPolyLocationFromID()).Methods("GET")
 	polyRouter.Path("/find").HandlerFunc(polyController.FeatureQuery()).Methods("POST")
+	polyRouter.Path("/export").HandlerFunc(polyController.ExportFences()).Methods("POST")
 	polyRouter.Path("/echo").HandlerFunc(polyController.Echo()).Methods("POST", "OPTIONS")
 	polyRouter.Path("/closest").HandlerFunc(polyController.FindMostProbableStore()).Methods("POST")
+	polyRouter.Path("/enclosing").HandlerFunc(polyController.FindEnclosingPolygon()).Methods("POST")
 	polyRouter.Path("/intersects").HandlerFunc(polyController.DetermineGeogMembership()).Methods("POST")
 	polyRouter.Path("/intersects/{id}").HandlerFunc(polyController.DetermineGeogMembershipFromID()).Methods("POST")
+	polyRouter.Path("/contains").HandlerFunc(polyController.ContainedBy()).Methods("POST")
+	polyRouter.Path("/contains/stream").HandlerFunc(polyController.StreamContainedBy()).Methods("POST")
+	polyRouter.Path("/batch").HandlerFunc(polyController.BatchMembership()).Methods("POST")
 
 	insertRouter := router.PathPrefix("/insert").Subrouter()
 	insertRouter.Path("/poly").HandlerFunc(polyController.InsertPolygon()).Methods("POST")
 
+	polygonRouter := router.PathPrefix("/polygons").Subrouter()
+	polygonRouter.Path("/import").HandlerFunc(polyController.ImportFences()).Methods("POST")
+	polygonRouter.Path("/{id}").HandlerFunc(polyController.GetPolygon()).Methods("GET")
+	polygonRouter.Path("/{id}").HandlerFunc(polyController.ReplacePolygon()).Methods("PUT")
+	polygonRouter.Path("/{id}").HandlerFunc(polyController.DeletePolygon()).Methods("DELETE")
+	polygonRouter.Path("/{id}/versions").HandlerFunc(polyController.ListPolygonVersions()).Methods("GET")
+	polygonRouter.Path("/{id}/versions/{version}").HandlerFunc(polyController.GetPolygonVersion()).Methods("GET")
+	polygonRouter.Path("/{id}/rollback").HandlerFunc(polyController.RollbackPolygon()).Methods("POST")
+
 	circleRouter := router.PathPrefix("/circle").Subrouter()
 	circleRouter.Path("/").HandlerFunc(circleController.DetermineMembership()).Methods("POST")
+	circleRouter.Path("/batch").HandlerFunc(circleController.BatchMembership()).Methods("POST")
+
+	trackRouter := router.PathPrefix("/track").Subrouter()
+	trackRouter.Path("/ping").HandlerFunc(trackingController.Ping()).Methods("POST")
+	trackRouter.Path("/events").HandlerFunc(trackingController.QueryEvents()).Methods("GET")
+	trackRouter.Path("/live").HandlerFunc(trackingController.LiveEvents()).Methods("GET")
+
+	storeRouter := router.PathPrefix("/stores").Subrouter()
+	storeRouter.Path("/nearest").HandlerFunc(polyController.NearestStores()).Methods("POST")
+	storeRouter.Path("/eligible").HandlerFunc(polyController.EligibleStores()).Methods("POST")
+	storeRouter.Path("/priorities").HandlerFunc(polyController.ListStorePriorities()).Methods("GET")
+	storeRouter.Path("/{store_id:[0-9]+}/priority").HandlerFunc(polyController.SetStorePriority()).Methods("PUT")
+
+	webhookRouter := router.PathPrefix("/webhooks").Subrouter()
+	webhookRouter.Path("").HandlerFunc(webhookController.ListSubscriptions()).Methods("GET")
+	webhookRouter.Path("").HandlerFunc(webhookController.CreateSubscription()).Methods("POST")
+	webhookRouter.Path("/dead-letters").HandlerFunc(webhookController.ListDeadLetters()).Methods("GET")
+	webhookRouter.Path("/{id}").HandlerFunc(webhookController.DeleteSubscription()).Methods("DELETE")
+
+	locationRouter := router.PathPrefix("/locations").Subrouter()
+	locationRouter.Path("/import").HandlerFunc(locationController.Import()).Methods("POST")
+	locationRouter.Path("/{id:[0-9]+}").HandlerFunc(locationController.GetLocation()).Methods("GET")
+	locationRouter.Path("/{id:[0-9]+}").HandlerFunc(locationController.CreateLocation()).Methods("POST")
+	locationRouter.Path("/{id:[0-9]+}").HandlerFunc(locationController.ReplaceLocation()).Methods("PUT")
+	locationRouter.Path("/{id:[0-9]+}").HandlerFunc(locationController.UpdateLocation()).Methods("PATCH")
+	locationRouter.Path("/{id:[0-9]+}").HandlerFunc(locationController.DeleteLocation()).Methods("DELETE")
+	locationRouter.Path("/{id:[0-9]+}/restore").HandlerFunc(locationController.RestoreLocation()).Methods("POST")
 }
@@ -16,7 +16,7 @@ type WithCORS struct {
 func (s WithCORS) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	if origin := req.Header.Get("Origin"); origin != "" {
 		res.Header().Set("Access-Control-Allow-Origin", origin)
-		res.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		res.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		res.Header().Set("Access-Control-Allow-Headers",
 			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 	}
@@ -33,10 +33,13 @@ func (s WithCORS) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 func InitRoutes(router WithCORS,
 	polyController *controller.PolyController,
 	circleController *controller.CircleController,
+	trackingController *controller.TrackingController,
+	webhookController *controller.WebhookController,
+	locationController *controller.LocationController,
 	appConfig *configuration.Config,
 	log log.Logger,
 ) WithCORS {
-	SetGeofencerV1Routes(router.S, *polyController, *circleController)
+	SetGeofencerV1Routes(router.S, *polyController, *circleController, *trackingController, *webhookController, *locationController)
 	router.S.
 		PathPrefix("/static/").
 		Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("."+"/static/"))))
@@ -0,0 +1,227 @@
+package scoring
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+// The strategies that choose between candidates a point is equally likely to belong to.
+const (
+	Nearest    = "nearest"
+	Priority   = "priority"
+	RoundRobin = "round_robin"
+	Hash       = "hash"
+)
+
+// How a Decision was reached: the only candidate, the only candidate whose fence contains the point, the one
+// candidate clearly scoring best when no fence contains it, or the tie-break strategy.
+const (
+	OnlyCandidate = "only_candidate"
+	OnlyInside    = "only_inside"
+	BestScore     = "best_score"
+	TieBreak      = "tie_break"
+)
+
+// How far below the best score a candidate may be and still contend in a tie-break when no fence contains the
+// point: a thirtieth of the search radius further away, or a tenth of the range of store priorities.
+const tieScoreMargin = 0.01
+
+// The weight of each part of a score. Scores are between 0 and 1.
+const (
+	insideWeight      = 0.5
+	proximityWeight   = 0.3
+	exclusivityWeight = 0.1
+	priorityWeight    = 0.1
+)
+
+// Candidate is a location a point might belong to, with what is known of it relative to the point. Overlaps is
+// how many fences contain the point when the location's does, and 0 otherwise.
+type Candidate struct {
+	Location repository.LocationRowNull
+	Meters   float64
+	Inside   bool
+	Overlaps int
+	Priority int
+	Score    Score
+}
+
+// Score explains how likely a point is to belong to a candidate. Total is the sum of the other parts:
+//
+//	Inside       0.5 if the candidate's fence contains the point
+//	Proximity    up to 0.3, falling linearly from the point to the edge of the search
+//	Exclusivity  up to 0.1, divided between every fence containing the point
+//	Priority     up to 0.1, the candidate's store priority relative to the others'
+type Score struct {
+	Total       float64 `json:"total"`
+	Inside      float64 `json:"inside"`
+	Proximity   float64 `json:"proximity"`
+	Exclusivity float64 `json:"exclusivity"`
+	Priority    float64 `json:"priority"`
+}
+
+// Decision is the candidate chosen for a point, Candidates[Chosen], with every candidate ranked by score. Basis says
+// how it was chosen, and Contenders how many candidates the strategy chose between when it was a tie-break.
+type Decision struct {
+	Candidates []Candidate
+	Chosen     int
+	Basis      string
+	Strategy   string
+	Contenders int
+}
+
+// ParseStrategy checks that a strategy is known, returning it, or Nearest if it is empty.
+func ParseStrategy(strategy string) (string, error) {
+	switch strategy {
+	case "":
+		return Nearest, nil
+	case Nearest, Priority, RoundRobin, Hash:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown tie-break strategy %q, expected %s, %s, %s or %s", strategy, Nearest, Priority, RoundRobin, Hash)
+}
+
+// Scorer ranks candidates and breaks ties with its Strategy unless a decision asks for another. Round robin turns
+// are counted per Scorer, so they rotate per instance of the service.
+type Scorer struct {
+	Strategy string
+	turn     uint64
+}
+
+func NewScorer(strategy string) (*Scorer, error) {
+	strategy, err := ParseStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	return &Scorer{Strategy: strategy}, nil
+}
+
+// Decide scores the candidates for a point searched for within maxMeters and chooses one. If only one candidate's
+// fence contains the point it is chosen; otherwise the strategy chooses between those whose fence contains the
+// point. If none does, the strategy only chooses between the candidates scoring within tieScoreMargin of the best,
+// and the best is chosen outright if no other is that close. An empty strategy is the Scorer's. There must be a
+// candidate.
+func (s *Scorer) Decide(point model.Coordinate, candidates []Candidate, maxMeters float64, strategy string) Decision {
+	if strategy == "" {
+		strategy = s.Strategy
+	}
+	ranked := score(candidates, maxMeters)
+	decision := Decision{Candidates: ranked, Strategy: strategy, Basis: OnlyCandidate}
+	if len(ranked) == 1 {
+		return decision
+	}
+
+	var contenders []int
+	for c, candidate := range ranked {
+		if candidate.Inside {
+			contenders = append(contenders, c)
+		}
+	}
+	if len(contenders) == 1 {
+		decision.Chosen, decision.Basis = contenders[0], OnlyInside
+		return decision
+	}
+	if len(contenders) == 0 {
+		for c, candidate := range ranked {
+			if ranked[0].Score.Total-candidate.Score.Total <= tieScoreMargin {
+				contenders = append(contenders, c)
+			}
+		}
+		if len(contenders) == 1 {
+			decision.Chosen, decision.Basis = contenders[0], BestScore
+			return decision
+		}
+	}
+	decision.Basis, decision.Contenders = TieBreak, len(contenders)
+	decision.Chosen = s.breakTie(point, ranked, contenders, strategy)
+	return decision
+}
+
+// Helper function to choose between the contenders, indexes of candidates ranked by score, with a strategy.
+func (s *Scorer) breakTie(point model.Coordinate, ranked []Candidate, contenders []int, strategy string) int {
+	better := func(a, b Candidate) bool {
+		if a.Meters != b.Meters {
+			return a.Meters < b.Meters
+		}
+		return a.Location.ID < b.Location.ID
+	}
+	if strategy == Priority {
+		better = func(a, b Candidate) bool {
+			if a.Priority != b.Priority {
+				return a.Priority > b.Priority
+			}
+			if a.Meters != b.Meters {
+				return a.Meters < b.Meters
+			}
+			return a.Location.ID < b.Location.ID
+		}
+	}
+	if strategy == RoundRobin || strategy == Hash {
+		byID := append([]int{}, contenders...)
+		sort.Slice(byID, func(i, j int) bool {
+			return ranked[byID[i]].Location.ID < ranked[byID[j]].Location.ID
+		})
+		if strategy == RoundRobin {
+			return byID[(atomic.AddUint64(&s.turn, 1)-1)%uint64(len(byID))]
+		}
+		hash := fnv.New64a()
+		hash.Write([]byte(strconv.FormatFloat(point.Lon(), 'f', 6, 64) + "," + strconv.FormatFloat(point.Lat(), 'f', 6, 64)))
+		return byID[hash.Sum64()%uint64(len(byID))]
+	}
+
+	chosen := contenders[0]
+	for _, c := range contenders[1:] {
+		if better(ranked[c], ranked[chosen]) {
+			chosen = c
+		}
+	}
+	return chosen
+}
+
+// Helper function to score candidates, returning them ordered by total score, then distance, then ID.
+func score(candidates []Candidate, maxMeters float64) []Candidate {
+	lowest, highest := math.MaxInt64, math.MinInt64
+	for _, candidate := range candidates {
+		if candidate.Priority < lowest {
+			lowest = candidate.Priority
+		}
+		if candidate.Priority > highest {
+			highest = candidate.Priority
+		}
+	}
+
+	ranked := make([]Candidate, len(candidates))
+	for c, candidate := range candidates {
+		parts := Score{}
+		if candidate.Inside {
+			parts.Inside = insideWeight
+			parts.Exclusivity = exclusivityWeight / math.Max(float64(candidate.Overlaps), 1)
+		}
+		if maxMeters > 0 {
+			parts.Proximity = proximityWeight * math.Max(0, 1-candidate.Meters/maxMeters)
+		}
+		if highest > lowest {
+			parts.Priority = priorityWeight * float64(candidate.Priority-lowest) / float64(highest-lowest)
+		}
+		parts.Total = parts.Inside + parts.Proximity + parts.Exclusivity + parts.Priority
+		candidate.Score = parts
+		ranked[c] = candidate
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Score.Total != b.Score.Total {
+			return a.Score.Total > b.Score.Total
+		}
+		if a.Meters != b.Meters {
+			return a.Meters < b.Meters
+		}
+		return a.Location.ID < b.Location.ID
+	})
+	return ranked
+}
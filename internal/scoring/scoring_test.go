@@ -0,0 +1,107 @@
+package scoring
+
+import (
+	"math"
+	"testing"
+
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+)
+
+func candidate(id int, meters float64, inside bool, priority int) Candidate {
+	overlaps := 0
+	if inside {
+		overlaps = 2
+	}
+	return Candidate{Location: repository.LocationRowNull{ID: id}, Meters: meters, Inside: inside, Overlaps: overlaps, Priority: priority}
+}
+
+func TestDecide(t *testing.T) {
+	point := model.NewCoordinate(-122.42, 37.76)
+	// Locations 1 and 2 both contain the point; 3 is nearest but does not.
+	tied := []Candidate{candidate(1, 500, true, 0), candidate(2, 300, true, 5), candidate(3, 100, false, 9)}
+
+	tests := []struct {
+		strategy string
+		want     int
+	}{
+		{Nearest, 2},
+		{Priority, 2},
+	}
+	for _, test := range tests {
+		scorer, _ := NewScorer(test.strategy)
+		decision := scorer.Decide(point, tied, 1000, "")
+		chosen := decision.Candidates[decision.Chosen]
+		if chosen.Location.ID != test.want || decision.Basis != TieBreak || decision.Contenders != 2 {
+			t.Errorf("%s chose %d by %s of %d, want 2 by tie-break of 2", test.strategy, chosen.Location.ID, decision.Basis, decision.Contenders)
+		}
+	}
+
+	scorer, _ := NewScorer(RoundRobin)
+	var turns []int
+	for i := 0; i < 3; i++ {
+		decision := scorer.Decide(point, tied, 1000, "")
+		turns = append(turns, decision.Candidates[decision.Chosen].Location.ID)
+	}
+	if turns[0] != 1 || turns[1] != 2 || turns[2] != 1 {
+		t.Errorf("round robin chose %v, want [1 2 1]", turns)
+	}
+
+	first := scorer.Decide(point, tied, 1000, Hash)
+	second := scorer.Decide(point, tied, 1000, Hash)
+	if first.Candidates[first.Chosen].Location.ID != second.Candidates[second.Chosen].Location.ID || !first.Candidates[first.Chosen].Inside {
+		t.Errorf("hash is not deterministic or chose a candidate outside its fence")
+	}
+
+	only := scorer.Decide(point, []Candidate{candidate(1, 500, true, 0), candidate(3, 100, false, 0)}, 1000, "")
+	if only.Basis != OnlyInside || only.Candidates[only.Chosen].Location.ID != 1 || only.Candidates[0].Location.ID != 1 {
+		t.Errorf("decision with one fence containing the point = %+v", only)
+	}
+	outside := scorer.Decide(point, []Candidate{candidate(4, 700, false, 0), candidate(5, 200, false, 0)}, 1000, Nearest)
+	if outside.Basis != BestScore || outside.Candidates[outside.Chosen].Location.ID != 5 {
+		t.Errorf("decision with no fence containing the point = %+v", outside)
+	}
+}
+
+func TestDecideOutsideEveryFence(t *testing.T) {
+	point := model.NewCoordinate(-122.42, 37.76)
+	// No fence contains the point. Location 6 is far nearer than 7 and 8, which only round robin or a hash could
+	// otherwise land on; 9 is within a few meters of 6 and so as likely a match.
+	far := []Candidate{candidate(6, 100, false, 0), candidate(7, 900, false, 0), candidate(8, 950, false, 0)}
+	near := append([]Candidate{candidate(9, 110, false, 0)}, far...)
+
+	for _, strategy := range []string{Nearest, Priority, RoundRobin, Hash} {
+		scorer, _ := NewScorer(strategy)
+		for turn := 0; turn < 3; turn++ {
+			decision := scorer.Decide(point, far, 1000, "")
+			if chosen := decision.Candidates[decision.Chosen]; chosen.Location.ID != 6 || decision.Basis != BestScore || decision.Contenders != 0 {
+				t.Errorf("%s chose %d by %s of %d, want 6 by best score", strategy, chosen.Location.ID, decision.Basis, decision.Contenders)
+			}
+		}
+
+		chosen := map[int]bool{}
+		for turn := 0; turn < 2; turn++ {
+			decision := scorer.Decide(point, near, 1000, "")
+			chosen[decision.Candidates[decision.Chosen].Location.ID] = true
+			if decision.Basis != TieBreak || decision.Contenders != 2 {
+				t.Errorf("%s decided by %s of %d, want a tie-break of 2", strategy, decision.Basis, decision.Contenders)
+			}
+		}
+		if chosen[7] || chosen[8] || (strategy == RoundRobin && len(chosen) != 2) {
+			t.Errorf("%s chose %v, want only 6 or 9", strategy, chosen)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	ranked := score([]Candidate{candidate(1, 250, true, 1), candidate(2, 1000, false, 3)}, 1000)
+	if got := ranked[0].Score; ranked[0].Location.ID != 1 || math.Abs(got.Total-0.775) > 1e-9 || math.Abs(got.Proximity-0.225) > 1e-9 || got.Exclusivity != 0.05 {
+		t.Errorf("score of 1 = %+v, want 0.775 with 0.225 proximity and 0.05 exclusivity", got)
+	}
+	if got := ranked[1].Score; got.Priority != 0.1 || got.Total != 0.1 {
+		t.Errorf("score of 2 = %+v, want only the priority part", got)
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Errorf("ParseStrategy accepted an unknown strategy")
+	}
+}
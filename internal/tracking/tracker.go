@@ -0,0 +1,194 @@
+package tracking
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/geofence/internal/events"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/model"
+	"github.com/pkg/errors"
+)
+
+// ErrStalePing is returned for a ping older than the last one accepted for the same device.
+var ErrStalePing = errors.New("ping is older than the device's last known location")
+
+// EventStore persists the events emitted by a Tracker.
+type EventStore interface {
+	InsertEvents(events []model.FenceEvent) error
+}
+
+// Ping is a single location report from a device.
+type Ping struct {
+	DeviceID  string
+	Point     model.Coordinate
+	Timestamp time.Time
+}
+
+// The state of a device inside one fence. The fence's store, metro and zone, as of the last ping inside it, are kept
+// so that its EXIT event carries them even once the fence has left the index.
+type membership struct {
+	enteredAt time.Time
+	dwelled   bool
+	storeID   int64
+	metroID   int64
+	zoneID    int64
+}
+
+// What is known of a device. pinging is held for the whole of a ping, including storing its events, so pings for
+// one device are applied in turn; the other fields are guarded by the Tracker's mutex. pings counts the pings
+// waiting for or holding pinging, and Expire leaves a device alone while it is not zero.
+type deviceState struct {
+	pinging  sync.Mutex
+	pings    int
+	lastSeen time.Time
+	inside   map[int]membership
+}
+
+// Tracker remembers the fences each device was last seen in and turns location pings into
+// ENTER, EXIT and DWELL events. DWELL is emitted once per visit, on the first ping at least
+// Dwell after the device entered. State is held in memory; devices not seen for longer than
+// the expiry passed to Expire are forgotten.
+type Tracker struct {
+	fences  *index.FenceIndex
+	store   EventStore
+	bus     *events.Bus
+	dwell   time.Duration
+	mutex   sync.Mutex
+	devices map[string]*deviceState
+}
+
+func NewTracker(fences *index.FenceIndex, store EventStore, bus *events.Bus, dwell time.Duration) *Tracker {
+	return &Tracker{
+		fences:  fences,
+		store:   store,
+		bus:     bus,
+		dwell:   dwell,
+		devices: map[string]*deviceState{},
+	}
+}
+
+// Ping updates the device's membership and returns, after storing and publishing them, the events it caused.
+// The membership only changes once the events are stored, so a ping whose events cannot be stored can be sent
+// again and cause the same events.
+func (t *Tracker) Ping(ping Ping) ([]model.FenceEvent, error) {
+	current := map[int]index.Fence{}
+	for _, fence := range t.fences.Containing(ping.Point, index.Filter{}) {
+		current[fence.Location.ID] = fence
+	}
+
+	t.mutex.Lock()
+	state, ok := t.devices[ping.DeviceID]
+	if !ok {
+		state = &deviceState{inside: map[int]membership{}}
+		t.devices[ping.DeviceID] = state
+	}
+	state.pings++
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		state.pings--
+		t.mutex.Unlock()
+	}()
+	state.pinging.Lock()
+	defer state.pinging.Unlock()
+
+	t.mutex.Lock()
+	if ping.Timestamp.Before(state.lastSeen) {
+		t.mutex.Unlock()
+		return nil, ErrStalePing
+	}
+	inside, events := t.transition(ping, state.inside, current)
+	t.mutex.Unlock()
+
+	err := t.store.InsertEvents(events)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed storing fence events")
+	}
+
+	t.mutex.Lock()
+	state.lastSeen = ping.Timestamp
+	state.inside = inside
+	t.mutex.Unlock()
+	t.bus.Publish(events...)
+	return events, nil
+}
+
+// Helper function to compare a device's previous membership with the fences it is in now, returning its new
+// membership and the events the change causes. The previous membership is left as it is.
+func (t *Tracker) transition(ping Ping, previous map[int]membership, current map[int]index.Fence) (map[int]membership, []model.FenceEvent) {
+	inside := make(map[int]membership, len(current))
+	events := []model.FenceEvent{}
+	for id, fence := range current {
+		visit, ok := previous[id]
+		visit.storeID = fence.Location.StoreID
+		visit.metroID = fence.Location.MetroID
+		visit.zoneID = fence.Location.ZoneID
+		switch {
+		case !ok:
+			visit.enteredAt = ping.Timestamp
+			events = append(events, newEvent(model.EnterEvent, ping, id, visit))
+		case !visit.dwelled && t.dwell > 0 && ping.Timestamp.Sub(visit.enteredAt) >= t.dwell:
+			visit.dwelled = true
+			events = append(events, newEvent(model.DwellEvent, ping, id, visit))
+		}
+		inside[id] = visit
+	}
+	for id, visit := range previous {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		events = append(events, newEvent(model.ExitEvent, ping, id, visit))
+	}
+
+	sort.Slice(events, func(a, b int) bool {
+		return events[a].LocationID < events[b].LocationID
+	})
+	return inside, events
+}
+
+func newEvent(eventType string, ping Ping, locationID int, visit membership) model.FenceEvent {
+	return model.FenceEvent{
+		DeviceID:   ping.DeviceID,
+		EventType:  eventType,
+		LocationID: locationID,
+		StoreID:    visit.storeID,
+		MetroID:    visit.metroID,
+		ZoneID:     visit.zoneID,
+		Longitude:  ping.Point.Lon(),
+		Latitude:   ping.Point.Lat(),
+		OccurredAt: ping.Timestamp,
+	}
+}
+
+// Membership returns the IDs of the fences a device was last seen in.
+func (t *Tracker) Membership(deviceID string) ([]int, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	state, ok := t.devices[deviceID]
+	if !ok || state.lastSeen.IsZero() {
+		return nil, false
+	}
+	ids := make([]int, 0, len(state.inside))
+	for id := range state.inside {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, true
+}
+
+// Expire forgets every device last seen before the given time, including devices none of whose pings have been
+// stored. A device with a ping in progress is kept, so that ping and the next see the same membership.
+func (t *Tracker) Expire(before time.Time) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	expired := 0
+	for id, state := range t.devices {
+		if state.pings == 0 && state.lastSeen.Before(before) {
+			delete(t.devices, id)
+			expired++
+		}
+	}
+	return expired
+}
@@ -0,0 +1,226 @@
+package tracking
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/geofence/internal/events"
+	"github.com/geofence/internal/index"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/pkg/errors"
+)
+
+type fenceSource []repository.PolyLocationResponseCleaned
+
+func (s fenceSource) GetAllFences() ([]repository.PolyLocationResponseCleaned, error) {
+	return s, nil
+}
+
+func (s fenceSource) GetPolyLocationFromID(id int) ([]repository.PolyLocationResponseCleaned, error) {
+	return nil, nil
+}
+
+type eventStore struct {
+	events []model.FenceEvent
+	err    error
+}
+
+func (s *eventStore) InsertEvents(events []model.FenceEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// Stores events only once release is closed, sending on storing each time it starts.
+type blockingStore struct {
+	storing chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) InsertEvents(events []model.FenceEvent) error {
+	s.storing <- struct{}{}
+	<-s.release
+	return nil
+}
+
+// Fence 1 spans longitudes 0 to 2 and fence 2 longitudes 1 to 3, both between latitudes 0 and 1.
+func newTestTracker(t *testing.T, store EventStore, dwell time.Duration) *Tracker {
+	square := `{"type": "Polygon", "coordinates": [[[%d, 0], [%d, 0], [%d, 1], [%d, 1], [%d, 0]]]}`
+	fences := index.NewFenceIndex(fenceSource{
+		{ID: 1, StoreID: 7, MetroID: 3, ZoneID: 4, Polygon: fmt.Sprintf(square, 0, 2, 2, 0, 0)},
+		{ID: 2, StoreID: 8, Polygon: fmt.Sprintf(square, 1, 3, 3, 1, 1)},
+	}, *log.New(ioutil.Discard, "", 0))
+	if err := fences.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return NewTracker(fences, store, events.NewBus(), dwell)
+}
+
+// Formats events as TYPE:location, in order.
+func describe(events []model.FenceEvent) string {
+	var described []string
+	for _, event := range events {
+		described = append(described, fmt.Sprintf("%s:%d", event.EventType, event.LocationID))
+	}
+	return fmt.Sprint(described)
+}
+
+func TestPing(t *testing.T) {
+	store := &eventStore{}
+	tracker := newTestTracker(t, store, 10*time.Minute)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		lon    float64
+		after  time.Duration
+		events string
+		inside string
+	}{
+		{0.5, 0, "[ENTER:1]", "[1]"},
+		{1.5, time.Minute, "[ENTER:2]", "[1 2]"},
+		{1.5, 5 * time.Minute, "[]", "[1 2]"},
+		{1.6, 10 * time.Minute, "[DWELL:1]", "[1 2]"},
+		{1.6, 12 * time.Minute, "[DWELL:2]", "[1 2]"},
+		{1.6, 30 * time.Minute, "[]", "[1 2]"},
+		{2.5, 31 * time.Minute, "[EXIT:1]", "[2]"},
+		{5, 32 * time.Minute, "[EXIT:2]", "[]"},
+		{0.5, 33 * time.Minute, "[ENTER:1]", "[1]"},
+	}
+	for _, step := range steps {
+		ping := Ping{DeviceID: "van-1", Point: model.NewCoordinate(step.lon, 0.5), Timestamp: start.Add(step.after)}
+		events, err := tracker.Ping(ping)
+		if err != nil {
+			t.Fatalf("ping at %v after %v: %v", step.lon, step.after, err)
+		}
+		if describe(events) != step.events {
+			t.Errorf("ping at %v after %v = %s, want %s", step.lon, step.after, describe(events), step.events)
+		}
+		if inside, _ := tracker.Membership("van-1"); fmt.Sprint(inside) != step.inside {
+			t.Errorf("membership after ping at %v = %v, want %s", step.lon, inside, step.inside)
+		}
+	}
+	if len(store.events) != 7 || store.events[0].StoreID != 7 || store.events[0].DeviceID != "van-1" {
+		t.Errorf("stored events = %+v", store.events)
+	}
+
+	_, err := tracker.Ping(Ping{DeviceID: "van-1", Point: model.NewCoordinate(2.5, 0.5), Timestamp: start})
+	if err != ErrStalePing {
+		t.Errorf("ping older than the last = %v, want ErrStalePing", err)
+	}
+	if inside, _ := tracker.Membership("van-1"); fmt.Sprint(inside) != "[1]" {
+		t.Errorf("stale ping changed membership to %v", inside)
+	}
+}
+
+func TestPingStoreFailure(t *testing.T) {
+	store := &eventStore{}
+	tracker := newTestTracker(t, store, 0)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	ping := func(lon float64, after time.Duration) ([]model.FenceEvent, error) {
+		return tracker.Ping(Ping{DeviceID: "van-1", Point: model.NewCoordinate(lon, 0.5), Timestamp: start.Add(after)})
+	}
+
+	store.err = errors.New("connection refused")
+	if _, err := ping(0.5, 0); err == nil {
+		t.Fatal("ping succeeded although its events could not be stored")
+	}
+	if _, ok := tracker.Membership("van-1"); ok {
+		t.Errorf("device is known although none of its pings were stored")
+	}
+
+	store.err = nil
+	if events, err := ping(0.5, time.Minute); err != nil || describe(events) != "[ENTER:1]" {
+		t.Fatalf("retried ping = %s, %v, want [ENTER:1]", describe(events), err)
+	}
+	store.err = errors.New("connection refused")
+	if _, err := ping(5, 2*time.Minute); err == nil {
+		t.Fatal("ping succeeded although its events could not be stored")
+	}
+	if inside, _ := tracker.Membership("van-1"); fmt.Sprint(inside) != "[1]" {
+		t.Errorf("failed ping changed membership to %v", inside)
+	}
+
+	store.err = nil
+	if events, err := ping(5, 2*time.Minute); err != nil || describe(events) != "[EXIT:1]" {
+		t.Errorf("retried ping = %s, %v, want [EXIT:1]", describe(events), err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	tracker := newTestTracker(t, &eventStore{}, 0)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	tracker.Ping(Ping{DeviceID: "van-1", Point: model.NewCoordinate(0.5, 0.5), Timestamp: start})
+	tracker.Ping(Ping{DeviceID: "van-2", Point: model.NewCoordinate(0.5, 0.5), Timestamp: start.Add(time.Hour)})
+
+	if expired := tracker.Expire(start.Add(30 * time.Minute)); expired != 1 {
+		t.Errorf("Expire = %d, want 1", expired)
+	}
+	if _, ok := tracker.Membership("van-1"); ok {
+		t.Errorf("expired device is still known")
+	}
+	if _, ok := tracker.Membership("van-2"); !ok {
+		t.Errorf("device seen after the expiry was forgotten")
+	}
+
+	// A forgotten device enters its fences again.
+	events, err := tracker.Ping(Ping{DeviceID: "van-1", Point: model.NewCoordinate(0.5, 0.5), Timestamp: start.Add(2 * time.Hour)})
+	if err != nil || describe(events) != "[ENTER:1]" {
+		t.Errorf("ping after expiry = %s, %v, want [ENTER:1]", describe(events), err)
+	}
+}
+
+func TestExitFromRemovedFence(t *testing.T) {
+	store := &eventStore{}
+	tracker := newTestTracker(t, store, 0)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	if _, err := tracker.Ping(Ping{DeviceID: "van-1", Point: model.NewCoordinate(0.5, 0.5), Timestamp: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker.fences.Remove(1)
+	events, err := tracker.Ping(Ping{DeviceID: "van-1", Point: model.NewCoordinate(0.5, 0.5), Timestamp: start.Add(time.Minute)})
+	if err != nil || describe(events) != "[EXIT:1]" {
+		t.Fatalf("ping after the fence was removed = %s, %v, want [EXIT:1]", describe(events), err)
+	}
+	if exit := events[0]; exit.StoreID != 7 || exit.MetroID != 3 || exit.ZoneID != 4 {
+		t.Errorf("EXIT from a removed fence has store %d, metro %d and zone %d, want 7, 3 and 4", exit.StoreID, exit.MetroID, exit.ZoneID)
+	}
+}
+
+func TestExpireDuringPing(t *testing.T) {
+	store := &blockingStore{storing: make(chan struct{}, 2), release: make(chan struct{})}
+	tracker := newTestTracker(t, store, 0)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	ping := func(after time.Duration) ([]model.FenceEvent, error) {
+		return tracker.Ping(Ping{DeviceID: "van-1", Point: model.NewCoordinate(0.5, 0.5), Timestamp: start.Add(after)})
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := ping(0)
+		done <- err
+	}()
+	<-store.storing
+	if expired := tracker.Expire(start.Add(time.Hour)); expired != 0 {
+		t.Errorf("Expire = %d while the device's first ping was being stored, want 0", expired)
+	}
+	close(store.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// The device is still known, so the same fence is not entered twice.
+	events, err := ping(time.Minute)
+	if err != nil || describe(events) != "[]" {
+		t.Errorf("second ping = %s, %v, want no events", describe(events), err)
+	}
+	if expired := tracker.Expire(start.Add(time.Hour)); expired != 1 {
+		t.Errorf("Expire = %d once the pings finished, want 1", expired)
+	}
+}
@@ -0,0 +1,330 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/pkg/errors"
+)
+
+const (
+	SignatureHeader = "X-Geofence-Signature"
+	TimestampHeader = "X-Geofence-Timestamp"
+)
+
+// Store provides subscriptions and records failed deliveries.
+type Store interface {
+	ListSubscriptions() ([]repository.WebhookSubscription, error)
+	InsertDeadLetter(deadLetter repository.WebhookDeadLetter) error
+}
+
+// Options controls delivery. Attempt n (from 1) waits InitialBackoff * 2^(n-2), capped at MaxBackoff, before being sent.
+type Options struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	QueueSize      int
+	Workers        int
+}
+
+// Payload is the JSON body POSTed to a subscriber.
+type Payload struct {
+	SubscriptionID int64            `json:"subscription_id"`
+	Event          model.FenceEvent `json:"event"`
+}
+
+// A delivery of one payload, with the attempts made so far and the error of the last.
+type delivery struct {
+	subscription repository.WebhookSubscription
+	body         []byte
+	attempts     int
+	err          error
+}
+
+// Dispatcher delivers events to matching subscriptions from background workers, retrying failures
+// with exponential backoff and recording deliveries that never succeed as dead letters. A delivery waiting
+// to be retried holds a timer rather than a worker, and dead letters are written to the store by a goroutine
+// of their own, so nothing that hands one over waits on the store.
+type Dispatcher struct {
+	store   Store
+	client  *http.Client
+	options Options
+	logger  log.Logger
+
+	mutex         sync.RWMutex
+	subscriptions []repository.WebhookSubscription
+	stopped       bool
+	retries       map[*time.Timer]delivery
+
+	queue       chan delivery
+	deadLetters chan repository.WebhookDeadLetter
+	dropped     uint64
+	stop        chan struct{}
+	wg          sync.WaitGroup
+	recorder    sync.WaitGroup
+}
+
+func NewDispatcher(store Store, client *http.Client, options Options, logger log.Logger) *Dispatcher {
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 1
+	}
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	return &Dispatcher{
+		store:       store,
+		client:      client,
+		options:     options,
+		logger:      logger,
+		queue:       make(chan delivery, options.QueueSize),
+		deadLetters: make(chan repository.WebhookDeadLetter, options.QueueSize),
+		retries:     map[*time.Timer]delivery{},
+		stop:        make(chan struct{}),
+	}
+}
+
+// Sign returns the signature sent in SignatureHeader: the hex HMAC-SHA256 of "timestamp.body" keyed by the secret.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign in constant time.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Reload refreshes the cached subscriptions from the store.
+func (d *Dispatcher) Reload() error {
+	subscriptions, err := d.store.ListSubscriptions()
+	if err != nil {
+		return errors.Wrap(err, "failed loading webhook subscriptions")
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.subscriptions = subscriptions
+	return nil
+}
+
+// Start loads the subscriptions and starts the delivery workers.
+func (d *Dispatcher) Start() error {
+	err := d.Reload()
+	if err != nil {
+		return err
+	}
+	d.recorder.Add(1)
+	go d.record()
+	d.wg.Add(d.options.Workers)
+	for i := 0; i < d.options.Workers; i++ {
+		go d.work()
+	}
+	return nil
+}
+
+// Stop lets the workers finish the deliveries they are making, records every delivery still queued or waiting
+// to be retried as a dead letter, and waits for every dead letter to be written.
+func (d *Dispatcher) Stop() {
+	var abandoned []repository.WebhookDeadLetter
+	d.mutex.Lock()
+	d.stopped = true
+	for timer, next := range d.retries {
+		timer.Stop()
+		abandoned = append(abandoned, newDeadLetter(next, next.attempts, errors.Wrap(next.err, "dispatcher stopped")))
+	}
+	d.retries = map[*time.Timer]delivery{}
+	d.mutex.Unlock()
+	close(d.stop)
+	d.wg.Wait()
+
+	// Nothing is queued once stopped is set, so the queue only holds what the workers left.
+	for len(d.queue) > 0 {
+		next := <-d.queue
+		abandoned = append(abandoned, newDeadLetter(next, next.attempts, errors.New("dispatcher stopped")))
+	}
+	close(d.deadLetters)
+	d.recorder.Wait()
+	for _, deadLetter := range abandoned {
+		if err := d.store.InsertDeadLetter(deadLetter); err != nil {
+			d.logger.Println("Failed to record webhook dead letter", err)
+		}
+	}
+}
+
+// Dropped returns the number of dead letters that were not recorded because the store could not keep up.
+func (d *Dispatcher) Dropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+// Publish queues a delivery of each event to every matching subscription without blocking.
+// Deliveries that do not fit in the queue are recorded as dead letters.
+func (d *Dispatcher) Publish(events ...model.FenceEvent) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.stopped {
+		return
+	}
+	subscriptions := d.subscriptions
+
+	for _, event := range events {
+		for _, subscription := range subscriptions {
+			if !subscription.Matches(event) {
+				continue
+			}
+			body, err := json.Marshal(Payload{SubscriptionID: subscription.ID, Event: event})
+			if err != nil {
+				d.logger.Println("Failed to marshal webhook payload", err)
+				continue
+			}
+			next := delivery{subscription: subscription, body: body}
+			select {
+			case d.queue <- next:
+			default:
+				d.deadLetter(next, 0, errors.New("delivery queue full"))
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		// Once stopping, leave what is queued to Stop rather than starting another delivery.
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+		select {
+		case <-d.stop:
+			return
+		case next := <-d.queue:
+			d.deliver(next)
+		}
+	}
+}
+
+// Helper function to make the next attempt at a delivery, scheduling a retry if it fails and attempts remain.
+func (d *Dispatcher) deliver(next delivery) {
+	next.attempts++
+	retry, err := d.send(next)
+	if err == nil {
+		return
+	}
+	if !retry || next.attempts >= d.options.MaxAttempts {
+		d.deadLetter(next, next.attempts, err)
+		return
+	}
+	next.err = err
+	d.scheduleRetry(next)
+}
+
+// Helper function to queue a delivery again once its backoff has passed. A retry that finds the queue full is
+// recorded as a dead letter, as a new delivery would be.
+func (d *Dispatcher) scheduleRetry(next delivery) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.stopped {
+		d.deadLetter(next, next.attempts, errors.Wrap(next.err, "dispatcher stopped"))
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d.backoff(next.attempts+1), func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		// Stop has already recorded the retry if it is no longer pending.
+		if _, ok := d.retries[timer]; !ok {
+			return
+		}
+		delete(d.retries, timer)
+		select {
+		case d.queue <- next:
+		default:
+			d.deadLetter(next, next.attempts, errors.Wrap(next.err, "delivery queue full"))
+		}
+	})
+	d.retries[timer] = next
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.options.InitialBackoff << uint(attempt-2)
+	if wait <= 0 || (d.options.MaxBackoff > 0 && wait > d.options.MaxBackoff) {
+		wait = d.options.MaxBackoff
+	}
+	return wait
+}
+
+// Helper function to POST a signed delivery once. Network errors, 408, 429 and 5xx responses are retried.
+func (d *Dispatcher) send(next delivery) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, next.subscription.URL, bytes.NewReader(next.body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(next.subscription.Secret, timestamp, next.body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("subscriber responded %s", response.Status)
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusRequestTimeout ||
+		response.StatusCode == http.StatusTooManyRequests
+	return retry, err
+}
+
+// Helper function to hand a failed delivery to the recorder without blocking. When the recorder is too far
+// behind the dead letter is dropped and counted.
+func (d *Dispatcher) deadLetter(next delivery, attempts int, cause error) {
+	deadLetter := newDeadLetter(next, attempts, cause)
+	select {
+	case d.deadLetters <- deadLetter:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		d.logger.Println("Dropped webhook dead letter for subscription", deadLetter.SubscriptionID, cause)
+	}
+}
+
+func newDeadLetter(next delivery, attempts int, cause error) repository.WebhookDeadLetter {
+	return repository.WebhookDeadLetter{
+		SubscriptionID: next.subscription.ID,
+		Payload:        string(next.body),
+		Attempts:       attempts,
+		LastError:      cause.Error(),
+		FailedAt:       time.Now().UTC(),
+	}
+}
+
+// Helper function to write dead letters to the store until Stop closes the channel.
+func (d *Dispatcher) record() {
+	defer d.recorder.Done()
+	for deadLetter := range d.deadLetters {
+		if err := d.store.InsertDeadLetter(deadLetter); err != nil {
+			d.logger.Println("Failed to record webhook dead letter", err)
+		}
+	}
+}
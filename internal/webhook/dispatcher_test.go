@@ -0,0 +1,321 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geofence/internal/json"
+	"github.com/geofence/internal/model"
+	"github.com/geofence/internal/repository"
+	"github.com/lib/pq"
+)
+
+type memoryStore struct {
+	mutex         sync.Mutex
+	subscriptions []repository.WebhookSubscription
+	deadLetters   chan repository.WebhookDeadLetter
+}
+
+func newMemoryStore(subscriptions ...repository.WebhookSubscription) *memoryStore {
+	return &memoryStore{subscriptions: subscriptions, deadLetters: make(chan repository.WebhookDeadLetter, 10)}
+}
+
+func (s *memoryStore) ListSubscriptions() ([]repository.WebhookSubscription, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.subscriptions, nil
+}
+
+func (s *memoryStore) InsertDeadLetter(deadLetter repository.WebhookDeadLetter) error {
+	s.deadLetters <- deadLetter
+	return nil
+}
+
+type received struct {
+	body      []byte
+	timestamp string
+	signature string
+}
+
+// Starts a receiver that answers with the given statuses in turn, repeating the last one.
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, chan received) {
+	deliveries := make(chan received, 10)
+	var mutex sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		deliveries <- received{body, r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader)}
+
+		mutex.Lock()
+		status := statuses[len(statuses)-1]
+		if calls < len(statuses) {
+			status = statuses[calls]
+		}
+		calls++
+		mutex.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, deliveries
+}
+
+func newTestDispatcher(t *testing.T, store Store) *Dispatcher {
+	dispatcher := NewDispatcher(store, http.DefaultClient, Options{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		QueueSize:      10,
+		Workers:        1,
+	}, *log.New(ioutil.Discard, "", 0))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dispatcher.Stop)
+	return dispatcher
+}
+
+func enterEvent(storeID int64) model.FenceEvent {
+	return model.FenceEvent{DeviceID: "device", EventType: model.EnterEvent, LocationID: 7, StoreID: storeID}
+}
+
+func receive(t *testing.T, deliveries chan received) received {
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+	}
+	return received{}
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	server, deliveries := newReceiver(t, http.StatusOK)
+	store := newMemoryStore(repository.WebhookSubscription{ID: 1, URL: server.URL, Secret: "secret", StoreID: 3})
+	dispatcher := newTestDispatcher(t, store)
+
+	dispatcher.Publish(enterEvent(3))
+	delivery := receive(t, deliveries)
+
+	if !Verify("secret", delivery.timestamp, delivery.body, delivery.signature) {
+		t.Errorf("signature %q does not verify", delivery.signature)
+	}
+	if Verify("other", delivery.timestamp, delivery.body, delivery.signature) {
+		t.Error("signature verifies with the wrong secret")
+	}
+	var payload Payload
+	if err := json.Unmarshal(delivery.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.SubscriptionID != 1 || payload.Event.EventType != model.EnterEvent || payload.Event.LocationID != 7 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestOnlyMatchingSubscriptionsReceive(t *testing.T) {
+	server, deliveries := newReceiver(t, http.StatusOK)
+	store := newMemoryStore(
+		repository.WebhookSubscription{ID: 1, URL: server.URL, Secret: "a", StoreID: 4},
+		repository.WebhookSubscription{ID: 2, URL: server.URL, Secret: "b", EventTypes: pq.StringArray{model.ExitEvent}},
+		repository.WebhookSubscription{ID: 3, URL: server.URL, Secret: "c", StoreID: 3},
+	)
+	dispatcher := newTestDispatcher(t, store)
+
+	dispatcher.Publish(enterEvent(3))
+	var payload Payload
+	if err := json.Unmarshal(receive(t, deliveries).body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.SubscriptionID != 3 {
+		t.Errorf("delivered to subscription %d, want 3", payload.SubscriptionID)
+	}
+	select {
+	case <-deliveries:
+		t.Error("delivered to a subscription that does not match")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetriesUntilSuccess(t *testing.T) {
+	server, deliveries := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	store := newMemoryStore(repository.WebhookSubscription{ID: 1, URL: server.URL, Secret: "secret"})
+	dispatcher := newTestDispatcher(t, store)
+
+	dispatcher.Publish(enterEvent(3))
+	for i := 0; i < 3; i++ {
+		receive(t, deliveries)
+	}
+	select {
+	case deadLetter := <-store.deadLetters:
+		t.Errorf("unexpected dead letter %+v", deadLetter)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestExhaustedRetriesAreDeadLettered(t *testing.T) {
+	server, deliveries := newReceiver(t, http.StatusInternalServerError)
+	store := newMemoryStore(repository.WebhookSubscription{ID: 1, URL: server.URL, Secret: "secret"})
+	dispatcher := newTestDispatcher(t, store)
+
+	dispatcher.Publish(enterEvent(3))
+	for i := 0; i < 3; i++ {
+		receive(t, deliveries)
+	}
+	select {
+	case deadLetter := <-store.deadLetters:
+		if deadLetter.SubscriptionID != 1 || deadLetter.Attempts != 3 || deadLetter.LastError == "" {
+			t.Errorf("unexpected dead letter %+v", deadLetter)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for dead letter")
+	}
+}
+
+func TestClientErrorsAreNotRetried(t *testing.T) {
+	server, deliveries := newReceiver(t, http.StatusBadRequest)
+	store := newMemoryStore(repository.WebhookSubscription{ID: 1, URL: server.URL, Secret: "secret"})
+	dispatcher := newTestDispatcher(t, store)
+
+	dispatcher.Publish(enterEvent(3))
+	receive(t, deliveries)
+	select {
+	case deadLetter := <-store.deadLetters:
+		if deadLetter.Attempts != 1 {
+			t.Errorf("dead lettered after %d attempts, want 1", deadLetter.Attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for dead letter")
+	}
+	select {
+	case <-deliveries:
+		t.Error("client error was retried")
+	default:
+	}
+}
+
+// A store whose InsertDeadLetter waits until release is closed.
+type blockingStore struct {
+	*memoryStore
+	release chan struct{}
+}
+
+func (s blockingStore) InsertDeadLetter(deadLetter repository.WebhookDeadLetter) error {
+	<-s.release
+	return nil
+}
+
+func TestPublishDoesNotWaitForDeadLetters(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	store := blockingStore{newMemoryStore(repository.WebhookSubscription{ID: 1, URL: server.URL, Secret: "secret"}), release}
+	dispatcher := NewDispatcher(store, http.DefaultClient, Options{MaxAttempts: 1, QueueSize: 1, Workers: 1}, *log.New(ioutil.Discard, "", 0))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dispatcher.Stop)
+	t.Cleanup(func() { close(release) })
+
+	// The worker is held by the receiver, the queue and the dead letter buffer fill up, and the store is held too.
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			dispatcher.Publish(enterEvent(3))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked while dead letters could not be written")
+	}
+	if dispatcher.Dropped() == 0 {
+		t.Errorf("no dead letters were dropped")
+	}
+}
+
+func TestRetriesDoNotHoldWorkers(t *testing.T) {
+	failing, _ := newReceiver(t, http.StatusServiceUnavailable)
+	healthy, deliveries := newReceiver(t, http.StatusOK)
+	store := newMemoryStore(
+		repository.WebhookSubscription{ID: 1, URL: failing.URL, Secret: "a"},
+		repository.WebhookSubscription{ID: 2, URL: healthy.URL, Secret: "b"},
+	)
+	dispatcher := NewDispatcher(store, http.DefaultClient, Options{
+		MaxAttempts:    3,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+		QueueSize:      10,
+		Workers:        1,
+	}, *log.New(ioutil.Discard, "", 0))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The only worker sends to the failing subscription first, then must be free for the healthy one.
+	dispatcher.Publish(enterEvent(3))
+	var payload Payload
+	if err := json.Unmarshal(receive(t, deliveries).body, &payload); err != nil || payload.SubscriptionID != 2 {
+		t.Fatalf("delivered %+v, %v, want subscription 2", payload, err)
+	}
+
+	// Stopping records the retry still waiting as a dead letter.
+	dispatcher.Stop()
+	select {
+	case deadLetter := <-store.deadLetters:
+		if deadLetter.SubscriptionID != 1 || deadLetter.Attempts != 1 {
+			t.Errorf("unexpected dead letter %+v", deadLetter)
+		}
+	default:
+		t.Fatal("pending retry was not dead lettered on Stop")
+	}
+}
+
+func TestStopDeadLettersQueuedDeliveries(t *testing.T) {
+	requested, release := make(chan struct{}, 3), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	store := newMemoryStore(repository.WebhookSubscription{ID: 1, URL: server.URL, Secret: "secret"})
+	dispatcher := NewDispatcher(store, http.DefaultClient, Options{MaxAttempts: 1, QueueSize: 10, Workers: 1}, *log.New(ioutil.Discard, "", 0))
+	if err := dispatcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker holds the first delivery while the other two wait in the queue.
+	dispatcher.Publish(enterEvent(3), enterEvent(3), enterEvent(3))
+	<-requested
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.Stop()
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+
+	if len(store.deadLetters) != 2 {
+		t.Fatalf("Stop recorded %d dead letters, want the 2 queued deliveries", len(store.deadLetters))
+	}
+	for i := 0; i < 2; i++ {
+		deadLetter := <-store.deadLetters
+		if deadLetter.Attempts != 0 || deadLetter.LastError != "dispatcher stopped" {
+			t.Errorf("unexpected dead letter %+v", deadLetter)
+		}
+	}
+}
@@ -197,3 +197,66 @@ map.on(L.Draw.Event.CREATED, function (event) {
 
 });
 
+var liveSource
+var liveLayer = L.layerGroup().addTo(map);
+var deviceMarkers = {}
+var liveColors = {"ENTER": "green", "EXIT": "red", "DWELL": "orange"}
+
+// Streams fence events from /track/live, filtered by the store, metro and zone inputs,
+// and moves one marker per device to where its latest event happened.
+function toggleLive() {
+    if (liveSource) {
+        liveSource.close()
+        liveSource = undefined
+        document.getElementById("livebtn").value = "Watch Live"
+        document.getElementById("live_status").innerHTML = ""
+        return
+    }
+    var params = []
+    var filters = {"store_id": "store_id_input", "metro_id": "metro_id_input", "zone_id": "zone_id_input"}
+    for (var name in filters) {
+        var value = document.getElementById(filters[name]).value
+        if (value != "") {
+            params.push(name + "=" + encodeURIComponent(value))
+        }
+    }
+    liveSource = new EventSource("/track/live?" + params.join("&"))
+    liveSource.onmessage = function (e) {
+        showDeviceEvent(JSON.parse(e.data))
+    }
+    liveSource.addEventListener("dropped", function (e) {
+        document.getElementById("live_status").textContent = e.data + " events dropped"
+    })
+    liveSource.onopen = function () {
+        document.getElementById("live_status").innerHTML = "Live"
+    }
+    liveSource.onerror = function () {
+        document.getElementById("live_status").innerHTML = "Reconnecting..."
+    }
+    document.getElementById("livebtn").value = "Stop Live"
+}
+
+function showDeviceEvent(event) {
+    var latlng = new L.LatLng(event.latitude, event.longitude)
+    var color = liveColors[event.event_type] || "blue"
+    var marker = deviceMarkers[event.device_id]
+    if (marker == undefined) {
+        marker = L.circleMarker(latlng, {radius: 7, weight: 2}).addTo(liveLayer)
+        deviceMarkers[event.device_id] = marker
+    }
+    marker.setLatLng(latlng)
+    marker.setStyle({color: color, fillColor: color})
+    marker.bindTooltip(deviceTooltip(event))
+}
+
+// Device IDs are whatever clients send to /track/ping, so event fields are only ever set as text.
+function deviceTooltip(event) {
+    var tooltip = document.createElement("div")
+    var lines = [event.device_id, event.event_type + " " + event.location_id, event.occurred_at]
+    for (var i = 0; i < lines.length; i++) {
+        var line = document.createElement(i == 0 ? "b" : "div")
+        line.textContent = lines[i]
+        tooltip.appendChild(line)
+    }
+    return tooltip
+}